@@ -0,0 +1,187 @@
+package genome
+
+import (
+	"database/sql"
+	"slices"
+)
+
+//
+// Alias and previous symbols of genes from HGNC or MGI so that genes
+// can be found by names they no longer have, e.g. MLL for KMT2A.
+//
+
+const (
+	GeneAliasesSql = `SELECT g.id, ga.alias
+		FROM gene_aliases AS ga
+		JOIN genes AS g ON ga.gene_id = g.id
+		WHERE LOWER(ga.alias) = LOWER(:q)
+		ORDER BY g.symbol, g.gene_id, ga.alias`
+
+	AllGeneAliasesSql = `SELECT ga.gene_id, g.gene_id, g.symbol, ga.alias
+		FROM gene_aliases AS ga
+		JOIN genes AS g ON ga.gene_id = g.id`
+
+	// alias matches rank just below symbol matches of the same kind
+	AliasMatchPenalty float64 = 0.01
+)
+
+// databases created by older importers do not have aliases
+func (gdb *GtfDB) hasGeneAliases() bool {
+	gdb.aliasesOnce.Do(func() {
+		gdb.hasAliases = gdb.hasTable("gene_aliases")
+	})
+
+	return gdb.hasAliases
+}
+
+// the genes with an alias equal to search, ignoring case
+func (gdb *GtfDB) aliasMatches(search string) ([]geneName, error) {
+	rows, err := gdb.db.Query(GeneAliasesSql, sql.Named("q", search))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ret := make([]geneName, 0, 5)
+
+	for rows.Next() {
+		var name geneName
+
+		err := rows.Scan(&name.id, &name.alias)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, name)
+	}
+
+	return ret, rows.Err()
+}
+
+// addAliasMatches adds the genes with an alias or xref equal to search
+// after the genes found by name, flagging the alias or xref that matched.
+// Only genes with row ids in genes are added unless genes is nil.
+func (gdb *GtfDB) addAliasMatches(features []*GenomicFeature,
+	search string,
+	level string,
+	policy *TranscriptPolicy,
+	n int16,
+	genes []int) ([]*GenomicFeature, error) {
+	aliases := make([]geneName, 0, 5)
+
+	if gdb.hasGeneAliases() {
+		found, err := gdb.aliasMatches(search)
+
+		if err != nil {
+			return nil, err
+		}
+
+		aliases = append(aliases, found...)
+	}
+
+	if gdb.hasGeneXrefs() {
+		found, err := gdb.xrefMatches(search)
+
+		if err != nil {
+			return nil, err
+		}
+
+		aliases = append(aliases, found...)
+	}
+
+	if genes != nil {
+		aliases = slices.DeleteFunc(aliases, func(alias geneName) bool {
+			return !slices.Contains(genes, alias.id)
+		})
+	}
+
+	aliases = newAliasMatches(features, aliases, level, n)
+
+	if len(aliases) == 0 {
+		return features, nil
+	}
+
+	ids := make([]int, 0, len(aliases))
+
+	for _, alias := range aliases {
+		ids = append(ids, alias.id)
+	}
+
+	found, err := gdb.searchGeneIds(ids, level, policy, n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return appendAliasMatches(features, found, aliases), nil
+}
+
+// whether the database has a table, which depends on the
+// version of the importer that made it
+func (gdb *GtfDB) hasTable(name string) bool {
+	var n int
+
+	err := gdb.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = :name`,
+		sql.Named("name", name)).Scan(&n)
+
+	return err == nil && n > 0
+}
+
+// an sql condition matching genes by row id
+func geneIdsMatchSql(ids []int) (string, []any) {
+	return inSql(GeneIdsMatchSql, "g", ids)
+}
+
+// the alias or xref matches of genes not already found by name, once per
+// gene. Genes are limited to n in total as for searches by name
+// unless n is NoLimit.
+func newAliasMatches(features []*GenomicFeature, aliases []geneName, level string, n int16) []geneName {
+	seen := make(map[int]bool, len(features)+len(aliases))
+
+	for _, feature := range features {
+		seen[feature.Id] = true
+	}
+
+	ret := make([]geneName, 0, len(aliases))
+
+	for _, alias := range aliases {
+		if seen[alias.id] {
+			continue
+		}
+
+		seen[alias.id] = true
+
+		ret = append(ret, alias)
+	}
+
+	if n != NoLimit && level != TranscriptLevel && level != ExonLevel {
+		ret = ret[:max(0, min(len(ret), int(n)-len(features)))]
+	}
+
+	return ret
+}
+
+// appendAliasMatches adds the genes found by alias or xref in the
+// order of their matches
+func appendAliasMatches(features []*GenomicFeature, found []*GenomicFeature, aliases []geneName) []*GenomicFeature {
+	for _, alias := range aliases {
+		i := slices.IndexFunc(found, func(feature *GenomicFeature) bool {
+			return feature.Id == alias.id
+		})
+
+		if i == -1 {
+			// e.g. no transcripts pass the policy
+			continue
+		}
+
+		found[i].MatchedAlias = alias.alias
+		found[i].MatchedXref = alias.xref
+
+		features = append(features, found[i])
+	}
+
+	return features
+}
@@ -39,6 +39,8 @@ type (
 		// Locations    string            `json:"geneLocs"`
 		WithinGenes  []*GenomicFeature `json:"withinGenes"`
 		ClosestGenes []*GenomicFeature `json:"closestGenes"`
+		// set when the location was lifted from another assembly
+		Liftover *LiftResult `json:"liftover,omitempty"`
 	}
 
 	// type ByAbsD []GeneProm
@@ -46,12 +48,14 @@ type (
 	// func (a ByAbsD) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 	// func (a ByAbsD) Less(i, j int) bool { return a[i].AbsD < a[j].AbsD }
 
-	// Built on top of GtfDB to provide annotation functionality
+	// Built on top of a GeneDB to provide annotation functionality
 	GtfAnnotateDb struct {
-		GtfDB            *GtfDB
+		GeneDB           GeneDB
 		TSSRegion        *dna.PromoterRegion
 		ClosestN         int8
 		UseOfficialGenes bool
+		// restricts genes to one transcript each, nil for all
+		TranscriptPolicy *TranscriptPolicy
 	}
 )
 
@@ -68,12 +72,13 @@ const (
 	FeatureSeparator string = "|"
 )
 
-func NewGtfAnnotateDb(genesdb *GtfDB, tssRegion *dna.PromoterRegion, closestN int8, useOfficialGenes bool) *GtfAnnotateDb {
+func NewGtfAnnotateDb(genesdb GeneDB, tssRegion *dna.PromoterRegion, closestN int8, useOfficialGenes bool, policy *TranscriptPolicy) *GtfAnnotateDb {
 	return &GtfAnnotateDb{
-		GtfDB:            genesdb,
+		GeneDB:           genesdb,
 		TSSRegion:        tssRegion,
 		ClosestN:         closestN,
 		UseOfficialGenes: useOfficialGenes,
+		TranscriptPolicy: policy,
 	}
 }
 
@@ -91,10 +96,11 @@ func (annotateDb *GtfAnnotateDb) Annotate(location *dna.Location, levels string)
 
 	level := GeneLevel
 
-	genesWithin, err := annotateDb.GtfDB.IntragenicFeatures(
+	genesWithin, err := annotateDb.GeneDB.IntragenicFeatures(
 		location,
 		level,
 		annotateDb.TSSRegion,
+		annotateDb.TranscriptPolicy,
 		annotateDb.UseOfficialGenes,
 	)
 
@@ -103,9 +109,10 @@ func (annotateDb *GtfAnnotateDb) Annotate(location *dna.Location, levels string)
 		return nil, err
 	}
 
-	closestGenes, err := annotateDb.GtfDB.ClosestGenes(location,
+	closestGenes, err := annotateDb.GeneDB.ClosestGenes(location,
 		annotateDb.TSSRegion,
 		annotateDb.ClosestN,
+		annotateDb.TranscriptPolicy,
 		annotateDb.UseOfficialGenes)
 
 	if err != nil {
@@ -154,7 +161,7 @@ func (annotateDb *GtfAnnotateDb) ClassifyFeature(location *dna.Location, feature
 	isPromoter := (feature.Location.Strand() == "+" && mid >= start && mid <= feature.Location.Start()+annotateDb.TSSRegion.Downstream()) ||
 		(feature.Location.Strand() == "-" && mid >= feature.Location.End()-annotateDb.TSSRegion.Downstream() && mid <= end)
 
-	exons, err := annotateDb.GtfDB.InExon(location, feature.Transcript, annotateDb.TSSRegion)
+	exons, err := annotateDb.GeneDB.InExon(location, feature.Transcript, annotateDb.TSSRegion)
 
 	if err != nil {
 		return "", err
@@ -0,0 +1,428 @@
+package genome
+
+import (
+	"slices"
+	"strings"
+)
+
+//
+// Suggestions of genes as a user types. The symbols, aliases and ids of
+// all genes are held in a prefix trie so that each keystroke is answered
+// from memory rather than by searching the database.
+//
+
+const (
+	AutocompleteGenesSql = `SELECT g.id, g.gene_id, g.symbol, COALESCE(g.official_gene_id, ''), b.name
+		FROM genes AS g
+		JOIN biotypes AS b ON g.biotype_id = b.id`
+
+	MaxSuggestions int16 = 20
+)
+
+type (
+	Suggestion struct {
+		// the symbol, alias or id that starts with the prefix
+		Name string `json:"name"`
+		// what name is, e.g. symbol or alias
+		MatchedBy string `json:"matchedBy"`
+		GeneId    string `json:"geneId"`
+		Symbol    string `json:"symbol"`
+		Biotype   string `json:"biotype"`
+	}
+
+	trieGene struct {
+		geneId  string
+		symbol  string
+		biotype string
+	}
+
+	// a name that can be suggested and the gene it is of
+	trieName struct {
+		name      string
+		lower     string
+		matchedBy string
+		gene      int32
+	}
+
+	// nodes are held in one slice and refer to each other by index
+	// which is far smaller than nodes with maps of children for the
+	// hundreds of thousands of nodes of a full annotation
+	trieNode struct {
+		// the byte of the name leading to the node
+		label byte
+		// the first child and next sibling, 0 if none since the root
+		// is neither
+		child   int32
+		sibling int32
+		// the best rank of the names ending at or below the node
+		best int32
+		// the best name ending at the node, -1 if none
+		name int32
+	}
+
+	prefixTrie struct {
+		nodes []trieNode
+		genes []trieGene
+		// names in rank order so that the rank of a name is its index
+		names []trieName
+		// the next best name ending at the same node, -1 if none
+		next []int32
+	}
+
+	// a node, or a name if node is -1, waiting to be suggested
+	trieItem struct {
+		rank int32
+		node int32
+	}
+)
+
+var (
+	// kinds of name in the order they are suggested when the same
+	// length
+	suggestionOrder = []string{SymbolMatch, AliasMatch, OfficialIdMatch, GeneIdMatch}
+)
+
+// the symbol and ids of a gene that can be suggested
+func appendGeneNames(names []trieName, gene int32, geneId string, symbol string, officialId string) []trieName {
+	names = append(names,
+		trieName{name: symbol, matchedBy: SymbolMatch, gene: gene},
+		trieName{name: geneId, matchedBy: GeneIdMatch, gene: gene})
+
+	if officialId != "" {
+		names = append(names, trieName{name: officialId, matchedBy: OfficialIdMatch, gene: gene})
+	}
+
+	return names
+}
+
+// newPrefixTrie indexes names of genes by their lower case prefixes.
+// Names are ranked shortest first so that whole names come before the
+// longer names they are a prefix of, then symbols before aliases and
+// ids, then alphabetically.
+func newPrefixTrie(genes []trieGene, names []trieName) *prefixTrie {
+	names = slices.DeleteFunc(names, func(name trieName) bool {
+		return name.name == ""
+	})
+
+	for i := range names {
+		names[i].lower = strings.ToLower(names[i].name)
+	}
+
+	slices.SortFunc(names, func(a, b trieName) int {
+		if len(a.lower) != len(b.lower) {
+			return len(a.lower) - len(b.lower)
+		}
+
+		if c := slices.Index(suggestionOrder, a.matchedBy) - slices.Index(suggestionOrder, b.matchedBy); c != 0 {
+			return c
+		}
+
+		if c := strings.Compare(a.lower, b.lower); c != 0 {
+			return c
+		}
+
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		}
+
+		if c := strings.Compare(genes[a.gene].symbol, genes[b.gene].symbol); c != 0 {
+			return c
+		}
+
+		return strings.Compare(genes[a.gene].geneId, genes[b.gene].geneId)
+	})
+
+	trie := &prefixTrie{nodes: make([]trieNode, 1, len(names)*4),
+		genes: genes,
+		names: names,
+		next:  make([]int32, len(names))}
+
+	trie.nodes[0] = trieNode{name: -1}
+
+	// added worst first so that each node ends up with the best rank
+	// below it and names ending at a node are listed best first
+	for i := len(names) - 1; i >= 0; i-- {
+		rank := int32(i)
+		node := int32(0)
+
+		trie.nodes[0].best = rank
+
+		for j := 0; j < len(names[i].lower); j++ {
+			node = trie.addChild(node, names[i].lower[j])
+			trie.nodes[node].best = rank
+		}
+
+		trie.next[i] = trie.nodes[node].name
+		trie.nodes[node].name = rank
+	}
+
+	trie.nodes = slices.Clip(trie.nodes)
+
+	return trie
+}
+
+// the child of node labelled with b, or -1 if none
+func (trie *prefixTrie) findChild(node int32, b byte) int32 {
+	for child := trie.nodes[node].child; child != 0; child = trie.nodes[child].sibling {
+		if trie.nodes[child].label == b {
+			return child
+		}
+	}
+
+	return -1
+}
+
+// the child of node labelled with b, added if missing
+func (trie *prefixTrie) addChild(node int32, b byte) int32 {
+	if child := trie.findChild(node, b); child != -1 {
+		return child
+	}
+
+	child := int32(len(trie.nodes))
+
+	trie.nodes = append(trie.nodes, trieNode{label: b, sibling: trie.nodes[node].child, name: -1})
+	trie.nodes[node].child = child
+
+	return child
+}
+
+// the n best names starting with prefix, one per gene. Starting from the
+// node of the prefix, names and nodes are visited best rank first, so a
+// node is only expanded when it may still have a better name than those
+// already found, which keeps suggestions fast however many genes share
+// a short prefix.
+func (trie *prefixTrie) suggest(prefix string, n int) []*Suggestion {
+	ret := make([]*Suggestion, 0, n)
+
+	lower := strings.ToLower(prefix)
+	node := int32(0)
+
+	for i := 0; i < len(lower); i++ {
+		node = trie.findChild(node, lower[i])
+
+		if node == -1 {
+			return ret
+		}
+	}
+
+	genes := make([]int32, 0, n)
+
+	queue := []trieItem{{rank: trie.nodes[node].best, node: node}}
+
+	for len(queue) > 0 && len(ret) < n {
+		item := popTrieItem(&queue)
+
+		if item.node == -1 {
+			name := &trie.names[item.rank]
+
+			if next := trie.next[item.rank]; next != -1 {
+				pushTrieItem(&queue, trieItem{rank: next, node: -1})
+			}
+
+			if slices.Contains(genes, name.gene) {
+				continue
+			}
+
+			genes = append(genes, name.gene)
+
+			gene := &trie.genes[name.gene]
+
+			ret = append(ret, &Suggestion{Name: name.name,
+				MatchedBy: name.matchedBy,
+				GeneId:    gene.geneId,
+				Symbol:    gene.symbol,
+				Biotype:   gene.biotype})
+
+			continue
+		}
+
+		if name := trie.nodes[item.node].name; name != -1 {
+			pushTrieItem(&queue, trieItem{rank: name, node: -1})
+		}
+
+		for child := trie.nodes[item.node].child; child != 0; child = trie.nodes[child].sibling {
+			pushTrieItem(&queue, trieItem{rank: trie.nodes[child].best, node: child})
+		}
+	}
+
+	return ret
+}
+
+// queue is a min heap on rank
+func pushTrieItem(queue *[]trieItem, item trieItem) {
+	*queue = append(*queue, item)
+
+	i := len(*queue) - 1
+
+	for i > 0 {
+		parent := (i - 1) / 2
+
+		if (*queue)[parent].rank <= (*queue)[i].rank {
+			break
+		}
+
+		(*queue)[parent], (*queue)[i] = (*queue)[i], (*queue)[parent]
+		i = parent
+	}
+}
+
+func popTrieItem(queue *[]trieItem) trieItem {
+	q := *queue
+	ret := q[0]
+
+	last := len(q) - 1
+	q[0] = q[last]
+	q = q[:last]
+
+	i := 0
+
+	for {
+		smallest := i
+
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(q) && q[child].rank < q[smallest].rank {
+				smallest = child
+			}
+		}
+
+		if smallest == i {
+			break
+		}
+
+		q[i], q[smallest] = q[smallest], q[i]
+		i = smallest
+	}
+
+	*queue = q
+
+	return ret
+}
+
+// Autocomplete suggests the n best genes whose symbol, an alias or an
+// id starts with prefix, ignoring case. The names are loaded on first use.
+func (gdb *GtfDB) Autocomplete(prefix string, n int16) ([]*Suggestion, error) {
+	trie, err := gdb.prefixTrie()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return autocomplete(trie, prefix, n), nil
+}
+
+// Autocomplete suggests genes as GtfDB.Autocomplete does
+func (mdb *MemGeneDB) Autocomplete(prefix string, n int16) ([]*Suggestion, error) {
+	return autocomplete(mdb.trie, prefix, n), nil
+}
+
+func autocomplete(trie *prefixTrie, prefix string, n int16) []*Suggestion {
+	// ids match with any version
+	prefix, _ = splitIdVersion(strings.TrimSpace(prefix))
+
+	if prefix == "" {
+		return []*Suggestion{}
+	}
+
+	return trie.suggest(prefix, int(max(1, min(n, MaxSuggestions))))
+}
+
+// the symbols, aliases and ids of all genes by prefix, built once
+func (gdb *GtfDB) prefixTrie() (*prefixTrie, error) {
+	gdb.trieOnce.Do(func() {
+		gdb.trie, gdb.trieErr = gdb.newPrefixTrie()
+	})
+
+	return gdb.trie, gdb.trieErr
+}
+
+func (gdb *GtfDB) newPrefixTrie() (*prefixTrie, error) {
+	rows, err := gdb.db.Query(AutocompleteGenesSql)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	genes := make([]trieGene, 0, 60000)
+	names := make([]trieName, 0, 200000)
+
+	// row ids of the genes to their index for aliases
+	geneIndex := make(map[int]int32, 60000)
+
+	for rows.Next() {
+		var id int
+		var gene trieGene
+		var officialId string
+
+		err := rows.Scan(&id, &gene.geneId, &gene.symbol, &officialId, &gene.biotype)
+
+		if err != nil {
+			return nil, err
+		}
+
+		geneIndex[id] = int32(len(genes))
+		names = appendGeneNames(names, int32(len(genes)), gene.geneId, gene.symbol, officialId)
+		genes = append(genes, gene)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if gdb.hasGeneAliases() {
+		names, err = gdb.aliasTrieNames(names, geneIndex)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newPrefixTrie(genes, names), nil
+}
+
+func (gdb *GtfDB) aliasTrieNames(names []trieName, geneIndex map[int]int32) ([]trieName, error) {
+	rows, err := gdb.db.Query(AllGeneAliasesSql)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var name geneName
+
+		err := rows.Scan(&name.id, &name.geneId, &name.symbol, &name.alias)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if gene, ok := geneIndex[name.id]; ok {
+			names = append(names, trieName{name: name.alias, matchedBy: AliasMatch, gene: gene})
+		}
+	}
+
+	return names, rows.Err()
+}
+
+func newMemPrefixTrie(genes []*MemGene) *prefixTrie {
+	trieGenes := make([]trieGene, 0, len(genes))
+	names := make([]trieName, 0, len(genes)*3)
+
+	for _, gene := range genes {
+		index := int32(len(trieGenes))
+
+		trieGenes = append(trieGenes, trieGene{geneId: gene.Id, symbol: gene.Symbol, biotype: gene.Biotype})
+		names = appendGeneNames(names, index, gene.Id, gene.Symbol, gene.OfficialId)
+
+		for _, alias := range gene.Aliases {
+			names = append(names, trieName{name: alias, matchedBy: AliasMatch, gene: index})
+		}
+	}
+
+	return newPrefixTrie(trieGenes, names)
+}
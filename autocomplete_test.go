@@ -0,0 +1,92 @@
+package genome_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+func suggestionNames(suggestions []*genome.Suggestion) []string {
+	ret := make([]string, 0, len(suggestions))
+
+	for _, suggestion := range suggestions {
+		ret = append(ret, fmt.Sprintf("%s:%s:%s:%s:%s", suggestion.Name, suggestion.MatchedBy, suggestion.Symbol, suggestion.GeneId, suggestion.Biotype))
+	}
+
+	return ret
+}
+
+func TestAutocomplete(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	tests := []struct {
+		prefix string
+		n      int16
+		want   []string
+	}{
+		{"gene", 10, []string{"GENEA:symbol:GENEA:ENSG00000000001:protein_coding",
+			"GENEB:symbol:GENEB:ENSG00000000002:protein_coding",
+			"GENED:symbol:GENED:ENSG00000000004:protein_coding",
+			"GENEE:symbol:GENEE:ENSG00000000005:protein_coding"}},
+		{"G", 1, []string{"GENEA:symbol:GENEA:ENSG00000000001:protein_coding"}},
+		// genes sharing an alias are each suggested
+		{"del", 10, []string{"DELTA:alias:GENED:ENSG00000000004:protein_coding",
+			"DELTA:alias:GENEE:ENSG00000000005:protein_coding"}},
+		{"hgnc:", 2, []string{"HGNC:1:officialId:GENEA:ENSG00000000001:protein_coding",
+			"HGNC:2:officialId:GENEB:ENSG00000000002:protein_coding"}},
+		// a gene is suggested once, by its best name
+		{"ensg00000000003", 10, []string{"ENSG00000000003:symbol:ENSG00000000003:ENSG00000000003:lncRNA"}},
+		{"ENSG00000000002.7", 10, []string{"ENSG00000000002:geneId:GENEB:ENSG00000000002:protein_coding"}},
+		{"geneq", 10, []string{}},
+		{" ", 10, []string{}},
+	}
+
+	for _, test := range tests {
+		suggestions, err := gdb.Autocomplete(test.prefix, test.n)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := suggestionNames(suggestions); !slices.Equal(got, test.want) {
+			t.Errorf("%q = %q, want %q", test.prefix, got, test.want)
+		}
+	}
+
+	// older databases do not have aliases
+	suggestions, err := openGtf(t, genometest.OldGtfId).Autocomplete("del", 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(suggestions) != 0 {
+		t.Errorf("old del = %q", suggestionNames(suggestions))
+	}
+}
+
+func TestMemGeneDBAutocompleteMatchesGtfDB(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+	mdb := memGeneDB(t)
+
+	for _, prefix := range []string{"g", "GENE", "d", "alp", "ensg", "ENST", "hgnc:5", "ENSG00000000001.4"} {
+		want, err := gdb.Autocomplete(prefix, 20)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := mdb.Autocomplete(prefix, 20)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if w, g := suggestionNames(want), suggestionNames(got); !slices.Equal(w, g) {
+			t.Errorf("%q: want %q\ngot %q", prefix, w, g)
+		}
+	}
+}
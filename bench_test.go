@@ -0,0 +1,328 @@
+package genome_test
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+//
+// Benchmarks of the GtfDB queries on a random genome of a realistic
+// size, e.g.
+//
+//	go test -run '^$' -bench . -bench-genes 60000
+//
+
+var benchGenes = flag.Int("bench-genes", 20000, "number of genes in the benchmark genome")
+
+const benchLocations int = 1000
+
+var bench struct {
+	once  sync.Once
+	dir   string
+	genes []*genometest.Gene
+	err   error
+}
+
+// the benchmark genome is built once, the first time it is needed
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	code := m.Run()
+
+	if bench.dir != "" {
+		os.RemoveAll(bench.dir)
+	}
+
+	os.Exit(code)
+}
+
+func benchGtf(b *testing.B) (*genome.GtfDB, []*genometest.Gene) {
+	b.Helper()
+
+	bench.once.Do(func() {
+		bench.genes = genometest.RandomGenome(rand.New(rand.NewPCG(1, 2)), *benchGenes)
+
+		bench.dir, bench.err = os.MkdirTemp("", "genomebench")
+
+		if bench.err != nil {
+			return
+		}
+
+		bench.err = genometest.WriteGtfDB(filepath.Join(bench.dir, "bench.db"), &genometest.Annotation{PublicId: "bench",
+			Name:  "bench",
+			File:  "bench.db",
+			Genes: bench.genes})
+	})
+
+	if bench.err != nil {
+		b.Fatal(bench.err)
+	}
+
+	gdb := genome.NewGtfDB(bench.dir, &genome.Annotation{Url: "bench.db"})
+
+	b.Cleanup(func() { gdb.Close() })
+
+	return gdb, bench.genes
+}
+
+// random locations of the given width over the genes of the genome
+func benchLocationsOf(b *testing.B, genes []*genometest.Gene, width int) []*dna.Location {
+	b.Helper()
+
+	rng := rand.New(rand.NewPCG(3, 4))
+
+	ret := make([]*dna.Location, 0, benchLocations)
+
+	for range benchLocations {
+		gene := genes[rng.IntN(len(genes))]
+
+		start := max(1, gene.Span().Start-width+rng.IntN(gene.Span().End-gene.Span().Start+width))
+
+		location, err := dna.NewLocation(gene.Chr, start, start+width)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		ret = append(ret, location)
+	}
+
+	return ret
+}
+
+func benchPolicy(b *testing.B) *genome.TranscriptPolicy {
+	b.Helper()
+
+	policy, err := genome.ParseTranscriptPolicy("mane,appris,tsl,canonical,longest")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return policy
+}
+
+// run query over each location in turn
+func benchQuery(b *testing.B, locations []*dna.Location, query func(location *dna.Location) error) {
+	b.Helper()
+
+	i := 0
+
+	for b.Loop() {
+		err := query(locations[i%len(locations)])
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		i++
+	}
+}
+
+func BenchmarkOverlappingGenes(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	locations := benchLocationsOf(b, genes, 1000)
+
+	prom := dna.DefaultPromoterRegion()
+
+	tests := []struct {
+		name       string
+		levels     string
+		policy     *genome.TranscriptPolicy
+		annotation bool
+	}{
+		{"genes", genome.GeneLevel, nil, false},
+		{"all levels", genome.AllLevels, nil, false},
+		{"policy", genome.AllLevels, benchPolicy(b), false},
+		{"annotation", genome.AllLevels, nil, true},
+		{"collapsed", genome.CollapsedLevel, nil, true},
+	}
+
+	for _, test := range tests {
+		b.Run(test.name, func(b *testing.B) {
+			benchQuery(b, locations, func(location *dna.Location) error {
+				_, err := gdb.OverlappingGenes(location, test.levels, prom, test.policy, test.annotation)
+				return err
+			})
+		})
+	}
+}
+
+func BenchmarkWithinGenes(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	prom := dna.DefaultPromoterRegion()
+
+	benchQuery(b, benchLocationsOf(b, genes, 1), func(location *dna.Location) error {
+		_, err := gdb.WithinGenes(location, genome.AllLevels, prom)
+		return err
+	})
+}
+
+func BenchmarkIntragenicFeatures(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	prom := dna.DefaultPromoterRegion()
+
+	benchQuery(b, benchLocationsOf(b, genes, 100), func(location *dna.Location) error {
+		_, err := gdb.IntragenicFeatures(location, "gene,transcript", prom, nil, false)
+		return err
+	})
+}
+
+func BenchmarkInExon(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	prom := dna.DefaultPromoterRegion()
+
+	locations := benchLocationsOf(b, genes, 100)
+
+	i := 0
+
+	for b.Loop() {
+		gene := genes[i%len(genes)]
+
+		_, err := gdb.InExon(locations[i%len(locations)], gene.Transcripts[0].Id, prom)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		i++
+	}
+}
+
+func BenchmarkClosestGenes(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	prom := dna.DefaultPromoterRegion()
+
+	locations := benchLocationsOf(b, genes, 1)
+
+	for _, policy := range []*genome.TranscriptPolicy{nil, benchPolicy(b)} {
+		b.Run(fmt.Sprintf("policy %v", policy != nil), func(b *testing.B) {
+			benchQuery(b, locations, func(location *dna.Location) error {
+				_, err := gdb.ClosestGenes(location, prom, 5, policy, false)
+				return err
+			})
+		})
+	}
+}
+
+func BenchmarkSearchByName(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	for _, level := range []string{genome.GeneLevel, genome.TranscriptLevel, genome.ExonLevel} {
+		b.Run(level, func(b *testing.B) {
+			i := 0
+
+			for b.Loop() {
+				_, err := gdb.SearchByName(genes[i%len(genes)].Symbol, level, nil, 10)
+
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				i++
+			}
+		})
+	}
+}
+
+// typos of the symbols
+func BenchmarkFuzzySearchByName(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	i := 0
+
+	for b.Loop() {
+		symbol := genes[i%len(genes)].Symbol
+
+		_, err := gdb.FuzzySearchByName(symbol[:len(symbol)-1]+"X", genome.GeneLevel, nil, 10)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		i++
+	}
+}
+
+func BenchmarkTssFeatures(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	prom := dna.DefaultPromoterRegion()
+
+	locations := benchLocationsOf(b, genes, 100000)
+
+	for _, level := range []string{genome.GeneLevel, genome.TranscriptLevel} {
+		b.Run(level, func(b *testing.B) {
+			benchQuery(b, locations, func(location *dna.Location) error {
+				return gdb.TssFeatures(location, level, prom, nil, func(feature *genome.GenomicFeature) error {
+					return nil
+				})
+			})
+		})
+	}
+}
+
+func BenchmarkCollapsedGeneModel(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	i := 0
+
+	for b.Loop() {
+		_, err := gdb.CollapsedGeneModel(genes[i%len(genes)].Id)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		i++
+	}
+}
+
+func BenchmarkTranscriptModel(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	i := 0
+
+	for b.Loop() {
+		_, err := gdb.TranscriptModel(genes[i%len(genes)].Transcripts[0].Id)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		i++
+	}
+}
+
+// prefixes of the symbols as they are typed
+func BenchmarkAutocomplete(b *testing.B) {
+	gdb, genes := benchGtf(b)
+
+	i := 0
+
+	for b.Loop() {
+		symbol := genes[i%len(genes)].Symbol
+
+		_, err := gdb.Autocomplete(symbol[:1+i%len(symbol)], 10)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		i++
+	}
+}
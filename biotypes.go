@@ -0,0 +1,199 @@
+package genome
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+)
+
+//
+// The biotypes of genes and transcripts, e.g. protein_coding, and groups
+// of them that filters accept in place of listing every biotype
+//
+
+type (
+	BiotypeCount struct {
+		Name string `json:"name"`
+		// the group the biotype is in, empty if none
+		Group       string `json:"group,omitempty"`
+		Genes       int    `json:"genes"`
+		Transcripts int    `json:"transcripts"`
+	}
+)
+
+const (
+	CodingBiotypes     string = "coding"
+	LncRnaBiotypes     string = "lncrna"
+	SmallRnaBiotypes   string = "small_rna"
+	PseudogeneBiotypes string = "pseudogene"
+
+	BiotypesSql = `SELECT
+		b.name,
+		(SELECT COUNT(*) FROM genes AS g WHERE g.biotype_id = b.id),
+		(SELECT COUNT(*) FROM transcripts AS t WHERE t.biotype_id = b.id)
+		FROM biotypes AS b
+		ORDER BY b.name`
+)
+
+var (
+	// the lower case GENCODE and Ensembl biotypes in each group. Groups
+	// that are also biotypes, such as lncrna, contain themselves.
+	BiotypeGroups = map[string][]string{
+		CodingBiotypes: {"protein_coding",
+			"protein_coding_lof",
+			"ig_c_gene",
+			"ig_d_gene",
+			"ig_j_gene",
+			"ig_v_gene",
+			"tr_c_gene",
+			"tr_d_gene",
+			"tr_j_gene",
+			"tr_v_gene"},
+		LncRnaBiotypes: {"lncrna",
+			"lincrna",
+			"antisense",
+			"sense_intronic",
+			"sense_overlapping",
+			"3prime_overlapping_ncrna",
+			"bidirectional_promoter_lncrna",
+			"macro_lncrna",
+			"processed_transcript"},
+		SmallRnaBiotypes: {"mirna",
+			"misc_rna",
+			"pirna",
+			"rrna",
+			"ribozyme",
+			"scarna",
+			"scrna",
+			"snorna",
+			"snrna",
+			"srna",
+			"vault_rna",
+			"vaultrna",
+			"y_rna",
+			"mt_rrna",
+			"mt_trna"},
+		PseudogeneBiotypes: {"pseudogene",
+			"processed_pseudogene",
+			"unprocessed_pseudogene",
+			"transcribed_processed_pseudogene",
+			"transcribed_unprocessed_pseudogene",
+			"transcribed_unitary_pseudogene",
+			"translated_processed_pseudogene",
+			"translated_unprocessed_pseudogene",
+			"unitary_pseudogene",
+			"polymorphic_pseudogene",
+			"ig_pseudogene",
+			"ig_c_pseudogene",
+			"ig_j_pseudogene",
+			"ig_v_pseudogene",
+			"tr_j_pseudogene",
+			"tr_v_pseudogene",
+			"rrna_pseudogene"},
+	}
+)
+
+// the biotypes of a group, or just name if it is not a group
+func expandBiotypeGroup(name string) []string {
+	if group, ok := BiotypeGroups[name]; ok {
+		return group
+	}
+
+	return []string{name}
+}
+
+// the group a biotype is in, empty if none
+func biotypeGroup(biotype string) string {
+	biotype = strings.ToLower(biotype)
+
+	for _, group := range slices.Sorted(maps.Keys(BiotypeGroups)) {
+		if slices.Contains(BiotypeGroups[group], biotype) {
+			return group
+		}
+	}
+
+	return ""
+}
+
+// Biotypes lists the biotypes of the genes and transcripts with the
+// number of each, by name
+func (gdb *GtfDB) Biotypes() ([]*BiotypeCount, error) {
+	rows, err := gdb.db.Query(BiotypesSql)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ret := make([]*BiotypeCount, 0, 50)
+
+	for rows.Next() {
+		var biotype BiotypeCount
+
+		err := rows.Scan(&biotype.Name, &biotype.Genes, &biotype.Transcripts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		biotype.Group = biotypeGroup(biotype.Name)
+
+		ret = append(ret, &biotype)
+	}
+
+	return ret, rows.Err()
+}
+
+// Biotypes counts biotypes as GtfDB.Biotypes does
+func (mdb *MemGeneDB) Biotypes() ([]*BiotypeCount, error) {
+	counts := make(map[string]*BiotypeCount)
+
+	count := func(name string) *BiotypeCount {
+		biotype, ok := counts[name]
+
+		if !ok {
+			biotype = &BiotypeCount{Name: name, Group: biotypeGroup(name)}
+			counts[name] = biotype
+		}
+
+		return biotype
+	}
+
+	for _, gene := range mdb.symbolGenes {
+		count(gene.Biotype).Genes++
+
+		for _, transcript := range gene.Transcripts {
+			count(transcript.Biotype).Transcripts++
+		}
+	}
+
+	ret := make([]*BiotypeCount, 0, len(counts))
+
+	for _, biotype := range counts {
+		ret = append(ret, biotype)
+	}
+
+	slices.SortFunc(ret, func(a, b *BiotypeCount) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return ret, nil
+}
+
+// whether a gene has a biotype the policy keeps, using the same rules
+// as MakeGeneBiotypeSql
+func (policy *TranscriptPolicy) keepsMemGene(gene *MemGene) bool {
+	if policy == nil {
+		return true
+	}
+
+	biotype := strings.ToLower(gene.Biotype)
+
+	if len(policy.includeGeneBiotypes) > 0 && !slices.Contains(policy.includeGeneBiotypes, biotype) {
+		return false
+	}
+
+	return !slices.Contains(policy.excludeGeneBiotypes, biotype)
+}
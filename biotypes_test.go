@@ -0,0 +1,165 @@
+package genome_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+func describeBiotypes(biotypes []*genome.BiotypeCount) []string {
+	ret := make([]string, 0, len(biotypes))
+
+	for _, biotype := range biotypes {
+		ret = append(ret, fmt.Sprintf("%s:%s:%d:%d", biotype.Name, biotype.Group, biotype.Genes, biotype.Transcripts))
+	}
+
+	return ret
+}
+
+func geneBiotypes(t *testing.T, include []string, exclude []string) *genome.TranscriptPolicy {
+	t.Helper()
+
+	ret, err := (*genome.TranscriptPolicy)(nil).WithGeneBiotypes(include, exclude)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
+
+func TestBiotypes(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	biotypes, err := gdb.Biotypes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"lncRNA:lncrna:1:1",
+		"nonsense_mediated_decay::0:1",
+		"protein_coding:coding:4:4",
+		"retained_intron::0:1"}
+
+	if got := describeBiotypes(biotypes); !slices.Equal(got, want) {
+		t.Errorf("biotypes = %q, want %q", got, want)
+	}
+
+	mbiotypes, err := memGeneDB(t).Biotypes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := describeBiotypes(mbiotypes); !slices.Equal(got, want) {
+		t.Errorf("mem biotypes = %q, want %q", got, want)
+	}
+}
+
+func TestGeneBiotypeFilters(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	prom := dna.DefaultPromoterRegion()
+
+	chr1 := location(t, "chr1", 1, 40000)
+
+	for _, test := range []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{"group", []string{genome.LncRnaBiotypes}, nil, []string{"ENSG00000000003"}},
+		{"several", []string{"lncRNA", "protein_coding"}, nil, []string{"GENEA", "GENEB", "ENSG00000000003", "GENED"}},
+		{"exclude group", nil, []string{genome.CodingBiotypes}, []string{"ENSG00000000003"}},
+		{"include and exclude", []string{genome.CodingBiotypes, genome.LncRnaBiotypes}, []string{"lncrna"}, []string{"GENEA", "GENEB", "GENED"}},
+	} {
+		policy := geneBiotypes(t, test.include, test.exclude)
+
+		genes, err := gdb.OverlappingGenes(chr1, genome.GeneLevel, prom, policy, false)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := symbols(genes); !slices.Equal(got, test.want) {
+			t.Errorf("%s: overlap = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	lncRna := geneBiotypes(t, []string{genome.LncRnaBiotypes}, nil)
+
+	genes, err := gdb.ClosestGenes(location(t, "chr1", 1000, 1000), prom, 5, lncRna, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"ENSG00000000003"}) {
+		t.Errorf("closest lncRNA = %v", got)
+	}
+
+	for _, level := range []string{genome.GeneLevel, genome.TranscriptLevel} {
+		genes, err = gdb.SearchByName("gene", level, lncRna, 10)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(genes) != 0 {
+			t.Errorf("%s search of lncRNAs = %v", level, symbols(genes))
+		}
+
+		genes, err = gdb.SearchByName("ENSG00000000003", level, lncRna, 10)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(genes) != 1 {
+			t.Errorf("%s search of ENSG00000000003 = %v", level, symbols(genes))
+		}
+	}
+
+	features, err := gdb.IntragenicFeatures(chr1, genome.GeneLevel, prom, geneBiotypes(t, nil, []string{genome.LncRnaBiotypes}), false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, feature := range features {
+		if feature.Biotype == "lncRNA" {
+			t.Errorf("intragenic kept %s", feature.GeneId)
+		}
+	}
+
+	if len(features) == 0 {
+		t.Error("intragenic found no features")
+	}
+
+	tss := make([]string, 0, 1)
+
+	err = gdb.TssFeatures(nil, genome.GeneLevel, nil, lncRna, func(feature *genome.GenomicFeature) error {
+		tss = append(tss, feature.GeneId)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(tss, []string{"ENSG00000000003"}) {
+		t.Errorf("tss of lncRNAs = %v", tss)
+	}
+
+	_, err = (*genome.TranscriptPolicy)(nil).WithGeneBiotypes([]string{"not a biotype"}, nil)
+
+	if err == nil {
+		t.Error("an invalid biotype should be an error")
+	}
+}
@@ -0,0 +1,106 @@
+// Compare two GTF databases, e.g. consecutive GENCODE releases, and
+// report the genes that were added, removed, renamed, moved, changed
+// biotype or changed canonical transcript. Databases can be given as
+// ids in the genome catalog or as paths to the database files.
+//
+//	gtfdiff -genomes genomes.v20260608.db -old <id> -new <id> -format tsv > diff.tsv
+//	gtfdiff -old gtf_gencode.v47.basic.grch38.db -new gtf_gencode.v48.basic.grch38.db
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antonybholmes/go-genome"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	genomesPath := flag.String("genomes", "", "genome catalog database, required if old and new are catalog ids")
+	oldId := flag.String("old", "", "old annotation id or database file")
+	newId := flag.String("new", "", "new annotation id or database file")
+	format := flag.String("format", "json", "output format: json or tsv")
+
+	flag.Parse()
+
+	if *oldId == "" || *newId == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	err := run(*genomesPath, *oldId, *newId, *format)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(genomesPath string, oldId string, newId string, format string) error {
+	var genomeDb *genome.GenomeDB
+
+	if genomesPath != "" {
+		genomeDb = genome.NewGenomeDB(genomesPath)
+	}
+
+	oldDb, err := openGtfDB(genomeDb, oldId)
+
+	if err != nil {
+		return err
+	}
+
+	defer oldDb.Close()
+
+	newDb, err := openGtfDB(genomeDb, newId)
+
+	if err != nil {
+		return err
+	}
+
+	defer newDb.Close()
+
+	diff, err := genome.DiffGtfDBs(oldDb, newDb)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, diff.SummaryString())
+
+	wtr := bufio.NewWriter(os.Stdout)
+
+	defer wtr.Flush()
+
+	if format == "tsv" {
+		return diff.WriteTsv(wtr)
+	}
+
+	encoder := json.NewEncoder(wtr)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(diff)
+}
+
+// open a database file directly, otherwise look the id up in the catalog
+func openGtfDB(genomeDb *genome.GenomeDB, id string) (*genome.GtfDB, error) {
+	if strings.HasSuffix(id, ".db") {
+		_, err := os.Stat(id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return genome.NewGtfDB(filepath.Dir(id), &genome.Annotation{Name: filepath.Base(id), Url: filepath.Base(id)}), nil
+	}
+
+	if genomeDb == nil {
+		return nil, fmt.Errorf("%s is not a database file so -genomes must be set", id)
+	}
+
+	return genomeDb.GtfFromId(id)
+}
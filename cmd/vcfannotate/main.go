@@ -0,0 +1,173 @@
+// Annotate the variants in a VCF with their consequences on the
+// transcripts of a GTF database. Runs offline using a local FASTA or
+// 2bit reference.
+//
+//	vcfannotate -db gtf_gencode.v48.basic.grch38.db -seq hg38.2bit -i in.vcf.gz -format vcf > out.vcf
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antonybholmes/go-genome"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	dbPath := flag.String("db", "", "GTF sqlite database")
+	seqPath := flag.String("seq", "", "indexed FASTA or 2bit reference sequence")
+	in := flag.String("i", "-", "input VCF, optionally gzipped. Use - for stdin")
+	format := flag.String("format", "vcf", "output format: vcf or json")
+	upstream := flag.Int("upstream", genome.DefaultUpstreamDist, "report upstream and downstream variants within this distance")
+
+	flag.Parse()
+
+	if *dbPath == "" || *seqPath == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	err := run(*dbPath, *seqPath, *in, *format, *upstream)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dbPath string, seqPath string, in string, format string, upstream int) error {
+	gtfdb := genome.NewGtfDB(filepath.Dir(dbPath), &genome.Annotation{Url: filepath.Base(dbPath)})
+
+	defer gtfdb.Close()
+
+	seqs, err := genome.OpenSequenceReader(seqPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer seqs.Close()
+
+	r, err := openInput(in)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	reader, err := genome.NewVcfReader(r)
+
+	if err != nil {
+		return err
+	}
+
+	annotator := genome.NewVariantAnnotator(gtfdb, seqs)
+	annotator.UpstreamDist = upstream
+
+	wtr := bufio.NewWriter(os.Stdout)
+
+	defer wtr.Flush()
+
+	jsonMode := format == "json"
+
+	var encoder *json.Encoder
+
+	if jsonMode {
+		// one json object per variant per line
+		encoder = json.NewEncoder(wtr)
+	} else {
+		for _, line := range genome.AnnotatedVcfHeader(reader.Header) {
+			fmt.Fprintln(wtr, line)
+		}
+	}
+
+	for {
+		record, err := reader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		csq := make([]string, 0, 10)
+
+		for _, variant := range record.Variants {
+			annotation, err := annotator.Annotate(variant)
+
+			if err != nil {
+				return err
+			}
+
+			if jsonMode {
+				err = encoder.Encode(annotation)
+
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			for _, consequence := range annotation.Consequences {
+				csq = append(csq, consequence.CsqString())
+			}
+		}
+
+		if !jsonMode {
+			if len(csq) > 0 {
+				record.AddInfo(genome.CsqInfoName, strings.Join(csq, ","))
+			}
+
+			fmt.Fprintln(wtr, record.String())
+		}
+	}
+
+	return nil
+}
+
+func openInput(in string) (io.ReadCloser, error) {
+	if in == "-" {
+		return os.Stdin, nil
+	}
+
+	f, err := os.Open(in)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(in, ".gz") {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &gzipFile{Reader: gz, file: f}, nil
+}
+
+// close both the gzip stream and the underlying file
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
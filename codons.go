@@ -0,0 +1,172 @@
+package genome
+
+import "strings"
+
+//
+// Codon tables for translating coding sequence
+//
+
+type (
+	CodonTable struct {
+		Name   string
+		Id     int
+		codons map[string]byte
+		starts map[string]bool
+	}
+)
+
+const (
+	StopAminoAcid    byte = '*'
+	UnknownAminoAcid byte = 'X'
+)
+
+var (
+	// NCBI translation table 1
+	StandardCodonTable = newCodonTable("Standard", 1,
+		"FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		[]string{"ATG"})
+
+	// NCBI translation table 2
+	VertebrateMitochondrialCodonTable = newCodonTable("Vertebrate Mitochondrial", 2,
+		"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSS**VVVVAAAADDEEGGGG",
+		[]string{"ATT", "ATC", "ATA", "ATG", "GTG"})
+
+	aminoAcidNames = map[byte]string{
+		'A':              "Ala",
+		'R':              "Arg",
+		'N':              "Asn",
+		'D':              "Asp",
+		'C':              "Cys",
+		'Q':              "Gln",
+		'E':              "Glu",
+		'G':              "Gly",
+		'H':              "His",
+		'I':              "Ile",
+		'L':              "Leu",
+		'K':              "Lys",
+		'M':              "Met",
+		'F':              "Phe",
+		'P':              "Pro",
+		'S':              "Ser",
+		'T':              "Thr",
+		'W':              "Trp",
+		'Y':              "Tyr",
+		'V':              "Val",
+		StopAminoAcid:    "Ter",
+		UnknownAminoAcid: "Xaa",
+	}
+)
+
+// newCodonTable builds a table from the NCBI amino acid string where
+// codons are ordered TTT, TTC, TTA, TTG, TCT... i.e. with bases in
+// the order TCAG
+func newCodonTable(name string, id int, aminoAcids string, starts []string) *CodonTable {
+	bases := "TCAG"
+
+	table := CodonTable{Name: name,
+		Id:     id,
+		codons: make(map[string]byte, 64),
+		starts: make(map[string]bool, len(starts))}
+
+	i := 0
+
+	for _, b1 := range bases {
+		for _, b2 := range bases {
+			for _, b3 := range bases {
+				table.codons[string([]rune{b1, b2, b3})] = aminoAcids[i]
+				i++
+			}
+		}
+	}
+
+	for _, start := range starts {
+		table.starts[start] = true
+	}
+
+	return &table
+}
+
+// Translate a codon, returning X for codons with unknown bases
+func (table *CodonTable) Translate(codon string) byte {
+	aa, ok := table.codons[strings.ToUpper(codon)]
+
+	if !ok {
+		return UnknownAminoAcid
+	}
+
+	return aa
+}
+
+func (table *CodonTable) IsStart(codon string) bool {
+	return table.starts[strings.ToUpper(codon)]
+}
+
+func (table *CodonTable) IsStop(codon string) bool {
+	return table.Translate(codon) == StopAminoAcid
+}
+
+// TranslateSequence translates a coding sequence in frame 1. Translation
+// stops after the first stop codon, which is included as '*'. Trailing
+// bases that do not form a full codon are ignored.
+func (table *CodonTable) TranslateSequence(seq string) string {
+	var buffer strings.Builder
+
+	for i := 0; i+3 <= len(seq); i += 3 {
+		aa := table.Translate(seq[i : i+3])
+
+		buffer.WriteByte(aa)
+
+		if aa == StopAminoAcid {
+			break
+		}
+	}
+
+	return buffer.String()
+}
+
+// TranslateCds translates a coding sequence starting at its start
+// codon. Alternative start codons, e.g. GTG, are translated as Met
+// when they are the first codon, as they are in vivo.
+func (table *CodonTable) TranslateCds(seq string) string {
+	protein := table.TranslateSequence(seq)
+
+	if len(protein) > 0 && table.IsStart(seq[:3]) {
+		protein = "M" + protein[1:]
+	}
+
+	return protein
+}
+
+// CodonTableForChr returns the mitochondrial table for chrM/MT and
+// the standard table for everything else
+func CodonTableForChr(chr string) *CodonTable {
+	switch strings.ToUpper(strings.TrimPrefix(chr, "chr")) {
+	case "M", "MT":
+		return VertebrateMitochondrialCodonTable
+	default:
+		return StandardCodonTable
+	}
+}
+
+// AminoAcidName returns the three letter name of an amino acid, e.g. Arg
+func AminoAcidName(aa byte) string {
+	name, ok := aminoAcidNames[aa]
+
+	if !ok {
+		return aminoAcidNames[UnknownAminoAcid]
+	}
+
+	return name
+}
+
+// ThreeLetterProtein converts a one letter protein sequence to three
+// letter codes as used by HGVS, e.g. MR -> MetArg
+func ThreeLetterProtein(protein string) string {
+	var buffer strings.Builder
+
+	for i := range len(protein) {
+		buffer.WriteString(AminoAcidName(protein[i]))
+	}
+
+	return buffer.String()
+}
@@ -0,0 +1,191 @@
+package genome
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//
+// Conversion between genomic positions and HGVS style transcript (n.)
+// and coding (c.) coordinates
+//
+
+type (
+	// A position in transcript or coding coordinates, e.g. c.123+5,
+	// c.-14 or c.*32
+	Coord struct {
+		// "n" or "c"
+		Prefix string `json:"prefix"`
+		// position of the anchoring exonic base. Negative if 5' of
+		// n.1 or c.1
+		Pos int `json:"pos"`
+		// intronic offset from the anchoring base, e.g. +5 or -3
+		Offset int `json:"offset,omitempty"`
+		// position is 3' of the stop codon (c.) or the end of the
+		// transcript (n.) and Pos counts from there
+		Star bool `json:"star,omitempty"`
+	}
+)
+
+const (
+	TranscriptCoordPrefix string = "n"
+	CodingCoordPrefix     string = "c"
+)
+
+var (
+	ErrNotCoding    = errors.New("transcript is not protein coding")
+	ErrInvalidCoord = errors.New("invalid coordinate")
+)
+
+func (coord *Coord) String() string {
+	return coord.Prefix + "." + coord.PosString()
+}
+
+// PosString returns the coordinate without the prefix, e.g. 123+5
+func (coord *Coord) PosString() string {
+	var buffer strings.Builder
+
+	if coord.Star {
+		buffer.WriteString("*")
+	}
+
+	buffer.WriteString(strconv.Itoa(coord.Pos))
+
+	if coord.Offset > 0 {
+		buffer.WriteString("+")
+		buffer.WriteString(strconv.Itoa(coord.Offset))
+	} else if coord.Offset < 0 {
+		buffer.WriteString(strconv.Itoa(coord.Offset))
+	}
+
+	return buffer.String()
+}
+
+// ParseCoord parses coordinates such as c.123+5, c.-14, c.*32-2
+// or n.45.
+func ParseCoord(s string) (*Coord, error) {
+	s = strings.TrimSpace(s)
+
+	prefix, rest, found := strings.Cut(s, ".")
+
+	if !found || (prefix != TranscriptCoordPrefix && prefix != CodingCoordPrefix) || rest == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCoord, s)
+	}
+
+	coord := Coord{Prefix: prefix}
+
+	if strings.HasPrefix(rest, "*") {
+		coord.Star = true
+		rest = rest[1:]
+	}
+
+	// find the start of the offset, skipping a leading minus
+	// sign on the position itself
+	i := strings.IndexAny(rest[min(1, len(rest)):], "+-")
+
+	posStr := rest
+
+	if i != -1 {
+		i++
+		posStr = rest[:i]
+
+		offset, err := strconv.Atoi(strings.TrimPrefix(rest[i:], "+"))
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCoord, s)
+		}
+
+		coord.Offset = offset
+	}
+
+	pos, err := strconv.Atoi(posStr)
+
+	// Atoi allows a + sign, which HGVS positions do not have
+	if err != nil || strings.HasPrefix(posStr, "+") || pos == 0 || (coord.Star && pos < 0) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCoord, s)
+	}
+
+	coord.Pos = pos
+
+	return &coord, nil
+}
+
+// GenomicToTranscript converts a genomic position to n. coordinates
+func (model *TranscriptModel) GenomicToTranscript(pos int) *Coord {
+	index, offset := model.genomicToIndex(pos)
+
+	coord := Coord{Prefix: TranscriptCoordPrefix, Offset: offset}
+
+	switch {
+	case index < 1:
+		// there is no n.0 so n.-1 is the base before n.1
+		coord.Pos = index - 1
+	case index > model.Length:
+		coord.Star = true
+		coord.Pos = index - model.Length
+	default:
+		coord.Pos = index
+	}
+
+	return &coord
+}
+
+// GenomicToCoding converts a genomic position to c. coordinates
+func (model *TranscriptModel) GenomicToCoding(pos int) (*Coord, error) {
+	if !model.IsCoding() {
+		return nil, ErrNotCoding
+	}
+
+	index, offset := model.genomicToIndex(pos)
+
+	coord := Coord{Prefix: CodingCoordPrefix, Offset: offset}
+
+	switch {
+	case index < model.cdsStart:
+		// 5' UTR and upstream, c.-1 is the base before c.1
+		coord.Pos = index - model.cdsStart
+	case index > model.cdsEnd:
+		coord.Star = true
+		coord.Pos = index - model.cdsEnd
+	default:
+		coord.Pos = index - model.cdsStart + 1
+	}
+
+	return &coord, nil
+}
+
+// ToGenomic converts n. or c. coordinates back to a genomic position
+func (model *TranscriptModel) ToGenomic(coord *Coord) (int, error) {
+	var index int
+
+	switch coord.Prefix {
+	case TranscriptCoordPrefix:
+		switch {
+		case coord.Star:
+			index = model.Length + coord.Pos
+		case coord.Pos < 0:
+			index = coord.Pos + 1
+		default:
+			index = coord.Pos
+		}
+	case CodingCoordPrefix:
+		if !model.IsCoding() {
+			return 0, ErrNotCoding
+		}
+
+		switch {
+		case coord.Star:
+			index = model.cdsEnd + coord.Pos
+		case coord.Pos < 0:
+			index = model.cdsStart + coord.Pos
+		default:
+			index = model.cdsStart + coord.Pos - 1
+		}
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrInvalidCoord, coord)
+	}
+
+	return model.indexToGenomic(index, coord.Offset)
+}
@@ -0,0 +1,291 @@
+package genome_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+type coordCase struct {
+	pos int
+	n   string
+	c   string
+}
+
+func transcriptModel(t *testing.T, id string) *genome.TranscriptModel {
+	t.Helper()
+
+	model, err := openGenes(t, genometest.Genes()).TranscriptModel(id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return model
+}
+
+// a non-coding transcript with the given exons
+func exonModel(t *testing.T, strand string, exons ...[2]int) *genome.TranscriptModel {
+	t.Helper()
+
+	stranded := func(start int, end int) *dna.Location {
+		loc, err := dna.NewStrandedLocation("chr1", start, end, strand)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return loc
+	}
+
+	transcript := &genome.GenomicFeature{Type: genome.TranscriptLevel,
+		Transcript: "ENST1",
+		Location:   stranded(exons[0][0], exons[len(exons)-1][1])}
+
+	for _, exon := range exons {
+		transcript.Children = append(transcript.Children, &genome.GenomicFeature{Type: genome.ExonLevel, Location: stranded(exon[0], exon[1])})
+	}
+
+	model, err := genome.NewTranscriptModel(transcript)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return model
+}
+
+func checkCoords(t *testing.T, model *genome.TranscriptModel, cases []coordCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		if got := model.GenomicToTranscript(tc.pos).String(); got != tc.n {
+			t.Errorf("%d: n = %s, want %s", tc.pos, got, tc.n)
+		}
+
+		coord, err := model.GenomicToCoding(tc.pos)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := coord.String(); got != tc.c {
+			t.Errorf("%d: c = %s, want %s", tc.pos, got, tc.c)
+		}
+
+		for _, s := range []string{tc.n, tc.c} {
+			coord, err := genome.ParseCoord(s)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pos, err := model.ToGenomic(coord)
+
+			if err != nil || pos != tc.pos {
+				t.Errorf("%s = %d, %v, want %d", s, pos, err, tc.pos)
+			}
+		}
+	}
+}
+
+// every position in and around a transcript converts to n. and c. and
+// back again
+func checkRoundTrips(t *testing.T, model *genome.TranscriptModel, start int, end int) {
+	t.Helper()
+
+	for pos := start; pos <= end; pos++ {
+		n := model.GenomicToTranscript(pos)
+
+		c, err := model.GenomicToCoding(pos)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, coord := range []*genome.Coord{n, c} {
+			got, err := model.ToGenomic(coord)
+
+			if err != nil || got != pos {
+				t.Fatalf("%d: %s = %d, %v", pos, coord, got, err)
+			}
+		}
+	}
+}
+
+func TestPlusStrandCoords(t *testing.T) {
+	// exons 1001-1200, 2001-2300 and 4001-5000 with the CDS and stop
+	// codon from 1101 to 4101
+	model := transcriptModel(t, "ENST00000000001")
+
+	if model.Length != 1500 || model.CdsStart() != 101 || model.CdsEnd() != 601 {
+		t.Fatalf("length %d, cds %d-%d", model.Length, model.CdsStart(), model.CdsEnd())
+	}
+
+	checkCoords(t, model, []coordCase{
+		// upstream
+		{990, "n.-11", "c.-111"},
+		{1000, "n.-1", "c.-101"},
+		// 5' UTR
+		{1001, "n.1", "c.-100"},
+		{1100, "n.100", "c.-1"},
+		{1101, "n.101", "c.1"},
+		{1200, "n.200", "c.100"},
+		// intron 1201-2000
+		{1201, "n.200+1", "c.100+1"},
+		{1600, "n.200+400", "c.100+400"},
+		{1601, "n.201-400", "c.101-400"},
+		{2000, "n.201-1", "c.101-1"},
+		{2001, "n.201", "c.101"},
+		{2301, "n.500+1", "c.400+1"},
+		{4000, "n.501-1", "c.401-1"},
+		// last base of the stop codon and the 3' UTR
+		{4101, "n.601", "c.501"},
+		{4102, "n.602", "c.*1"},
+		{5000, "n.1500", "c.*899"},
+		// downstream
+		{5001, "n.*1", "c.*900"},
+		{5010, "n.*10", "c.*909"},
+	})
+
+	checkRoundTrips(t, model, 900, 5100)
+}
+
+func TestMinusStrandCoords(t *testing.T) {
+	// exons 11001-12000, 9001-9200 and 8001-8500 in transcript order
+	// with the CDS and stop codon from 11101 down to 8400
+	model := transcriptModel(t, "ENST00000000003")
+
+	if model.Length != 1700 || model.CdsStart() != 900 || model.CdsEnd() != 1301 {
+		t.Fatalf("length %d, cds %d-%d", model.Length, model.CdsStart(), model.CdsEnd())
+	}
+
+	checkCoords(t, model, []coordCase{
+		// upstream is to the right on the minus strand
+		{12010, "n.-10", "c.-909"},
+		{12001, "n.-1", "c.-900"},
+		// 5' UTR
+		{12000, "n.1", "c.-899"},
+		{11102, "n.899", "c.-1"},
+		{11101, "n.900", "c.1"},
+		{11001, "n.1000", "c.101"},
+		// intron 9201-11000
+		{11000, "n.1000+1", "c.101+1"},
+		{10101, "n.1000+900", "c.101+900"},
+		{10100, "n.1001-900", "c.102-900"},
+		{9201, "n.1001-1", "c.102-1"},
+		{9200, "n.1001", "c.102"},
+		{9001, "n.1200", "c.301"},
+		{9000, "n.1200+1", "c.301+1"},
+		{8501, "n.1201-1", "c.302-1"},
+		// last base of the stop codon and the 3' UTR
+		{8400, "n.1301", "c.402"},
+		{8399, "n.1302", "c.*1"},
+		{8001, "n.1700", "c.*399"},
+		// downstream
+		{8000, "n.*1", "c.*400"},
+		{7990, "n.*11", "c.*410"},
+	})
+
+	checkRoundTrips(t, model, 7900, 12100)
+}
+
+func TestIntronMidpointCoords(t *testing.T) {
+	// the intron 201-301 has 101 bases so 251 is as far from either
+	// exon and is anchored on the upstream one
+	plus := exonModel(t, "+", [2]int{101, 200}, [2]int{302, 400})
+
+	for pos, want := range map[int]string{250: "n.100+50", 251: "n.100+51", 252: "n.101-50"} {
+		if got := plus.GenomicToTranscript(pos).String(); got != want {
+			t.Errorf("+ %d = %s, want %s", pos, got, want)
+		}
+	}
+
+	minus := exonModel(t, "-", [2]int{101, 200}, [2]int{302, 400})
+
+	for pos, want := range map[int]string{252: "n.99+50", 251: "n.99+51", 250: "n.100-50"} {
+		if got := minus.GenomicToTranscript(pos).String(); got != want {
+			t.Errorf("- %d = %s, want %s", pos, got, want)
+		}
+	}
+
+	checkTranscriptRoundTrips(t, plus, 1, 500)
+	checkTranscriptRoundTrips(t, minus, 1, 500)
+
+	// non-coding transcripts have no c. coordinates
+	_, err := plus.GenomicToCoding(150)
+
+	if !errors.Is(err, genome.ErrNotCoding) {
+		t.Errorf("c. of a non-coding transcript: %v", err)
+	}
+
+	_, err = plus.ToGenomic(&genome.Coord{Prefix: genome.CodingCoordPrefix, Pos: 1})
+
+	if !errors.Is(err, genome.ErrNotCoding) {
+		t.Errorf("c.1 of a non-coding transcript: %v", err)
+	}
+
+	// offsets only make sense within the transcript
+	for _, s := range []string{"n.-5+2", "n.*3-1"} {
+		coord, err := genome.ParseCoord(s)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pos, err := plus.ToGenomic(coord); err == nil {
+			t.Errorf("%s = %d", s, pos)
+		}
+	}
+}
+
+func checkTranscriptRoundTrips(t *testing.T, model *genome.TranscriptModel, start int, end int) {
+	t.Helper()
+
+	for pos := start; pos <= end; pos++ {
+		coord := model.GenomicToTranscript(pos)
+
+		got, err := model.ToGenomic(coord)
+
+		if err != nil || got != pos {
+			t.Fatalf("%d: %s = %d, %v", pos, coord, got, err)
+		}
+	}
+}
+
+func TestParseCoord(t *testing.T) {
+	for s, want := range map[string]genome.Coord{
+		"c.123":    {Prefix: "c", Pos: 123},
+		"c.123+5":  {Prefix: "c", Pos: 123, Offset: 5},
+		"c.124-3":  {Prefix: "c", Pos: 124, Offset: -3},
+		"c.-14":    {Prefix: "c", Pos: -14},
+		"c.-14+2":  {Prefix: "c", Pos: -14, Offset: 2},
+		"c.-14-2":  {Prefix: "c", Pos: -14, Offset: -2},
+		"c.*32":    {Prefix: "c", Pos: 32, Star: true},
+		"c.*32-2":  {Prefix: "c", Pos: 32, Offset: -2, Star: true},
+		" n.45 ":   {Prefix: "n", Pos: 45},
+		"n.*1":     {Prefix: "n", Pos: 1, Star: true},
+		"n.100+51": {Prefix: "n", Pos: 100, Offset: 51},
+	} {
+		coord, err := genome.ParseCoord(s)
+
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+
+		if *coord != want {
+			t.Errorf("%q = %+v, want %+v", s, coord, want)
+		}
+	}
+
+	for _, s := range []string{"", "c", "c.", "123", "g.123", "p.12", "c.0", "n.*0", "c.*-3",
+		"c.abc", "c.12+", "c.12+x", "c.+5", "c.1.5"} {
+		if coord, err := genome.ParseCoord(s); !errors.Is(err, genome.ErrInvalidCoord) {
+			t.Errorf("%q = %+v, %v", s, coord, err)
+		}
+	}
+}
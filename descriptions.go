@@ -0,0 +1,100 @@
+package genome
+
+import (
+	"slices"
+)
+
+//
+// The full names of genes, e.g. MYC proto-oncogene, bHLH transcription
+// factor for MYC, from the description attribute of the GTF or from
+// HGNC or MGI.
+//
+
+const (
+	DescriptionsOfGenesSql = `SELECT d.gene_id, d.description
+		FROM gene_descriptions AS d
+		WHERE d.gene_id IN (<<IDS>>)`
+)
+
+// databases created by older importers do not have descriptions
+func (gdb *GtfDB) hasGeneDescriptions() bool {
+	gdb.descriptionsOnce.Do(func() {
+		gdb.hasDescriptions = gdb.hasTable("gene_descriptions")
+	})
+
+	return gdb.hasDescriptions
+}
+
+// AddDescriptions sets the descriptions of the genes in features and of
+// genes that are children of other features
+func (gdb *GtfDB) AddDescriptions(features []*GenomicFeature) error {
+	if !gdb.hasGeneDescriptions() {
+		return nil
+	}
+
+	genes := xrefGenes(features, nil)
+
+	ids := make([]int, 0, len(genes))
+
+	for _, gene := range genes {
+		ids = append(ids, gene.Id)
+	}
+
+	slices.Sort(ids)
+
+	descriptions := make(map[int]string, len(ids))
+
+	for chunk := range slices.Chunk(slices.Compact(ids), MaxTagQueryIds) {
+		query, namedArgs := inSql(DescriptionsOfGenesSql, "g", chunk)
+
+		err := gdb.geneDescriptions(query, namedArgs, descriptions)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, gene := range genes {
+		gene.Description = descriptions[gene.Id]
+	}
+
+	return nil
+}
+
+func (gdb *GtfDB) geneDescriptions(query string, namedArgs []any, descriptions map[int]string) error {
+	rows, err := gdb.db.Query(query, namedArgs...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var description string
+
+		err := rows.Scan(&id, &description)
+
+		if err != nil {
+			return err
+		}
+
+		descriptions[id] = description
+	}
+
+	return rows.Err()
+}
+
+// AddDescriptions sets descriptions as GtfDB.AddDescriptions does
+func (mdb *MemGeneDB) AddDescriptions(features []*GenomicFeature) error {
+	for _, feature := range xrefGenes(features, nil) {
+		if gene, ok := mdb.geneByRowId(feature.Id); ok {
+			feature.Description = gene.Description
+		} else {
+			feature.Description = ""
+		}
+	}
+
+	return nil
+}
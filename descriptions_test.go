@@ -0,0 +1,71 @@
+package genome_test
+
+import (
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+func TestGeneDescriptions(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	genes, err := gdb.OverlappingGenes(location(t, "chr1", 1, 40000), "gene,transcript", dna.DefaultPromoterRegion(), nil, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// descriptions are only added when asked for
+	if genes[0].Description != "" {
+		t.Errorf("description without asking: %s", genes[0].Description)
+	}
+
+	err = gdb.AddDescriptions(genes)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"ENSG00000000003": "",
+		"GENEA": "gene alpha, test transcription factor",
+		"GENEB": "gene beta",
+		"GENED": "gene delta"}
+
+	if len(genes) != len(want) {
+		t.Fatalf("got %d genes, want %d", len(genes), len(want))
+	}
+
+	for _, gene := range genes {
+		if gene.Description != want[gene.Symbol] {
+			t.Errorf("description of %s = %q", gene.Symbol, gene.Description)
+		}
+
+		// only genes are described
+		for _, transcript := range gene.Children {
+			if transcript.Description != "" {
+				t.Errorf("description of %s = %q", transcript.Transcript, transcript.Description)
+			}
+		}
+	}
+
+	// older databases do not have descriptions
+	old := openGtf(t, genometest.OldGtfId)
+
+	genes, err = old.SearchByName("genea", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = old.AddDescriptions(genes)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || genes[0].Description != "" {
+		t.Errorf("old descriptions = %+v", genes)
+	}
+}
@@ -0,0 +1,385 @@
+package genome
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/antonybholmes/go-dna"
+)
+
+//
+// Differences between two versions of an annotation, e.g. GENCODE v47
+// and v48, keyed by version-stripped gene and transcript ids
+//
+
+type (
+	// The state of a gene in one version of the annotation
+	GeneVersion struct {
+		Location  *dna.Location `json:"loc"`
+		Symbol    string        `json:"symbol"`
+		Biotype   string        `json:"biotype"`
+		Canonical string        `json:"canonical,omitempty"`
+		// version-stripped transcript ids
+		transcripts map[string]bool
+	}
+
+	GeneChange struct {
+		GeneId string `json:"geneId"`
+		// e.g. added, renamed, moved
+		Changes            []string     `json:"changes"`
+		Old                *GeneVersion `json:"old,omitempty"`
+		New                *GeneVersion `json:"new,omitempty"`
+		AddedTranscripts   []string     `json:"addedTranscripts,omitempty"`
+		RemovedTranscripts []string     `json:"removedTranscripts,omitempty"`
+	}
+
+	AnnotationDiff struct {
+		Old *Annotation `json:"old"`
+		New *Annotation `json:"new"`
+		// number of genes with each type of change
+		Summary map[string]int `json:"summary"`
+		Genes   []*GeneChange  `json:"genes"`
+	}
+)
+
+const (
+	GeneAdded          string = "added"
+	GeneRemoved        string = "removed"
+	GeneRenamed        string = "renamed"
+	BiotypeChanged     string = "biotype"
+	GeneMoved          string = "moved"
+	CanonicalChanged   string = "canonical"
+	TranscriptsChanged string = "transcripts"
+
+	DiffGenesSql = `SELECT
+		g.gene_id,
+		g.symbol,
+		c.name AS chr,
+		g.start,
+		g.end,
+		g.strand,
+		gt.name AS biotype
+		FROM genes AS g
+		JOIN chromosomes AS c ON g.chr_id = c.id
+		JOIN biotypes AS gt ON g.biotype_id = gt.id`
+
+	// genes can have more than one transcript flagged as canonical so
+	// order them and use the first
+	DiffTranscriptsSql = `SELECT
+		g.gene_id,
+		t.transcript_id,
+		t.is_canonical
+		FROM transcripts AS t
+		JOIN genes AS g ON t.gene_id = g.id
+		ORDER BY g.gene_id, t.is_canonical DESC, t.transcript_id`
+
+	// as DiffTranscriptsSql but preferring MANE Select and then
+	// Ensembl canonical transcripts
+	DiffTaggedTranscriptsSql = `SELECT
+		g.gene_id,
+		t.transcript_id,
+		t.is_canonical OR mane.transcript_id IS NOT NULL OR ec.transcript_id IS NOT NULL
+		FROM transcripts AS t
+		JOIN genes AS g ON t.gene_id = g.id
+		LEFT JOIN (
+			SELECT tt.transcript_id
+			FROM transcript_tags AS tt
+			JOIN tags AS tg ON tt.tag_id = tg.id
+			WHERE tg.name = :mane) AS mane ON mane.transcript_id = t.id
+		LEFT JOIN (
+			SELECT tt.transcript_id
+			FROM transcript_tags AS tt
+			JOIN tags AS tg ON tt.tag_id = tg.id
+			WHERE tg.name = :ensembl_canonical) AS ec ON ec.transcript_id = t.id
+		ORDER BY g.gene_id,
+			mane.transcript_id IS NOT NULL DESC,
+			ec.transcript_id IS NOT NULL DESC,
+			t.is_canonical DESC,
+			t.transcript_id`
+)
+
+var (
+	// GENCODE style versions, including those of PAR genes such as
+	// ENSG00000002586.20_PAR_Y
+	idVersionRegex = regexp.MustCompile(`\.\d+(_PAR_Y)?$`)
+
+	// order of columns in tsv reports
+	geneChangeOrder = []string{GeneAdded,
+		GeneRemoved,
+		GeneRenamed,
+		BiotypeChanged,
+		GeneMoved,
+		CanonicalChanged,
+		TranscriptsChanged}
+)
+
+// StripIdVersion removes the version from an id, e.g.
+// ENSG00000141510.18 -> ENSG00000141510
+func StripIdVersion(id string) string {
+	return idVersionRegex.ReplaceAllString(id, "$1")
+}
+
+// DiffGtfDBs compares the genes and transcripts of two annotation
+// databases. Genes are reported if anything about them changed and
+// are sorted by id.
+func DiffGtfDBs(oldDb *GtfDB, newDb *GtfDB) (*AnnotationDiff, error) {
+	oldGenes, err := oldDb.geneVersions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	newGenes, err := newDb.geneVersions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret := AnnotationDiff{Old: oldDb.Annotation(),
+		New:     newDb.Annotation(),
+		Summary: make(map[string]int),
+		Genes:   make([]*GeneChange, 0, 100)}
+
+	for _, change := range geneChangeOrder {
+		ret.Summary[change] = 0
+	}
+
+	for id, oldGene := range oldGenes {
+		newGene, ok := newGenes[id]
+
+		change := GeneChange{GeneId: id, Old: oldGene, New: newGene, Changes: make([]string, 0, 2)}
+
+		if !ok {
+			change.Changes = append(change.Changes, GeneRemoved)
+		} else {
+			compareGeneVersions(&change)
+		}
+
+		if len(change.Changes) > 0 {
+			ret.Genes = append(ret.Genes, &change)
+		}
+	}
+
+	for id, newGene := range newGenes {
+		if _, ok := oldGenes[id]; !ok {
+			ret.Genes = append(ret.Genes, &GeneChange{GeneId: id, New: newGene, Changes: []string{GeneAdded}})
+		}
+	}
+
+	slices.SortFunc(ret.Genes, func(a, b *GeneChange) int {
+		return strings.Compare(a.GeneId, b.GeneId)
+	})
+
+	for _, change := range ret.Genes {
+		for _, c := range change.Changes {
+			ret.Summary[c]++
+		}
+	}
+
+	return &ret, nil
+}
+
+func compareGeneVersions(change *GeneChange) {
+	oldGene := change.Old
+	newGene := change.New
+
+	if oldGene.Symbol != newGene.Symbol {
+		change.Changes = append(change.Changes, GeneRenamed)
+	}
+
+	if oldGene.Biotype != newGene.Biotype {
+		change.Changes = append(change.Changes, BiotypeChanged)
+	}
+
+	if oldGene.Location.Chr() != newGene.Location.Chr() ||
+		oldGene.Location.Start() != newGene.Location.Start() ||
+		oldGene.Location.End() != newGene.Location.End() ||
+		oldGene.Location.Strand() != newGene.Location.Strand() {
+		change.Changes = append(change.Changes, GeneMoved)
+	}
+
+	if oldGene.Canonical != newGene.Canonical {
+		change.Changes = append(change.Changes, CanonicalChanged)
+	}
+
+	for id := range newGene.transcripts {
+		if !oldGene.transcripts[id] {
+			change.AddedTranscripts = append(change.AddedTranscripts, id)
+		}
+	}
+
+	for id := range oldGene.transcripts {
+		if !newGene.transcripts[id] {
+			change.RemovedTranscripts = append(change.RemovedTranscripts, id)
+		}
+	}
+
+	if len(change.AddedTranscripts) > 0 || len(change.RemovedTranscripts) > 0 {
+		slices.Sort(change.AddedTranscripts)
+		slices.Sort(change.RemovedTranscripts)
+		change.Changes = append(change.Changes, TranscriptsChanged)
+	}
+}
+
+// load every gene with its transcripts keyed by version-stripped id
+func (gdb *GtfDB) geneVersions() (map[string]*GeneVersion, error) {
+	rows, err := gdb.db.Query(DiffGenesSql)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	genes := make(map[string]*GeneVersion, 50000)
+
+	for rows.Next() {
+		var id string
+		var chr string
+		var start int
+		var end int
+		var strand string
+
+		gene := GeneVersion{transcripts: make(map[string]bool, 10)}
+
+		err := rows.Scan(&id, &gene.Symbol, &chr, &start, &end, &strand, &gene.Biotype)
+
+		if err != nil {
+			return nil, err
+		}
+
+		gene.Location, err = dna.NewStrandedLocation(chr, start, end, strand)
+
+		if err != nil {
+			return nil, err
+		}
+
+		genes[StripIdVersion(id)] = &gene
+	}
+
+	var transcriptRows *sql.Rows
+
+	if gdb.hasTranscriptTags() {
+		transcriptRows, err = gdb.db.Query(DiffTaggedTranscriptsSql,
+			sql.Named("mane", ManeSelectTag),
+			sql.Named("ensembl_canonical", EnsemblCanonicalTag))
+	} else {
+		transcriptRows, err = gdb.db.Query(DiffTranscriptsSql)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer transcriptRows.Close()
+
+	for transcriptRows.Next() {
+		var geneId string
+		var transcriptId string
+		var isCanonical bool
+
+		err := transcriptRows.Scan(&geneId, &transcriptId, &isCanonical)
+
+		if err != nil {
+			return nil, err
+		}
+
+		gene, ok := genes[StripIdVersion(geneId)]
+
+		if !ok {
+			continue
+		}
+
+		transcriptId = StripIdVersion(transcriptId)
+
+		gene.transcripts[transcriptId] = true
+
+		// the rows are ordered so the first canonical is the best
+		if isCanonical && gene.Canonical == "" {
+			gene.Canonical = transcriptId
+		}
+	}
+
+	return genes, nil
+}
+
+// WriteTsv writes one row per changed gene
+func (diff *AnnotationDiff) WriteTsv(w io.Writer) error {
+	wtr := csv.NewWriter(w)
+	wtr.Comma = '\t'
+
+	err := wtr.Write([]string{"Gene Id",
+		"Changes",
+		"Old Symbol",
+		"New Symbol",
+		"Old Biotype",
+		"New Biotype",
+		"Old Location",
+		"New Location",
+		"Old Canonical",
+		"New Canonical",
+		"Added Transcripts",
+		"Removed Transcripts"})
+
+	if err != nil {
+		return err
+	}
+
+	for _, change := range diff.Genes {
+		row := []string{change.GeneId, strings.Join(change.Changes, GroupSeparator)}
+
+		row = append(row, geneVersionFields(change.Old, change.New)...)
+
+		row = append(row,
+			strings.Join(change.AddedTranscripts, GroupSeparator),
+			strings.Join(change.RemovedTranscripts, GroupSeparator))
+
+		err := wtr.Write(row)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	wtr.Flush()
+
+	return wtr.Error()
+}
+
+// old and new values interleaved for the tsv columns
+func geneVersionFields(oldGene *GeneVersion, newGene *GeneVersion) []string {
+	fields := make([]string, 8)
+
+	for i, gene := range []*GeneVersion{oldGene, newGene} {
+		if gene == nil {
+			for j := range 4 {
+				fields[j*2+i] = Na
+			}
+
+			continue
+		}
+
+		fields[i] = gene.Symbol
+		fields[2+i] = gene.Biotype
+		fields[4+i] = gene.Location.String() + ":" + gene.Location.Strand()
+		fields[6+i] = gene.Canonical
+	}
+
+	return fields
+}
+
+// SummaryString returns the summary as e.g. added=10, removed=2
+func (diff *AnnotationDiff) SummaryString() string {
+	items := make([]string, 0, len(geneChangeOrder))
+
+	for _, change := range geneChangeOrder {
+		items = append(items, change+"="+strconv.Itoa(diff.Summary[change]))
+	}
+
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,113 @@
+package genome_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+// a gene with several transcripts flagged as canonical
+func canonicalGenes() []*genometest.Gene {
+	transcript := func(id string, start int) *genometest.Transcript {
+		return &genometest.Transcript{Id: id,
+			Biotype:   "lncRNA",
+			Exons:     []genometest.Interval{{Start: start, End: start + 100}},
+			Canonical: true}
+	}
+
+	return []*genometest.Gene{{Id: "ENSG00000000001",
+		Symbol:  "GENEA",
+		Chr:     "chr1",
+		Strand:  "+",
+		Biotype: "lncRNA",
+		Transcripts: []*genometest.Transcript{transcript("ENST00000000003", 1000),
+			transcript("ENST00000000002", 1200),
+			transcript("ENST00000000001", 1400)}}}
+}
+
+func TestDiffCanonical(t *testing.T) {
+	oldGdb := openGenes(t, canonicalGenes())
+
+	genes := canonicalGenes()
+
+	// no longer canonical
+	genes[0].Transcripts[2].Canonical = false
+
+	newGdb := openGenes(t, genes)
+
+	// the lowest canonical id wins
+	diff, err := genome.DiffGtfDBs(oldGdb, newGdb)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.Genes) != 1 {
+		t.Fatalf("got %d changed genes, want 1", len(diff.Genes))
+	}
+
+	change := diff.Genes[0]
+
+	if !slices.Equal(change.Changes, []string{genome.CanonicalChanged}) ||
+		change.Old.Canonical != "ENST00000000001" ||
+		change.New.Canonical != "ENST00000000002" {
+		t.Errorf("change = %v %s -> %s", change.Changes, change.Old.Canonical, change.New.Canonical)
+	}
+
+	// and the same every time
+	for range 5 {
+		diff, err := genome.DiffGtfDBs(oldGdb, oldGdb)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(diff.Genes) != 0 {
+			t.Fatalf("self diff = %+v", diff.Genes[0])
+		}
+	}
+}
+
+// with tags MANE Select wins over Ensembl canonical, which wins over
+// the canonical flag
+func TestDiffCanonicalTags(t *testing.T) {
+	legacy := openAnnotation(t, &genometest.Annotation{PublicId: "legacy",
+		Name:   "legacy",
+		File:   "legacy.db",
+		Legacy: true,
+		Genes:  canonicalGenes()})
+
+	genes := canonicalGenes()
+
+	genes[0].Transcripts[0].Tags = []string{genome.EnsemblCanonicalTag}
+	genes[0].Transcripts[1].Tags = []string{genome.ManeSelectTag}
+
+	tagged := openGenes(t, genes)
+
+	diff, err := genome.DiffGtfDBs(legacy, tagged)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.Genes) != 1 ||
+		diff.Genes[0].Old.Canonical != "ENST00000000001" ||
+		diff.Genes[0].New.Canonical != "ENST00000000002" {
+		t.Fatalf("diff = %+v", diff.Genes)
+	}
+
+	// without MANE Select, Ensembl canonical
+	genes[0].Transcripts[1].Tags = nil
+
+	diff, err = genome.DiffGtfDBs(legacy, openGenes(t, genes))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.Genes) != 1 || diff.Genes[0].New.Canonical != "ENST00000000003" {
+		t.Fatalf("diff = %+v", diff.Genes)
+	}
+}
@@ -0,0 +1,262 @@
+package genome
+
+import (
+	"slices"
+	"strings"
+
+	basemath "github.com/antonybholmes/go-sys/math"
+)
+
+//
+// Fuzzy searching of genes by name so that typos such as MYCC or BCL-6
+// still find MYC and BCL6. The names of the genes are held in memory
+// and matched by edit distance.
+//
+
+const (
+	FuzzySearchMode string = "fuzzy"
+
+	// matches are ranked exact > case insensitive > prefix > fuzzy
+	ExactMatchScore           float64 = 1
+	CaseInsensitiveMatchScore float64 = 0.9
+	PrefixMatchScore          float64 = 0.8
+	// the score of a fuzzy match is at most this and falls
+	// with the number of edits
+	FuzzyMatchScore float64 = 0.7
+)
+
+type (
+	geneName struct {
+		// row id of the gene
+		id     int
+		geneId string
+		symbol string
+		// set if the name is an alias of the gene
+		alias string
+		// set if the name is an xref of the gene, as db:xref
+		xref string
+	}
+
+	nameMatch struct {
+		geneName
+		score float64
+	}
+
+	nameIndex struct {
+		names []geneName
+		// lower case symbols or aliases so they are not made on
+		// each search
+		symbols []string
+	}
+)
+
+func newNameIndex(names []geneName) *nameIndex {
+	symbols := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if name.alias != "" {
+			symbols = append(symbols, strings.ToLower(name.alias))
+		} else {
+			symbols = append(symbols, strings.ToLower(name.symbol))
+		}
+	}
+
+	return &nameIndex{names: names, symbols: symbols}
+}
+
+// the n genes best matching search, best first, or all of them if n is
+// NoLimit. Genes with the same score are ordered by symbol, then gene id
+// as the database orders them. Each gene is matched once, by its best
+// name.
+func (index *nameIndex) search(search string, n int16) []nameMatch {
+	lower := strings.ToLower(search)
+
+	edits := maxEdits(lower)
+
+	// ids match with any version
+	id, _ := splitIdVersion(search)
+	lowerId := strings.ToLower(id)
+
+	ret := make([]nameMatch, 0, 10)
+
+	for i, name := range index.names {
+		var score float64
+
+		if name.alias != "" {
+			// aliases are not matched by prefix, which would find
+			// too many genes
+			score = symbolScore(name.alias, index.symbols[i], search, lower, edits, false)
+
+			if score > 0 {
+				score -= AliasMatchPenalty
+			}
+		} else {
+			score = max(idScore(name.geneId, id, lowerId),
+				symbolScore(name.symbol, index.symbols[i], search, lower, edits, true))
+		}
+
+		if score > 0 {
+			ret = append(ret, nameMatch{geneName: name, score: score})
+		}
+	}
+
+	slices.SortFunc(ret, func(a, b nameMatch) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+
+		if c := strings.Compare(a.symbol, b.symbol); c != 0 {
+			return c
+		}
+
+		if c := strings.Compare(a.geneId, b.geneId); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.alias, b.alias)
+	})
+
+	seen := make(map[int]bool, len(ret))
+
+	ret = slices.DeleteFunc(ret, func(match nameMatch) bool {
+		if seen[match.id] {
+			return true
+		}
+
+		seen[match.id] = true
+
+		return false
+	})
+
+	if n == NoLimit {
+		return ret
+	}
+
+	return ret[:min(len(ret), int(n))]
+}
+
+// ids are only matched in full since most ids are a single
+// edit from another
+func idScore(id string, search string, lower string) float64 {
+	switch {
+	case id == search:
+		return ExactMatchScore
+	case strings.EqualFold(id, lower):
+		return CaseInsensitiveMatchScore
+	default:
+		return 0
+	}
+}
+
+func symbolScore(symbol string, lowerSymbol string, search string, lower string, edits int, prefix bool) float64 {
+	switch {
+	case symbol == "":
+		return 0
+	case symbol == search:
+		return ExactMatchScore
+	case lowerSymbol == lower:
+		return CaseInsensitiveMatchScore
+	case prefix && strings.HasPrefix(lowerSymbol, lower):
+		// shorter symbols are closer to what was typed
+		return PrefixMatchScore - (CaseInsensitiveMatchScore-PrefixMatchScore)*(1-float64(len(lower))/float64(len(lowerSymbol)))
+	}
+
+	// cheap test before the edit distance
+	if basemath.AbsInt(len(lowerSymbol)-len(lower)) > edits {
+		return 0
+	}
+
+	d := damerauLevenshtein(lowerSymbol, lower)
+
+	if d > edits {
+		return 0
+	}
+
+	return FuzzyMatchScore * (1 - float64(d)/float64(max(len(lowerSymbol), len(lower))))
+}
+
+// short searches allow fewer typos or they match everything
+func maxEdits(search string) int {
+	switch {
+	case len(search) < 3:
+		return 0
+	case len(search) < 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// damerauLevenshtein returns the number of insertions, deletions,
+// substitutions and transpositions of adjacent characters needed to
+// turn a into b (the optimal string alignment distance)
+func damerauLevenshtein(a string, b string) int {
+	s := []rune(a)
+	t := []rune(b)
+
+	// three rows of the distance matrix are enough
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	row := make([]int, len(t)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		row[0] = i
+
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+
+			row[j] = min(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				row[j] = min(row[j], prev2[j-2]+1)
+			}
+		}
+
+		prev2, prev, row = prev, row, prev2
+	}
+
+	return prev[len(t)]
+}
+
+// rankMatches orders genes as their matches and sets their score
+// and the score of their children, and the alias that matched
+func rankMatches(features []*GenomicFeature, matches []nameMatch) []*GenomicFeature {
+	ranks := make(map[int]int, len(matches))
+
+	for i, match := range matches {
+		ranks[match.id] = i
+	}
+
+	slices.SortStableFunc(features, func(a, b *GenomicFeature) int {
+		return ranks[a.Id] - ranks[b.Id]
+	})
+
+	for _, feature := range features {
+		match := matches[ranks[feature.Id]]
+
+		setScore(feature, match.score)
+
+		feature.MatchedAlias = match.alias
+	}
+
+	return features
+}
+
+func setScore(feature *GenomicFeature, score float64) {
+	feature.Score = score
+
+	for _, child := range feature.Children {
+		setScore(child, score)
+	}
+}
@@ -0,0 +1,88 @@
+package genome
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDamerauLevenshtein(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"myc", "myc", 0},
+		{"mycc", "myc", 1},
+		{"bcl-6", "bcl6", 1},
+		{"tp53", "tp35", 1},
+		{"kmt2a", "mll", 4},
+		{"", "abc", 3},
+		{"ca", "abc", 3},
+	}
+
+	for _, test := range tests {
+		if got := damerauLevenshtein(test.a, test.b); got != test.want {
+			t.Errorf("damerauLevenshtein(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+
+		if got := damerauLevenshtein(test.b, test.a); got != test.want {
+			t.Errorf("damerauLevenshtein(%q, %q) = %d, want %d", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestNameIndexRanks(t *testing.T) {
+	index := newNameIndex([]geneName{{1, "ENSG1", "MYC", "", ""},
+		{2, "ENSG2", "MYCN", "", ""},
+		{3, "ENSG3", "MYCL", "", ""},
+		{4, "ENSG4", "myc", "", ""},
+		{5, "ENSG5", "BCL6", "", ""},
+		{6, "ENSG6", "MYCBP2", "", ""},
+		{7, "ENSG7", "KMT2A", "", ""},
+		{7, "ENSG7", "KMT2A", "MLL", ""},
+		{7, "ENSG7", "KMT2A", "MLL1", ""},
+		{8, "ENSG8", "MLLT1", "", ""}})
+
+	ids := func(matches []nameMatch) []int {
+		ret := make([]int, 0, len(matches))
+
+		for _, match := range matches {
+			ret = append(ret, match.id)
+		}
+
+		return ret
+	}
+
+	// exact, case insensitive, shorter prefix, longer prefix
+	if got := ids(index.search("MYC", 10)); !slices.Equal(got, []int{1, 4, 3, 2, 6}) {
+		t.Errorf("MYC = %v", got)
+	}
+
+	// one edit from MYC, MYCL, MYCN and myc, ties by symbol
+	matches := index.search("MYCC", 10)
+
+	if got := ids(matches); !slices.Equal(got, []int{1, 3, 2, 4}) || matches[0].score >= FuzzyMatchScore {
+		t.Errorf("MYCC = %v", matches)
+	}
+
+	if got := ids(index.search("BCL-6", 10)); !slices.Equal(got, []int{5}) {
+		t.Errorf("BCL-6 = %v", got)
+	}
+
+	if got := ids(index.search("ensg5", 10)); !slices.Equal(got, []int{5}) {
+		t.Errorf("ensg5 = %v", got)
+	}
+
+	// aliases rank below symbols of the same kind and are
+	// not matched by prefix
+	matches = index.search("MLL", 10)
+
+	if got := ids(matches); !slices.Equal(got, []int{7, 8}) ||
+		matches[0].alias != "MLL" || matches[0].score != ExactMatchScore-AliasMatchPenalty {
+		t.Errorf("MLL = %v", matches)
+	}
+
+	if got := ids(index.search("MYC", 2)); !slices.Equal(got, []int{1, 4}) {
+		t.Errorf("n = 2 gives %v", got)
+	}
+}
@@ -3,6 +3,7 @@ package genome
 import (
 	"database/sql"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/antonybholmes/go-dna"
@@ -24,12 +25,14 @@ const (
 		g.strand, 
 		g.gene_id, 
 		g.symbol,
+		COALESCE(g.official_gene_id, '') AS official_gene_id,
 		gt.name AS biotype
 	FROM genes as g
 	JOIN biotypes AS gt ON g.biotype_id = gt.id
 	JOIN chromosomes AS c ON g.chr_id = c.id
-	WHERE (g.symbol LIKE :symbol OR g.gene_id = :q)
-	ORDER BY g.symbol
+	WHERE <<MATCH>>
+		<<GENES>>
+	ORDER BY g.symbol, g.gene_id
 	LIMIT :n`
 
 	TranscriptInfoSql = `SELECT *
@@ -42,23 +45,29 @@ const (
 				g.strand, 
 				g.gene_id, 
 				g.symbol,
+				COALESCE(g.official_gene_id, '') AS official_gene_id,
 				gt.name AS biotype,
 				t.transcript_id,
 				t.start,
 				t.end,
 				t.is_canonical,
 				t.is_longest,
-				ROW_NUMBER() OVER (PARTITION BY g.gene_id ORDER BY g.gene_id) AS rank
+				tb.name AS transcript_biotype,
+				ROW_NUMBER() OVER (PARTITION BY g.gene_id ORDER BY t.transcript_id) AS rank
 			FROM genes as g
 			JOIN transcripts AS t ON g.id = t.gene_id
 			JOIN biotypes AS gt ON g.biotype_id = gt.id
+			JOIN biotypes AS tb ON t.biotype_id = tb.id
 			JOIN chromosomes AS c ON g.chr_id = c.id
-			WHERE (g.symbol LIKE :q OR g.gene_id LIKE :q OR t.transcript_id LIKE :q) 
-				<<CANONICAL>>
-			ORDER BY g.symbol
+			WHERE <<MATCH>>
+				<<GENES>>
+				<<TRANSCRIPTS>>
+			ORDER BY g.symbol, g.gene_id, t.transcript_id
 		) g
-		WHERE g.rank < :n`
+		WHERE :n < 0 OR g.rank <= :n`
 
+	// the unary + stops sqlite starting from every exon of the
+	// genome when the genes are matched by id
 	ExonInfoSql = `SELECT *
 		FROM(
 			SELECT DISTINCT
@@ -69,71 +78,297 @@ const (
 				g.strand, 
 				g.gene_id, 
 				g.symbol,
+				COALESCE(g.official_gene_id, '') AS official_gene_id,
 				gt.name AS biotype,
 				t.transcript_id,
 				t.start,
 				t.end,
 				t.is_canonical,
 				t.is_longest,
+				tb.name AS transcript_biotype,
 				e.exon_id,
-				e.start,
-				e.end,
+				f.start,
+				f.end,
 				e.exon_number,
-				ROW_NUMBER() OVER (PARTITION BY g.gene_id ORDER BY g.gene_id) AS rank
+				ROW_NUMBER() OVER (PARTITION BY g.gene_id ORDER BY t.transcript_id, f.start) AS rank
 			FROM genes as g
 			JOIN transcripts AS t ON g.id = t.gene_id
-			JOIN exons AS e ON e.transcript_id = t.id
+			JOIN features AS f ON f.transcript_id = t.id
+			JOIN feature_types AS ft ON f.feature_type_id = ft.id
+			JOIN exons AS e ON f.exon_id = e.id
 			JOIN biotypes AS gt ON g.biotype_id = gt.id
+			JOIN biotypes AS tb ON t.biotype_id = tb.id
 			JOIN chromosomes AS c ON g.chr_id = c.id
-			WHERE (g.symbol LIKE :q OR g.gene_id LIKE :q OR t.transcript_id LIKE :q OR e.exon_id LIKE :q) 
-				<<CANONICAL>>
-			ORDER BY g.symbol
+			WHERE <<MATCH>>
+				AND +ft.name = 'exon'
+				<<GENES>>
+				<<TRANSCRIPTS>>
+			ORDER BY g.symbol, g.gene_id, t.transcript_id, f.start
 		) g
-		WHERE g.rank < :n`
+		WHERE :n < 0 OR g.rank <= :n`
+
+	// what the info queries match on when searching by name,
+	// including the HGNC or MGI id of genes. Ensembl ids are
+	// matched on :id, the search without a version
+	GeneNameMatchSql       = `(g.symbol LIKE :symbol OR g.gene_id LIKE :id OR LOWER(g.official_gene_id) = :q)`
+	TranscriptNameMatchSql = `(g.symbol LIKE :q OR g.gene_id LIKE :id OR LOWER(g.official_gene_id) = :q OR t.transcript_id LIKE :id)`
+	ExonNameMatchSql       = `(g.symbol LIKE :q OR g.gene_id LIKE :id OR LOWER(g.official_gene_id) = :q OR t.transcript_id LIKE :id OR e.exon_id LIKE :id)`
+
+	// or on the genes found by a fuzzy search
+	GeneIdsMatchSql = `g.id IN (<<IDS>>)`
+
+	GeneNamesSql = `SELECT g.id, g.gene_id, g.symbol FROM genes AS g`
 )
 
 func (gdb *GtfDB) SearchByName(search string,
 	level string,
-	canonicalMode bool,
+	policy *TranscriptPolicy,
 	n int16) ([]*GenomicFeature, error) {
-	n = max(1, min(n, MaxGeneInfoResults))
+	return gdb.searchByName(search, level, policy, max(1, min(n, MaxGeneInfoResults)), nil)
+}
 
+// searchByName is SearchByName without a cap on n, which can be NoLimit,
+// and only finding the genes with row ids in genes unless genes is nil
+func (gdb *GtfDB) searchByName(search string,
+	level string,
+	policy *TranscriptPolicy,
+	n int16,
+	genes []int) ([]*GenomicFeature, error) {
 	//log.Debug().Msgf("SearchForGeneByName for gene %s level %s fuzzy %v canonical %v geneType %s n %d",
 	//	search, level, fuzzy, canonical, geneType, n)
 
 	// case insensitive search
 	search = strings.ToLower(search)
 
-	if len(search) < 2 || strings.Contains(search, "chr:") {
-		return nil, fmt.Errorf("%s is an invalid search term", search)
+	err := checkSearch(search)
+
+	if err != nil {
+		return nil, err
 	}
 
+	id, _ := splitIdVersion(search)
+
+	namedArgs := []any{sql.Named("q", search), sql.Named("id", id)}
+
+	var match string
+
 	switch level {
-	case "transcript":
-		return gdb.searchTranscripts(search,
-			canonicalMode,
-			false,
-			n)
-
-	case "exon":
-		return gdb.searchTranscripts(search,
-			canonicalMode,
-			true,
-			n)
+	case TranscriptLevel:
+		match = TranscriptNameMatchSql
+	case ExonLevel:
+		match = ExonNameMatchSql
 	default:
-		return gdb.searchGenes(search, n)
+		match = GeneNameMatchSql
+		namedArgs = append(namedArgs, sql.Named("symbol", search+"%"))
 	}
 
+	if genes != nil {
+		genesSql, genesArgs := geneIdsMatchSql(genes)
+
+		match += " AND " + genesSql
+		namedArgs = append(namedArgs, genesArgs...)
+	}
+
+	var ret []*GenomicFeature
+
+	switch level {
+	case TranscriptLevel:
+		ret, err = gdb.searchTranscripts(match, namedArgs, policy, false, n)
+	case ExonLevel:
+		ret, err = gdb.searchTranscripts(match, namedArgs, policy, true, n)
+	default:
+		ret, err = gdb.searchGenes(match, namedArgs, policy, n)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err = gdb.addAliasMatches(ret, search, level, policy, n, genes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, matchVersions(gdb.AddVersions, ret, search)
 }
 
-// Searching for exons or transcripts uses essentially
-// the same pipeline so combine into one method.
-func (gdb *GtfDB) searchTranscripts(search string,
-	canonicalMode bool,
-	exonMode bool,
+// FuzzySearchByName finds the n genes whose symbol, alias or id best match
+// search exactly, case insensitively, by prefix or with a few typos,
+// and returns them best first with the score of their match.
+func (gdb *GtfDB) FuzzySearchByName(search string,
+	level string,
+	policy *TranscriptPolicy,
 	n int16) ([]*GenomicFeature, error) {
 	n = max(1, min(n, MaxGeneInfoResults))
 
+	return gdb.fuzzySearchByName(search, level, policy, n, n, nil)
+}
+
+// fuzzySearchByName is FuzzySearchByName without a cap on n, which can
+// be NoLimit, with perGene limiting the transcripts or exons of each gene
+// separately and only finding the genes with row ids in genes unless
+// genes is nil
+func (gdb *GtfDB) fuzzySearchByName(search string,
+	level string,
+	policy *TranscriptPolicy,
+	n int16,
+	perGene int16,
+	genes []int) ([]*GenomicFeature, error) {
+	err := checkSearch(strings.ToLower(search))
+
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := gdb.geneNames()
+
+	if err != nil {
+		return nil, err
+	}
+
+	matches := names.search(search, n)
+
+	if genes != nil {
+		matches = slices.DeleteFunc(matches, func(match nameMatch) bool {
+			return !slices.Contains(genes, match.id)
+		})
+	}
+
+	if len(matches) == 0 {
+		return []*GenomicFeature{}, nil
+	}
+
+	ids := make([]int, 0, len(matches))
+
+	for _, match := range matches {
+		ids = append(ids, match.id)
+	}
+
+	ret, err := gdb.searchGeneIds(ids, level, policy, perGene)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rankMatches(ret, matches), matchVersions(gdb.AddVersions, ret, search)
+}
+
+// searchGeneIds finds genes by row id at a level. The ids are
+// queried in chunks so there can be any number of them.
+func (gdb *GtfDB) searchGeneIds(ids []int,
+	level string,
+	policy *TranscriptPolicy,
+	n int16) ([]*GenomicFeature, error) {
+	ret := make([]*GenomicFeature, 0, len(ids))
+
+	for chunk := range slices.Chunk(ids, MaxTagQueryIds) {
+		matchSql, namedArgs := geneIdsMatchSql(chunk)
+
+		var found []*GenomicFeature
+		var err error
+
+		switch level {
+		case TranscriptLevel:
+			found, err = gdb.searchTranscripts(matchSql, namedArgs, policy, false, n)
+		case ExonLevel:
+			found, err = gdb.searchTranscripts(matchSql, namedArgs, policy, true, n)
+		default:
+			found, err = gdb.searchGenes(matchSql, namedArgs, policy, n)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, found...)
+	}
+
+	return ret, nil
+}
+
+// the symbols, aliases and ids of all genes, loaded once
+func (gdb *GtfDB) geneNames() (*nameIndex, error) {
+	gdb.namesOnce.Do(func() {
+		rows, err := gdb.db.Query(GeneNamesSql)
+
+		if err != nil {
+			gdb.namesErr = err
+			return
+		}
+
+		defer rows.Close()
+
+		names := make([]geneName, 0, 60000)
+
+		for rows.Next() {
+			var name geneName
+
+			err := rows.Scan(&name.id, &name.geneId, &name.symbol)
+
+			if err != nil {
+				gdb.namesErr = err
+				return
+			}
+
+			names = append(names, name)
+		}
+
+		gdb.namesErr = rows.Err()
+
+		if gdb.namesErr != nil || !gdb.hasGeneAliases() {
+			gdb.names = newNameIndex(names)
+			return
+		}
+
+		aliasRows, err := gdb.db.Query(AllGeneAliasesSql)
+
+		if err != nil {
+			gdb.namesErr = err
+			return
+		}
+
+		defer aliasRows.Close()
+
+		for aliasRows.Next() {
+			var name geneName
+
+			err := aliasRows.Scan(&name.id, &name.geneId, &name.symbol, &name.alias)
+
+			if err != nil {
+				gdb.namesErr = err
+				return
+			}
+
+			names = append(names, name)
+		}
+
+		gdb.names = newNameIndex(names)
+		gdb.namesErr = aliasRows.Err()
+	})
+
+	return gdb.names, gdb.namesErr
+}
+
+// checkSearch rejects terms too short to search on or that
+// look like locations
+func checkSearch(search string) error {
+	if len(search) < 2 || strings.Contains(search, "chr:") {
+		return fmt.Errorf("%s is an invalid search term", search)
+	}
+
+	return nil
+}
+
+// Searching for exons or transcripts uses essentially
+// the same pipeline so combine into one method. Rows
+// are matched by match, an sql condition using namedArgs,
+// and limited to n per gene unless n is NoLimit.
+func (gdb *GtfDB) searchTranscripts(match string,
+	namedArgs []any,
+	policy *TranscriptPolicy,
+	exonMode bool,
+	n int16) ([]*GenomicFeature, error) {
 	var sqlStmt string
 
 	if exonMode {
@@ -142,17 +377,19 @@ func (gdb *GtfDB) searchTranscripts(search string,
 		sqlStmt = TranscriptInfoSql
 	}
 
-	if canonicalMode {
-		sqlStmt = strings.Replace(sqlStmt, "<<CANONICAL>>", "AND t.is_canonical = 1", 1)
-	} else {
-		sqlStmt = strings.Replace(sqlStmt, "<<CANONICAL>>", "", 1)
+	sqlStmt = strings.Replace(sqlStmt, "<<MATCH>>", match, 1)
+
+	namedArgs = append(slices.Clip(namedArgs), sql.Named("n", n))
+
+	sqlStmt, err := gdb.makeTranscriptPolicySql(sqlStmt, policy, &namedArgs)
+
+	if err != nil {
+		return nil, err
 	}
 
 	//log.Debug().Msgf("SQL: %s %s %d", sqlStmt, search, n)
 
-	rows, err := gdb.db.Query(sqlStmt,
-		sql.Named("q", search),
-		sql.Named("n", n))
+	rows, err := gdb.db.Query(sqlStmt, namedArgs...)
 
 	if err != nil {
 		return nil, err //fmt.Errorf("there was an error with the database query")
@@ -160,24 +397,34 @@ func (gdb *GtfDB) searchTranscripts(search string,
 
 	defer rows.Close()
 
+	var ret []*GenomicFeature
+
 	if exonMode {
-		return exonsToGeneInfoRecords(rows, canonicalMode)
+		ret, err = exonsToGeneInfoRecords(rows)
 	} else {
-		return transcriptsToGeneInfoRecords(rows, canonicalMode)
+		ret, err = transcriptsToGeneInfoRecords(rows)
+	}
+
+	if err != nil {
+		return nil, err
 	}
 
+	return ret, gdb.addTranscriptTags(ret)
+
 }
 
-func (gdb *GtfDB) searchGenes(search string,
+// the first n genes matching match, or all of them if n is NoLimit
+func (gdb *GtfDB) searchGenes(match string,
+	namedArgs []any,
+	policy *TranscriptPolicy,
 	n int16) ([]*GenomicFeature, error) {
-	n = max(1, min(n, MaxGeneInfoResults))
+	namedArgs = append(slices.Clip(namedArgs), sql.Named("n", n))
+
+	query := MakeGeneBiotypeSql(strings.Replace(GeneInfoSql, "<<MATCH>>", match, 1), policy, &namedArgs)
 
-	log.Debug().Msgf("searching for gene: %s, n: %d, SQL: %s", search, n, GeneInfoSql)
+	log.Debug().Msgf("searching for genes, n: %d, SQL: %s", n, query)
 
-	rows, err := gdb.db.Query(GeneInfoSql,
-		sql.Named("q", search),
-		sql.Named("symbol", search+"%"),
-		sql.Named("n", n))
+	rows, err := gdb.db.Query(query, namedArgs...)
 
 	if err != nil {
 		return nil, err //fmt.Errorf("there was an error with the database query")
@@ -203,6 +450,7 @@ func genesToGeneInfoRecords(rows *sql.Rows) ([]*GenomicFeature, error) {
 	var strand string
 	var geneSymbol string
 	var geneId string
+	var officialId string
 	var geneType string
 
 	// 10 seems a reasonable guess for the number of features we might see, just
@@ -219,6 +467,7 @@ func genesToGeneInfoRecords(rows *sql.Rows) ([]*GenomicFeature, error) {
 			&strand,
 			&geneId,
 			&geneSymbol,
+			&officialId,
 			&geneType,
 		)
 
@@ -243,7 +492,8 @@ func genesToGeneInfoRecords(rows *sql.Rows) ([]*GenomicFeature, error) {
 			Symbol:   geneSymbol,
 			GeneId:   geneId,
 			//Strand:   strand,
-			Biotype: geneType,
+			OfficialId: officialId,
+			Biotype:    geneType,
 			//Children: make([]*GenomicFeature, 0, 10)
 		}
 
@@ -257,7 +507,7 @@ func genesToGeneInfoRecords(rows *sql.Rows) ([]*GenomicFeature, error) {
 }
 
 // complete records for genes -> transcripts -> exons
-func transcriptsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*GenomicFeature, error) {
+func transcriptsToGeneInfoRecords(rows *sql.Rows) ([]*GenomicFeature, error) {
 	var gid int
 	var chr string
 	var geneStart int
@@ -265,6 +515,7 @@ func transcriptsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*Genomi
 	var strand string
 	var geneSymbol string
 	var geneId string
+	var officialId string
 	var biotype string
 
 	var transcriptId string
@@ -274,6 +525,7 @@ func transcriptsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*Genomi
 
 	var isCanonical bool
 	var isLongest bool
+	var transcriptBiotype string
 
 	var rank int
 
@@ -294,12 +546,14 @@ func transcriptsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*Genomi
 			&strand,
 			&geneId,
 			&geneSymbol,
+			&officialId,
 			&biotype,
 			&transcriptId,
 			&transcriptStart,
 			&transcriptEnd,
 			&isCanonical,
 			&isLongest,
+			&transcriptBiotype,
 			&rank,
 		)
 
@@ -324,7 +578,8 @@ func transcriptsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*Genomi
 				Symbol:   geneSymbol,
 				GeneId:   geneId,
 				//Strand:   strand,
-				Biotype: biotype,
+				OfficialId: officialId,
+				Biotype:    biotype,
 				//Children: make([]*GenomicFeature, 0, 10)
 			}
 
@@ -339,11 +594,9 @@ func transcriptsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*Genomi
 
 		}
 
-		//if canonical mode only add if transcript is canonical
-		// also only add if we have a current gene
-		// also only add if we don't already have this transcript
-		if (currentTranscript == nil || currentTranscript.Transcript != transcriptId) &&
-			(!canonicalMode || isCanonical) {
+		// only add if we don't already have this transcript. Transcripts
+		// not chosen by a transcript policy are filtered out in sql
+		if currentTranscript == nil || currentTranscript.Transcript != transcriptId {
 
 			location, err := dna.NewStrandedLocation(chr, transcriptStart, transcriptEnd, strand)
 
@@ -361,7 +614,7 @@ func transcriptsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*Genomi
 				Transcript:  transcriptId,
 				IsCanonical: isCanonical,
 				IsLongest:   isLongest,
-				//Biotype:      transcriptType,
+				Biotype:     transcriptBiotype,
 				//Children: make([]*GenomicFeature, 0, 10)
 			}
 
@@ -383,7 +636,7 @@ func transcriptsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*Genomi
 }
 
 // complete records for genes -> transcripts -> exons
-func exonsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*GenomicFeature, error) {
+func exonsToGeneInfoRecords(rows *sql.Rows) ([]*GenomicFeature, error) {
 	var gid int
 	var chr string
 	var geneStart int
@@ -391,6 +644,7 @@ func exonsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*GenomicFeatu
 	var strand string
 	var geneSymbol string
 	var geneId string
+	var officialId string
 	var biotype string
 
 	var transcriptId string
@@ -400,6 +654,7 @@ func exonsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*GenomicFeatu
 
 	var isCanonical bool
 	var isLongest bool
+	var transcriptBiotype string
 
 	var exonId string
 	var exonStart int
@@ -426,12 +681,14 @@ func exonsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*GenomicFeatu
 			&strand,
 			&geneId,
 			&geneSymbol,
+			&officialId,
 			&biotype,
 			&transcriptId,
 			&transcriptStart,
 			&transcriptEnd,
 			&isCanonical,
 			&isLongest,
+			&transcriptBiotype,
 			&exonId,
 			&exonStart,
 			&exonEnd,
@@ -460,7 +717,8 @@ func exonsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*GenomicFeatu
 				Symbol:   geneSymbol,
 				GeneId:   geneId,
 				//Strand:   strand,
-				Biotype: biotype,
+				OfficialId: officialId,
+				Biotype:    biotype,
 				//Children: make([]*GenomicFeature, 0, 10)
 			}
 
@@ -475,11 +733,9 @@ func exonsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*GenomicFeatu
 
 		}
 
-		//if canonical mode only add if transcript is canonical
-		// also only add if we have a current gene
-		// also only add if we don't already have this transcript
-		if (currentTranscript == nil || currentTranscript.Transcript != transcriptId) &&
-			(!canonicalMode || isCanonical) {
+		// only add if we don't already have this transcript. Transcripts
+		// not chosen by a transcript policy are filtered out in sql
+		if currentTranscript == nil || currentTranscript.Transcript != transcriptId {
 
 			location, err := dna.NewStrandedLocation(chr, transcriptStart, transcriptEnd, strand)
 
@@ -497,7 +753,7 @@ func exonsToGeneInfoRecords(rows *sql.Rows, canonicalMode bool) ([]*GenomicFeatu
 				Transcript:  transcriptId,
 				IsCanonical: isCanonical,
 				IsLongest:   isLongest,
-				//Biotype:      transcriptType,
+				Biotype:     transcriptBiotype,
 				//Children: make([]*GenomicFeature, 0, 10)
 			}
 
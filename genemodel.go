@@ -0,0 +1,283 @@
+package genome
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/antonybholmes/go-dna"
+)
+
+//
+// Collapsed gene models, i.e. the union of the exons of all
+// transcripts of a gene, for read counting and coverage plots
+//
+
+const (
+	ConstitutiveLabel string = "constitutive"
+	AlternativeLabel  string = "alternative"
+
+	// all exons of all transcripts of a gene, ordered by
+	// transcript so rowsToRecords can build the transcripts. The unary +
+	// stops sqlite starting from every exon of the genome
+	GeneModelSql = BasicLocationSql +
+		` WHERE
+			LOWER(g.gene_id) = LOWER(:geneId) AND +ft.name = 'exon'
+		ORDER BY
+			g.gene_id,
+			t.transcript_id,
+			f.start,
+			f.end`
+
+	// the exons of several genes by row id, as GeneModelSql
+	GeneModelsSql = BasicLocationSql +
+		` WHERE
+			g.id IN (<<IDS>>) AND +ft.name = 'exon'
+		ORDER BY
+			g.gene_id,
+			t.transcript_id,
+			f.start,
+			f.end`
+
+	// max genes in a single IN query to keep under the sqlite
+	// variable limit
+	MaxGeneModelIds int = 500
+)
+
+// CollapsedGeneModel returns a gene whose children are the merged exonic
+// intervals of all of its transcripts, numbered 5' to 3'. Each interval is
+// flagged as constitutive if every transcript has an exon overlapping it.
+// The gene records the total exonic length. The gene id can have any
+// version.
+func (gdb *GtfDB) CollapsedGeneModel(geneId string) (*GenomicFeature, error) {
+	id, _ := splitIdVersion(geneId)
+
+	rows, err := gdb.db.Query(GeneModelSql, sql.Named("geneId", id))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	genes, err := rowsToRecords(rows, "gene,transcript,exon", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(genes) == 0 {
+		return nil, fmt.Errorf("gene %s not found", geneId)
+	}
+
+	gene := genes[0]
+
+	err = CollapseGene(gene)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gene, matchVersions(gdb.AddVersions, genes, geneId)
+}
+
+// the uncollapsed models of genes by row id, with one query per chunk
+// of ids
+func (gdb *GtfDB) geneModels(ids []int) ([]*GenomicFeature, error) {
+	ret := make([]*GenomicFeature, 0, len(ids))
+
+	for chunk := range slices.Chunk(ids, MaxGeneModelIds) {
+		query, namedArgs := inSql(GeneModelsSql, "g", chunk)
+
+		genes, err := gdb.geneModelRecords(query, namedArgs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, genes...)
+	}
+
+	return ret, nil
+}
+
+func (gdb *GtfDB) geneModelRecords(query string, namedArgs []any) ([]*GenomicFeature, error) {
+	rows, err := gdb.db.Query(query, namedArgs...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return rowsToRecords(rows, "gene,transcript,exon", false)
+}
+
+// CollapseGene replaces the transcript children of a gene with the union
+// of their exons. The gene must have been loaded with transcript and exon
+// levels.
+func CollapseGene(gene *GenomicFeature) error {
+	transcripts := make([]*GenomicFeature, 0, len(gene.Children))
+	exons := make([]*GenomicFeature, 0, 20)
+
+	for _, child := range gene.Children {
+		if child.Type != TranscriptLevel {
+			continue
+		}
+
+		transcripts = append(transcripts, child)
+
+		for _, exon := range child.Children {
+			if exon.Type == ExonLevel {
+				exons = append(exons, exon)
+			}
+		}
+	}
+
+	slices.SortFunc(exons, func(a, b *GenomicFeature) int {
+		if a.Location.Start() != b.Location.Start() {
+			return a.Location.Start() - b.Location.Start()
+		}
+
+		return a.Location.End() - b.Location.End()
+	})
+
+	chr := gene.Location.Chr()
+	strand := gene.Location.Strand()
+
+	collapsed := make([]*GenomicFeature, 0, len(exons))
+
+	exonicLength := 0
+
+	for i := 0; i < len(exons); {
+		start := exons[i].Location.Start()
+		end := exons[i].Location.End()
+
+		// keep extending whilst the next exon overlaps or abuts
+		// the current interval
+		j := i + 1
+
+		for j < len(exons) && exons[j].Location.Start() <= end+1 {
+			end = max(end, exons[j].Location.End())
+			j++
+		}
+
+		location, err := dna.NewStrandedLocation(chr, start, end, strand)
+
+		if err != nil {
+			return err
+		}
+
+		// constitutive if every transcript contributes to the interval
+		isConstitutive := len(transcripts) > 0
+
+		for _, transcript := range transcripts {
+			if !hasExonOverlapping(transcript, start, end) {
+				isConstitutive = false
+				break
+			}
+		}
+
+		label := AlternativeLabel
+
+		if isConstitutive {
+			label = ConstitutiveLabel
+		}
+
+		collapsed = append(collapsed, &GenomicFeature{Id: gene.Id,
+			Location:       location,
+			Type:           ExonLevel,
+			Label:          label,
+			Symbol:         gene.Symbol,
+			GeneId:         gene.GeneId,
+			IsConstitutive: isConstitutive,
+		})
+
+		exonicLength += end - start + 1
+
+		i = j
+	}
+
+	// number exons in the direction of transcription
+	for i, exon := range collapsed {
+		if strand == "-" {
+			exon.ExonNumber = len(collapsed) - i
+		} else {
+			exon.ExonNumber = i + 1
+		}
+	}
+
+	gene.Children = collapsed
+	gene.ExonicLength = exonicLength
+
+	return nil
+}
+
+func hasExonOverlapping(transcript *GenomicFeature, start int, end int) bool {
+	for _, exon := range transcript.Children {
+		if exon.Type == ExonLevel && exon.Location.Start() <= end && exon.Location.End() >= start {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collapse the genes found in an overlap query. The full models
+// are loaded, all at once, because the overlap query only returns
+// transcripts that overlap the location.
+func collapseGenes(features []*GenomicFeature, geneModels func(ids []int) ([]*GenomicFeature, error)) ([]*GenomicFeature, error) {
+	ids := make([]int, 0, len(features))
+
+	for _, feature := range features {
+		if feature.Type == GeneLevel {
+			ids = append(ids, feature.Id)
+		}
+	}
+
+	slices.Sort(ids)
+
+	models, err := geneModels(slices.Compact(ids))
+
+	if err != nil {
+		return nil, err
+	}
+
+	genes := make(map[int]*GenomicFeature, len(models))
+
+	for _, model := range models {
+		err := CollapseGene(model)
+
+		if err != nil {
+			return nil, err
+		}
+
+		genes[model.Id] = model
+	}
+
+	ret := make([]*GenomicFeature, 0, len(ids))
+
+	for _, feature := range features {
+		if feature.Type != GeneLevel {
+			continue
+		}
+
+		gene, ok := genes[feature.Id]
+
+		if !ok {
+			return nil, fmt.Errorf("gene %s has no exons", feature.GeneId)
+		}
+
+		// keep anything we learned about the gene relative to
+		// the location
+		gene.Label = feature.Label
+		gene.TssDist = feature.TssDist
+		gene.InPromoter = feature.InPromoter
+		gene.InExon = feature.InExon
+		gene.IsIntragenic = feature.IsIntragenic
+
+		ret = append(ret, gene)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,149 @@
+package genome_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+// a gene of the given strand whose transcripts have the given exons
+func modelGene(t *testing.T, strand string, transcripts ...[][2]int) *genome.GenomicFeature {
+	t.Helper()
+
+	stranded := func(start int, end int) *dna.Location {
+		loc, err := dna.NewStrandedLocation("chr1", start, end, strand)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return loc
+	}
+
+	gene := &genome.GenomicFeature{Type: genome.GeneLevel, GeneId: "ENSG1", Symbol: "GENE1", Location: stranded(1, 1000)}
+
+	for ti, exons := range transcripts {
+		transcript := &genome.GenomicFeature{Type: genome.TranscriptLevel, Transcript: fmt.Sprintf("ENST%d", ti+1)}
+
+		for _, exon := range exons {
+			transcript.Children = append(transcript.Children, &genome.GenomicFeature{Type: genome.ExonLevel,
+				Location: stranded(exon[0], exon[1])})
+		}
+
+		gene.Children = append(gene.Children, transcript)
+	}
+
+	return gene
+}
+
+func TestCollapseGene(t *testing.T) {
+	// exons that partly overlap (100-200, 150-250, 120-180), abut
+	// (300-400, 401-450) or are in one transcript only (800-900)
+	transcripts := [][][2]int{{{100, 200}, {300, 400}, {600, 700}},
+		{{150, 250}, {401, 450}, {600, 650}},
+		{{120, 180}, {800, 900}}}
+
+	for _, strand := range []string{"+", "-"} {
+		gene := modelGene(t, strand, transcripts...)
+
+		err := genome.CollapseGene(gene)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"chr1:100-250 constitutive 1",
+			"chr1:300-450 alternative 2",
+			"chr1:600-700 alternative 3",
+			"chr1:800-900 alternative 4"}
+
+		if strand == "-" {
+			want = []string{"chr1:100-250 constitutive 4",
+				"chr1:300-450 alternative 3",
+				"chr1:600-700 alternative 2",
+				"chr1:800-900 alternative 1"}
+		}
+
+		got := make([]string, 0, len(gene.Children))
+
+		for _, exon := range gene.Children {
+			if exon.Type != genome.ExonLevel || exon.IsConstitutive != (exon.Label == genome.ConstitutiveLabel) {
+				t.Errorf("%s: bad exon %+v", strand, exon)
+			}
+
+			got = append(got, fmt.Sprintf("%s %s %d", exon.Location, exon.Label, exon.ExonNumber))
+		}
+
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: collapsed = %v, want %v", strand, got, want)
+		}
+
+		// 151 + 151 + 101 + 101
+		if gene.ExonicLength != 504 {
+			t.Errorf("%s: exonic length = %d", strand, gene.ExonicLength)
+		}
+	}
+
+	// the exons of a single transcript are all constitutive
+	gene := modelGene(t, "+", [][2]int{{100, 200}, {300, 400}})
+
+	err := genome.CollapseGene(gene)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gene.Children) != 2 || !gene.Children[0].IsConstitutive || !gene.Children[1].IsConstitutive || gene.ExonicLength != 202 {
+		t.Errorf("single transcript = %+v", gene.Children)
+	}
+}
+
+// the collapsed exons of a gene as location, label and number
+func collapsedExons(gene *genome.GenomicFeature) []string {
+	ret := make([]string, 0, len(gene.Children))
+
+	for _, exon := range gene.Children {
+		ret = append(ret, fmt.Sprintf("%s %s %d", exon.Location, exon.Label, exon.ExonNumber))
+	}
+
+	return ret
+}
+
+func TestCollapsedOverlapMatchesGeneModels(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	for _, tc := range []struct {
+		loc   *dna.Location
+		genes int
+	}{{location(t, "chr1", 1, 40000), 4},
+		// only the first exon of GENEA and the last of GENEB, which
+		// must still be collapsed with all their exons
+		{location(t, "chr1", 1001, 1100), 1},
+		{location(t, "chr1", 11500, 11600), 1}} {
+		genes, err := gdb.OverlappingGenes(tc.loc, genome.CollapsedLevel, dna.DefaultPromoterRegion(), nil, false)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(genes) != tc.genes {
+			t.Fatalf("%s: got %d collapsed genes, want %d", tc.loc, len(genes), tc.genes)
+		}
+
+		for _, gene := range genes {
+			model, err := gdb.CollapsedGeneModel(gene.GeneId)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := collapsedExons(gene), collapsedExons(model); !slices.Equal(got, want) || gene.ExonicLength != model.ExonicLength {
+				t.Errorf("%s: overlap = %v, model = %v", gene.Symbol, got, want)
+			}
+		}
+	}
+}
@@ -1,54 +1,629 @@
 package genome_test
 
-// func TestWithin(t *testing.T) {
-// 	fmt.Println("Within")
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
 
-// 	//file := fmt.Sprintf("../data/gene/%s.db", "grch38")
-// 	db := genome.NewGtfDB("grch38", "../data/gene/")
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
 
-// 	defer db.Close()
+// write an annotation to a temporary database and open it
+func openAnnotation(t *testing.T, annotation *genometest.Annotation) *genome.GtfDB {
+	t.Helper()
 
-// 	location, err := dna.NewLocation("chr3", 187721370, 187733550)
+	dir := t.TempDir()
 
-// 	if err != nil {
-// 		fmt.Println(err)
-// 		return
-// 	}
+	err := genometest.WriteGtfDB(filepath.Join(dir, annotation.File), annotation)
 
-// 	records, err := db.WithinGenes(location, genome.GeneLevel, dna.DefaultPromoterRegion())
+	if err != nil {
+		t.Fatal(err)
+	}
 
-// 	if err != nil {
-// 		fmt.Println(err)
-// 		return
-// 	}
+	gdb := genome.NewGtfDB(dir, &genome.Annotation{PublicId: annotation.PublicId,
+		Genome:   genometest.Genome,
+		Assembly: genometest.Assembly,
+		Name:     annotation.Name,
+		Url:      annotation.File})
 
-// 	b, _ := json.Marshal(&records)
-// 	fmt.Printf("%s", string(b))
-// }
+	t.Cleanup(func() { gdb.Close() })
 
-// func TestClosest(t *testing.T) {
-// 	fmt.Println("Closest")
+	return gdb
+}
 
-// 	//file := fmt.Sprintf("../data/gene/%s.db", "grch38")
+// open a database of some genes
+func openGenes(t *testing.T, genes []*genometest.Gene) *genome.GtfDB {
+	t.Helper()
 
-// 	db := genome.NewGtfDB("grch38", "../data/gene/")
+	return openAnnotation(t, &genometest.Annotation{PublicId: "test-gtf",
+		Name:  "GENCODE test",
+		File:  "gtf.test.db",
+		Genes: genes})
+}
 
-// 	defer db.Close()
+// open an annotation of a freshly built fixture through the catalog
+func openGtf(t *testing.T, id string) *genome.GtfDB {
+	t.Helper()
 
-// 	location, err := dna.NewLocation("chr3", 187721377, 187745725)
+	fixture := genometest.New(t)
 
-// 	if err != nil {
-// 		fmt.Println(err)
-// 		return
-// 	}
+	gdb, err := genome.NewGenomeDB(fixture.Catalog).GtfFromId(id)
 
-// 	records, err := db.ClosestGenes(location, dna.DefaultPromoterRegion(), 10)
+	if err != nil {
+		t.Fatalf("opening %s: %v", id, err)
+	}
 
-// 	if err != nil {
-// 		fmt.Println(err)
-// 		return
-// 	}
+	t.Cleanup(func() { gdb.Close() })
 
-// 	b, _ := json.Marshal(&records)
-// 	fmt.Printf("%s", string(b))
-// }
+	return gdb
+}
+
+func location(t *testing.T, chr string, start int, end int) *dna.Location {
+	t.Helper()
+
+	loc, err := dna.NewLocation(chr, start, end)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loc
+}
+
+func symbols(features []*genome.GenomicFeature) []string {
+	ret := make([]string, 0, len(features))
+
+	for _, feature := range features {
+		ret = append(ret, feature.Symbol)
+	}
+
+	return ret
+}
+
+func transcriptIds(features []*genome.GenomicFeature) []string {
+	ret := make([]string, 0, len(features))
+
+	for _, feature := range features {
+		ret = append(ret, feature.Transcript)
+	}
+
+	return ret
+}
+
+func TestOverlappingGenes(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	genes, err := gdb.OverlappingGenes(location(t, "chr1", 1500, 2100),
+		genome.GeneAndTranscriptLevels,
+		dna.DefaultPromoterRegion(),
+		nil,
+		false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENEA"}) {
+		t.Fatalf("genes = %v, want [GENEA]", got)
+	}
+
+	gene := genes[0]
+
+	if gene.Location.Start() != 1001 || gene.Location.End() != 5000 || gene.Location.Strand() != "+" {
+		t.Errorf("gene location = %v %s", gene.Location, gene.Location.Strand())
+	}
+
+	if got := transcriptIds(gene.Children); !slices.Equal(got, []string{"ENST00000000001", "ENST00000000002"}) {
+		t.Fatalf("transcripts = %v", got)
+	}
+
+	canonical := gene.Children[0]
+
+	if !canonical.IsCanonical || !canonical.IsLongest || canonical.Biotype != "protein_coding" {
+		t.Errorf("canonical transcript = %+v", canonical)
+	}
+
+	if !slices.Contains(canonical.Tags, genome.ManeSelectTag) || canonical.Tsl != 1 {
+		t.Errorf("canonical tags = %v tsl = %d", canonical.Tags, canonical.Tsl)
+	}
+
+	if gene.Children[1].Biotype != "nonsense_mediated_decay" {
+		t.Errorf("transcript biotype = %s", gene.Children[1].Biotype)
+	}
+}
+
+func TestOverlappingGenesExons(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	genes, err := gdb.OverlappingGenes(location(t, "chr1", 8000, 12000),
+		genome.AllLevels,
+		dna.DefaultPromoterRegion(),
+		genome.CanonicalPolicy,
+		false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || len(genes[0].Children) != 1 {
+		t.Fatalf("want GENEB with one transcript, got %v", symbols(genes))
+	}
+
+	transcript := genes[0].Children[0]
+
+	exons := make([]*genome.GenomicFeature, 0, 3)
+	cds := 0
+
+	for _, feature := range transcript.Children {
+		switch feature.Type {
+		case genome.ExonLevel:
+			exons = append(exons, feature)
+		case genome.CdsFeature:
+			cds++
+		}
+	}
+
+	if len(exons) != 3 || cds != 3 {
+		t.Fatalf("exons = %d cds = %d, want 3 and 3", len(exons), cds)
+	}
+
+	// exons are numbered 5' to 3' so on the minus strand the
+	// rightmost exon is first
+	for _, exon := range exons {
+		if exon.Location.Start() == 11001 && exon.ExonNumber != 1 {
+			t.Errorf("exon %v number = %d, want 1", exon.Location, exon.ExonNumber)
+		}
+	}
+}
+
+func TestOverlappingGenesFilters(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	loc := location(t, "chr1", 19000, 21000)
+
+	genes, err := gdb.OverlappingGenes(loc, genome.GeneLevel, dna.DefaultPromoterRegion(), nil, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || genes[0].Biotype != "lncRNA" {
+		t.Fatalf("want the lncRNA, got %v", symbols(genes))
+	}
+
+	proteinCoding, err := (*genome.TranscriptPolicy)(nil).WithGeneBiotypes([]string{"protein_coding"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genes, err = gdb.OverlappingGenes(loc, genome.GeneLevel, dna.DefaultPromoterRegion(), proteinCoding, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 0 {
+		t.Errorf("protein coding filter returned %v", symbols(genes))
+	}
+
+	excludeNmd, err := (*genome.TranscriptPolicy)(nil).WithBiotypes(nil, []string{"nonsense_mediated_decay"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genes, err = gdb.OverlappingGenes(location(t, "chr1", 1001, 5000),
+		genome.GeneAndTranscriptLevels,
+		dna.DefaultPromoterRegion(),
+		excludeNmd,
+		false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := transcriptIds(genes[0].Children); !slices.Equal(got, []string{"ENST00000000001"}) {
+		t.Errorf("transcripts excluding nmd = %v", got)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	results, err := gdb.WithinGenes(location(t, "chr1", 2001, 2100), genome.GeneLevel, dna.DefaultPromoterRegion())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(results.Features); !slices.Contains(got, "GENEA") {
+		t.Errorf("within genes = %v", got)
+	}
+
+	results, err = gdb.WithinGenes(location(t, "chr2", 100, 200), genome.GeneLevel, dna.DefaultPromoterRegion())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results.Features) != 0 {
+		t.Errorf("intergenic location is within %v", symbols(results.Features))
+	}
+}
+
+func TestClosest(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	loc := location(t, "chr1", 6000, 6001)
+
+	// the retained intron transcript of GENEB has its TSS at 9200,
+	// closer than that of GENEA at 1001
+	genes, err := gdb.ClosestGenes(loc, dna.DefaultPromoterRegion(), 2, nil, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENEB", "GENEA"}) {
+		t.Fatalf("closest genes = %v", got)
+	}
+
+	if genes[0].TssDist != 6000-9200 || genes[1].TssDist != 6000-1001 {
+		t.Errorf("tss distances = %d %d", genes[0].TssDist, genes[1].TssDist)
+	}
+
+	// only using canonical transcripts, GENEB's TSS is at 12000
+	genes, err = gdb.ClosestGenes(loc, dna.DefaultPromoterRegion(), 2, genome.CanonicalPolicy, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENEA", "GENEB"}) {
+		t.Errorf("closest canonical genes = %v", got)
+	}
+}
+
+func TestClosestOfficialGenes(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	loc := location(t, "chr1", 20500, 20500)
+
+	genes, err := gdb.ClosestGenes(loc, dna.DefaultPromoterRegion(), 1, nil, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"ENSG00000000003"}) {
+		t.Errorf("closest gene = %v", got)
+	}
+
+	// genes without an official id are skipped
+	genes, err = gdb.ClosestGenes(loc, dna.DefaultPromoterRegion(), 1, nil, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENEB"}) {
+		t.Errorf("closest official gene = %v", got)
+	}
+}
+
+func TestSearchByName(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	genes, err := gdb.SearchByName("gene", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENEA", "GENEB", "GENED", "GENEE"}) {
+		t.Errorf("genes = %v", got)
+	}
+
+	genes, err = gdb.SearchByName("ENSG00000000004", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENED"}) {
+		t.Errorf("genes by id = %v", got)
+	}
+
+	genes, err = gdb.SearchByName("genea", genome.TranscriptLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || len(genes[0].Children) != 2 {
+		t.Fatalf("want GENEA with 2 transcripts, got %v", symbols(genes))
+	}
+
+	genes, err = gdb.SearchByName("genea", genome.TranscriptLevel, policy(t, "mane"), 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := transcriptIds(genes[0].Children); !slices.Equal(got, []string{"ENST00000000001"}) {
+		t.Errorf("mane transcripts = %v", got)
+	}
+
+	genes, err = gdb.SearchByName("ENST00000000003", genome.ExonLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || len(genes[0].Children) != 1 || len(genes[0].Children[0].Children) != 3 {
+		t.Errorf("want one transcript with 3 exons for %v", symbols(genes))
+	}
+
+	if _, err := gdb.SearchByName("g", genome.GeneLevel, nil, 10); err == nil {
+		t.Error("short search was accepted")
+	}
+}
+
+func TestFuzzySearchByName(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	// one transposition from GENEA and one substitution from GENEE
+	genes, err := gdb.FuzzySearchByName("GENAE", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENEA", "GENEE"}) {
+		t.Errorf("fuzzy genes = %v", got)
+	}
+
+	// exact matches rank above fuzzy ones
+	genes, err = gdb.FuzzySearchByName("GENED", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENED", "GENEA", "GENEB", "GENEE"}) {
+		t.Fatalf("ranked genes = %v", got)
+	}
+
+	if genes[0].Score != genome.ExactMatchScore || genes[1].Score >= genome.FuzzyMatchScore {
+		t.Errorf("scores %v %v", genes[0].Score, genes[1].Score)
+	}
+
+	genes, err = gdb.FuzzySearchByName("gened", genome.GeneLevel, nil, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || genes[0].Score != genome.CaseInsensitiveMatchScore {
+		t.Errorf("case insensitive match %v", symbols(genes))
+	}
+
+	// transcripts carry the score of their gene
+	genes, err = gdb.FuzzySearchByName("GENAE", genome.TranscriptLevel, policy(t, "mane"), 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) == 0 || genes[0].Symbol != "GENEA" || len(genes[0].Children) != 1 ||
+		genes[0].Children[0].Score != genes[0].Score {
+		t.Errorf("fuzzy transcripts of %v", symbols(genes))
+	}
+
+	genes, err = gdb.FuzzySearchByName("XYZXYZ", genome.ExonLevel, nil, 10)
+
+	if err != nil || len(genes) != 0 {
+		t.Errorf("no match = %v, %v", symbols(genes), err)
+	}
+}
+
+func TestSearchByAlias(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	genes, err := gdb.SearchByName("alpha", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || genes[0].Symbol != "GENEA" || genes[0].MatchedAlias != "ALPHA" {
+		t.Fatalf("alpha = %v", symbols(genes))
+	}
+
+	// an alias of several genes
+	genes, err = gdb.SearchByName("DELTA", genome.TranscriptLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENED", "GENEE"}) || genes[1].MatchedAlias != "DELTA" {
+		t.Errorf("delta = %v", got)
+	}
+
+	// genes found by name come first and the limit applies to both
+	genes, err = gdb.SearchByName("delta", genome.GeneLevel, nil, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 {
+		t.Errorf("n = 1 gives %v", symbols(genes))
+	}
+
+	// names are matched as usual
+	genes, err = gdb.SearchByName("gene", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, gene := range genes {
+		if gene.MatchedAlias != "" {
+			t.Errorf("%s matched alias %s", gene.Symbol, gene.MatchedAlias)
+		}
+	}
+
+	genes, err = gdb.FuzzySearchByName("DELTX", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENED", "GENEE"}) || genes[0].MatchedAlias != "DELTA" {
+		t.Errorf("fuzzy delta = %v", got)
+	}
+
+	// older databases do not have aliases
+	genes, err = openGtf(t, genometest.OldGtfId).SearchByName("alpha", genome.GeneLevel, nil, 10)
+
+	if err != nil || len(genes) != 0 {
+		t.Errorf("old alpha = %v, %v", symbols(genes), err)
+	}
+}
+
+func TestSearchByXref(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	// official ids are searched as gene ids are
+	genes, err := gdb.SearchByName("hgnc:2", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENEB"}) || genes[0].MatchedXref != "" {
+		t.Errorf("hgnc:2 = %v", got)
+	}
+
+	genes, err = gdb.SearchByName("HGNC:1", genome.TranscriptLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || len(genes[0].Children) != 2 {
+		t.Errorf("transcripts of HGNC:1 = %v", symbols(genes))
+	}
+
+	genes, err = gdb.SearchByName("1001", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || genes[0].Symbol != "GENEA" || genes[0].MatchedXref != "entrez:1001" {
+		t.Errorf("1001 = %v", symbols(genes))
+	}
+
+	// an xref of several genes
+	genes, err = gdb.SearchByName("p00045", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENED", "GENEE"}) || genes[1].MatchedXref != "uniprot:P00045" {
+		t.Errorf("p00045 = %v", got)
+	}
+
+	// xrefs are only added when asked for
+	genes, err = gdb.SearchByName("gene", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if genes[0].Xrefs != nil {
+		t.Errorf("xrefs without asking: %v", genes[0].Xrefs)
+	}
+
+	err = gdb.AddXrefs(genes)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{"entrez": {"1001"}, "refseq": {"NM_000001", "NM_000011"}, "uniprot": {"P00001"}}
+
+	if genes[0].Symbol != "GENEA" || !reflect.DeepEqual(genes[0].Xrefs, want) {
+		t.Errorf("xrefs of %s = %v", genes[0].Symbol, genes[0].Xrefs)
+	}
+
+	// genes without xrefs have none
+	for _, gene := range genes {
+		if gene.Symbol == "ENSG00000000003" && gene.Xrefs != nil {
+			t.Errorf("xrefs of %s = %v", gene.Symbol, gene.Xrefs)
+		}
+	}
+
+	// older databases do not have xrefs
+	old := openGtf(t, genometest.OldGtfId)
+
+	genes, err = old.SearchByName("1001", genome.GeneLevel, nil, 10)
+
+	if err != nil || len(genes) != 0 {
+		t.Errorf("old 1001 = %v, %v", symbols(genes), err)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	annotateDb := genome.NewGtfAnnotateDb(gdb, dna.DefaultPromoterRegion(), 3, true, nil)
+
+	// in the first exon of GENEA
+	annotation, err := annotateDb.Annotate(location(t, "chr1", 1050, 1060), genome.GeneLevel)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(annotation.WithinGenes); !slices.Equal(got, []string{"GENEA"}) {
+		t.Fatalf("within genes = %v", got)
+	}
+
+	label := annotation.WithinGenes[0].Label
+
+	for _, want := range []string{genome.PromoterLabel, genome.ExonicLabel} {
+		if !strings.Contains(label, want) {
+			t.Errorf("label %q does not contain %s", label, want)
+		}
+	}
+
+	if len(annotation.ClosestGenes) != 3 || annotation.ClosestGenes[0].Symbol != "GENEA" {
+		t.Errorf("closest genes = %v", symbols(annotation.ClosestGenes))
+	}
+
+	// between genes, upstream of GENED
+	annotation, err = annotateDb.Annotate(location(t, "chr1", 29500, 29500), genome.GeneLevel)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(annotation.WithinGenes); !slices.Equal(got, []string{"GENED"}) {
+		t.Fatalf("within genes = %v", got)
+	}
+
+	if label := annotation.WithinGenes[0].Label; !strings.Contains(label, genome.PromoterLabel) ||
+		strings.Contains(label, genome.ExonicLabel) {
+		t.Errorf("promoter label = %q", label)
+	}
+}
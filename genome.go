@@ -3,9 +3,12 @@ package genome
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	"github.com/antonybholmes/go-dna"
 	"github.com/antonybholmes/go-sys"
 	"github.com/antonybholmes/go-web"
 
@@ -19,39 +22,104 @@ type (
 	//string string
 
 	GenomeDB struct {
-		db   *sql.DB
-		dir  string
-		path string
+		db  *sql.DB
+		dir string
+		// chain files are slow to parse so are cached once loaded
+		liftOvers map[string]*LiftOver
+		path      string
+		mu        sync.Mutex
 	}
 
-	// GeneDB interface {
-	// 	//GeneDBInfo() (*GeneDBInfo, error)
+	// A GeneDB answers location and name queries against a set of
+	// gene models. GtfDB reads them from the sqlite databases made by
+	// the importer and MemGeneDB holds them in memory, e.g. for tests
+	// or small custom annotations.
+	GeneDB interface {
+		// the catalog entry the genes came from
+		Annotation() *Annotation
+
+		Close() error
+
+		OverlappingGenes(location *dna.Location,
+			levels string,
+			prom *dna.PromoterRegion,
+			policy *TranscriptPolicy,
+			annotationMode bool) ([]*GenomicFeature, error)
+
+		WithinGenes(location *dna.Location, levels string, prom *dna.PromoterRegion) (*GenomicSearchResults, error)
+
+		IntragenicFeatures(location *dna.Location,
+			levels string,
+			prom *dna.PromoterRegion,
+			policy *TranscriptPolicy,
+			useOfficialGenes bool) ([]*GenomicFeature, error)
+
+		InExon(location *dna.Location, transcriptId string, prom *dna.PromoterRegion) ([]*GenomicFeature, error)
+
+		ClosestGenes(location *dna.Location,
+			prom *dna.PromoterRegion,
+			closestN int8,
+			policy *TranscriptPolicy,
+			useOfficialGenes bool) ([]*GenomicFeature, error)
+
+		SearchByName(search string,
+			level string,
+			policy *TranscriptPolicy,
+			n int16) ([]*GenomicFeature, error)
+
+		FuzzySearchByName(search string,
+			level string,
+			policy *TranscriptPolicy,
+			n int16) ([]*GenomicFeature, error)
+	}
+
+	// The optional capabilities of a GeneDB are small interfaces of
+	// their own so a backend need only answer the queries it can.
+	// Routes type-assert for them.
+
+	// GeneSearcher ranks genes matching a search a page at a time
+	GeneSearcher interface {
+		Search(search string,
+			level string,
+			policy *TranscriptPolicy,
+			fuzzy bool,
+			n int16,
+			cursor string) (*SearchPage, error)
+	}
 
-	// 	Close() error
+	GeneAutocompleter interface {
+		// the n best genes whose symbol, an alias or an id starts
+		// with prefix, for suggestions as a user types
+		Autocomplete(prefix string, n int16) ([]*Suggestion, error)
+	}
 
-	// 	OverlappingGenes(location *dna.Location,
-	// 		level string,
-	// 		prom *dna.PromoterRegion,
-	// 		canonicalMode bool,
-	// 		geneTypeFilter string) ([]*GenomicFeature, error)
+	GeneResolver interface {
+		ResolveIds(ids []string) ([]*ResolvedId, error)
+	}
 
-	// 	SearchByName(search string,
-	// 		level string,
-	// 		fuzzy bool,
-	// 		canonical bool,
-	// 		geneType string,
-	// 		n int16) ([]*GenomicFeature, error)
+	OrthologMapper interface {
+		// the orthologs of a gene with their genes in target
+		Orthologs(id string, target GeneDB) ([]*OrthologMapping, error)
+	}
 
-	// 	WithinGenes(location *dna.Location, level string, prom *dna.PromoterRegion) (*GenomicFeatures, error)
+	XrefAdder interface {
+		// set the Entrez, UniProt and RefSeq ids of genes
+		AddXrefs(features []*GenomicFeature) error
+	}
 
-	// 	WithinGenesAndPromoter(location *dna.Location, level string, prom *dna.PromoterRegion) ([]*GenomicFeature, error)
+	DescriptionAdder interface {
+		// set the full names of genes
+		AddDescriptions(features []*GenomicFeature) error
+	}
 
-	// 	InExon(location *dna.Location, transcriptId string, prom *dna.PromoterRegion) ([]*GenomicFeature, error)
+	VersionAdder interface {
+		AddVersions(features []*GenomicFeature) error
+	}
 
-	// 	ClosestGenes(location *dna.Location,
-	// 		prom *dna.PromoterRegion,
-	// 		closestN int8) ([]*GenomicFeature, error)
-	// }
+	BiotypeCatalog interface {
+		// the biotypes of the genes and transcripts with their counts
+		Biotypes() ([]*BiotypeCount, error)
+	}
 
 	Annotation struct {
 		PublicId string `json:"id"`
@@ -65,6 +133,11 @@ type (
 )
 
 const (
+	GtfAnnotationType    string = "gtf"
+	TwoBitAnnotationType string = "2bit"
+	FastaAnnotationType  string = "fasta"
+	ChainAnnotationType  string = "chain"
+
 	GenomesSQL = `SELECT DISTINCT
 		g.id,
 		g.public_id,
@@ -127,7 +200,43 @@ const (
 		JOIN annotation_types at ON a.annotation_type_id = at.id
 		JOIN assembly_aliases aa ON asm.id = aa.assembly_id
 		WHERE
-			a.public_id = :id OR LOWER(aa.name) = LOWER(:id)`
+			a.public_id = :id 
+			OR (LOWER(aa.name) = LOWER(:id) AND LOWER(at.name) = :type)
+		ORDER BY a.public_id = :id DESC, a.id DESC
+		LIMIT 1`
+
+	AssemblyIdSql = `SELECT DISTINCT
+		asm.id
+		FROM assemblies asm
+		JOIN assembly_aliases aa ON asm.id = aa.assembly_id
+		WHERE asm.public_id = :assembly OR LOWER(aa.name) = LOWER(:assembly)`
+
+	// chain files are registered against the assembly they map to
+	// and named after both assemblies, e.g. hg19ToHg38.over.chain.gz,
+	// so match the start of the name against the aliases of the
+	// assembly being mapped from
+	ChainSql = `SELECT DISTINCT
+		a.id,
+		a.public_id,
+		g.name AS genome,
+		asm.name AS assembly,
+		at.name AS type,
+		a.name,
+		a.url
+		FROM annotations a
+		JOIN assemblies asm ON a.assembly_id = asm.id
+		JOIN genomes g ON asm.genome_id = g.id
+		JOIN annotation_types at ON a.annotation_type_id = at.id
+		JOIN assembly_aliases aa ON asm.id = aa.assembly_id
+		JOIN assembly_aliases faa ON LOWER(a.name) LIKE LOWER(faa.name) || 'to%'
+		WHERE
+			LOWER(at.name) = 'chain'
+			AND (asm.public_id = :to OR LOWER(aa.name) = LOWER(:to))
+			AND faa.assembly_id IN (
+				SELECT fasm.id FROM assemblies fasm
+				JOIN assembly_aliases fa ON fasm.id = fa.assembly_id
+				WHERE fasm.public_id = :from OR LOWER(fa.name) = LOWER(:from))
+		ORDER BY a.id DESC`
 
 	AnnotationsByTypeSql = `SELECT DISTINCT
 		a.id,
@@ -166,7 +275,10 @@ func NewGenomeDB(dbPath string) *GenomeDB {
 
 	dir := filepath.Dir(dbPath)
 
-	return &GenomeDB{dir: dir, path: dbPath, db: sys.Must(sql.Open(db.Sqlite3DB, dbPath+db.SqliteReadOnlySuffix))}
+	return &GenomeDB{dir: dir,
+		path:      dbPath,
+		db:        sys.Must(sql.Open(db.Sqlite3DB, dbPath+db.SqliteReadOnlySuffix)),
+		liftOvers: make(map[string]*LiftOver)}
 
 }
 
@@ -224,10 +336,13 @@ func (gdb *GenomeDB) Assemblies(genome string) ([]*db.Entity, error) {
 	return assemblies, nil
 }
 
+// Find an annotation by its public id or, given an assembly alias
+// such as hg38, the latest GTF annotation of that assembly
 func (gdb *GenomeDB) Annotation(id string) (*Annotation, error) {
 
 	namedArgs := []any{
 		sql.Named("id", strings.ToLower(id)),
+		sql.Named("type", GtfAnnotationType),
 	}
 
 	var annotation Annotation
@@ -343,7 +458,7 @@ func (gdb *GenomeDB) GtfFromId(id string) (*GtfDB, error) {
 func (gdb *GenomeDB) GtfFromAssembly(assembly string) (*GtfDB, error) {
 	//_, ok := cache.cacheMap[assembly]
 
-	annotations, err := gdb.Annotations(assembly, "gtf")
+	annotations, err := gdb.Annotations(assembly, GtfAnnotationType)
 
 	if err != nil {
 		return nil, err
@@ -366,6 +481,106 @@ func (gdb *GenomeDB) GtfFromAssembly(assembly string) (*GtfDB, error) {
 	return db, nil //cache.cacheMap[assembly], nil
 }
 
+// SequenceFromAssembly opens the reference sequence registered for
+// an assembly in the catalog, preferring 2bit over FASTA since it
+// does not need a separate index. The caller must close the reader.
+func (gdb *GenomeDB) SequenceFromAssembly(assembly string) (SequenceReader, error) {
+	for _, annotationType := range []string{TwoBitAnnotationType, FastaAnnotationType} {
+		annotations, err := gdb.Annotations(assembly, annotationType)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(annotations) > 0 {
+			return OpenSequenceReader(filepath.Join(gdb.dir, annotations[0].Url))
+		}
+	}
+
+	return nil, errors.New("no reference sequence found for assembly " + assembly)
+}
+
+// LiftOver returns the chain file registered for converting locations
+// from one assembly to another. Chains are loaded on first use and
+// then cached. If both names refer to the same assembly, e.g. hg38 and
+// GRCh38, no conversion is needed and nil is returned.
+func (gdb *GenomeDB) LiftOver(from string, to string) (*LiftOver, error) {
+	fromId, err := gdb.assemblyId(from)
+
+	if err != nil {
+		return nil, err
+	}
+
+	toId, err := gdb.assemblyId(to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if fromId == toId {
+		return nil, nil
+	}
+
+	namedArgs := []any{
+		sql.Named("from", strings.ToLower(from)),
+		sql.Named("to", strings.ToLower(to)),
+	}
+
+	var annotation Annotation
+
+	err = gdb.db.QueryRow(ChainSql, namedArgs...).Scan(
+		&annotation.Id,
+		&annotation.PublicId,
+		&annotation.Genome,
+		&annotation.Assembly,
+		&annotation.Type,
+		&annotation.Name,
+		&annotation.Url)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("no liftover found from %s to %s", from, to)
+		}
+
+		return nil, err
+	}
+
+	gdb.mu.Lock()
+	defer gdb.mu.Unlock()
+
+	liftOver, ok := gdb.liftOvers[annotation.Url]
+
+	if !ok {
+		log.Debug().Msgf("loading chain file %s", annotation.Url)
+
+		liftOver, err = ReadLiftOver(filepath.Join(gdb.dir, annotation.Url))
+
+		if err != nil {
+			return nil, err
+		}
+
+		gdb.liftOvers[annotation.Url] = liftOver
+	}
+
+	return liftOver, nil
+}
+
+func (gdb *GenomeDB) assemblyId(assembly string) (int, error) {
+	var id int
+
+	err := gdb.db.QueryRow(AssemblyIdSql, sql.Named("assembly", strings.ToLower(assembly))).Scan(&id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("unknown assembly %s", assembly)
+		}
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
 func (gdb *GenomeDB) Dir() string {
 	return gdb.dir
 }
@@ -39,3 +39,11 @@ func GtfFromAssembly(assembly string) (*genome.GtfDB, error) {
 func Gtfs() ([]*genome.Annotation, error) {
 	return instance.Gtfs()
 }
+
+func SequenceFromAssembly(assembly string) (genome.SequenceReader, error) {
+	return instance.SequenceFromAssembly(assembly)
+}
+
+func LiftOver(from string, to string) (*genome.LiftOver, error) {
+	return instance.LiftOver(from, to)
+}
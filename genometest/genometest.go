@@ -0,0 +1,1363 @@
+// Package genometest builds a small synthetic genome catalog for tests.
+// It writes GTF databases with the same schema as the importer scripts,
+// a FASTA reference with an index and a liftover chain, so that the
+// genome package and its routes can be tested without the real data
+// files.
+package genometest
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type (
+	// An exon or other interval in 1-based closed coordinates
+	Interval struct {
+		Start int
+		End   int
+	}
+
+	Transcript struct {
+		Id string
+		// the version of Id, 1 if not set
+		Version int
+		Biotype string
+		// genomic order
+		Exons []Interval
+		// genomic span of the coding region including the start and
+		// stop codons, zero for non-coding transcripts. The spliced
+		// length must be a multiple of 3
+		Cds       Interval
+		Canonical bool
+		Tsl       int
+		Tags      []string
+	}
+
+	Gene struct {
+		Id string
+		// the version of Id, 1 if not set
+		Version int
+		// empty for genes without an HGNC id
+		OfficialId  string
+		Symbol      string
+		Chr         string
+		Strand      string
+		Biotype     string
+		Transcripts []*Transcript
+		// alias and previous symbols from HGNC
+		Aliases []string
+		// Entrez, UniProt and RefSeq ids from HGNC by database
+		Xrefs map[string][]string
+		// full name, written as the description attribute
+		Description string
+		// genes of other genomes predicted to be orthologs
+		Orthologs []Ortholog
+	}
+
+	Ortholog struct {
+		Genome string
+		GeneId string
+		Symbol string
+		// e.g. the databases supporting an HCOP prediction
+		Source string
+	}
+
+	// A GTF database in the catalog
+	Annotation struct {
+		PublicId string
+		Name     string
+		Version  string
+		File     string
+		Genes    []*Gene
+		// create the database without the tag, alias, xref, ortholog,
+		// id version and description tables and tsl column as older
+		// importers did
+		Legacy bool
+		// empty for the human Genome and Assembly
+		Genome   string
+		Assembly string
+	}
+
+	Fixture struct {
+		Dir string
+		// path of the genomes catalog database
+		Catalog string
+	}
+)
+
+const (
+	Genome   string = "Human"
+	Assembly string = "hg38"
+	// chain coordinates are offset so that hg19 = hg38 + LiftOffset
+	LiftFromAssembly string = "hg19"
+	LiftOffset       int    = 1000
+
+	GtfId    string = "test-gtf-v2"
+	OldGtfId string = "test-gtf-v1"
+
+	// a mouse annotation with orthologs of the human genes
+	MouseGenome   string = "Mouse"
+	MouseAssembly string = "mm10"
+	MouseGtfId    string = "test-mouse-gtf"
+
+	CatalogFile string = "genomes.db"
+	FastaFile   string = "hg38.fa"
+	ChainFile   string = "hg19ToHg38.over.chain"
+
+	fastaLineWidth int = 60
+
+	// order matches the importer
+	exonFeatureType       int = 1
+	cdsFeatureType        int = 2
+	startCodonFeatureType int = 4
+	stopCodonFeatureType  int = 5
+)
+
+var (
+	ChromosomeSizes = map[string]int{"chr1": 40000, "chr2": 10000}
+
+	chromosomes = []string{"chr1", "chr2"}
+
+	// codons used to fill coding sequences, none of which are stops
+	fillCodons = []string{"GCT", "CGA", "AAC", "GAT", "TGC", "CAG", "GAA", "GGT", "CAT", "ATC",
+		"CTG", "AAA", "TTC", "CCA", "TCT", "ACC", "TGG", "TAC", "GTG"}
+
+	schema = []string{`CREATE TABLE info (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		genome TEXT NOT NULL DEFAULT '',
+		assembly TEXT NOT NULL DEFAULT '',
+		version TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL DEFAULT '',
+		file TEXT NOT NULL DEFAULT '')`,
+		`CREATE TABLE biotypes (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE chromosomes (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE genes (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		biotype_id INT NOT NULL,
+		gene_id TEXT NOT NULL DEFAULT '',
+		official_gene_id TEXT,
+		symbol TEXT NOT NULL DEFAULT '',
+		chr_id INT NOT NULL DEFAULT 1,
+		start INT NOT NULL DEFAULT 1,
+		end INT NOT NULL DEFAULT 1,
+		strand TEXT NOT NULL DEFAULT '.')`,
+		`CREATE TABLE transcripts (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		gene_id INT NOT NULL,
+		biotype_id INT NOT NULL,
+		transcript_id TEXT NOT NULL DEFAULT '',
+		start INT NOT NULL DEFAULT 1,
+		end INT NOT NULL DEFAULT 1,
+		is_canonical INT NOT NULL DEFAULT 0,
+		is_longest INT NOT NULL DEFAULT 0<<TSL>>)`,
+		`CREATE TABLE feature_types (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE exons (
+		id INTEGER PRIMARY KEY,
+		transcript_id INT NOT NULL,
+		exon_id TEXT NOT NULL DEFAULT '',
+		exon_number INT NOT NULL DEFAULT 1,
+		UNIQUE(transcript_id, exon_id, exon_number))`,
+		`CREATE TABLE features (
+		id INTEGER PRIMARY KEY,
+		transcript_id INT NOT NULL,
+		exon_id INTEGER NOT NULL,
+		feature_type_id INT NOT NULL,
+		start INT NOT NULL DEFAULT 1,
+		end INT NOT NULL DEFAULT 1,
+		UNIQUE(transcript_id, exon_id, feature_type_id, start, end))`,
+		// the indexes of the importer, which query plans depend on
+		`CREATE UNIQUE INDEX idx_info_public_id ON info(public_id)`,
+		`CREATE UNIQUE INDEX idx_biotypes_name ON biotypes(LOWER(name))`,
+		`CREATE UNIQUE INDEX idx_chromosomes_public_id ON chromosomes(public_id)`,
+		`CREATE UNIQUE INDEX idx_chromosomes_name ON chromosomes(LOWER(name))`,
+		`CREATE UNIQUE INDEX idx_genes_public_id ON genes(public_id)`,
+		`CREATE INDEX idx_genes_gene_id ON genes(LOWER(gene_id))`,
+		`CREATE INDEX idx_genes_official_gene_id ON genes(LOWER(official_gene_id))`,
+		`CREATE INDEX idx_genes_symbol ON genes(LOWER(symbol))`,
+		`CREATE INDEX idx_genes_strand ON genes(strand)`,
+		`CREATE INDEX idx_genes_chr_id ON genes(chr_id)`,
+		`CREATE INDEX idx_genes_biotype_id ON genes(biotype_id)`,
+		`CREATE UNIQUE INDEX idx_transcripts_public_id ON transcripts(public_id)`,
+		`CREATE INDEX idx_transcripts_transcript_id ON transcripts(LOWER(transcript_id))`,
+		`CREATE INDEX idx_transcripts_start_end ON transcripts(start, end)`,
+		`CREATE INDEX idx_transcripts_is_canonical ON transcripts(is_canonical)`,
+		`CREATE INDEX idx_transcripts_is_longest ON transcripts(is_longest)`,
+		`CREATE INDEX idx_transcripts_gene_id ON transcripts(gene_id)`,
+		`CREATE INDEX idx_transcripts_biotype_id ON transcripts(biotype_id)`,
+		`CREATE UNIQUE INDEX idx_feature_types_public_id ON feature_types(public_id)`,
+		`CREATE UNIQUE INDEX idx_feature_types_name ON feature_types(LOWER(name))`,
+		`CREATE INDEX idx_exons_exon_id ON exons(LOWER(exon_id))`,
+		`CREATE INDEX idx_exons_transcript_id ON exons(transcript_id)`,
+		`CREATE INDEX idx_features_start_end ON features(start, end)`,
+		`CREATE INDEX idx_features_transcript_id ON features(transcript_id)`,
+		`CREATE INDEX idx_features_exon_id ON features(exon_id)`,
+		`CREATE INDEX idx_features_feature_type_id ON features(feature_type_id)`}
+
+	tagSchema = []string{`CREATE TABLE tags (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE transcript_tags (
+		transcript_id INT NOT NULL,
+		tag_id INT NOT NULL,
+		PRIMARY KEY (transcript_id, tag_id))`,
+		`CREATE INDEX idx_transcript_tags_tag_id ON transcript_tags(tag_id)`}
+
+	aliasSchema = []string{`CREATE TABLE gene_aliases (
+		id INTEGER PRIMARY KEY,
+		gene_id INT NOT NULL,
+		alias TEXT NOT NULL,
+		UNIQUE(gene_id, alias))`,
+		`CREATE INDEX idx_gene_aliases_alias ON gene_aliases(LOWER(alias))`}
+
+	xrefSchema = []string{`CREATE TABLE gene_xrefs (
+		id INTEGER PRIMARY KEY,
+		gene_id INT NOT NULL,
+		db TEXT NOT NULL,
+		xref TEXT NOT NULL,
+		UNIQUE(gene_id, db, xref))`,
+		`CREATE INDEX idx_gene_xrefs_xref ON gene_xrefs(LOWER(xref))`,
+		`CREATE INDEX idx_gene_xrefs_gene_id ON gene_xrefs(gene_id)`}
+
+	orthologSchema = []string{`CREATE TABLE gene_orthologs (
+		id INTEGER PRIMARY KEY,
+		gene_id INT NOT NULL,
+		genome TEXT NOT NULL,
+		ortholog_gene_id TEXT NOT NULL,
+		ortholog_symbol TEXT NOT NULL DEFAULT '',
+		source TEXT NOT NULL DEFAULT '',
+		UNIQUE(gene_id, genome, ortholog_gene_id))`,
+		`CREATE INDEX idx_gene_orthologs_gene_id ON gene_orthologs(gene_id)`}
+
+	versionSchema = []string{`CREATE TABLE id_versions (
+		id INTEGER PRIMARY KEY,
+		stable_id TEXT NOT NULL UNIQUE,
+		version TEXT NOT NULL)`}
+
+	descriptionSchema = []string{`CREATE TABLE gene_descriptions (
+		gene_id INTEGER PRIMARY KEY,
+		description TEXT NOT NULL)`}
+
+	featureTypes = []string{"exon", "cds", "utr", "start_codon", "stop_codon", "five_prime_utr", "three_prime_utr"}
+
+	catalogSchema = []string{`CREATE TABLE genomes (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL,
+		scientific_name TEXT NOT NULL)`,
+		`CREATE TABLE assemblies (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		genome_id INTEGER NOT NULL,
+		name TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE assembly_aliases (
+		id INTEGER PRIMARY KEY,
+		assembly_id INTEGER NOT NULL,
+		name TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE annotation_types (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE annotations (
+		id INTEGER PRIMARY KEY,
+		public_id TEXT NOT NULL UNIQUE,
+		assembly_id INTEGER NOT NULL,
+		annotation_type_id INTEGER NOT NULL,
+		name TEXT NOT NULL UNIQUE,
+		url TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '')`,
+		`INSERT INTO genomes (id, public_id, name, scientific_name) VALUES (1, 'human', 'Human', 'Homo sapiens')`,
+		`INSERT INTO genomes (id, public_id, name, scientific_name) VALUES (2, 'mouse', 'Mouse', 'Mus musculus')`,
+		`INSERT INTO assemblies (id, public_id, genome_id, name) VALUES (1, 'grch37', 1, 'GRCh37')`,
+		`INSERT INTO assemblies (id, public_id, genome_id, name) VALUES (2, 'grch38', 1, 'GRCh38')`,
+		`INSERT INTO assemblies (id, public_id, genome_id, name) VALUES (3, 'grcm38', 2, 'GRCm38')`,
+		`INSERT INTO assembly_aliases (assembly_id, name) VALUES (1, 'hg19')`,
+		`INSERT INTO assembly_aliases (assembly_id, name) VALUES (1, 'GRCh37')`,
+		`INSERT INTO assembly_aliases (assembly_id, name) VALUES (2, 'hg38')`,
+		`INSERT INTO assembly_aliases (assembly_id, name) VALUES (2, 'GRCh38')`,
+		`INSERT INTO assembly_aliases (assembly_id, name) VALUES (3, 'mm10')`,
+		`INSERT INTO assembly_aliases (assembly_id, name) VALUES (3, 'GRCm38')`,
+		`INSERT INTO annotation_types (id, public_id, name) VALUES (1, 'gtf', 'GTF')`,
+		`INSERT INTO annotation_types (id, public_id, name) VALUES (2, '2bit', '2bit')`,
+		`INSERT INTO annotation_types (id, public_id, name) VALUES (3, 'fasta', 'FASTA')`,
+		`INSERT INTO annotation_types (id, public_id, name) VALUES (4, 'chain', 'chain')`}
+)
+
+// Genes returns the current annotation: two genes with several
+// transcripts on opposite strands of chr1, a lncRNA without an
+// official id, a single transcript gene and a minus strand gene
+// on chr2. DELTA is an alias of both GENED and GENEE. GENEA, GENEB and
+// GENED have mouse orthologs. GENEB is version 7 and ENST00000000002
+// version 2, other ids are version 1. The lncRNA has no description.
+func Genes() []*Gene {
+	return []*Gene{
+		{Id: "ENSG00000000001",
+			OfficialId:  "HGNC:1",
+			Symbol:      "GENEA",
+			Chr:         "chr1",
+			Strand:      "+",
+			Biotype:     "protein_coding",
+			Aliases:     []string{"ALPHA"},
+			Description: "gene alpha, test transcription factor",
+			Xrefs: map[string][]string{"entrez": {"1001"},
+				"uniprot": {"P00001"},
+				"refseq":  {"NM_000001", "NM_000011"}},
+			Orthologs: []Ortholog{{MouseGenome, "ENSMUSG00000000001", "Genea", "Ensembl,HGNC,NCBI"}},
+			Transcripts: []*Transcript{
+				{Id: "ENST00000000001",
+					Biotype:   "protein_coding",
+					Exons:     []Interval{{1001, 1200}, {2001, 2300}, {4001, 5000}},
+					Cds:       Interval{1101, 4101},
+					Canonical: true,
+					Tsl:       1,
+					Tags:      []string{"basic", "Ensembl_canonical", "MANE_Select", "CCDS"}},
+				{Id: "ENST00000000002",
+					Version: 2,
+					Biotype: "nonsense_mediated_decay",
+					Exons:   []Interval{{1001, 1200}, {4001, 4500}},
+					Tsl:     2,
+					Tags:    []string{"basic"}},
+			}},
+		{Id: "ENSG00000000002",
+			Version:     7,
+			OfficialId:  "HGNC:2",
+			Symbol:      "GENEB",
+			Chr:         "chr1",
+			Strand:      "-",
+			Biotype:     "protein_coding",
+			Xrefs:       map[string][]string{"entrez": {"1002"}},
+			Description: "gene beta",
+			Orthologs:   []Ortholog{{MouseGenome, "ENSMUSG00000000002", "Geneb", "HGNC"}},
+			Transcripts: []*Transcript{
+				{Id: "ENST00000000003",
+					Biotype:   "protein_coding",
+					Exons:     []Interval{{8001, 8500}, {9001, 9200}, {11001, 12000}},
+					Cds:       Interval{8400, 11101},
+					Canonical: true,
+					Tsl:       1,
+					Tags:      []string{"basic", "Ensembl_canonical", "MANE_Select"}},
+				{Id: "ENST00000000004",
+					Biotype: "retained_intron",
+					Exons:   []Interval{{8001, 9200}},
+					Tsl:     3},
+			}},
+		{Id: "ENSG00000000003",
+			Symbol:  "ENSG00000000003",
+			Chr:     "chr1",
+			Strand:  "+",
+			Biotype: "lncRNA",
+			Transcripts: []*Transcript{
+				{Id: "ENST00000000005",
+					Biotype:   "lncRNA",
+					Exons:     []Interval{{20001, 21000}},
+					Canonical: true,
+					Tags:      []string{"basic", "Ensembl_canonical"}},
+			}},
+		{Id: "ENSG00000000004",
+			OfficialId:  "HGNC:4",
+			Symbol:      "GENED",
+			Chr:         "chr1",
+			Strand:      "+",
+			Biotype:     "protein_coding",
+			Aliases:     []string{"DELTA"},
+			Xrefs:       map[string][]string{"uniprot": {"P00045"}},
+			Description: "gene delta",
+			Orthologs: []Ortholog{{MouseGenome, "ENSMUSG00000000004", "Gened", "Ensembl,HGNC"},
+				{MouseGenome, "ENSMUSG00000000044", "Gened2", "Ensembl"}},
+			Transcripts: []*Transcript{
+				{Id: "ENST00000000006",
+					Biotype:   "protein_coding",
+					Exons:     []Interval{{30001, 30500}, {31501, 32000}},
+					Cds:       Interval{30101, 31601},
+					Canonical: true,
+					Tsl:       1,
+					Tags:      []string{"basic", "Ensembl_canonical", "MANE_Select"}},
+			}},
+		{Id: "ENSG00000000005",
+			OfficialId:  "HGNC:5",
+			Symbol:      "GENEE",
+			Chr:         "chr2",
+			Strand:      "-",
+			Biotype:     "protein_coding",
+			Aliases:     []string{"DELTA"},
+			Xrefs:       map[string][]string{"uniprot": {"P00045"}},
+			Description: "gene epsilon",
+			Transcripts: []*Transcript{
+				{Id: "ENST00000000007",
+					Biotype:   "protein_coding",
+					Exons:     []Interval{{5001, 5500}, {6501, 7000}},
+					Cds:       Interval{5201, 6800},
+					Canonical: true,
+					Tsl:       2,
+					Tags:      []string{"basic", "Ensembl_canonical"}},
+			}},
+	}
+}
+
+// OldGenes returns an earlier version of the annotation in which
+// GENEB has another name, GENED does not exist, GENEA has a different
+// canonical transcript and an extra gene exists on chr2
+func OldGenes() []*Gene {
+	genes := slices.DeleteFunc(Genes(), func(gene *Gene) bool {
+		return gene.Symbol == "GENED"
+	})
+
+	for _, gene := range genes {
+		switch gene.Symbol {
+		case "GENEA":
+			gene.Transcripts[0].Canonical = false
+			gene.Transcripts[1].Canonical = true
+		case "GENEB":
+			gene.Symbol = "OLDB"
+		}
+	}
+
+	return append(genes, &Gene{Id: "ENSG00000000009",
+		OfficialId: "HGNC:9",
+		Symbol:     "GENEZ",
+		Chr:        "chr2",
+		Strand:     "+",
+		Biotype:    "protein_coding",
+		Transcripts: []*Transcript{
+			{Id: "ENST00000000009",
+				Biotype:   "protein_coding",
+				Exons:     []Interval{{1001, 1500}},
+				Canonical: true},
+		}})
+}
+
+// Annotations returns the GTF databases of the catalog, oldest first
+func Annotations() []*Annotation {
+	return []*Annotation{
+		{PublicId: OldGtfId,
+			Name:    "GENCODE test v1",
+			Version: "1",
+			File:    "gtf.test.v1.db",
+			Genes:   OldGenes(),
+			Legacy:  true},
+		{PublicId: GtfId,
+			Name:    "GENCODE test v2",
+			Version: "2",
+			File:    "gtf.test.v2.db",
+			Genes:   Genes()},
+		{PublicId: MouseGtfId,
+			Name:     "GENCODE test mouse",
+			Version:  "M1",
+			File:     "gtf.test.mouse.db",
+			Genes:    MouseGenes(),
+			Genome:   MouseGenome,
+			Assembly: MouseAssembly},
+	}
+}
+
+// MouseGenes returns the mouse orthologs of GENEA and GENED, which
+// has two. The ortholog of GENEB is not in the annotation.
+func MouseGenes() []*Gene {
+	return []*Gene{
+		{Id: "ENSMUSG00000000001",
+			OfficialId: "MGI:1",
+			Symbol:     "Genea",
+			Chr:        "chr1",
+			Strand:     "-",
+			Biotype:    "protein_coding",
+			Orthologs:  []Ortholog{{Genome, "ENSG00000000001", "GENEA", "Ensembl,HGNC,NCBI"}},
+			Transcripts: []*Transcript{
+				{Id: "ENSMUST00000000001",
+					Biotype:   "protein_coding",
+					Exons:     []Interval{{50001, 50500}, {51001, 52000}},
+					Cds:       Interval{50201, 51501},
+					Canonical: true},
+			}},
+		{Id: "ENSMUSG00000000004",
+			OfficialId: "MGI:4",
+			Symbol:     "Gened",
+			Chr:        "chr2",
+			Strand:     "+",
+			Biotype:    "protein_coding",
+			Orthologs:  []Ortholog{{Genome, "ENSG00000000004", "GENED", "Ensembl,HGNC"}},
+			Transcripts: []*Transcript{
+				{Id: "ENSMUST00000000004",
+					Biotype:   "protein_coding",
+					Exons:     []Interval{{20001, 20900}},
+					Canonical: true},
+			}},
+		{Id: "ENSMUSG00000000044",
+			OfficialId: "MGI:44",
+			Symbol:     "Gened2",
+			Chr:        "chr2",
+			Strand:     "-",
+			Biotype:    "protein_coding",
+			Orthologs:  []Ortholog{{Genome, "ENSG00000000004", "GENED", "Ensembl"}},
+			Transcripts: []*Transcript{
+				{Id: "ENSMUST00000000044",
+					Biotype:   "protein_coding",
+					Exons:     []Interval{{40001, 40600}},
+					Canonical: true},
+			}},
+	}
+}
+
+func (annotation *Annotation) genome() string {
+	if annotation.Genome == "" {
+		return Genome
+	}
+
+	return annotation.Genome
+}
+
+func (annotation *Annotation) assembly() string {
+	if annotation.Assembly == "" {
+		return Assembly
+	}
+
+	return annotation.Assembly
+}
+
+// New builds the fixture in a temporary directory that is removed when
+// the test finishes
+func New(t testing.TB) *Fixture {
+	t.Helper()
+
+	fixture, err := Build(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("building genome fixture: %v", err)
+	}
+
+	return fixture
+}
+
+// Build writes the catalog and everything it refers to into dir
+func Build(dir string) (*Fixture, error) {
+	annotations := Annotations()
+
+	for _, annotation := range annotations {
+		err := WriteGtfDB(filepath.Join(dir, annotation.File), annotation)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := WriteFasta(filepath.Join(dir, FastaFile))
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = WriteChain(filepath.Join(dir, ChainFile))
+
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := Fixture{Dir: dir, Catalog: filepath.Join(dir, CatalogFile)}
+
+	err = writeCatalog(fixture.Catalog, annotations)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fixture, nil
+}
+
+func writeCatalog(path string, annotations []*Annotation) error {
+	db, err := sql.Open("sqlite3", path)
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	err = execAll(db, catalogSchema)
+
+	if err != nil {
+		return err
+	}
+
+	const insertSql = `INSERT INTO annotations (public_id, assembly_id, annotation_type_id, name, url)
+		VALUES (?, (SELECT assembly_id FROM assembly_aliases WHERE name = ?), ?, ?, ?)`
+
+	for _, annotation := range annotations {
+		_, err := db.Exec(insertSql, annotation.PublicId, annotation.assembly(), 1, annotation.Name, annotation.File)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(insertSql, "test-fasta", Assembly, 3, FastaFile, FastaFile)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(insertSql, "test-chain", Assembly, 4, ChainFile, ChainFile)
+
+	return err
+}
+
+// execAll runs statements against a db or transaction
+func execAll(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, stmts []string) error {
+	for _, stmt := range stmts {
+		_, err := db.Exec(stmt)
+
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, stmt)
+		}
+	}
+
+	return nil
+}
+
+// WriteGtfDB writes an annotation with the schema of the importer
+func WriteGtfDB(path string, annotation *Annotation) error {
+	db, err := sql.Open("sqlite3", path)
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	w := gtfWriter{tx: tx,
+		biotypes: make(map[string]int),
+		tags:     make(map[string]int),
+		legacy:   annotation.Legacy}
+
+	err = w.writeSchema()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO info (public_id, genome, assembly, version, name, file) VALUES (?, ?, ?, ?, ?, ?)`,
+		annotation.PublicId,
+		annotation.genome(),
+		annotation.assembly(),
+		annotation.Version,
+		annotation.Name,
+		annotation.File)
+
+	if err != nil {
+		return err
+	}
+
+	for _, gene := range annotation.Genes {
+		err := w.writeGene(gene)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type gtfWriter struct {
+	tx       *sql.Tx
+	biotypes map[string]int
+	tags     map[string]int
+	legacy   bool
+
+	genes       int
+	transcripts int
+	exons       int
+}
+
+func (w *gtfWriter) writeSchema() error {
+	stmts := slices.Clone(schema)
+
+	tsl := ",\n\t\ttsl INT"
+
+	if w.legacy {
+		tsl = ""
+	} else {
+		stmts = append(stmts, tagSchema...)
+		stmts = append(stmts, aliasSchema...)
+		stmts = append(stmts, xrefSchema...)
+		stmts = append(stmts, orthologSchema...)
+		stmts = append(stmts, versionSchema...)
+		stmts = append(stmts, descriptionSchema...)
+	}
+
+	for i, stmt := range stmts {
+		stmts[i] = strings.Replace(stmt, "<<TSL>>", tsl, 1)
+	}
+
+	err := execAll(w.tx, stmts)
+
+	if err != nil {
+		return err
+	}
+
+	for i, name := range chromosomes {
+		_, err := w.tx.Exec(`INSERT INTO chromosomes (id, public_id, name) VALUES (?, ?, ?)`, i+1, name, name)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, name := range featureTypes {
+		_, err := w.tx.Exec(`INSERT INTO feature_types (id, public_id, name) VALUES (?, ?, ?)`, i+1, name, name)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *gtfWriter) biotypeId(name string) (int, error) {
+	id, ok := w.biotypes[name]
+
+	if ok {
+		return id, nil
+	}
+
+	id = len(w.biotypes) + 1
+
+	_, err := w.tx.Exec(`INSERT INTO biotypes (id, public_id, name) VALUES (?, ?, ?)`, id, name, name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	w.biotypes[name] = id
+
+	return id, nil
+}
+
+func (w *gtfWriter) tagId(name string) (int, error) {
+	id, ok := w.tags[name]
+
+	if ok {
+		return id, nil
+	}
+
+	id = len(w.tags) + 1
+
+	_, err := w.tx.Exec(`INSERT INTO tags (id, public_id, name) VALUES (?, ?, ?)`, id, name, name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	w.tags[name] = id
+
+	return id, nil
+}
+
+func (w *gtfWriter) writeGene(gene *Gene) error {
+	biotypeId, err := w.biotypeId(gene.Biotype)
+
+	if err != nil {
+		return err
+	}
+
+	span := gene.Span()
+
+	w.genes++
+
+	var officialId any
+
+	if gene.OfficialId != "" {
+		officialId = gene.OfficialId
+	}
+
+	_, err = w.tx.Exec(`INSERT INTO genes (id, public_id, biotype_id, gene_id, official_gene_id, symbol, chr_id, start, end, strand) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.genes,
+		gene.Id,
+		biotypeId,
+		gene.Id,
+		officialId,
+		gene.Symbol,
+		slices.Index(chromosomes, gene.Chr)+1,
+		span.Start,
+		span.End,
+		gene.Strand)
+
+	if err != nil {
+		return err
+	}
+
+	if !w.legacy {
+		err := w.writeVersion(gene.Id, version(gene.Version))
+
+		if err != nil {
+			return err
+		}
+
+		for _, alias := range gene.Aliases {
+			_, err := w.tx.Exec(`INSERT INTO gene_aliases (gene_id, alias) VALUES (?, ?)`, w.genes, alias)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, db := range slices.Sorted(maps.Keys(gene.Xrefs)) {
+			for _, xref := range gene.Xrefs[db] {
+				_, err := w.tx.Exec(`INSERT INTO gene_xrefs (gene_id, db, xref) VALUES (?, ?, ?)`, w.genes, db, xref)
+
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if gene.Description != "" {
+			_, err := w.tx.Exec(`INSERT INTO gene_descriptions (gene_id, description) VALUES (?, ?)`, w.genes, gene.Description)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, ortholog := range gene.Orthologs {
+			_, err := w.tx.Exec(`INSERT INTO gene_orthologs (gene_id, genome, ortholog_gene_id, ortholog_symbol, source) VALUES (?, ?, ?, ?, ?)`,
+				w.genes,
+				ortholog.Genome,
+				ortholog.GeneId,
+				ortholog.Symbol,
+				ortholog.Source)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	longest := gene.Longest()
+
+	for _, transcript := range gene.Transcripts {
+		err := w.writeTranscript(gene, transcript, transcript == longest)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *gtfWriter) writeTranscript(gene *Gene, transcript *Transcript, isLongest bool) error {
+	biotypeId, err := w.biotypeId(transcript.Biotype)
+
+	if err != nil {
+		return err
+	}
+
+	span := transcript.Span()
+
+	w.transcripts++
+
+	transcriptId := w.transcripts
+
+	columns := "id, public_id, gene_id, biotype_id, transcript_id, start, end, is_canonical, is_longest"
+	values := []any{transcriptId,
+		transcript.Id,
+		w.genes,
+		biotypeId,
+		transcript.Id,
+		span.Start,
+		span.End,
+		transcript.Canonical,
+		isLongest}
+
+	if !w.legacy {
+		columns += ", tsl"
+
+		var tsl any
+
+		if transcript.Tsl > 0 {
+			tsl = transcript.Tsl
+		}
+
+		values = append(values, tsl)
+	}
+
+	_, err = w.tx.Exec(fmt.Sprintf(`INSERT INTO transcripts (%s) VALUES (?%s)`, columns, strings.Repeat(", ?", len(values)-1)), values...)
+
+	if err != nil {
+		return err
+	}
+
+	if !w.legacy {
+		err := w.writeVersion(transcript.Id, version(transcript.Version))
+
+		if err != nil {
+			return err
+		}
+
+		for _, tag := range transcript.Tags {
+			tagId, err := w.tagId(tag)
+
+			if err != nil {
+				return err
+			}
+
+			_, err = w.tx.Exec(`INSERT INTO transcript_tags (transcript_id, tag_id) VALUES (?, ?)`, transcriptId, tagId)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cds, startCodon, stopCodon, err := transcript.CodingFeatures(gene.Strand)
+
+	if err != nil {
+		return err
+	}
+
+	for i, exon := range transcript.Exons {
+		// exons are numbered 5' to 3'
+		exonNumber := i + 1
+
+		if gene.Strand == "-" {
+			exonNumber = len(transcript.Exons) - i
+		}
+
+		w.exons++
+
+		exonId := fmt.Sprintf("ENSE%011d", w.exons)
+
+		_, err := w.tx.Exec(`INSERT INTO exons (id, transcript_id, exon_id, exon_number) VALUES (?, ?, ?, ?)`,
+			w.exons,
+			transcriptId,
+			exonId,
+			exonNumber)
+
+		if err != nil {
+			return err
+		}
+
+		if !w.legacy {
+			// exons are all version 1
+			err := w.writeVersion(exonId, 1)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		err = w.writeFeature(transcriptId, exonFeatureType, exon)
+
+		if err != nil {
+			return err
+		}
+
+		for _, features := range []struct {
+			featureType int
+			intervals   []Interval
+		}{{cdsFeatureType, cds}, {startCodonFeatureType, startCodon}, {stopCodonFeatureType, stopCodon}} {
+			for _, interval := range features.intervals {
+				if interval.Start >= exon.Start && interval.End <= exon.End {
+					err := w.writeFeature(transcriptId, features.featureType, interval)
+
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *gtfWriter) writeVersion(id string, version int) error {
+	_, err := w.tx.Exec(`INSERT INTO id_versions (stable_id, version) VALUES (?, ?)`, id, fmt.Sprintf("%d", version))
+
+	return err
+}
+
+func (w *gtfWriter) writeFeature(transcriptId int, featureType int, interval Interval) error {
+	_, err := w.tx.Exec(`INSERT INTO features (transcript_id, exon_id, feature_type_id, start, end) VALUES (?, ?, ?, ?, ?)`,
+		transcriptId,
+		w.exons,
+		featureType,
+		interval.Start,
+		interval.End)
+
+	return err
+}
+
+// Span returns the extent of the gene's transcripts
+// the version of an id, 1 if not set
+func version(v int) int {
+	return max(v, 1)
+}
+
+func (gene *Gene) Span() Interval {
+	span := gene.Transcripts[0].Span()
+
+	for _, transcript := range gene.Transcripts[1:] {
+		s := transcript.Span()
+		span.Start = min(span.Start, s.Start)
+		span.End = max(span.End, s.End)
+	}
+
+	return span
+}
+
+// Tss returns the transcription start site of the gene
+func (gene *Gene) Tss() int {
+	span := gene.Span()
+
+	if gene.Strand == "-" {
+		return span.End
+	}
+
+	return span.Start
+}
+
+// Longest returns the transcript with the largest span, as the
+// importer defines it, with ties going to the first
+func (gene *Gene) Longest() *Transcript {
+	var ret *Transcript
+
+	for _, transcript := range gene.Transcripts {
+		if ret == nil || transcript.Span().End-transcript.Span().Start > ret.Span().End-ret.Span().Start {
+			ret = transcript
+		}
+	}
+
+	return ret
+}
+
+func (transcript *Transcript) Span() Interval {
+	return Interval{transcript.Exons[0].Start, transcript.Exons[len(transcript.Exons)-1].End}
+}
+
+// IsCoding returns true if the transcript has a coding region
+func (transcript *Transcript) IsCoding() bool {
+	return transcript.Cds.Start > 0
+}
+
+// CodingPositions returns the genomic positions of the coding region
+// including the stop codon in transcript order
+func (transcript *Transcript) CodingPositions(strand string) []int {
+	positions := make([]int, 0, 1000)
+
+	if !transcript.IsCoding() {
+		return positions
+	}
+
+	for _, exon := range transcript.Exons {
+		for p := max(exon.Start, transcript.Cds.Start); p <= min(exon.End, transcript.Cds.End); p++ {
+			positions = append(positions, p)
+		}
+	}
+
+	if strand == "-" {
+		slices.Reverse(positions)
+	}
+
+	return positions
+}
+
+// CodingFeatures splits the coding region into the GTF CDS, which
+// excludes the stop codon, and the start and stop codons
+func (transcript *Transcript) CodingFeatures(strand string) ([]Interval, []Interval, []Interval, error) {
+	positions := transcript.CodingPositions(strand)
+
+	if len(positions) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	if len(positions)%3 != 0 || len(positions) < 6 {
+		return nil, nil, nil, fmt.Errorf("coding region of %s is %d bases", transcript.Id, len(positions))
+	}
+
+	n := len(positions)
+
+	return toIntervals(positions[:n-3]), toIntervals(positions[:3]), toIntervals(positions[n-3:]), nil
+}
+
+// merge positions into intervals in genomic order
+func toIntervals(positions []int) []Interval {
+	sorted := slices.Clone(positions)
+	slices.Sort(sorted)
+
+	ret := make([]Interval, 0, 4)
+
+	for _, p := range sorted {
+		if len(ret) > 0 && ret[len(ret)-1].End == p-1 {
+			ret[len(ret)-1].End = p
+		} else {
+			ret = append(ret, Interval{p, p})
+		}
+	}
+
+	return ret
+}
+
+// CodingSequence returns the designed coding sequence of a transcript
+// including the stop codon. It starts with ATG, ends with TAA and has
+// no other stop codons
+func (transcript *Transcript) CodingSequence(strand string) string {
+	n := len(transcript.CodingPositions(strand)) / 3
+
+	if n == 0 {
+		return ""
+	}
+
+	var seq strings.Builder
+
+	seq.WriteString("ATG")
+
+	for i := range n - 2 {
+		seq.WriteString(fillCodons[i%len(fillCodons)])
+	}
+
+	seq.WriteString("TAA")
+
+	return seq.String()
+}
+
+// Sequence returns the reference sequence of a chromosome. The
+// background is pseudo random with the coding sequences of the current
+// annotation written over it so that transcripts translate cleanly
+func Sequence(chr string) string {
+	size := ChromosomeSizes[chr]
+
+	seq := make([]byte, size)
+
+	// a fixed linear congruential generator so the sequence is the
+	// same on every run
+	x := uint32(len(chr)*7919 + int(chr[len(chr)-1]))
+
+	for i := range seq {
+		x = x*1664525 + 1013904223
+		seq[i] = "ACGT"[x>>30]
+	}
+
+	for _, gene := range Genes() {
+		if gene.Chr != chr {
+			continue
+		}
+
+		for _, transcript := range gene.Transcripts {
+			coding := transcript.CodingSequence(gene.Strand)
+
+			for i, p := range transcript.CodingPositions(gene.Strand) {
+				base := coding[i]
+
+				if gene.Strand == "-" {
+					base = complement(base)
+				}
+
+				seq[p-1] = base
+			}
+		}
+	}
+
+	return string(seq)
+}
+
+func complement(base byte) byte {
+	switch base {
+	case 'A':
+		return 'T'
+	case 'C':
+		return 'G'
+	case 'G':
+		return 'C'
+	default:
+		return 'A'
+	}
+}
+
+// WriteFasta writes the reference with a samtools style .fai index
+func WriteFasta(path string) error {
+	var fasta strings.Builder
+	var fai strings.Builder
+
+	for _, chr := range chromosomes {
+		seq := Sequence(chr)
+
+		fasta.WriteString(">" + chr + "\n")
+
+		fmt.Fprintf(&fai, "%s\t%d\t%d\t%d\t%d\n", chr, len(seq), fasta.Len(), fastaLineWidth, fastaLineWidth+1)
+
+		for i := 0; i < len(seq); i += fastaLineWidth {
+			fasta.WriteString(seq[i:min(i+fastaLineWidth, len(seq))] + "\n")
+		}
+	}
+
+	err := os.WriteFile(path, []byte(fasta.String()), 0644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path+".fai", []byte(fai.String()), 0644)
+}
+
+// WriteChain writes a chain mapping hg19 to hg38 by shifting every
+// chromosome LiftOffset bases to the left
+func WriteChain(path string) error {
+	var chain strings.Builder
+
+	for i, chr := range chromosomes {
+		size := ChromosomeSizes[chr]
+
+		fmt.Fprintf(&chain, "chain 1000 %s %d + %d %d %s %d + 0 %d %d\n%d\n\n",
+			chr,
+			size+LiftOffset,
+			LiftOffset,
+			size+LiftOffset,
+			chr,
+			size,
+			size,
+			i+1,
+			size)
+	}
+
+	return os.WriteFile(path, []byte(chain.String()), 0644)
+}
+
+// WriteGtf writes genes as a GENCODE style GTF. Ids are versioned and
+// exons are numbered as WriteGtfDB numbers them, so that a GTF loaded
+// into memory should match the database.
+func WriteGtf(w io.Writer, genes []*Gene) error {
+	exons := 0
+
+	line := func(gene *Gene, featureType string, interval Interval, attributes string) error {
+		_, err := fmt.Fprintf(w, "%s\tTEST\t%s\t%d\t%d\t.\t%s\t.\t%s\n",
+			gene.Chr,
+			featureType,
+			interval.Start,
+			interval.End,
+			gene.Strand,
+			attributes)
+
+		return err
+	}
+
+	for _, gene := range genes {
+		geneAttributes := fmt.Sprintf(`gene_id "%s.%d"; gene_type "%s"; gene_name "%s";`, gene.Id, version(gene.Version), gene.Biotype, gene.Symbol)
+
+		if gene.OfficialId != "" {
+			geneAttributes += fmt.Sprintf(` hgnc_id "%s";`, gene.OfficialId)
+		}
+
+		if gene.Description != "" {
+			geneAttributes += fmt.Sprintf(` description "%s";`, gene.Description)
+		}
+
+		err := line(gene, "gene", gene.Span(), geneAttributes)
+
+		if err != nil {
+			return err
+		}
+
+		for _, transcript := range gene.Transcripts {
+			transcriptAttributes := fmt.Sprintf(`%s transcript_id "%s.%d"; transcript_type "%s";`,
+				geneAttributes,
+				transcript.Id,
+				version(transcript.Version),
+				transcript.Biotype)
+
+			tsl := "NA"
+
+			if transcript.Tsl > 0 {
+				tsl = fmt.Sprintf("%d", transcript.Tsl)
+			}
+
+			tags := ""
+
+			for _, tag := range transcript.Tags {
+				tags += fmt.Sprintf(` tag "%s";`, tag)
+			}
+
+			err := line(gene, "transcript", transcript.Span(), fmt.Sprintf(`%s transcript_support_level "%s";%s`,
+				transcriptAttributes,
+				tsl,
+				tags))
+
+			if err != nil {
+				return err
+			}
+
+			cds, startCodon, stopCodon, err := transcript.CodingFeatures(gene.Strand)
+
+			if err != nil {
+				return err
+			}
+
+			for i, exon := range transcript.Exons {
+				exonNumber := i + 1
+
+				if gene.Strand == "-" {
+					exonNumber = len(transcript.Exons) - i
+				}
+
+				exons++
+
+				exonAttributes := fmt.Sprintf(`%s exon_number %d; exon_id "ENSE%011d.1";`, transcriptAttributes, exonNumber, exons)
+
+				err := line(gene, "exon", exon, exonAttributes)
+
+				if err != nil {
+					return err
+				}
+
+				for _, features := range []struct {
+					featureType string
+					intervals   []Interval
+				}{{"CDS", cds}, {"start_codon", startCodon}, {"stop_codon", stopCodon}} {
+					for _, interval := range features.intervals {
+						if interval.Start >= exon.Start && interval.End <= exon.End {
+							err := line(gene, features.featureType, interval, exonAttributes)
+
+							if err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package genometest
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+)
+
+const (
+	// random genes are packed into the start of the chromosomes so
+	// that they overlap each other and their promoters often
+	RandomRegionSize int = 8000
+
+	// genes of a random genome are spread out at about this
+	// many bases per gene, roughly the density of the human genome
+	RandomGeneSpacing int = 50000
+
+	maxRandomExonLength   int = 200
+	maxRandomIntronLength int = 300
+)
+
+// RandomGenes returns n non-coding gene models with up to 3 transcripts
+// of up to 4 exons each. Most genes are on chr1 with the rest on chr2
+// so that queries can be checked for leaking across chromosomes. Ids
+// are numbered in order so that they sort as the database does.
+func RandomGenes(rng *rand.Rand, n int) []*Gene {
+	return randomGenes(rng, n, RandomRegionSize)
+}
+
+// RandomGenome returns n gene models as RandomGenes does but spread
+// along the chromosomes at a realistic density, e.g. for benchmarks
+func RandomGenome(rng *rand.Rand, n int) []*Gene {
+	return randomGenes(rng, n, n*RandomGeneSpacing)
+}
+
+// genes start anywhere in the first regionSize bases of a chromosome
+func randomGenes(rng *rand.Rand, n int, regionSize int) []*Gene {
+	genes := make([]*Gene, 0, n)
+
+	transcriptNumber := 0
+
+	for i := range n {
+		chr := "chr1"
+
+		if rng.IntN(5) == 0 {
+			chr = "chr2"
+		}
+
+		strand := "+"
+
+		if rng.IntN(2) == 0 {
+			strand = "-"
+		}
+
+		gene := &Gene{Id: fmt.Sprintf("ENSG%011d", i+1),
+			Symbol:  fmt.Sprintf("GENE%d", i+1),
+			Chr:     chr,
+			Strand:  strand,
+			Biotype: "lncRNA"}
+
+		// genes without an official id are skipped by annotation
+		if rng.IntN(4) != 0 {
+			gene.OfficialId = fmt.Sprintf("HGNC:%d", i+1)
+		}
+
+		anchor := 1 + rng.IntN(regionSize)
+
+		for t := range 1 + rng.IntN(3) {
+			transcriptNumber++
+
+			transcript := &Transcript{Id: fmt.Sprintf("ENST%011d", transcriptNumber),
+				Biotype:   "lncRNA",
+				Canonical: t == 0}
+
+			// as GTFs mark canonical transcripts
+			if transcript.Canonical {
+				transcript.Tags = []string{"Ensembl_canonical"}
+			}
+
+			start := anchor + rng.IntN(maxRandomIntronLength)
+
+			for range 1 + rng.IntN(4) {
+				end := start + rng.IntN(maxRandomExonLength)
+
+				transcript.Exons = append(transcript.Exons, Interval{start, end})
+
+				start = end + 2 + rng.IntN(maxRandomIntronLength)
+			}
+
+			gene.Transcripts = append(gene.Transcripts, transcript)
+		}
+
+		genes = append(genes, gene)
+	}
+
+	return genes
+}
+
+// CloneGenes returns a deep copy of genes so that they can be
+// modified, e.g. when shrinking a failing test case
+func CloneGenes(genes []*Gene) []*Gene {
+	ret := make([]*Gene, 0, len(genes))
+
+	for _, gene := range genes {
+		clone := *gene
+		clone.Aliases = slices.Clone(gene.Aliases)
+		clone.Xrefs = maps.Clone(gene.Xrefs)
+		clone.Orthologs = slices.Clone(gene.Orthologs)
+		clone.Transcripts = make([]*Transcript, 0, len(gene.Transcripts))
+
+		for _, transcript := range gene.Transcripts {
+			t := *transcript
+			t.Exons = slices.Clone(transcript.Exons)
+			t.Tags = slices.Clone(transcript.Tags)
+			clone.Transcripts = append(clone.Transcripts, &t)
+		}
+
+		ret = append(ret, &clone)
+	}
+
+	return ret
+}
+
+func (gene *Gene) String() string {
+	official := ""
+
+	if gene.OfficialId != "" {
+		official = " " + gene.OfficialId
+	}
+
+	ret := fmt.Sprintf("%s %s:%s%s", gene.Id, gene.Chr, gene.Strand, official)
+
+	for _, transcript := range gene.Transcripts {
+		ret += " " + transcript.String()
+	}
+
+	return ret
+}
+
+func (transcript *Transcript) String() string {
+	ret := transcript.Id + "["
+
+	for i, exon := range transcript.Exons {
+		if i > 0 {
+			ret += ","
+		}
+
+		ret += fmt.Sprintf("%d-%d", exon.Start, exon.End)
+	}
+
+	return ret + "]"
+}
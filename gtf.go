@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/antonybholmes/go-dna"
 	basemath "github.com/antonybholmes/go-sys/math"
@@ -15,11 +16,47 @@ import (
 	"github.com/antonybholmes/go-sys/log"
 )
 
+var (
+	_ GeneDB            = (*GtfDB)(nil)
+	_ GeneSearcher      = (*GtfDB)(nil)
+	_ GeneAutocompleter = (*GtfDB)(nil)
+	_ GeneResolver      = (*GtfDB)(nil)
+	_ OrthologMapper    = (*GtfDB)(nil)
+	_ XrefAdder         = (*GtfDB)(nil)
+	_ DescriptionAdder  = (*GtfDB)(nil)
+	_ VersionAdder      = (*GtfDB)(nil)
+	_ BiotypeCatalog    = (*GtfDB)(nil)
+)
+
 type (
 	GtfDB struct {
 		db         *sql.DB
 		annotation *Annotation
 		file       string
+		// whether the db has transcript tags, checked on first use
+		tagsOnce    sync.Once
+		hasTags     bool
+		aliasesOnce sync.Once
+		hasAliases  bool
+		xrefsOnce   sync.Once
+		hasXrefs    bool
+		// descriptions of genes, checked on first use
+		descriptionsOnce sync.Once
+		hasDescriptions  bool
+		// orthologs in other genomes, checked on first use
+		orthologsOnce sync.Once
+		hasOrthologs  bool
+		// versions of ids, checked on first use
+		versionsOnce sync.Once
+		hasVersions  bool
+		// gene names for fuzzy searches, loaded on first use
+		namesOnce sync.Once
+		names     *nameIndex
+		namesErr  error
+		// names of genes by prefix for autocomplete, built on first use
+		trieOnce sync.Once
+		trie     *prefixTrie
+		trieErr  error
 	}
 
 	// GtfDBInfo struct {
@@ -37,14 +74,16 @@ type (
 	}
 
 	GenomicFeature struct {
-		Location   *dna.Location `json:"loc"`
-		PublicId   string        `json:"id,omitempty"`
-		Label      string        `json:"label,omitempty"`
-		Biotype    string        `json:"biotype,omitempty"`
-		GeneId     string        `json:"geneId,omitempty"`
-		Symbol     string        `json:"symbol,omitempty"`
-		Transcript string        `json:"transcript,omitempty"`
-		Exon       string        `json:"exon,omitempty"`
+		Location *dna.Location `json:"loc"`
+		PublicId string        `json:"id,omitempty"`
+		Label    string        `json:"label,omitempty"`
+		Biotype  string        `json:"biotype,omitempty"`
+		GeneId   string        `json:"geneId,omitempty"`
+		// the HGNC or MGI id of genes found by name
+		OfficialId string `json:"officialId,omitempty"`
+		Symbol     string `json:"symbol,omitempty"`
+		Transcript string `json:"transcript,omitempty"`
+		Exon       string `json:"exon,omitempty"`
 		//Strand       string            `json:"strand,omitempty"`
 		Type         string            `json:"type,omitempty"`
 		Children     []*GenomicFeature `json:"children,omitempty"`
@@ -57,12 +96,41 @@ type (
 		IsIntragenic bool              `json:"isIntragenic,omitempty"`
 		IsLongest    bool              `json:"isLongest,omitempty"`
 		IsCanonical  bool              `json:"isCanonical,omitempty"`
+		// only set on collapsed gene models
+		IsConstitutive bool `json:"isConstitutive,omitempty"`
+		ExonicLength   int  `json:"exonicLength,omitempty"`
+		// GTF tags of transcripts, e.g. MANE_Select, and their
+		// transcript support level (1-5, 0 if unknown)
+		Tags []string `json:"tags,omitempty"`
+		Tsl  int      `json:"tsl,omitempty"`
+		// how well the feature matched a fuzzy or paged search,
+		// from ExactMatchScore down
+		Score float64 `json:"score,omitempty"`
+		// the alias or previous symbol a search matched, Symbol
+		// is the current one
+		MatchedAlias string `json:"matchedAlias,omitempty"`
+		// the Entrez, UniProt or RefSeq id a search matched, as db:xref
+		MatchedXref string `json:"matchedXref,omitempty"`
+		// the version of the gene, transcript or exon id of the
+		// feature, only set when asked for
+		Version string `json:"version,omitempty"`
+		// the version a search or lookup gave for the id of the
+		// feature when it is not Version
+		MatchedVersion string `json:"matchedVersion,omitempty"`
+		// ids of genes in other databases by database, only set
+		// when asked for
+		Xrefs map[string][]string `json:"xrefs,omitempty"`
+		// the full name of genes, e.g. MYC proto-oncogene, bHLH
+		// transcription factor, only set when asked for
+		Description string `json:"description,omitempty"`
 	}
 
 	GenomicSearchResults struct {
 		Location *dna.Location     `json:"location"`
 		Type     string            `json:"type"`
 		Features []*GenomicFeature `json:"features"`
+		// set when the location was lifted from another assembly
+		Liftover *LiftResult `json:"liftover,omitempty"`
 	}
 )
 
@@ -92,6 +160,10 @@ const (
 	GeneAndExonLevels       string = "gene,exon"
 	TranscriptAndExonLevels string = "transcript,exon"
 
+	// return genes with a single non-redundant set of exons
+	// rather than their transcripts
+	CollapsedLevel string = "collapsed"
+
 	// search within transcripts and their promoters
 
 	BasicLocationSql = `SELECT DISTINCT
@@ -108,6 +180,7 @@ const (
 		t.end,
 		t.is_canonical,
 		t.is_longest,
+		tb.name AS transcript_biotype,
 		ft.name AS feature_type,
 		f.start,
 		f.end,
@@ -119,7 +192,8 @@ const (
 		JOIN features AS f ON f.transcript_id = t.id
 		JOIN feature_types AS ft ON f.feature_type_id = ft.id
 		JOIN exons AS e ON f.exon_id = e.id
-		JOIN biotypes AS gt ON g.biotype_id = gt.id`
+		JOIN biotypes AS gt ON g.biotype_id = gt.id
+		JOIN biotypes AS tb ON t.biotype_id = tb.id`
 
 	CoreLocationSql = `SELECT DISTINCT
 		g.id, 
@@ -135,6 +209,7 @@ const (
 		t.end,
 		t.is_canonical,
 		t.is_longest,
+		tb.name AS transcript_biotype,
 		ft.name AS feature_type,
 		f.start,
 		f.end,
@@ -155,7 +230,8 @@ const (
 	JOIN features AS f ON f.transcript_id = t.id
 	JOIN feature_types AS ft ON f.feature_type_id = ft.id
 	JOIN exons AS e ON f.exon_id = e.id
-	JOIN biotypes AS gt ON g.biotype_id = gt.id`
+	JOIN biotypes AS gt ON g.biotype_id = gt.id
+	JOIN biotypes AS tb ON t.biotype_id = tb.id`
 
 	CdsSql = `SELECT DISTINCT
 		e.id,
@@ -193,6 +269,7 @@ const (
 			t.end,
 			t.is_canonical,
 			t.is_longest,
+			tb.name AS transcript_biotype,
 			ft.name AS feature_type,
 			f.start,
 			f.end,
@@ -214,16 +291,25 @@ const (
 		JOIN feature_types AS ft ON f.feature_type_id = ft.id
 		JOIN exons AS e ON f.exon_id = e.id
 		JOIN biotypes AS gt ON g.biotype_id = gt.id
+		JOIN biotypes AS tb ON t.biotype_id = tb.id
 		WHERE c.name = :chr AND 
 			(
-				(g.strand = '+' AND (:start <= t.end) AND (:end >= t.start - :prom5p)) OR
-				(g.strand = '-' AND (:start <= t.end + :prom5p) AND (:end >= t.start))
+				(g.strand = '+' AND (:start <= MAX(t.end, t.start + :prom3p)) AND (:end >= t.start - :prom5p)) OR
+				(g.strand = '-' AND (:start <= t.end + :prom5p) AND (:end >= MIN(t.start, t.end - :prom3p)))
 			) AND
 			(:use_official = 0 OR g.official_gene_id IS NOT NULL)
+			<<GENES>>
+			<<TRANSCRIPTS>>
 			ORDER BY g.gene_id, t.transcript_id, e.exon_number`
 
 	InGeneSql = CoreLocationSql +
-		` WHERE c.name = :chr AND (:start <= t.end AND :end >= t.start)`
+		` WHERE c.name = :chr AND (:start <= t.end AND :end >= t.start)
+		ORDER BY 
+			g.gene_id,
+			t.transcript_id,
+			f.start,
+			f.end,
+			f.feature_type_id`
 
 	ClosestGeneSql = `WITH ranked_transcripts AS 
 		(
@@ -254,6 +340,8 @@ const (
 				c.name = :chr AND
 				-- avoid annotating to genes with an ENSG symbol as these are likely to be less well characterized 
 				(:use_official = 0 OR g.official_gene_id IS NOT NULL)
+				<<GENES>>
+				<<TRANSCRIPTS>>
 		),
 		closest_transcripts AS (
 			-- get the ids of the closest transcripts for the closest genes
@@ -283,6 +371,7 @@ const (
 			t.end,
 			t.is_canonical,
 			t.is_longest,
+			tb.name AS transcript_biotype,
 			ft.name AS feature_type,
 			f.start,
 			f.end,
@@ -305,20 +394,23 @@ const (
 		JOIN feature_types AS ft ON f.feature_type_id = ft.id
 		JOIN exons AS e ON f.exon_id = e.id
 		JOIN biotypes AS gt ON g.biotype_id = gt.id
+		JOIN biotypes AS tb ON t.biotype_id = tb.id
 		ORDER BY 
 			ct.rank ASC`
 
-	// when annotating genes, see if position falls within an exon
+	// when annotating genes, see if position falls within an exon. The
+	// unary + stops sqlite starting from every exon of the genome
 	InExonSql = CoreLocationSql +
-		` WHERE e.transcript_id = :transcriptId AND (e.start <= :end AND e.end >= :start)
-		ORDER BY e.start, e.end DESC`
+		` WHERE LOWER(t.transcript_id) = LOWER(:transcriptId) AND +ft.name = 'exon' AND (f.start <= :end AND f.end >= :start)
+		ORDER BY f.start, f.end DESC`
 
 	// order by gene, then transcript, then exon number, then feature type
 	// so that exons come before cds and cds come before utrs, which is important for building the gene structure in memory
 	BasicOverlapSql = BasicLocationSql +
 		` WHERE 
 			c.name = :chr AND (t.start <= :end AND t.end >= :start)
-			AND (:biotype = '' OR LOWER(gt.name) = :biotype)
+			<<GENES>>
+			<<TRANSCRIPTS>>
 		ORDER BY 
 			g.gene_id,
 			t.transcript_id,
@@ -329,7 +421,8 @@ const (
 	OverlapSql = CoreLocationSql +
 		` WHERE 
 			c.name = :chr AND (t.start <= :end AND t.end >= :start)
-			AND (:biotype = '' OR LOWER(gt.name) = :biotype)
+			<<GENES>>
+			<<TRANSCRIPTS>>
 		ORDER BY 
 			g.gene_id,
 			t.transcript_id,
@@ -372,6 +465,11 @@ func NewGtfDB(dir string, annotation *Annotation) *GtfDB {
 
 }
 
+// Annotation returns the catalog entry the database was opened from
+func (gdb *GtfDB) Annotation() *Annotation {
+	return gdb.annotation
+}
+
 func (gdb *GtfDB) Close() error {
 	return gdb.db.Close()
 }
@@ -397,12 +495,8 @@ func (gdb *GtfDB) Close() error {
 func (gdb *GtfDB) OverlappingGenes(location *dna.Location,
 	levels string,
 	prom *dna.PromoterRegion,
-	canonicalMode bool,
-	annotationMode bool,
-	biotypeFilter string) ([]*GenomicFeature, error) {
-
-	//log.Debug().Msgf("canonical mode %v gene type filter %s", canonicalMode, biotypeFilter)
-
+	policy *TranscriptPolicy,
+	annotationMode bool) ([]*GenomicFeature, error) {
 	var geneRows *sql.Rows
 	var err error
 
@@ -424,16 +518,22 @@ func (gdb *GtfDB) OverlappingGenes(location *dna.Location,
 
 	stmt = strings.Replace(stmt, "<<LEVEL>>", levelTable, 1)
 
-	//log.Debug().Msgf("querying overlapping genes with sql %s", stmt)
-
-	geneRows, err = gdb.db.Query(stmt,
-		sql.Named("chr", location.Chr()),
+	namedArgs := []any{sql.Named("chr", location.Chr()),
 		sql.Named("start", location.Start()),
 		sql.Named("end", location.End()),
 		sql.Named("mid", location.Mid()),
 		sql.Named("prom5p", prom.Upstream()),
-		sql.Named("prom3p", prom.Downstream()),
-		sql.Named("biotype", biotypeFilter))
+		sql.Named("prom3p", prom.Downstream())}
+
+	stmt, err = gdb.makeTranscriptPolicySql(stmt, policy, &namedArgs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//log.Debug().Msgf("querying overlapping genes with sql %s", stmt)
+
+	geneRows, err = gdb.db.Query(stmt, namedArgs...)
 
 	if err != nil {
 		return nil, err //fmt.Errorf("there was an error with the database query")
@@ -458,7 +558,24 @@ func (gdb *GtfDB) OverlappingGenes(location *dna.Location,
 	// 	e.exon_id,
 	// 	e.exon_number,
 
-	return rowsToRecords(geneRows, levels, canonicalMode, annotationMode)
+	// collapsed models are built from whole genes
+	if strings.Contains(levels, CollapsedLevel) {
+		genes, err := rowsToRecords(geneRows, GeneLevel, annotationMode)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return collapseGenes(genes, gdb.geneModels)
+	}
+
+	features, err := rowsToRecords(geneRows, levels, annotationMode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return features, gdb.addTranscriptTags(features)
 }
 
 func (gdb *GtfDB) WithinGenes(location *dna.Location, feature string,
@@ -493,6 +610,7 @@ func (gdb *GtfDB) WithinGenes(location *dna.Location, feature string,
 func (gdb *GtfDB) IntragenicFeatures(location *dna.Location,
 	levels string,
 	prom *dna.PromoterRegion,
+	policy *TranscriptPolicy,
 	useOfficialGenes bool) ([]*GenomicFeature, error) {
 
 	// rows, err := genedb.withinGeneAndPromStmt.Query(
@@ -508,14 +626,21 @@ func (gdb *GtfDB) IntragenicFeatures(location *dna.Location,
 	// 	pad,
 	// 	location.End())
 
-	rows, err := gdb.db.Query(IntragenicSql,
-		sql.Named("chr", location.Chr()),
+	namedArgs := []any{sql.Named("chr", location.Chr()),
 		sql.Named("mid", location.Mid()),
 		sql.Named("start", location.Start()),
 		sql.Named("end", location.End()),
 		sql.Named("prom5p", prom.Upstream()),
 		sql.Named("prom3p", prom.Downstream()),
-		sql.Named("use_official", useOfficialGenes)) // only consider genes with an official id for intragenic annotation
+		sql.Named("use_official", useOfficialGenes)} // only consider genes with an official id for intragenic annotation
+
+	query, err := gdb.makeTranscriptPolicySql(IntragenicSql, policy, &namedArgs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := gdb.db.Query(query, namedArgs...)
 
 	if err != nil {
 		return nil, err //fmt.Errorf("there was an error with the database query")
@@ -523,7 +648,13 @@ func (gdb *GtfDB) IntragenicFeatures(location *dna.Location,
 
 	defer rows.Close()
 
-	return rowsToRecords(rows, levels, false, true)
+	features, err := rowsToRecords(rows, levels, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return features, gdb.addTranscriptTags(features)
 }
 
 func (gdb *GtfDB) InExon(location *dna.Location, transcriptId string, prom *dna.PromoterRegion) ([]*GenomicFeature, error) {
@@ -538,7 +669,7 @@ func (gdb *GtfDB) InExon(location *dna.Location, transcriptId string, prom *dna.
 	// 	location.End())
 
 	rows, err := gdb.db.Query(InExonSql,
-		sql.Named("transcriptId", transcriptId),
+		sql.Named("transcriptId", StripIdVersion(transcriptId)),
 		sql.Named("start", location.Start()),
 		sql.Named("end", location.End()),
 		sql.Named("mid", location.Mid()),
@@ -551,25 +682,33 @@ func (gdb *GtfDB) InExon(location *dna.Location, transcriptId string, prom *dna.
 
 	defer rows.Close()
 
-	return rowsToRecords(rows, ExonLevel, false, true)
+	return rowsToRecords(rows, ExonLevel, true)
 }
 
 func (gdb *GtfDB) ClosestGenes(location *dna.Location,
 	prom *dna.PromoterRegion,
 	closestN int8,
+	policy *TranscriptPolicy,
 	useOfficialGenes bool) ([]*GenomicFeature, error) {
 
 	///log.Debug().Msgf("querying closest genes with sql %s", ClosestGeneSql)
 
-	rows, err := gdb.db.Query(ClosestGeneSql,
-		sql.Named("chr", location.Chr()),
+	namedArgs := []any{sql.Named("chr", location.Chr()),
 		sql.Named("mid", location.Mid()),
 		sql.Named("start", location.Start()),
 		sql.Named("end", location.End()),
 		sql.Named("prom5p", prom.Upstream()),
 		sql.Named("prom3p", prom.Downstream()),
 		sql.Named("n", closestN),
-		sql.Named("use_official", useOfficialGenes)) // only consider genes with an official id for closest gene annotation
+		sql.Named("use_official", useOfficialGenes)} // only consider genes with an official id for closest gene annotation
+
+	query, err := gdb.makeTranscriptPolicySql(ClosestGeneSql, policy, &namedArgs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := gdb.db.Query(query, namedArgs...)
 
 	if err != nil {
 		return nil, err
@@ -577,264 +716,291 @@ func (gdb *GtfDB) ClosestGenes(location *dna.Location,
 
 	defer rows.Close()
 
-	return rowsToRecords(rows, GeneLevel, false, true)
+	return rowsToRecords(rows, GeneLevel, true)
+
+}
 
+// A row of the location queries. The tss distance and flags are only
+// set in annotation mode.
+type featureRow struct {
+	gid               int
+	chr               string
+	geneStart         int
+	geneEnd           int
+	strand            string
+	geneId            string
+	geneSymbol        string
+	geneBiotype       string
+	transcriptId      string
+	transcriptStart   int
+	transcriptEnd     int
+	isCanonical       bool
+	isLongest         bool
+	transcriptBiotype string
+	featureType       string // are an exon, cds, or utr
+	featureStart      int
+	featureEnd        int
+	exonId            string // tie feature to an exon
+	exonNumber        int
+	tssDist           int
+	inPromoter        bool
+	inExon            bool
+	isIntragenic      bool
 }
 
-func rowsToRecords(rows *sql.Rows, levels string, canonicalMode bool, annotationMode bool) ([]*GenomicFeature, error) {
-	var gid int
-	var chr string
-	var geneStart int
-	var geneEnd int
-	var strand string
-	var geneSymbol string
-	var geneId string
-	var geneBiotype string
+// Builds genes -> transcripts -> features from rows ordered by gene
+// and then transcript, keeping only the levels asked for
+type featureBuilder struct {
+	levels            string
+	annotationMode    bool
+	currentGene       *GenomicFeature
+	currentTranscript *GenomicFeature
+	features          []*GenomicFeature
+}
 
-	var transcriptId string
+func rowsToRecords(rows *sql.Rows, levels string, annotationMode bool) ([]*GenomicFeature, error) {
+	builder := newFeatureBuilder(levels, annotationMode)
 
-	var transcriptStart int
-	var transcriptEnd int
+	var row featureRow
 
-	var isCanonical bool
-	var isLongest bool
+	for rows.Next() {
+		err := row.scan(rows, annotationMode)
 
-	var exonId string
-	var featureType string
-	var featureStart int
-	var featureEnd int
-	var exonNumber int
+		if err != nil {
+			log.Error().Msgf("error reading overlapping gene rows %s", err)
+			return nil, err
+		}
 
-	var tssDist int
+		err = builder.add(&row)
 
-	var inPromoter bool
-	var inExon bool
-	var isIntragenic bool
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// 10 seems a reasonable guess for the number of features we might see, just
-	// to reduce slice reallocation
+	//log.Debug().Msgf("converted rows to %d features", len(ret))
 
-	var currentGene *GenomicFeature
-	var currentTranscript *GenomicFeature
+	return builder.features, nil
+}
 
-	var currentFeature *GenomicFeature
+func (row *featureRow) scan(rows *sql.Rows, annotationMode bool) error {
+	if annotationMode {
+		return rows.Scan(&row.gid,
+			&row.chr,
+			&row.geneStart,
+			&row.geneEnd,
+			&row.strand,
+			&row.geneId,
+			&row.geneSymbol,
+			&row.geneBiotype,
+			&row.transcriptId,
+			&row.transcriptStart,
+			&row.transcriptEnd,
+			&row.isCanonical,
+			&row.isLongest,
+			&row.transcriptBiotype,
+			&row.featureType,
+			&row.featureStart,
+			&row.featureEnd,
+			&row.exonId,
+			&row.exonNumber,
+			&row.tssDist,
+			&row.inPromoter,
+			&row.inExon,
+			&row.isIntragenic,
+		)
+	}
 
-	var ret = make([]*GenomicFeature, 0, 10)
+	// a shorter query for non-annotation mode when you just
+	// want coordinates without extra checks to see if in exon or not etc.
+	return rows.Scan(&row.gid,
+		&row.chr,
+		&row.geneStart,
+		&row.geneEnd,
+		&row.strand,
+		&row.geneId,
+		&row.geneSymbol,
+		&row.geneBiotype,
+		&row.transcriptId,
+		&row.transcriptStart,
+		&row.transcriptEnd,
+		&row.isCanonical,
+		&row.isLongest,
+		&row.transcriptBiotype,
+		&row.featureType,
+		&row.featureStart,
+		&row.featureEnd,
+		&row.exonId,
+		&row.exonNumber,
+	)
+}
 
-	//exonMap := make(map[int]*GenomicFeature)
+func newFeatureBuilder(levels string, annotationMode bool) *featureBuilder {
+	// 10 seems a reasonable guess for the number of features we might see, just
+	// to reduce slice reallocation
+	return &featureBuilder{levels: levels,
+		annotationMode: annotationMode,
+		features:       make([]*GenomicFeature, 0, 10)}
+}
 
-	var err error
+func (builder *featureBuilder) add(row *featureRow) error {
+	// only add a new gene if we don't already have it. We
+	// assume the rows are ordered by gene id hence if the
+	// id changes, we are processing a set of rows for a new gene
+	if strings.Contains(builder.levels, "gene") && (builder.currentGene == nil || builder.currentGene.GeneId != row.geneId) {
+		location, err := dna.NewStrandedLocation(row.chr, row.geneStart, row.geneEnd, row.strand)
 
-	for rows.Next() {
-		//err := geneRows.Scan(&id, &level, &chr, &start, &end, &strand, &geneId, &geneSymbol, &transcriptId, &exonId)
-		if annotationMode {
-			err = rows.Scan(&gid,
-				&chr,
-				&geneStart,
-				&geneEnd,
-				&strand,
-				&geneId,
-				&geneSymbol,
-				&geneBiotype,
-				&transcriptId,
-				&transcriptStart,
-				&transcriptEnd,
-				&isCanonical,
-				&isLongest,
-				&featureType, // are an exon, cds, or utr
-				&featureStart,
-				&featureEnd,
-				&exonId, // tie feature to an exon
-				&exonNumber,
-				&tssDist,
-				&inPromoter,
-				&inExon,
-				&isIntragenic,
-			)
-		} else {
-			// a shorter query for non-annotation mode when you just
-			// want coordinates without extra checks to see if in exon or not etc.
-			err = rows.Scan(&gid,
-				&chr,
-				&geneStart,
-				&geneEnd,
-				&strand,
-				&geneId,
-				&geneSymbol,
-				&geneBiotype,
-				&transcriptId,
-				&transcriptStart,
-				&transcriptEnd,
-				&isCanonical,
-				&isLongest,
-				&featureType, // are an exon, cds, or utr
-				&featureStart,
-				&featureEnd,
-				&exonId, // tie feature to an exon
-				&exonNumber,
-			)
+		if err != nil {
+			return err
 		}
 
-		if err != nil {
-			log.Error().Msgf("error reading overlapping gene rows %s", err)
-			return nil, err
+		builder.currentGene = &GenomicFeature{Id: row.gid,
+			Location: location,
+			Type:     GeneLevel,
+			Symbol:   row.geneSymbol,
+			GeneId:   row.geneId,
+			//Strand:   strand,
+			Biotype: row.geneBiotype,
+			// zero outside of annotation mode
+			TssDist: row.tssDist,
 		}
 
-		// only add a new gene if we don't already have it. We
-		// assume the rows are ordered by gene id hence if the
-		// id changes, we are processing a set of rows for a new gene
-		if strings.Contains(levels, "gene") && (currentGene == nil || currentGene.GeneId != geneId) {
-			location, err := dna.NewStrandedLocation(chr, geneStart, geneEnd, strand)
+		builder.features = append(builder.features, builder.currentGene)
+	}
 
-			if err != nil {
-				return nil, err
+	currentGene := builder.currentGene
+
+	// gene inherits properties from transcripts and these become true
+	// if any transcript has them true
+	if currentGene != nil {
+		currentGene.IsCanonical = currentGene.IsCanonical || row.isCanonical
+		currentGene.IsLongest = currentGene.IsLongest || row.isLongest
+
+		// add extra properties if in annotation mode
+		if builder.annotationMode {
+			currentGene.InPromoter = currentGene.InPromoter || row.inPromoter
+			currentGene.InExon = currentGene.InExon || row.inExon
+			currentGene.IsIntragenic = currentGene.IsIntragenic || row.isIntragenic
+			currentGene.Label = MakePromLabel(currentGene.InPromoter, currentGene.InExon, currentGene.IsIntragenic)
+
+			// the first row of the gene sets the distance so that a
+			// transcript exactly on the location is not overwritten
+			if basemath.AbsInt(row.tssDist) < basemath.AbsInt(currentGene.TssDist) {
+				currentGene.TssDist = row.tssDist
 			}
+		}
+	}
 
-			currentGene = &GenomicFeature{Id: gid,
-				Location: location,
-				Type:     GeneLevel,
-				Symbol:   geneSymbol,
-				GeneId:   geneId,
-				//Strand:   strand,
-				Biotype: geneBiotype,
-			}
+	// only add if we don't already have this transcript. Transcripts
+	// not chosen by a transcript policy are filtered out in sql
+	if strings.Contains(builder.levels, "transcript") &&
+		(builder.currentTranscript == nil || builder.currentTranscript.Transcript != row.transcriptId) {
 
-			ret = append(ret, currentGene)
-		}
+		location, err := dna.NewStrandedLocation(row.chr, row.transcriptStart, row.transcriptEnd, row.strand)
 
-		// gene inherits properties from transcripts and these become true
-		// if any transcript has them true
-		if currentGene != nil {
-			currentGene.IsCanonical = currentGene.IsCanonical || isCanonical
-			currentGene.IsLongest = currentGene.IsLongest || isLongest
-
-			// add extra properties if in annotation mode
-			if annotationMode {
-				currentGene.InPromoter = currentGene.InPromoter || inPromoter
-				currentGene.InExon = currentGene.InExon || inExon
-				currentGene.IsIntragenic = currentGene.IsIntragenic || isIntragenic
-				currentGene.Label = MakePromLabel(currentGene.InPromoter, currentGene.InExon, currentGene.IsIntragenic)
-
-				if (basemath.AbsInt(tssDist) < basemath.AbsInt(currentGene.TssDist)) || currentGene.TssDist == 0 {
-					currentGene.TssDist = tssDist
-				}
-			}
+		if err != nil {
+			return err
 		}
 
-		//if canonical mode only add if transcript is canonical
-		// also only add if we have a current gene
-		// also only add if we don't already have this transcript
-		if strings.Contains(levels, "transcript") &&
-			(currentTranscript == nil || currentTranscript.Transcript != transcriptId) &&
-			(!canonicalMode || isCanonical) {
+		// set the properties that will not change for a transcript
+		builder.currentTranscript = &GenomicFeature{Id: row.gid,
+			Location: location,
+			//Strand:       strand,
+			Type:        TranscriptLevel,
+			Symbol:      row.geneSymbol,
+			GeneId:      row.geneId,
+			Transcript:  row.transcriptId,
+			Biotype:     row.transcriptBiotype,
+			IsCanonical: row.isCanonical,
+			IsLongest:   row.isLongest,
+		}
 
-			location, err := dna.NewStrandedLocation(chr, transcriptStart, transcriptEnd, strand)
+		if builder.annotationMode {
+			builder.currentTranscript.InPromoter = row.inPromoter
+			builder.currentTranscript.IsIntragenic = row.isIntragenic
+			builder.currentTranscript.TssDist = row.tssDist
+		}
 
-			if err != nil {
-				return nil, err
+		if currentGene != nil {
+			if currentGene.Children == nil {
+				currentGene.Children = make([]*GenomicFeature, 0, 10)
 			}
 
-			// set the properties that will not change for a transcript
-			currentTranscript = &GenomicFeature{Id: gid,
-				Location: location,
-				//Strand:       strand,
-				Type:       TranscriptLevel,
-				Symbol:     geneSymbol,
-				GeneId:     geneId,
-				Transcript: transcriptId,
-				//Biotype:      transcriptBiotype,
-				IsCanonical: isCanonical,
-				IsLongest:   isLongest,
-			}
+			currentGene.Children = append(currentGene.Children, builder.currentTranscript)
+		} else {
+			builder.features = append(builder.features, builder.currentTranscript)
+		}
+	}
 
-			if annotationMode {
-				currentTranscript.InPromoter = inPromoter
-				currentTranscript.IsIntragenic = isIntragenic
-				currentTranscript.TssDist = tssDist
-			}
+	currentTranscript := builder.currentTranscript
 
-			if currentGene != nil {
-				if currentGene.Children == nil {
-					currentGene.Children = make([]*GenomicFeature, 0, 10)
-				}
+	if currentTranscript != nil && builder.annotationMode {
+		// these properties may be updated as we see more rows and we find
+		// we are in an exon
+		currentTranscript.InExon = currentTranscript.InExon || row.inExon
+		currentTranscript.Label = MakePromLabel(currentTranscript.InPromoter,
+			currentTranscript.InExon,
+			currentTranscript.IsIntragenic)
+	}
 
-				currentGene.Children = append(currentGene.Children, currentTranscript)
-			} else {
-				ret = append(ret, currentTranscript)
-			}
-		}
+	// exons are a bit more complex because they can be tagged as exon, cds, or utr and we want
+	// to capture that information in the feature level. We also want to add the exon
+	// to the transcript if we have a current transcript, but if not, we add it to the gene.
+	// If we don't have a gene, we just add it to the return list.
+	// This is because some databases may not have transcripts and we still want to
+	// capture exon information if it is available.
+	// rows without a feature, e.g. transcript search results, only
+	// describe the gene and transcript
+	if row.featureType != "" && strings.Contains(builder.levels, row.featureType) {
+		location, err := dna.NewStrandedLocation(row.chr, row.featureStart, row.featureEnd, row.strand)
 
-		if currentTranscript != nil {
-			// these properties may be updated as we see more rows and we find
-			// we are in an exon
-			currentTranscript.InExon = currentTranscript.InExon || inExon
-			currentTranscript.Label = MakePromLabel(currentTranscript.InPromoter,
-				currentTranscript.InExon,
-				currentTranscript.IsIntragenic)
+		if err != nil {
+			return err
 		}
 
-		// only add exon if we have a current transcript and it matches
-		// the transcript id
-
-		// exons are a bit more complex because they can be tagged as exon, cds, or utr and we want
-		// to capture that information in the feature level. We also want to add the exon
-		// to the transcript if we have a current transcript, but if not, we add it to the gene.
-		// If we don't have a gene, we just add it to the return list.
-		// This is because some databases may not have transcripts and we still want to
-		// capture exon information if it is available.
-		if strings.Contains(levels, featureType) {
-			location, err := dna.NewStrandedLocation(chr, featureStart, featureEnd, strand)
+		feature := &GenomicFeature{Id: row.gid,
+			Location:   location,
+			Type:       row.featureType,
+			Symbol:     row.geneSymbol,
+			GeneId:     row.geneId,
+			Transcript: row.transcriptId,
+			Exon:       row.exonId,
+			ExonNumber: row.exonNumber,
+		}
 
-			if err != nil {
-				return nil, err
-			}
+		if builder.annotationMode {
+			feature.InExon = row.inExon
+			feature.Label = MakePromLabel(row.inPromoter, row.inExon, row.isIntragenic)
+		}
 
-			currentFeature = &GenomicFeature{Id: gid,
-				Location:   location,
-				Type:       featureType,
-				Symbol:     geneSymbol,
-				GeneId:     geneId,
-				Transcript: transcriptId,
-				Exon:       exonId,
-				ExonNumber: exonNumber,
+		if currentTranscript != nil {
+			// lazy initialize children slice only if we have exons to add
+			if currentTranscript.Children == nil {
+				currentTranscript.Children = make([]*GenomicFeature, 0, 10)
 			}
 
-			if annotationMode {
-				currentFeature.InExon = inExon
-				currentFeature.Label = MakePromLabel(inPromoter, inExon, isIntragenic)
+			currentTranscript.Children = append(currentTranscript.Children, feature)
+		} else if currentGene != nil {
+			// normally add to transcript, but if no transcript, add to gene
+			if currentGene.Children == nil {
+				currentGene.Children = make([]*GenomicFeature, 0, 10)
 			}
 
-			if currentTranscript != nil {
-				// lazy initialize children slice only if we have exons to add
-				if currentTranscript.Children == nil {
-					currentTranscript.Children = make([]*GenomicFeature, 0, 10)
-				}
-
-				currentTranscript.Children = append(currentTranscript.Children, currentFeature)
-			} else if currentGene != nil {
-				// normally add to transcript, but if no transcript, add to gene
-				if currentGene.Children == nil {
-					currentGene.Children = make([]*GenomicFeature, 0, 10)
-				}
-
-				currentGene.Children = append(currentGene.Children, currentFeature)
-			} else {
-				// no gene or transcript, just add to return list
-				ret = append(ret, currentFeature)
-			}
+			currentGene.Children = append(currentGene.Children, feature)
+		} else {
+			// no gene or transcript, just add to return list
+			builder.features = append(builder.features, feature)
 		}
 	}
 
-	//log.Debug().Msgf("converted rows to %d features", len(ret))
-
-	return ret, nil
+	return nil
 }
 
 func rowsToFeatures(location *dna.Location, levels string, rows *sql.Rows, annotationMode bool) (*GenomicSearchResults, error) {
 
 	// 10 seems a reasonable guess for the number of features we might see, just
 	// to reduce slice reallocation
-	features, err := rowsToRecords(rows, levels, false, annotationMode)
+	features, err := rowsToRecords(rows, levels, annotationMode)
 
 	if err != nil {
 		log.Error().Msgf("error converting rows to features %s", err)
@@ -0,0 +1,146 @@
+package genome
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+// run an overlap query directly so rowsToRecords can be tested on
+// its own
+func overlapRows(t *testing.T, query string, loc *dna.Location) (*GtfDB, *sql.Rows) {
+	t.Helper()
+
+	fixture := genometest.New(t)
+
+	gdb := NewGtfDB(fixture.Dir, &Annotation{Url: filepath.Base(genometest.Annotations()[1].File)})
+
+	t.Cleanup(func() { gdb.Close() })
+
+	prom := dna.DefaultPromoterRegion()
+
+	namedArgs := []any{sql.Named("chr", loc.Chr()),
+		sql.Named("start", loc.Start()),
+		sql.Named("end", loc.End()),
+		sql.Named("mid", loc.Mid()),
+		sql.Named("prom5p", prom.Upstream()),
+		sql.Named("prom3p", prom.Downstream())}
+
+	query = MakeTranscriptPolicySql(query, nil, &namedArgs)
+
+	rows, err := gdb.db.Query(query, namedArgs...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { rows.Close() })
+
+	return gdb, rows
+}
+
+func TestRowsToRecords(t *testing.T) {
+	loc, _ := dna.NewLocation("chr1", 1, 12000)
+
+	_, rows := overlapRows(t, BasicOverlapSql, loc)
+
+	genes, err := rowsToRecords(rows, "gene,transcript,exon", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 2 {
+		t.Fatalf("got %d genes, want 2", len(genes))
+	}
+
+	for _, gene := range genes {
+		if gene.Type != GeneLevel || len(gene.Children) != 2 {
+			t.Errorf("%s: type %s with %d transcripts", gene.Symbol, gene.Type, len(gene.Children))
+		}
+
+		// any canonical transcript makes the gene canonical
+		if !gene.IsCanonical || !gene.IsLongest {
+			t.Errorf("%s: canonical %v longest %v", gene.Symbol, gene.IsCanonical, gene.IsLongest)
+		}
+
+		for _, transcript := range gene.Children {
+			if transcript.Type != TranscriptLevel || transcript.GeneId != gene.GeneId {
+				t.Errorf("%s: bad transcript %+v", gene.Symbol, transcript)
+			}
+
+			for _, exon := range transcript.Children {
+				if exon.Type != ExonLevel || exon.Transcript != transcript.Transcript {
+					t.Errorf("%s: bad exon %+v", transcript.Transcript, exon)
+				}
+			}
+		}
+	}
+
+	geneA := genes[0]
+
+	if n := len(geneA.Children[0].Children); n != 3 {
+		t.Errorf("ENST00000000001 has %d exons, want 3", n)
+	}
+
+	if n := len(geneA.Children[1].Children); n != 2 {
+		t.Errorf("ENST00000000002 has %d exons, want 2", n)
+	}
+}
+
+func TestRowsToRecordsLevels(t *testing.T) {
+	loc, _ := dna.NewLocation("chr1", 1, 12000)
+
+	// without the gene level, transcripts are returned at the top
+	_, rows := overlapRows(t, BasicOverlapSql, loc)
+
+	transcripts, err := rowsToRecords(rows, TranscriptLevel, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transcripts) != 4 {
+		t.Fatalf("got %d transcripts, want 4", len(transcripts))
+	}
+
+	for _, transcript := range transcripts {
+		if transcript.Type != TranscriptLevel || len(transcript.Children) != 0 {
+			t.Errorf("bad transcript %+v", transcript)
+		}
+	}
+}
+
+func TestRowsToRecordsAnnotationMode(t *testing.T) {
+	// in the first exon and promoter of GENEA
+	loc, _ := dna.NewLocation("chr1", 1050, 1060)
+
+	_, rows := overlapRows(t, OverlapSql, loc)
+
+	genes, err := rowsToRecords(rows, "gene,transcript,exon", true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 {
+		t.Fatalf("got %d genes, want 1", len(genes))
+	}
+
+	gene := genes[0]
+
+	if !gene.InPromoter || !gene.InExon || !gene.IsIntragenic {
+		t.Errorf("promoter %v exon %v intragenic %v", gene.InPromoter, gene.InExon, gene.IsIntragenic)
+	}
+
+	if gene.TssDist != loc.Mid()-1001 {
+		t.Errorf("tss dist = %d, want %d", gene.TssDist, loc.Mid()-1001)
+	}
+
+	if gene.Label != MakePromLabel(true, true, true) {
+		t.Errorf("label = %s", gene.Label)
+	}
+}
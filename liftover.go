@@ -0,0 +1,428 @@
+package genome
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/antonybholmes/go-dna"
+)
+
+//
+// Conversion of locations between assemblies using UCSC chain files
+// such as hg19ToHg38.over.chain.gz
+//
+
+type (
+	// an ungapped aligned block. Positions are 0-based as in the
+	// chain file and qStart is on the query strand of the chain
+	chainBlock struct {
+		tStart int
+		qStart int
+		size   int
+	}
+
+	chain struct {
+		qName   string
+		qStrand string
+		blocks  []chainBlock
+		score   int64
+		tStart  int
+		tEnd    int
+		qSize   int
+	}
+
+	// the chains of a target chromosome sorted by start. Chains can
+	// overlap so maxEnd[i] is the furthest end of chains[:i+1], which
+	// lets us binary search for the first chain that can overlap a
+	// location
+	chromChains struct {
+		chains []*chain
+		maxEnd []int
+	}
+
+	LiftOver struct {
+		// chains indexed by target (from) chromosome
+		chains map[string]*chromChains
+		// minimum fraction of bases that must map for a location
+		// not to be considered failed, as with liftOver -minMatch
+		MinMatch float64
+	}
+
+	LiftResult struct {
+		Location *dna.Location `json:"loc"`
+		// mapped locations in the new assembly, largest first. Split
+		// and duplicated mappings have more than one
+		Mapped []*dna.Location `json:"mapped"`
+		Status string          `json:"status"`
+		// fraction of bases that mapped, counting bases mapped by
+		// more than one chain once
+		Ratio float64 `json:"ratio"`
+	}
+
+	// bases of a location that map through a single chain
+	chainHit struct {
+		chain  *chain
+		qStart int
+		qEnd   int
+		bases  int
+		// the 0-based, half open target intervals that were aligned
+		tBlocks [][2]int
+	}
+)
+
+const (
+	LiftMapped  string = "mapped"
+	LiftPartial string = "partial"
+	LiftSplit   string = "split"
+	LiftFailed  string = "failed"
+
+	DefaultMinMatch float64 = 0.95
+)
+
+// ReadLiftOver loads a chain file, which may be gzipped
+func ReadLiftOver(path string) (*LiftOver, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer gz.Close()
+
+		r = gz
+	}
+
+	return NewLiftOver(r)
+}
+
+// NewLiftOver parses chains from a reader
+func NewLiftOver(r io.Reader) (*LiftOver, error) {
+	liftOver := LiftOver{chains: make(map[string]*chromChains), MinMatch: DefaultMinMatch}
+
+	scanner := bufio.NewScanner(r)
+
+	var current *chain
+
+	// positions of the next block
+	t := 0
+	q := 0
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		tokens := strings.Fields(line)
+
+		if tokens[0] == "chain" {
+			// chain score tName tSize tStrand tStart tEnd qName qSize qStrand qStart qEnd id
+			if len(tokens) < 12 {
+				return nil, fmt.Errorf("invalid chain header: %s", line)
+			}
+
+			values, err := atois(tokens[5], tokens[6], tokens[8], tokens[10])
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid chain header: %s", line)
+			}
+
+			score, err := strconv.ParseInt(tokens[1], 10, 64)
+
+			if err != nil {
+				// some chain files have fractional scores
+				s, err := strconv.ParseFloat(tokens[1], 64)
+
+				if err != nil {
+					return nil, fmt.Errorf("invalid chain header: %s", line)
+				}
+
+				score = int64(s)
+			}
+
+			current = &chain{score: score,
+				tStart:  values[0],
+				tEnd:    values[1],
+				qName:   tokens[7],
+				qSize:   values[2],
+				qStrand: tokens[9],
+				blocks:  make([]chainBlock, 0, 10)}
+
+			t = values[0]
+			q = values[3]
+
+			chrChains, ok := liftOver.chains[tokens[2]]
+
+			if !ok {
+				chrChains = &chromChains{chains: make([]*chain, 0, 10)}
+				liftOver.chains[tokens[2]] = chrChains
+			}
+
+			chrChains.chains = append(chrChains.chains, current)
+
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("alignment data before chain header: %s", line)
+		}
+
+		// size [dt dq], the last block of a chain has only a size
+		values, err := atois(tokens...)
+
+		if err != nil || (len(values) != 1 && len(values) != 3) {
+			return nil, fmt.Errorf("invalid chain alignment line: %s", line)
+		}
+
+		current.blocks = append(current.blocks, chainBlock{tStart: t, qStart: q, size: values[0]})
+
+		if len(values) == 3 {
+			t += values[0] + values[1]
+			q += values[0] + values[2]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, chrChains := range liftOver.chains {
+		slices.SortFunc(chrChains.chains, func(a, b *chain) int {
+			return a.tStart - b.tStart
+		})
+
+		chrChains.maxEnd = make([]int, len(chrChains.chains))
+
+		end := 0
+
+		for i, c := range chrChains.chains {
+			end = max(end, c.tEnd)
+			chrChains.maxEnd[i] = end
+		}
+	}
+
+	return &liftOver, nil
+}
+
+func atois(tokens ...string) ([]int, error) {
+	values := make([]int, len(tokens))
+
+	for i, token := range tokens {
+		v, err := strconv.Atoi(token)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// Lift converts a location to the new assembly
+func (liftOver *LiftOver) Lift(location *dna.Location) *LiftResult {
+	ret := LiftResult{Location: location, Status: LiftFailed, Mapped: make([]*dna.Location, 0, 1)}
+
+	// chain coordinates are 0-based, half open
+	s := location.Start() - 1
+	e := location.End()
+
+	hits := liftOver.hits(location.Chr(), s, e)
+
+	// overlapping chains can map the same bases more than once so
+	// count the distinct bases
+	tBlocks := make([][2]int, 0, len(hits))
+
+	for _, hit := range hits {
+		tBlocks = append(tBlocks, hit.tBlocks...)
+	}
+
+	bases := distinctBases(tBlocks)
+
+	ret.Ratio = float64(bases) / float64(e-s)
+
+	if len(hits) == 0 || ret.Ratio < liftOver.MinMatch {
+		return &ret
+	}
+
+	// prefer the chains that map the most bases, then the best scoring
+	slices.SortFunc(hits, func(a, b *chainHit) int {
+		if a.bases != b.bases {
+			return b.bases - a.bases
+		}
+
+		switch {
+		case a.chain.score > b.chain.score:
+			return -1
+		case a.chain.score < b.chain.score:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	for _, hit := range hits {
+		mapped, err := hit.location(location.Strand())
+
+		if err != nil {
+			continue
+		}
+
+		ret.Mapped = append(ret.Mapped, mapped)
+	}
+
+	switch {
+	case len(ret.Mapped) == 0:
+		ret.Status = LiftFailed
+	case len(ret.Mapped) > 1 && hits[0].bases < bases:
+		// other chains map bases the primary one does not, rather
+		// than duplicating them
+		ret.Status = LiftSplit
+	case bases < e-s:
+		ret.Status = LiftPartial
+	default:
+		ret.Status = LiftMapped
+	}
+
+	return &ret
+}
+
+// the chains of chr that align any of the 0-based interval [s, e)
+func (liftOver *LiftOver) hits(chr string, s int, e int) []*chainHit {
+	hits := make([]*chainHit, 0, 2)
+
+	chrChains, ok := lookupChr(liftOver.chains, chr)
+
+	if !ok {
+		return hits
+	}
+
+	// chains before this one all end before s
+	i := sort.SearchInts(chrChains.maxEnd, s+1)
+
+	for _, c := range chrChains.chains[i:] {
+		if c.tStart >= e {
+			break
+		}
+
+		if c.tEnd <= s {
+			continue
+		}
+
+		hit := c.lift(s, e)
+
+		if hit != nil {
+			hits = append(hits, hit)
+		}
+	}
+
+	return hits
+}
+
+// the number of bases covered by a set of 0-based, half open intervals
+func distinctBases(intervals [][2]int) int {
+	slices.SortFunc(intervals, func(a, b [2]int) int {
+		return a[0] - b[0]
+	})
+
+	bases := 0
+	end := -1
+
+	for _, interval := range intervals {
+		s := max(interval[0], end)
+
+		if interval[1] > s {
+			bases += interval[1] - s
+		}
+
+		end = max(end, interval[1])
+	}
+
+	return bases
+}
+
+// Primary returns the location mapping the most bases or nil if the
+// location could not be lifted
+func (result *LiftResult) Primary() *dna.Location {
+	if len(result.Mapped) == 0 {
+		return nil
+	}
+
+	return result.Mapped[0]
+}
+
+// lift the 0-based interval [s, e) through a chain, returning the span
+// in the query or nil if no bases are aligned
+func (c *chain) lift(s int, e int) *chainHit {
+	// first block ending after s
+	i := sort.Search(len(c.blocks), func(i int) bool {
+		return c.blocks[i].tStart+c.blocks[i].size > s
+	})
+
+	hit := chainHit{chain: c, qStart: -1}
+
+	for _, block := range c.blocks[i:] {
+		if block.tStart >= e {
+			break
+		}
+
+		overlapStart := max(s, block.tStart)
+		overlapEnd := min(e, block.tStart+block.size)
+
+		qs := block.qStart + overlapStart - block.tStart
+		qe := block.qStart + overlapEnd - block.tStart
+
+		if hit.qStart == -1 {
+			hit.qStart = qs
+		}
+
+		hit.qEnd = qe
+		hit.bases += overlapEnd - overlapStart
+		hit.tBlocks = append(hit.tBlocks, [2]int{overlapStart, overlapEnd})
+	}
+
+	if hit.bases == 0 {
+		return nil
+	}
+
+	return &hit
+}
+
+func (hit *chainHit) location(strand string) (*dna.Location, error) {
+	qs := hit.qStart
+	qe := hit.qEnd
+
+	if hit.chain.qStrand == "-" {
+		// convert from reverse strand coordinates
+		qs, qe = hit.chain.qSize-qe, hit.chain.qSize-qs
+
+		switch strand {
+		case "+":
+			strand = "-"
+		case "-":
+			strand = "+"
+		}
+	}
+
+	return dna.NewStrandedLocation(hit.chain.qName, qs+1, qe, strand)
+}
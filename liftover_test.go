@@ -0,0 +1,107 @@
+package genome_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+)
+
+// chrT bases 0-1000 map to chrQ with a 100 base target gap, 2000-3000
+// map to the minus strand of chrQ2 and 3000-4000 to chrQ, 6000-7000
+// are duplicated in chrQ and chrQ3 and 8100-8200 is inside a longer
+// chain from 8000 to 9900
+const testChains = `chain 5000 chrT 10000 + 0 1000 chrQ 20000 + 0 900 1
+400 100 0
+500
+
+chain 1000 chrT 10000 + 2000 3000 chrQ2 5000 - 1000 2000 2
+1000
+
+chain 900 chrT 10000 + 3000 4000 chrQ 20000 + 5000 6000 3
+1000
+
+chain 2000 chrT 10000 + 6000 7000 chrQ 20000 + 10000 11000 4
+1000
+
+chain 1000 chrT 10000 + 6000 7000 chrQ3 1000 + 0 1000 5
+1000
+
+chain 3000 chrT 10000 + 8000 9900 chrQ4 1900 + 0 1900 6
+1900
+
+chain 100 chrT 10000 + 8100 8200 chrQ5 100 + 0 100 7
+100
+`
+
+func strandedLocation(t *testing.T, chr string, start int, end int, strand string) *dna.Location {
+	t.Helper()
+
+	loc, err := dna.NewStrandedLocation(chr, start, end, strand)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loc
+}
+
+func TestLiftOver(t *testing.T) {
+	liftOver, err := genome.NewLiftOver(strings.NewReader(testChains))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(location *dna.Location, status string, ratio float64, mapped ...string) {
+		t.Helper()
+
+		result := liftOver.Lift(location)
+
+		got := make([]string, 0, len(result.Mapped))
+
+		for _, loc := range result.Mapped {
+			got = append(got, loc.String()+loc.Strand())
+		}
+
+		if result.Status != status || result.Ratio != ratio || strings.Join(got, ",") != strings.Join(mapped, ",") {
+			t.Errorf("%s = %s %f %v, want %s %f %v", location, result.Status, result.Ratio, got, status, ratio, mapped)
+		}
+	}
+
+	check(location(t, "chrT", 101, 200), genome.LiftMapped, 1, "chrQ:101-200+")
+
+	// the minus strand chain reverses the strand
+	check(strandedLocation(t, "chrT", 2101, 2200, "+"), genome.LiftMapped, 1, "chrQ2:3801-3900-")
+
+	// 40 of 140 bases are in the gap so it only maps with a lower
+	// minimum
+	check(location(t, "chrT", 381, 520), genome.LiftFailed, 40.0/140)
+
+	liftOver.MinMatch = 0.2
+
+	check(location(t, "chrT", 381, 520), genome.LiftPartial, 40.0/140, "chrQ:381-420+")
+
+	liftOver.MinMatch = genome.DefaultMinMatch
+
+	// no chain
+	check(location(t, "chrT", 1101, 1200), genome.LiftFailed, 0)
+	check(location(t, "chrX", 101, 200), genome.LiftFailed, 0)
+
+	// half in each of two chains, the better scoring first
+	check(location(t, "chrT", 2951, 3050), genome.LiftSplit, 1, "chrQ2:3001-3050-", "chrQ:5001-5050+")
+
+	// a duplication maps every base twice but is not split
+	check(location(t, "chrT", 6101, 6200), genome.LiftMapped, 1, "chrQ:10101-10200+", "chrQ3:101-200+")
+
+	// a location past the end of a short chain nested in a longer one
+	check(location(t, "chrT", 9501, 9600), genome.LiftMapped, 1, "chrQ4:1501-1600+")
+	check(location(t, "chrT", 8151, 8160), genome.LiftMapped, 1, "chrQ4:151-160+", "chrQ5:51-60+")
+
+	_, err = genome.NewLiftOver(strings.NewReader("100 0 0\n"))
+
+	if err == nil {
+		t.Errorf("blocks before a chain header")
+	}
+}
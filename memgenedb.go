@@ -0,0 +1,1150 @@
+package genome
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/antonybholmes/go-dna"
+	basemath "github.com/antonybholmes/go-sys/math"
+)
+
+//
+// A GeneDB held in memory, e.g. for unit tests with fake gene models
+// or annotations too small to be worth importing. Queries return the
+// same features as the equivalent GtfDB.
+//
+
+var (
+	_ GeneDB            = (*MemGeneDB)(nil)
+	_ GeneSearcher      = (*MemGeneDB)(nil)
+	_ GeneAutocompleter = (*MemGeneDB)(nil)
+	_ GeneResolver      = (*MemGeneDB)(nil)
+	_ XrefAdder         = (*MemGeneDB)(nil)
+	_ DescriptionAdder  = (*MemGeneDB)(nil)
+	_ VersionAdder      = (*MemGeneDB)(nil)
+	_ BiotypeCatalog    = (*MemGeneDB)(nil)
+)
+
+type (
+	MemFeature struct {
+		// exon, cds, utr, start_codon etc.
+		Type   string
+		ExonId string
+		// version of ExonId, empty if unknown
+		ExonVersion string
+		ExonNumber  int
+		Start       int
+		End         int
+	}
+
+	MemTranscript struct {
+		Id string
+		// version of Id, empty if unknown
+		Version     string
+		Biotype     string
+		Start       int
+		End         int
+		IsCanonical bool
+		IsLongest   bool
+		// 1-5, 0 if unknown
+		Tsl      int
+		Tags     []string
+		Features []*MemFeature
+	}
+
+	MemGene struct {
+		Id string
+		// version of Id, empty if unknown
+		Version string
+		// HGNC or MGI id, empty if the gene does not have one
+		OfficialId  string
+		Symbol      string
+		Biotype     string
+		Chr         string
+		Start       int
+		End         int
+		Strand      string
+		Transcripts []*MemTranscript
+		// alias and previous symbols
+		Aliases []string
+		// Entrez, UniProt and RefSeq ids by database
+		Xrefs map[string][]string
+		// full name, e.g. MYC proto-oncogene, bHLH transcription
+		// factor, empty if unknown
+		Description string
+	}
+
+	MemGeneDB struct {
+		annotation *Annotation
+		// genes on each chr in gene id order
+		chrGenes map[string][]*MemGene
+		// all genes ordered by symbol for searching
+		symbolGenes []*MemGene
+		// lower case ids, as the database matches ids
+		genes       map[string]*MemGene
+		transcripts map[string]*memTranscriptRef
+		// row ids of the genes, as the database would have
+		geneIds map[*MemGene]int
+		// genes in row id order
+		rowGenes []*MemGene
+		names    *nameIndex
+		trie     *prefixTrie
+	}
+
+	memTranscriptRef struct {
+		gene       *MemGene
+		transcript *MemTranscript
+	}
+)
+
+var (
+	// feature types in the order of the importer, which is used to
+	// sort features with the same coordinates
+	memFeatureTypes = []string{"exon", "cds", "utr", "start_codon", "stop_codon", "five_prime_utr", "three_prime_utr"}
+
+	// tags that mark a transcript as canonical in a GTF
+	canonicalTags = []string{EnsemblCanonicalTag, ManeSelectTag, "appris_principal"}
+)
+
+// NewMemGeneDB indexes a set of genes. The genes, their transcripts and
+// features are sorted in place, and transcript tags are sorted by name.
+func NewMemGeneDB(annotation *Annotation, genes []*MemGene) *MemGeneDB {
+	mdb := MemGeneDB{annotation: annotation,
+		chrGenes:    make(map[string][]*MemGene),
+		symbolGenes: slices.Clone(genes),
+		genes:       make(map[string]*MemGene),
+		transcripts: make(map[string]*memTranscriptRef),
+		geneIds:     make(map[*MemGene]int),
+		rowGenes:    make([]*MemGene, 0, len(genes))}
+
+	slices.SortFunc(genes, func(a, b *MemGene) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	for i, gene := range genes {
+		mdb.genes[strings.ToLower(gene.Id)] = gene
+		mdb.geneIds[gene] = i + 1
+		mdb.rowGenes = append(mdb.rowGenes, gene)
+
+		slices.SortFunc(gene.Transcripts, func(a, b *MemTranscript) int {
+			return strings.Compare(a.Id, b.Id)
+		})
+
+		for _, transcript := range gene.Transcripts {
+			slices.Sort(transcript.Tags)
+
+			slices.SortFunc(transcript.Features, func(a, b *MemFeature) int {
+				if a.Start != b.Start {
+					return a.Start - b.Start
+				}
+
+				if a.End != b.End {
+					return a.End - b.End
+				}
+
+				return slices.Index(memFeatureTypes, a.Type) - slices.Index(memFeatureTypes, b.Type)
+			})
+
+			mdb.transcripts[strings.ToLower(transcript.Id)] = &memTranscriptRef{gene: gene, transcript: transcript}
+		}
+
+		mdb.chrGenes[gene.Chr] = append(mdb.chrGenes[gene.Chr], gene)
+	}
+
+	slices.SortFunc(mdb.symbolGenes, func(a, b *MemGene) int {
+		if a.Symbol != b.Symbol {
+			return strings.Compare(a.Symbol, b.Symbol)
+		}
+
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	names := make([]geneName, 0, len(genes))
+
+	for _, gene := range genes {
+		names = append(names, geneName{id: mdb.geneIds[gene], geneId: gene.Id, symbol: gene.Symbol})
+
+		for _, alias := range gene.Aliases {
+			names = append(names, geneName{id: mdb.geneIds[gene], geneId: gene.Id, symbol: gene.Symbol, alias: alias})
+		}
+	}
+
+	mdb.names = newNameIndex(names)
+	mdb.trie = newMemPrefixTrie(genes)
+
+	return &mdb
+}
+
+// the gene with the row id the database would give it
+func (mdb *MemGeneDB) geneByRowId(id int) (*MemGene, bool) {
+	if id < 1 || id > len(mdb.rowGenes) {
+		return nil, false
+	}
+
+	return mdb.rowGenes[id-1], true
+}
+
+// ReadMemGeneDB loads a GTF file, which may be gzipped
+func ReadMemGeneDB(path string, annotation *Annotation) (*MemGeneDB, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer gz.Close()
+
+		r = gz
+	}
+
+	genes, err := ParseGtf(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMemGeneDB(annotation, genes), nil
+}
+
+// ParseGtf reads the genes of a GENCODE or Ensembl style GTF the way
+// the importer does: versions are stripped from ids and kept apart,
+// transcripts tagged Ensembl_canonical, MANE_Select or appris_principal
+// are canonical and otherwise the longest transcript of a gene is. Genes
+// and transcripts without their own lines take their extent from their
+// features.
+func ParseGtf(r io.Reader) ([]*MemGene, error) {
+	genes := make([]*MemGene, 0, 1000)
+	geneMap := make(map[string]*MemGene)
+	transcriptMap := make(map[string]*MemTranscript)
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		tokens := strings.Split(line, "\t")
+
+		if len(tokens) < 9 {
+			return nil, fmt.Errorf("invalid gtf line: %s", line)
+		}
+
+		start, err := strconv.Atoi(tokens[3])
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid gtf start: %s", line)
+		}
+
+		end, err := strconv.Atoi(tokens[4])
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid gtf end: %s", line)
+		}
+
+		attributes := parseGtfAttributes(tokens[8])
+
+		geneId, geneVersion := splitIdVersion(gtfAttribute(attributes, "gene_id"))
+
+		if geneId == "" {
+			continue
+		}
+
+		gene, ok := geneMap[geneId]
+
+		if !ok {
+			gene = &MemGene{Id: geneId, Chr: tokens[0], Strand: tokens[6]}
+			geneMap[geneId] = gene
+			genes = append(genes, gene)
+		}
+
+		featureType := strings.ToLower(tokens[2])
+
+		if featureType == GeneLevel {
+			gene.Start = start
+			gene.End = end
+		}
+
+		// any line of a gene can describe it
+		gene.Version = firstNonEmpty(gene.Version, geneVersion)
+		gene.Symbol = firstNonEmpty(gtfAttribute(attributes, "gene_name"), gene.Symbol)
+		gene.Biotype = firstNonEmpty(gtfAttribute(attributes, "gene_type"), gtfAttribute(attributes, "gene_biotype"), gene.Biotype)
+		gene.OfficialId = firstNonEmpty(gtfAttribute(attributes, "hgnc_id"), gtfAttribute(attributes, "mgi_id"), gene.OfficialId)
+		gene.Description = firstNonEmpty(gtfAttribute(attributes, "description"), gene.Description)
+
+		transcriptId, transcriptVersion := splitIdVersion(gtfAttribute(attributes, "transcript_id"))
+
+		if transcriptId == "" {
+			continue
+		}
+
+		transcript, ok := transcriptMap[transcriptId]
+
+		if !ok {
+			transcript = &MemTranscript{Id: transcriptId}
+			transcriptMap[transcriptId] = transcript
+			gene.Transcripts = append(gene.Transcripts, transcript)
+		}
+
+		transcript.Version = firstNonEmpty(transcript.Version, transcriptVersion)
+		transcript.Biotype = firstNonEmpty(gtfAttribute(attributes, "transcript_type"),
+			gtfAttribute(attributes, "transcript_biotype"),
+			transcript.Biotype)
+
+		if featureType == TranscriptLevel {
+			transcript.Start = start
+			transcript.End = end
+
+			for _, tag := range attributes["tag"] {
+				if !slices.Contains(transcript.Tags, tag) {
+					transcript.Tags = append(transcript.Tags, tag)
+				}
+			}
+
+			// e.g. "1", "NA" or "1 (assigned to previous version 3)"
+			tsl, err := strconv.Atoi(strings.Fields(gtfAttribute(attributes, "transcript_support_level") + " NA")[0])
+
+			if err == nil {
+				transcript.Tsl = tsl
+			}
+
+			continue
+		}
+
+		if !slices.Contains(memFeatureTypes, featureType) {
+			continue
+		}
+
+		exonNumber, _ := strconv.Atoi(gtfAttribute(attributes, "exon_number"))
+
+		exonId, exonVersion := splitIdVersion(gtfAttribute(attributes, "exon_id"))
+
+		transcript.Features = append(transcript.Features, &MemFeature{Type: featureType,
+			ExonId:      exonId,
+			ExonVersion: exonVersion,
+			ExonNumber:  exonNumber,
+			Start:       start,
+			End:         end})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, gene := range genes {
+		if gene.Symbol == "" {
+			gene.Symbol = gene.Id
+		}
+
+		var longest *MemTranscript
+		hasCanonical := false
+
+		for _, transcript := range gene.Transcripts {
+			if transcript.Start == 0 {
+				transcript.Start, transcript.End = memFeatureSpan(transcript.Features)
+			}
+
+			if gene.Start == 0 {
+				gene.Start = transcript.Start
+				gene.End = transcript.End
+			} else {
+				gene.Start = min(gene.Start, transcript.Start)
+				gene.End = max(gene.End, transcript.End)
+			}
+
+			for _, tag := range transcript.Tags {
+				if slices.ContainsFunc(canonicalTags, func(prefix string) bool {
+					return strings.HasPrefix(tag, prefix)
+				}) {
+					transcript.IsCanonical = true
+				}
+			}
+
+			hasCanonical = hasCanonical || transcript.IsCanonical
+
+			if longest == nil || transcript.End-transcript.Start > longest.End-longest.Start {
+				longest = transcript
+			}
+		}
+
+		if longest != nil {
+			longest.IsLongest = true
+
+			if !hasCanonical {
+				longest.IsCanonical = true
+			}
+		}
+	}
+
+	return genes, nil
+}
+
+// attributes of the form key "value"; key value; where keys such as
+// tag can be repeated
+func parseGtfAttributes(s string) map[string][]string {
+	ret := make(map[string][]string)
+
+	for _, attribute := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(attribute), " ")
+
+		if !ok {
+			continue
+		}
+
+		ret[key] = append(ret[key], strings.Trim(strings.TrimSpace(value), `"`))
+	}
+
+	return ret
+}
+
+func gtfAttribute(attributes map[string][]string, key string) string {
+	values := attributes[key]
+
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func memFeatureSpan(features []*MemFeature) (int, int) {
+	if len(features) == 0 {
+		return 0, 0
+	}
+
+	start := features[0].Start
+	end := features[0].End
+
+	for _, feature := range features[1:] {
+		start = min(start, feature.Start)
+		end = max(end, feature.End)
+	}
+
+	return start, end
+}
+
+func (mdb *MemGeneDB) Annotation() *Annotation {
+	return mdb.annotation
+}
+
+func (mdb *MemGeneDB) Close() error {
+	return nil
+}
+
+func (mdb *MemGeneDB) OverlappingGenes(location *dna.Location,
+	levels string,
+	prom *dna.PromoterRegion,
+	policy *TranscriptPolicy,
+	annotationMode bool) ([]*GenomicFeature, error) {
+
+	builderLevels := levels
+
+	// collapsed models are built from whole genes
+	if strings.Contains(levels, CollapsedLevel) {
+		builderLevels = GeneLevel
+	}
+
+	builder := newFeatureBuilder(builderLevels, annotationMode)
+
+	for _, gene := range mdb.chrGenes[location.Chr()] {
+		for _, transcript := range policy.memTranscripts(gene) {
+			if transcript.Start > location.End() || transcript.End < location.Start() {
+				continue
+			}
+
+			err := mdb.addFeatures(builder, gene, transcript, transcript.Features, location, prom)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if strings.Contains(levels, CollapsedLevel) {
+		return collapseGenes(builder.features, mdb.geneModels)
+	}
+
+	mdb.addTranscriptTags(builder.features)
+
+	return builder.features, nil
+}
+
+func (mdb *MemGeneDB) WithinGenes(location *dna.Location, levels string, prom *dna.PromoterRegion) (*GenomicSearchResults, error) {
+	builder := newFeatureBuilder(levels, true)
+
+	for _, gene := range mdb.chrGenes[location.Chr()] {
+		for _, transcript := range gene.Transcripts {
+			if transcript.Start > location.End() || transcript.End < location.Start() {
+				continue
+			}
+
+			err := mdb.addFeatures(builder, gene, transcript, transcript.Features, location, prom)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &GenomicSearchResults{Location: location, Type: MaxLevel(levels), Features: builder.features}, nil
+}
+
+func (mdb *MemGeneDB) IntragenicFeatures(location *dna.Location,
+	levels string,
+	prom *dna.PromoterRegion,
+	policy *TranscriptPolicy,
+	useOfficialGenes bool) ([]*GenomicFeature, error) {
+
+	builder := newFeatureBuilder(levels, true)
+
+	for _, gene := range mdb.chrGenes[location.Chr()] {
+		if useOfficialGenes && gene.OfficialId == "" {
+			continue
+		}
+
+		for _, transcript := range policy.memTranscripts(gene) {
+			if !memInTranscriptOrPromoter(gene.Strand, transcript, location, prom) {
+				continue
+			}
+
+			// features are in exon order as in the database query
+			features := slices.Clone(transcript.Features)
+
+			slices.SortStableFunc(features, func(a, b *MemFeature) int {
+				return a.ExonNumber - b.ExonNumber
+			})
+
+			err := mdb.addFeatures(builder, gene, transcript, features, location, prom)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	mdb.addTranscriptTags(builder.features)
+
+	return builder.features, nil
+}
+
+func (mdb *MemGeneDB) InExon(location *dna.Location, transcriptId string, prom *dna.PromoterRegion) ([]*GenomicFeature, error) {
+	builder := newFeatureBuilder(ExonLevel, true)
+
+	ref, ok := mdb.transcripts[strings.ToLower(StripIdVersion(transcriptId))]
+
+	if !ok {
+		return builder.features, nil
+	}
+
+	exons := make([]*MemFeature, 0, len(ref.transcript.Features))
+
+	for _, feature := range ref.transcript.Features {
+		if feature.Type == ExonLevel && feature.Start <= location.End() && feature.End >= location.Start() {
+			exons = append(exons, feature)
+		}
+	}
+
+	slices.SortStableFunc(exons, func(a, b *MemFeature) int {
+		if a.Start != b.Start {
+			return a.Start - b.Start
+		}
+
+		return b.End - a.End
+	})
+
+	err := mdb.addFeatures(builder, ref.gene, ref.transcript, exons, location, prom)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return builder.features, nil
+}
+
+func (mdb *MemGeneDB) ClosestGenes(location *dna.Location,
+	prom *dna.PromoterRegion,
+	closestN int8,
+	policy *TranscriptPolicy,
+	useOfficialGenes bool) ([]*GenomicFeature, error) {
+
+	closest := make([]*memTranscriptRef, 0, 10)
+
+	for _, gene := range mdb.chrGenes[location.Chr()] {
+		if useOfficialGenes && gene.OfficialId == "" {
+			continue
+		}
+
+		var ref *memTranscriptRef
+
+		for _, transcript := range policy.memTranscripts(gene) {
+			if ref == nil || basemath.AbsInt(memTssDist(gene.Strand, transcript, location)) <
+				basemath.AbsInt(memTssDist(gene.Strand, ref.transcript, location)) {
+				ref = &memTranscriptRef{gene: gene, transcript: transcript}
+			}
+		}
+
+		if ref != nil {
+			closest = append(closest, ref)
+		}
+	}
+
+	slices.SortStableFunc(closest, func(a, b *memTranscriptRef) int {
+		return basemath.AbsInt(memTssDist(a.gene.Strand, a.transcript, location)) -
+			basemath.AbsInt(memTssDist(b.gene.Strand, b.transcript, location))
+	})
+
+	if closestN >= 0 && int(closestN) < len(closest) {
+		closest = closest[:closestN]
+	}
+
+	builder := newFeatureBuilder(GeneLevel, true)
+
+	for _, ref := range closest {
+		err := mdb.addFeatures(builder, ref.gene, ref.transcript, ref.transcript.Features, location, prom)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.features, nil
+}
+
+// SearchByName matches genes by symbol prefix, id or official id, and
+// transcripts and exons by the symbol or ids of their gene or their own id
+func (mdb *MemGeneDB) SearchByName(search string,
+	level string,
+	policy *TranscriptPolicy,
+	n int16) ([]*GenomicFeature, error) {
+	return mdb.searchByName(search, level, policy, max(1, min(n, MaxGeneInfoResults)))
+}
+
+// searchByName is SearchByName without a cap on n, which can be NoLimit
+func (mdb *MemGeneDB) searchByName(search string,
+	level string,
+	policy *TranscriptPolicy,
+	n int16) ([]*GenomicFeature, error) {
+	// case insensitive search
+	search = strings.ToLower(search)
+
+	err := checkSearch(search)
+
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := splitIdVersion(search)
+
+	matchGene := func(gene *MemGene) bool {
+		return strings.EqualFold(gene.Symbol, search) || strings.EqualFold(gene.Id, id) ||
+			strings.EqualFold(gene.OfficialId, search)
+	}
+
+	matchId := func(transcriptOrExonId string) bool {
+		return strings.EqualFold(transcriptOrExonId, id)
+	}
+
+	var ret []*GenomicFeature
+
+	switch level {
+	case TranscriptLevel:
+		ret, err = mdb.searchTranscripts(matchGene, matchId, policy, false, n)
+	case ExonLevel:
+		ret, err = mdb.searchTranscripts(matchGene, matchId, policy, true, n)
+	default:
+		ret, err = mdb.searchGenes(func(gene *MemGene) bool {
+			return strings.HasPrefix(strings.ToLower(gene.Symbol), search) || strings.EqualFold(gene.Id, id) ||
+				strings.EqualFold(gene.OfficialId, search)
+		}, policy, n)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err = mdb.addAliasMatches(ret, search, level, policy, n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, matchVersions(mdb.AddVersions, ret, search)
+}
+
+// addAliasMatches adds genes by alias or xref as GtfDB.addAliasMatches does
+func (mdb *MemGeneDB) addAliasMatches(features []*GenomicFeature,
+	search string,
+	level string,
+	policy *TranscriptPolicy,
+	n int16) ([]*GenomicFeature, error) {
+	aliases := make([]geneName, 0, 5)
+
+	for _, gene := range mdb.symbolGenes {
+		for _, alias := range slices.Sorted(slices.Values(gene.Aliases)) {
+			if strings.EqualFold(alias, search) {
+				aliases = append(aliases, geneName{id: mdb.geneIds[gene], alias: alias})
+			}
+		}
+	}
+
+	aliases = newAliasMatches(features, append(aliases, mdb.xrefMatches(search)...), level, n)
+
+	if len(aliases) == 0 {
+		return features, nil
+	}
+
+	ids := make(map[int]bool, len(aliases))
+
+	for _, alias := range aliases {
+		ids[alias.id] = true
+	}
+
+	found, err := mdb.searchGeneIds(ids, level, policy, n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return appendAliasMatches(features, found, aliases), nil
+}
+
+// FuzzySearchByName ranks genes as GtfDB.FuzzySearchByName does
+func (mdb *MemGeneDB) FuzzySearchByName(search string,
+	level string,
+	policy *TranscriptPolicy,
+	n int16) ([]*GenomicFeature, error) {
+	return mdb.fuzzySearchByName(search, level, policy, max(1, min(n, MaxGeneInfoResults)))
+}
+
+// fuzzySearchByName is FuzzySearchByName without a cap on n, which can
+// be NoLimit
+func (mdb *MemGeneDB) fuzzySearchByName(search string,
+	level string,
+	policy *TranscriptPolicy,
+	n int16) ([]*GenomicFeature, error) {
+	err := checkSearch(strings.ToLower(search))
+
+	if err != nil {
+		return nil, err
+	}
+
+	matches := mdb.names.search(search, n)
+
+	ids := make(map[int]bool, len(matches))
+
+	for _, match := range matches {
+		ids[match.id] = true
+	}
+
+	ret, err := mdb.searchGeneIds(ids, level, policy, n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rankMatches(ret, matches), matchVersions(mdb.AddVersions, ret, search)
+}
+
+// searchGeneIds finds genes by row id as GtfDB.searchGeneIds does
+func (mdb *MemGeneDB) searchGeneIds(ids map[int]bool,
+	level string,
+	policy *TranscriptPolicy,
+	n int16) ([]*GenomicFeature, error) {
+	matchGene := func(gene *MemGene) bool {
+		return ids[mdb.geneIds[gene]]
+	}
+
+	matchId := func(id string) bool {
+		return false
+	}
+
+	switch level {
+	case TranscriptLevel:
+		return mdb.searchTranscripts(matchGene, matchId, policy, false, n)
+	case ExonLevel:
+		return mdb.searchTranscripts(matchGene, matchId, policy, true, n)
+	default:
+		return mdb.searchGenes(matchGene, policy, n)
+	}
+}
+
+// genes matching matchGene with their transcripts, and transcripts and
+// exons whose own id matches matchId, n per gene unless n is NoLimit
+func (mdb *MemGeneDB) searchTranscripts(matchGene func(gene *MemGene) bool,
+	matchId func(id string) bool,
+	policy *TranscriptPolicy,
+	exonMode bool,
+	n int16) ([]*GenomicFeature, error) {
+
+	levels := GeneAndTranscriptLevels
+
+	if exonMode {
+		levels = "gene,transcript,exon"
+	}
+
+	builder := newFeatureBuilder(levels, false)
+
+	for _, gene := range mdb.symbolGenes {
+		geneMatch := matchGene(gene)
+
+		// results are ranked within each gene
+		rank := int16(0)
+
+		for _, transcript := range policy.memTranscripts(gene) {
+			match := geneMatch || matchId(transcript.Id)
+
+			if !exonMode {
+				if match && (n == NoLimit || rank < n) {
+					rank++
+
+					// a row without a feature
+					err := builder.add(mdb.row(gene, transcript, &MemFeature{}))
+
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				continue
+			}
+
+			for _, feature := range transcript.Features {
+				if feature.Type != ExonLevel || !(match || matchId(feature.ExonId)) || (n != NoLimit && rank >= n) {
+					continue
+				}
+
+				rank++
+
+				err := builder.add(mdb.row(gene, transcript, feature))
+
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	mdb.addTranscriptTags(builder.features)
+
+	for _, feature := range builder.features {
+		feature.OfficialId = mdb.genes[strings.ToLower(feature.GeneId)].OfficialId
+	}
+
+	return builder.features, nil
+}
+
+// the first n genes matching match, or all of them if n is NoLimit
+func (mdb *MemGeneDB) searchGenes(match func(gene *MemGene) bool, policy *TranscriptPolicy, n int16) ([]*GenomicFeature, error) {
+	ret := make([]*GenomicFeature, 0, 10)
+
+	for _, gene := range mdb.symbolGenes {
+		if len(ret) == int(n) {
+			break
+		}
+
+		if !match(gene) || !policy.keepsMemGene(gene) {
+			continue
+		}
+
+		location, err := dna.NewStrandedLocation(gene.Chr, gene.Start, gene.End, gene.Strand)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, &GenomicFeature{Id: mdb.geneIds[gene],
+			Location:   location,
+			Type:       GeneLevel,
+			Symbol:     gene.Symbol,
+			GeneId:     gene.Id,
+			OfficialId: gene.OfficialId,
+			Biotype:    gene.Biotype,
+		})
+	}
+
+	return ret, nil
+}
+
+// CollapsedGeneModel returns the union of the exons of a gene as
+// GtfDB.CollapsedGeneModel does
+func (mdb *MemGeneDB) CollapsedGeneModel(geneId string) (*GenomicFeature, error) {
+	gene, ok := mdb.genes[strings.ToLower(StripIdVersion(geneId))]
+
+	if !ok {
+		return nil, fmt.Errorf("gene %s not found", geneId)
+	}
+
+	models, err := mdb.geneModels([]int{mdb.geneIds[gene]})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(models) == 0 {
+		return nil, fmt.Errorf("gene %s has no exons", geneId)
+	}
+
+	model := models[0]
+
+	err = CollapseGene(model)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return model, matchVersions(mdb.AddVersions, models, geneId)
+}
+
+// the uncollapsed models of genes by row id as GtfDB.geneModels gives
+// them, leaving out genes without exons
+func (mdb *MemGeneDB) geneModels(ids []int) ([]*GenomicFeature, error) {
+	builder := newFeatureBuilder("gene,transcript,exon", false)
+
+	for _, id := range ids {
+		gene, ok := mdb.geneByRowId(id)
+
+		if !ok {
+			continue
+		}
+
+		for _, transcript := range gene.Transcripts {
+			for _, feature := range transcript.Features {
+				if feature.Type != ExonLevel {
+					continue
+				}
+
+				err := builder.add(mdb.row(gene, transcript, feature))
+
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return builder.features, nil
+}
+
+// add the rows of some features of a transcript, which are annotated
+// relative to the location if the builder is in annotation mode
+func (mdb *MemGeneDB) addFeatures(builder *featureBuilder,
+	gene *MemGene,
+	transcript *MemTranscript,
+	features []*MemFeature,
+	location *dna.Location,
+	prom *dna.PromoterRegion) error {
+	for _, feature := range features {
+		row := mdb.row(gene, transcript, feature)
+
+		if builder.annotationMode {
+			row.tssDist = memTssDist(gene.Strand, transcript, location)
+			row.inPromoter = memInPromoter(gene.Strand, transcript, location, prom)
+			row.inExon = location.Start() <= feature.End && location.End() >= feature.Start
+			row.isIntragenic = location.Start() <= transcript.End && location.End() >= transcript.Start
+		}
+
+		err := builder.add(row)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (mdb *MemGeneDB) row(gene *MemGene, transcript *MemTranscript, feature *MemFeature) *featureRow {
+	return &featureRow{gid: mdb.geneIds[gene],
+		chr:               gene.Chr,
+		geneStart:         gene.Start,
+		geneEnd:           gene.End,
+		strand:            gene.Strand,
+		geneId:            gene.Id,
+		geneSymbol:        gene.Symbol,
+		geneBiotype:       gene.Biotype,
+		transcriptId:      transcript.Id,
+		transcriptStart:   transcript.Start,
+		transcriptEnd:     transcript.End,
+		isCanonical:       transcript.IsCanonical,
+		isLongest:         transcript.IsLongest,
+		transcriptBiotype: transcript.Biotype,
+		featureType:       feature.Type,
+		featureStart:      feature.Start,
+		featureEnd:        feature.End,
+		exonId:            feature.ExonId,
+		exonNumber:        feature.ExonNumber}
+}
+
+// set the tags and TSL of transcripts, including those that are
+// children of genes
+func (mdb *MemGeneDB) addTranscriptTags(features []*GenomicFeature) {
+	for _, feature := range features {
+		if feature.Type == TranscriptLevel {
+			if ref, ok := mdb.transcripts[strings.ToLower(feature.Transcript)]; ok {
+				feature.Tags = slices.Clone(ref.transcript.Tags)
+				feature.Tsl = ref.transcript.Tsl
+			}
+		}
+
+		mdb.addTranscriptTags(feature.Children)
+	}
+}
+
+func memTssDist(strand string, transcript *MemTranscript, location *dna.Location) int {
+	if strand == "+" {
+		return location.Mid() - transcript.Start
+	}
+
+	return location.Mid() - transcript.End
+}
+
+func memInPromoter(strand string, transcript *MemTranscript, location *dna.Location, prom *dna.PromoterRegion) bool {
+	switch strand {
+	case "+":
+		return location.Start() <= transcript.Start+prom.Downstream() && location.End() >= transcript.Start-prom.Upstream()
+	case "-":
+		return location.Start() <= transcript.End+prom.Upstream() && location.End() >= transcript.End-prom.Downstream()
+	default:
+		return false
+	}
+}
+
+// whether a location overlaps a transcript or its promoter, which
+// for short transcripts can extend past the end of the transcript
+func memInTranscriptOrPromoter(strand string, transcript *MemTranscript, location *dna.Location, prom *dna.PromoterRegion) bool {
+	switch strand {
+	case "+":
+		return location.Start() <= max(transcript.End, transcript.Start+prom.Downstream()) &&
+			location.End() >= transcript.Start-prom.Upstream()
+	case "-":
+		return location.Start() <= transcript.End+prom.Upstream() &&
+			location.End() >= min(transcript.Start, transcript.End-prom.Downstream())
+	default:
+		return false
+	}
+}
+
+// memTranscripts returns the transcripts of a gene a policy keeps
+// using the same rules as MakeTranscriptPolicySql
+func (policy *TranscriptPolicy) memTranscripts(gene *MemGene) []*MemTranscript {
+	if policy == nil {
+		return gene.Transcripts
+	}
+
+	if !policy.keepsMemGene(gene) {
+		return nil
+	}
+
+	ret := make([]*MemTranscript, 0, len(gene.Transcripts))
+
+	for _, transcript := range gene.Transcripts {
+		biotype := strings.ToLower(transcript.Biotype)
+
+		if len(policy.includeBiotypes) > 0 && !slices.Contains(policy.includeBiotypes, biotype) {
+			continue
+		}
+
+		if slices.Contains(policy.excludeBiotypes, biotype) {
+			continue
+		}
+
+		ret = append(ret, transcript)
+	}
+
+	if len(policy.criteria) == 0 || len(ret) == 0 {
+		return ret
+	}
+
+	// transcripts are in id order so ties go to the lowest id
+	best := ret[0]
+
+	for _, transcript := range ret[1:] {
+		if policy.compareMemTranscripts(transcript, best) < 0 {
+			best = transcript
+		}
+	}
+
+	return []*MemTranscript{best}
+}
+
+// negative if a is preferred to b
+func (policy *TranscriptPolicy) compareMemTranscripts(a *MemTranscript, b *MemTranscript) int {
+	for _, criterion := range policy.criteria {
+		var c int
+
+		switch criterion {
+		case CanonicalCriterion:
+			c = compareFlags(a.IsCanonical, b.IsCanonical)
+		case LongestCriterion:
+			c = compareFlags(a.IsLongest, b.IsLongest)
+		case TslCriterion:
+			c = memTsl(a) - memTsl(b)
+		case ApprisCriterion:
+			c = compareFlags(a.hasTagPrefix("appris_principal"), b.hasTagPrefix("appris_principal"))
+		default:
+			tag := policyTag(criterion)
+			c = compareFlags(slices.Contains(a.Tags, tag), slices.Contains(b.Tags, tag))
+		}
+
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// true sorts first
+func compareFlags(a bool, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func memTsl(transcript *MemTranscript) int {
+	if transcript.Tsl == 0 {
+		return MissingTsl
+	}
+
+	return transcript.Tsl
+}
+
+func (transcript *MemTranscript) hasTagPrefix(prefix string) bool {
+	return slices.ContainsFunc(transcript.Tags, func(tag string) bool {
+		return strings.HasPrefix(strings.ToLower(tag), prefix)
+	})
+}
@@ -0,0 +1,424 @@
+package genome_test
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+// the current fixture annotation loaded from GTF
+func memGeneDB(t *testing.T) *genome.MemGeneDB {
+	t.Helper()
+
+	var gtf bytes.Buffer
+
+	err := genometest.WriteGtf(&gtf, genometest.Genes())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genes, err := genome.ParseGtf(&gtf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// aliases and xrefs come from HGNC rather than the GTF
+	fixture := make(map[string]*genometest.Gene)
+
+	for _, gene := range genometest.Genes() {
+		fixture[gene.Id] = gene
+	}
+
+	for _, gene := range genes {
+		gene.Aliases = fixture[gene.Id].Aliases
+		gene.Xrefs = fixture[gene.Id].Xrefs
+	}
+
+	return genome.NewMemGeneDB(&genome.Annotation{PublicId: genometest.GtfId}, genes)
+}
+
+// every field of the features that is part of the query results
+func dump(features []*genome.GenomicFeature, depth int) []string {
+	ret := make([]string, 0, len(features))
+
+	for _, feature := range features {
+		ret = append(ret, fmt.Sprintf("%s%s %s%s %s %s %s %s %s %d %s %d %v %v %v %v %v %v %d %v %d %v %s %s %v %s %s %s %s",
+			strings.Repeat("  ", depth),
+			feature.Type,
+			feature.Location,
+			feature.Location.Strand(),
+			feature.GeneId,
+			feature.Symbol,
+			feature.Biotype,
+			feature.Transcript,
+			feature.Exon,
+			feature.ExonNumber,
+			feature.Label,
+			feature.TssDist,
+			feature.InPromoter,
+			feature.InExon,
+			feature.IsIntragenic,
+			feature.IsCanonical,
+			feature.IsLongest,
+			feature.IsConstitutive,
+			feature.ExonicLength,
+			feature.Tags,
+			feature.Tsl,
+			feature.Score,
+			feature.MatchedAlias,
+			feature.MatchedXref,
+			feature.Xrefs,
+			feature.OfficialId,
+			feature.Version,
+			feature.MatchedVersion,
+			feature.Description))
+
+		ret = append(ret, dump(feature.Children, depth+1)...)
+	}
+
+	return ret
+}
+
+func TestParseGtf(t *testing.T) {
+	gtf := strings.Join([]string{
+		"##description: test",
+		"chr1\tTEST\tgene\t100\t900\t.\t-\t.\tgene_id \"ENSG1.4\"; gene_type \"protein_coding\"; gene_name \"ABC\"; hgnc_id \"HGNC:7\";",
+		"chr1\tTEST\ttranscript\t100\t500\t.\t-\t.\tgene_id \"ENSG1.4\"; transcript_id \"ENST1.2\"; transcript_type \"protein_coding\"; transcript_support_level \"2 (assigned to previous version 1)\"; tag \"basic\"; tag \"CCDS\";",
+		"chr1\tTEST\texon\t100\t500\t.\t-\t.\tgene_id \"ENSG1.4\"; transcript_id \"ENST1.2\"; exon_number 1; exon_id \"ENSE1.1\";",
+		"chr1\tTEST\tCDS\t150\t400\t.\t-\t0\tgene_id \"ENSG1.4\"; transcript_id \"ENST1.2\"; exon_number 1; exon_id \"ENSE1.1\";",
+		"chr1\tTEST\ttranscript\t100\t900\t.\t-\t.\tgene_id \"ENSG1.4\"; transcript_id \"ENST2.1\"; transcript_type \"retained_intron\"; transcript_support_level \"NA\";",
+		"chr1\tTEST\texon\t100\t200\t.\t-\t.\tgene_id \"ENSG1.4\"; transcript_id \"ENST2.1\"; exon_number 2; exon_id \"ENSE2.1\";",
+		"chr1\tTEST\texon\t800\t900\t.\t-\t.\tgene_id \"ENSG1.4\"; transcript_id \"ENST2.1\"; exon_number 1; exon_id \"ENSE3.1\";",
+		// a gene described only by its exons
+		"chr2\tTEST\texon\t50\t60\t.\t+\t.\tgene_id \"ENSG2\"; gene_biotype \"lncRNA\"; transcript_id \"ENST3\"; transcript_biotype \"lncRNA\"; exon_number \"1\"; exon_id \"ENSE4\";",
+	}, "\n")
+
+	genes, err := genome.ParseGtf(strings.NewReader(gtf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 2 {
+		t.Fatalf("got %d genes, want 2", len(genes))
+	}
+
+	gene := genes[0]
+
+	if gene.Id != "ENSG1" || gene.Version != "4" || gene.Symbol != "ABC" || gene.OfficialId != "HGNC:7" || gene.Start != 100 || gene.End != 900 {
+		t.Errorf("gene = %+v", gene)
+	}
+
+	t1 := gene.Transcripts[0]
+	t2 := gene.Transcripts[1]
+
+	if t1.Id != "ENST1" || t1.Version != "2" || t1.Tsl != 2 || !slices.Equal(t1.Tags, []string{"basic", "CCDS"}) || len(t1.Features) != 2 {
+		t.Errorf("transcript = %+v", t1)
+	}
+
+	if t1.Features[1].Type != "cds" || t1.Features[1].ExonId != "ENSE1" || t1.Features[1].ExonVersion != "1" || t1.Features[1].ExonNumber != 1 {
+		t.Errorf("cds = %+v", t1.Features[1])
+	}
+
+	// without a canonical tag the longest transcript is canonical
+	if t1.IsCanonical || t1.IsLongest || !t2.IsCanonical || !t2.IsLongest || t2.Tsl != 0 {
+		t.Errorf("canonical %v %v longest %v %v", t1.IsCanonical, t2.IsCanonical, t1.IsLongest, t2.IsLongest)
+	}
+
+	gene = genes[1]
+
+	if gene.Symbol != "ENSG2" || gene.Biotype != "lncRNA" || gene.Start != 50 || gene.End != 60 ||
+		gene.Transcripts[0].Start != 50 || !gene.Transcripts[0].IsCanonical {
+		t.Errorf("gene = %+v", gene)
+	}
+}
+
+// the in-memory genes should answer every query exactly as the
+// database made from the same genes
+func TestMemGeneDBMatchesGtfDB(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+	mdb := memGeneDB(t)
+
+	prom := dna.DefaultPromoterRegion()
+
+	tests := []struct {
+		name  string
+		query func(db genome.GeneDB) ([]*genome.GenomicFeature, error)
+	}{
+		{"overlap all levels", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.OverlappingGenes(location(t, "chr1", 1, 40000), genome.AllLevels, prom, nil, false)
+		}},
+		{"overlap annotation", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.OverlappingGenes(location(t, "chr1", 1150, 4200), genome.AllLevels, prom, nil, true)
+		}},
+		{"overlap policy", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			p, err := policy(t, "tsl,longest").WithGeneBiotypes([]string{"protein_coding"}, nil)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return db.OverlappingGenes(location(t, "chr1", 1, 40000), "gene,transcript", prom, p, false)
+		}},
+		{"overlap collapsed", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.OverlappingGenes(location(t, "chr1", 8100, 8200), genome.CollapsedLevel, prom, nil, true)
+		}},
+		{"within", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			results, err := db.WithinGenes(location(t, "chr1", 9000, 9100), genome.AllLevels, prom)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return results.Features, nil
+		}},
+		{"intragenic", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.IntragenicFeatures(location(t, "chr1", 12500, 12600), "gene,transcript", prom, nil, true)
+		}},
+		{"intragenic biotypes", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			p, err := policy(t, "mane").WithBiotypes(nil, []string{"protein_coding"})
+
+			if err != nil {
+				return nil, err
+			}
+
+			return db.IntragenicFeatures(location(t, "chr1", 1000, 9000), "gene,transcript", prom, p, false)
+		}},
+		{"overlap gene biotypes", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			p, err := policy(t, "canonical").WithGeneBiotypes([]string{genome.CodingBiotypes, genome.LncRnaBiotypes}, []string{"lncrna"})
+
+			if err != nil {
+				return nil, err
+			}
+
+			return db.OverlappingGenes(location(t, "chr1", 1, 40000), "gene,transcript", prom, p, false)
+		}},
+		{"closest gene biotypes", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.ClosestGenes(location(t, "chr1", 1000, 1000), prom, 3, geneBiotypes(t, []string{genome.LncRnaBiotypes}, nil), false)
+		}},
+		{"search gene biotypes", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("gene", genome.GeneLevel, geneBiotypes(t, []string{genome.CodingBiotypes}, []string{"lncrna"}), 10)
+		}},
+		{"in exon", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.InExon(location(t, "chr1", 1100, 2100), "enst00000000001", prom)
+		}},
+		{"closest", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.ClosestGenes(location(t, "chr1", 15000, 15000), prom, 3, policy(t, "canonical"), false)
+		}},
+		{"search genes", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("gene", genome.GeneLevel, nil, 10)
+		}},
+		{"search transcripts", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("GENEA", genome.TranscriptLevel, nil, 10)
+		}},
+		{"search exons", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("geneb", genome.ExonLevel, nil, 4)
+		}},
+		{"search alias", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("delta", genome.ExonLevel, policy(t, "mane"), 10)
+		}},
+		{"search alias limit", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("Delta", genome.GeneLevel, nil, 1)
+		}},
+		{"search official id", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("hgnc:4", genome.TranscriptLevel, nil, 10)
+		}},
+		{"search xref", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("p00045", genome.ExonLevel, nil, 10)
+		}},
+		{"xrefs", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			features, err := db.SearchByName("genea", genome.TranscriptLevel, nil, 10)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return features, db.(genome.XrefAdder).AddXrefs(features)
+		}},
+		{"descriptions", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			features, err := db.OverlappingGenes(location(t, "chr1", 1, 40000), "gene,transcript", prom, nil, false)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return features, db.(genome.DescriptionAdder).AddDescriptions(features)
+		}},
+		{"search page", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			page, err := db.(genome.GeneSearcher).Search("delta", genome.TranscriptLevel, policy(t, "mane"), false, 1, "")
+
+			if err != nil {
+				return nil, err
+			}
+
+			page, err = db.(genome.GeneSearcher).Search("delta", genome.TranscriptLevel, policy(t, "mane"), false, 1, page.Next)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return page.Features, nil
+		}},
+		{"search page genes", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			page, err := db.(genome.GeneSearcher).Search("GENE", genome.GeneLevel, nil, false, 10, "")
+
+			if err != nil {
+				return nil, err
+			}
+
+			return page.Features, nil
+		}},
+		{"search exon pages", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			features := make([]*genome.GenomicFeature, 0, 4)
+
+			cursor := ""
+
+			for {
+				page, err := db.(genome.GeneSearcher).Search("delta", genome.ExonLevel, nil, false, 1, cursor)
+
+				if err != nil {
+					return nil, err
+				}
+
+				features = append(features, page.Features...)
+
+				if page.Next == "" {
+					return features, nil
+				}
+
+				cursor = page.Next
+			}
+		}},
+		{"fuzzy transcript pages", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			page, err := db.(genome.GeneSearcher).Search("genae", genome.TranscriptLevel, policy(t, "mane"), true, 1, "")
+
+			if err != nil {
+				return nil, err
+			}
+
+			page, err = db.(genome.GeneSearcher).Search("genae", genome.TranscriptLevel, policy(t, "mane"), true, 1, page.Next)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return page.Features, nil
+		}},
+		{"fuzzy page", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			page, err := db.(genome.GeneSearcher).Search("genae", genome.TranscriptLevel, nil, true, 2, "")
+
+			if err != nil {
+				return nil, err
+			}
+
+			return page.Features, nil
+		}},
+		{"search versioned ids", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("ENST00000000002.1", genome.ExonLevel, nil, 10)
+		}},
+		{"search versioned exon", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.SearchByName("ENSE00000000001.2", genome.ExonLevel, nil, 10)
+		}},
+		{"versions", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			features, err := db.SearchByName("geneb", genome.ExonLevel, nil, 10)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return features, db.(genome.VersionAdder).AddVersions(features)
+		}},
+		{"fuzzy versioned id", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.FuzzySearchByName("ENSG00000000002.3", genome.TranscriptLevel, nil, 10)
+		}},
+		{"fuzzy alias", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.FuzzySearchByName("alpah", genome.TranscriptLevel, nil, 10)
+		}},
+		{"fuzzy genes", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.FuzzySearchByName("GENED", genome.GeneLevel, nil, 10)
+		}},
+		{"fuzzy transcripts", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.FuzzySearchByName("genae", genome.TranscriptLevel, policy(t, "tsl"), 10)
+		}},
+		{"fuzzy exons", func(db genome.GeneDB) ([]*genome.GenomicFeature, error) {
+			return db.FuzzySearchByName("ENSG00000000004", genome.ExonLevel, nil, 2)
+		}},
+	}
+
+	for _, test := range tests {
+		want, err := test.query(gdb)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		got, err := test.query(mdb)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if len(want) == 0 {
+			t.Errorf("%s: no features", test.name)
+		}
+
+		if w, g := dump(want, 0), dump(got, 0); !slices.Equal(w, g) {
+			t.Errorf("%s:\nwant:\n%s\ngot:\n%s", test.name, strings.Join(w, "\n"), strings.Join(g, "\n"))
+		}
+	}
+}
+
+func TestMemGeneDBResolveIdsMatchesGtfDB(t *testing.T) {
+	ids := []string{"GENEA", "ENSG00000000002.3", "enst00000000007", "HGNC:5", "DELTA", "alpha", "ENSG00000000003", "unknown",
+		"nm_000011", "P00045"}
+
+	want, err := openGtf(t, genometest.GtfId).ResolveIds(ids)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := memGeneDB(t).ResolveIds(ids)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w, g := describeResolved(want), describeResolved(got); !slices.Equal(w, g) {
+		t.Fatalf("want %q\ngot %q", w, g)
+	}
+
+	for i := range want {
+		for j := range want[i].Features {
+			if w, g := dump(want[i].Features[j:j+1], 0), dump(got[i].Features[j:j+1], 0); !slices.Equal(w, g) {
+				t.Errorf("%s:\nwant:\n%s\ngot:\n%s", ids[i], strings.Join(w, "\n"), strings.Join(g, "\n"))
+			}
+		}
+	}
+}
+
+func TestAnnotateMemGeneDB(t *testing.T) {
+	annotateDb := genome.NewGtfAnnotateDb(memGeneDB(t), dna.DefaultPromoterRegion(), 3, true, nil)
+
+	annotation, err := annotateDb.Annotate(location(t, "chr1", 1050, 1060), genome.GeneLevel)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(annotation.WithinGenes); !slices.Equal(got, []string{"GENEA"}) {
+		t.Fatalf("within genes = %v", got)
+	}
+
+	if got := symbols(annotation.ClosestGenes); !slices.Equal(got, []string{"GENEA", "GENEB", "GENED"}) {
+		t.Errorf("closest genes = %v", got)
+	}
+}
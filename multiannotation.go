@@ -0,0 +1,177 @@
+package genome
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/antonybholmes/go-dna"
+	basemath "github.com/antonybholmes/go-sys/math"
+)
+
+//
+// Annotation of locations against several annotation databases at once,
+// e.g. GENCODE basic, GENCODE comprehensive and RefSeq
+//
+
+type (
+	SourceAnnotation struct {
+		Source     *Annotation     `json:"source"`
+		Annotation *GeneAnnotation `json:"annotation"`
+	}
+
+	// The nearest gene most sources agree on. Sources can use different
+	// ids for the same gene, e.g. Ensembl vs RefSeq, so genes are
+	// matched by symbol.
+	ConsensusGene struct {
+		Symbol string `json:"symbol"`
+		// ids of the gene in each source that agreed
+		GeneIds []string `json:"geneIds"`
+		// number of sources whose nearest gene this is
+		Votes int `json:"votes"`
+		// number of sources with a nearest gene
+		Sources int `json:"sources"`
+		// the smallest absolute tss distance across the sources
+		TssDist int `json:"tssDist"`
+		// every source agrees
+		Unanimous bool `json:"unanimous"`
+	}
+
+	MultiGeneAnnotation struct {
+		Location  *dna.Location       `json:"loc"`
+		Sources   []*SourceAnnotation `json:"sources"`
+		Consensus *ConsensusGene      `json:"consensus,omitempty"`
+		// set when the location was lifted from another assembly
+		Liftover *LiftResult `json:"liftover,omitempty"`
+	}
+
+	// Runs the same annotation against each database
+	GtfMultiAnnotateDb struct {
+		Sources []*GtfAnnotateDb
+	}
+)
+
+var ErrMixedAssemblies = errors.New("annotations must be for the same assembly")
+
+// CheckSameAssembly returns ErrMixedAssemblies unless every database
+// is for the same assembly, since a location is only valid in one
+func CheckSameAssembly(gtfdbs []GeneDB) error {
+	if len(gtfdbs) == 0 {
+		return nil
+	}
+
+	first := gtfdbs[0].Annotation()
+
+	for _, gtfdb := range gtfdbs[1:] {
+		annotation := gtfdb.Annotation()
+
+		if annotation.Assembly != first.Assembly {
+			return fmt.Errorf("%w: %s is %s, %s is %s", ErrMixedAssemblies,
+				first.PublicId, first.Assembly,
+				annotation.PublicId, annotation.Assembly)
+		}
+	}
+
+	return nil
+}
+
+func NewGtfMultiAnnotateDb(gtfdbs []GeneDB, tssRegion *dna.PromoterRegion, closestN int8, useOfficialGenes bool, policy *TranscriptPolicy) *GtfMultiAnnotateDb {
+	sources := make([]*GtfAnnotateDb, 0, len(gtfdbs))
+
+	for _, gtfdb := range gtfdbs {
+		sources = append(sources, NewGtfAnnotateDb(gtfdb, tssRegion, closestN, useOfficialGenes, policy))
+	}
+
+	return &GtfMultiAnnotateDb{Sources: sources}
+}
+
+func (multiDb *GtfMultiAnnotateDb) Annotate(location *dna.Location, levels string) (*MultiGeneAnnotation, error) {
+	ret := MultiGeneAnnotation{Location: location, Sources: make([]*SourceAnnotation, 0, len(multiDb.Sources))}
+
+	for _, annotateDb := range multiDb.Sources {
+		annotation, err := annotateDb.Annotate(location, levels)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret.Sources = append(ret.Sources, &SourceAnnotation{Source: annotateDb.GeneDB.Annotation(), Annotation: annotation})
+	}
+
+	ret.Consensus = ConsensusNearestGene(ret.Sources)
+
+	return &ret, nil
+}
+
+// ConsensusNearestGene finds the nearest gene of each source and
+// returns the one with the most votes. Ties are broken by the smallest
+// tss distance. Returns nil if no source has a nearest gene.
+func ConsensusNearestGene(sources []*SourceAnnotation) *ConsensusGene {
+	votes := make(map[string]*ConsensusGene)
+
+	// keep the order genes were first seen so ties are deterministic
+	order := make([]*ConsensusGene, 0, len(sources))
+
+	n := 0
+
+	for _, source := range sources {
+		nearest := nearestGene(source.Annotation.ClosestGenes)
+
+		if nearest == nil {
+			continue
+		}
+
+		n++
+
+		key := strings.ToUpper(nearest.Symbol)
+
+		gene, ok := votes[key]
+
+		if !ok {
+			gene = &ConsensusGene{Symbol: nearest.Symbol,
+				GeneIds: make([]string, 0, len(sources)),
+				TssDist: nearest.TssDist}
+
+			votes[key] = gene
+			order = append(order, gene)
+		}
+
+		gene.Votes++
+		gene.GeneIds = append(gene.GeneIds, nearest.GeneId)
+
+		if basemath.AbsInt(nearest.TssDist) < basemath.AbsInt(gene.TssDist) {
+			gene.TssDist = nearest.TssDist
+		}
+	}
+
+	var ret *ConsensusGene
+
+	for _, gene := range order {
+		gene.Sources = n
+
+		if ret == nil ||
+			gene.Votes > ret.Votes ||
+			(gene.Votes == ret.Votes && basemath.AbsInt(gene.TssDist) < basemath.AbsInt(ret.TssDist)) {
+			ret = gene
+		}
+	}
+
+	if ret != nil {
+		ret.Unanimous = ret.Votes == n
+	}
+
+	return ret
+}
+
+// the gene whose tss is closest to the location
+func nearestGene(genes []*GenomicFeature) *GenomicFeature {
+	var ret *GenomicFeature
+
+	for _, gene := range genes {
+		if ret == nil || basemath.AbsInt(gene.TssDist) < basemath.AbsInt(ret.TssDist) {
+			ret = gene
+		}
+	}
+
+	return ret
+}
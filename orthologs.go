@@ -0,0 +1,148 @@
+package genome
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+//
+// Orthologs of genes in other genomes, e.g. human and mouse, from HGNC
+// HCOP or Ensembl Compara, so that a gene can be found in the annotation
+// of another genome.
+//
+
+type (
+	Ortholog struct {
+		// unversioned Ensembl id in the other genome
+		GeneId string `json:"geneId"`
+		Symbol string `json:"symbol"`
+		// e.g. the databases supporting an HCOP prediction or a
+		// Compara homology type
+		Source string `json:"source,omitempty"`
+		// the gene in the target annotation, nil if it is not there
+		Feature *GenomicFeature `json:"feature,omitempty"`
+	}
+
+	OrthologMapping struct {
+		// the gene in this annotation
+		Gene      *GenomicFeature `json:"gene"`
+		Orthologs []*Ortholog     `json:"orthologs"`
+	}
+)
+
+const (
+	OrthologsSql = `SELECT o.gene_id, o.ortholog_gene_id, o.ortholog_symbol, o.source
+		FROM gene_orthologs AS o
+		WHERE o.gene_id IN (<<IDS>>) AND LOWER(o.genome) = LOWER(:genome)
+		ORDER BY o.gene_id, o.ortholog_symbol, o.ortholog_gene_id`
+)
+
+// databases created by older importers do not have orthologs
+func (gdb *GtfDB) hasGeneOrthologs() bool {
+	gdb.orthologsOnce.Do(func() {
+		gdb.hasOrthologs = gdb.hasTable("gene_orthologs")
+	})
+
+	return gdb.hasOrthologs
+}
+
+// Orthologs maps the genes that id resolves to, as ResolveIds resolves
+// them, to their orthologs in the genome of target. Orthologs annotated
+// in target have their gene from target so its coordinates are in the
+// target assembly.
+func (gdb *GtfDB) Orthologs(id string, target GeneDB) ([]*OrthologMapping, error) {
+	resolved, err := gdb.ResolveIds([]string{id})
+
+	if err != nil {
+		return nil, err
+	}
+
+	genes := resolved[0].Features
+
+	ret := make([]*OrthologMapping, 0, len(genes))
+
+	mappings := make(map[int]*OrthologMapping, len(genes))
+
+	ids := make([]int, 0, len(genes))
+
+	for _, gene := range genes {
+		mapping := &OrthologMapping{Gene: gene, Orthologs: []*Ortholog{}}
+
+		ret = append(ret, mapping)
+
+		mappings[gene.Id] = mapping
+
+		ids = append(ids, gene.Id)
+	}
+
+	if len(ids) == 0 || !gdb.hasGeneOrthologs() {
+		return ret, nil
+	}
+
+	query, namedArgs := inSql(OrthologsSql, "g", ids)
+
+	rows, err := gdb.db.Query(query, append(namedArgs, sql.Named("genome", target.Annotation().Genome))...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	orthologs := make([]*Ortholog, 0, 10)
+	orthologIds := make([]string, 0, 10)
+
+	for rows.Next() {
+		var geneId int
+		var ortholog Ortholog
+
+		err := rows.Scan(&geneId, &ortholog.GeneId, &ortholog.Symbol, &ortholog.Source)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mapping := mappings[geneId]
+
+		mapping.Orthologs = append(mapping.Orthologs, &ortholog)
+
+		orthologs = append(orthologs, &ortholog)
+		orthologIds = append(orthologIds, ortholog.GeneId)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, addOrthologGenes(orthologs, orthologIds, target)
+}
+
+// sets the genes of orthologs from the target annotation, matching
+// them by gene id only
+func addOrthologGenes(orthologs []*Ortholog, ids []string, target GeneDB) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	resolver, ok := target.(GeneResolver)
+
+	if !ok {
+		return fmt.Errorf("%s cannot resolve gene ids", target.Annotation().PublicId)
+	}
+
+	resolved, err := resolver.ResolveIds(ids)
+
+	if err != nil {
+		return err
+	}
+
+	for i, r := range resolved {
+		if r.Status == ResolvedMatched && r.MatchedBy == GeneIdMatch {
+			orthologs[i].Feature = r.Features[0]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package genome_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+func TestOrthologs(t *testing.T) {
+	human := openGtf(t, genometest.GtfId)
+	mouse := openGtf(t, genometest.MouseGtfId)
+
+	mappings, err := human.Orthologs("GENED", mouse)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mappings) != 1 || mappings[0].Gene.Symbol != "GENED" {
+		t.Fatalf("mappings = %v", mappings)
+	}
+
+	orthologs := mappings[0].Orthologs
+
+	symbols := make([]string, 0, len(orthologs))
+
+	for _, ortholog := range orthologs {
+		symbols = append(symbols, ortholog.Feature.Symbol)
+	}
+
+	if !slices.Equal(symbols, []string{"Gened", "Gened2"}) {
+		t.Fatalf("orthologs of GENED = %v", symbols)
+	}
+
+	// coordinates are those of the mouse annotation
+	if gene := orthologs[0].Feature; gene.Location.Chr() != "chr2" || gene.Location.Start() != 20001 ||
+		orthologs[0].Source != "Ensembl,HGNC" {
+		t.Errorf("Gened = %v %s", gene.Location, orthologs[0].Source)
+	}
+
+	// an ortholog not in the target annotation has no gene
+	mappings, err = human.Orthologs("ENSG00000000002", mouse)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mappings) != 1 || len(mappings[0].Orthologs) != 1 ||
+		mappings[0].Orthologs[0].Symbol != "Geneb" || mappings[0].Orthologs[0].Feature != nil {
+		t.Errorf("orthologs of GENEB = %+v", mappings[0].Orthologs)
+	}
+
+	// mouse to human
+	mappings, err = mouse.Orthologs("MGI:1", human)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mappings) != 1 || len(mappings[0].Orthologs) != 1 || mappings[0].Orthologs[0].Feature.Symbol != "GENEA" {
+		t.Errorf("orthologs of Genea = %+v", mappings)
+	}
+
+	// orthologs are only of the genome of the target
+	mappings, err = human.Orthologs("GENEA", openGtf(t, genometest.OldGtfId))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mappings) != 1 || len(mappings[0].Orthologs) != 0 {
+		t.Errorf("human orthologs of GENEA = %+v", mappings[0].Orthologs)
+	}
+
+	// genes that are not found have no mappings
+	mappings, err = human.Orthologs("NOTAGENE", mouse)
+
+	if err != nil || len(mappings) != 0 {
+		t.Errorf("NOTAGENE = %v, %v", mappings, err)
+	}
+
+	// older databases do not have orthologs
+	mappings, err = openGtf(t, genometest.OldGtfId).Orthologs("GENEA", mouse)
+
+	if err != nil || len(mappings) != 1 || len(mappings[0].Orthologs) != 0 {
+		t.Errorf("old GENEA = %v, %v", mappings, err)
+	}
+}
@@ -0,0 +1,125 @@
+package genome
+
+import (
+	"io"
+	"strings"
+)
+
+//
+// Translation of coding transcripts into protein
+//
+
+type (
+	TranscriptProtein struct {
+		Transcript *GenomicFeature `json:"transcript"`
+		// one letter amino acids without the terminal *
+		Protein    string `json:"protein"`
+		CodonTable string `json:"codonTable"`
+		// the transcript has a start_codon feature and the first
+		// codon of the CDS is a start codon
+		HasStart bool `json:"hasStart"`
+		// the transcript has a stop_codon feature and the CDS ends
+		// with a stop codon
+		HasStop bool `json:"hasStop"`
+		// the CDS is missing a start or stop, is not a multiple of
+		// 3 or contains a premature stop, so the protein may not be
+		// the real one
+		Incomplete bool     `json:"incomplete,omitempty"`
+		Warnings   []string `json:"warnings,omitempty"`
+	}
+)
+
+const (
+	ProteinSequence string = "protein"
+
+	MissingStartWarning        string = "missing start codon"
+	MissingStopWarning         string = "missing stop codon"
+	PartialCodonWarning        string = "cds length is not a multiple of 3"
+	PrematureStopWarning       string = "premature stop codon"
+	StartCodonMismatchWarning  string = "start_codon feature is not a start codon"
+	StopCodonMismatchWarning   string = "stop_codon feature is not a stop codon"
+	NonCodingTranscriptWarning string = "transcript is not protein coding"
+)
+
+// TranscriptProtein translates a transcript using the codon table
+// of its chromosome. As with TranscriptSequences, only the transcript
+// id needs to be set.
+func (gdb *GtfDB) TranscriptProtein(transcript *GenomicFeature, seqs SequenceReader) (*TranscriptProtein, error) {
+	model, err := gdb.TranscriptModel(transcript.Transcript)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return model.Protein(seqs)
+}
+
+// Protein translates the CDS of the transcript. Non-coding transcripts
+// are returned with an empty protein and a warning rather than an
+// error so that mixed lists of transcripts can be translated.
+func (model *TranscriptModel) Protein(seqs SequenceReader) (*TranscriptProtein, error) {
+	table := CodonTableForChr(model.Transcript.Location.Chr())
+
+	ret := TranscriptProtein{Transcript: model.Transcript,
+		CodonTable: table.Name,
+		Warnings:   make([]string, 0, 2)}
+
+	if !model.IsCoding() {
+		ret.Incomplete = true
+		ret.Warnings = append(ret.Warnings, NonCodingTranscriptWarning)
+		return &ret, nil
+	}
+
+	sequences, err := model.Sequences(seqs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cds := sequences.Cds
+
+	if len(model.StartCodon) == 0 {
+		ret.Warnings = append(ret.Warnings, MissingStartWarning)
+	} else if len(cds) < 3 || !table.IsStart(cds[:3]) {
+		ret.Warnings = append(ret.Warnings, StartCodonMismatchWarning)
+	} else {
+		ret.HasStart = true
+	}
+
+	if len(model.StopCodon) == 0 {
+		ret.Warnings = append(ret.Warnings, MissingStopWarning)
+	} else if len(cds) < 3 || !table.IsStop(cds[len(cds)-3:]) {
+		ret.Warnings = append(ret.Warnings, StopCodonMismatchWarning)
+	} else {
+		ret.HasStop = true
+	}
+
+	if len(cds)%3 != 0 {
+		ret.Warnings = append(ret.Warnings, PartialCodonWarning)
+	}
+
+	protein := table.TranslateCds(cds)
+
+	// translation stops at the first stop so if that is before the
+	// end of the cds, the stop is premature
+	if strings.HasSuffix(protein, string(StopAminoAcid)) && len(protein) < len(cds)/3 {
+		ret.Warnings = append(ret.Warnings, PrematureStopWarning)
+	}
+
+	ret.Protein = strings.TrimSuffix(protein, string(StopAminoAcid))
+	ret.Incomplete = len(ret.Warnings) > 0
+
+	return &ret, nil
+}
+
+// WriteFasta writes the protein as FASTA using the same header style
+// as transcript sequences
+func (protein *TranscriptProtein) WriteFasta(w io.Writer) error {
+	err := writeFastaHeader(w, protein.Transcript, ProteinSequence)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFastaSequence(w, protein.Protein)
+}
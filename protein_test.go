@@ -0,0 +1,224 @@
+package genome_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+// a reference that is one base repeated
+type baseReader byte
+
+func (base baseReader) Sequence(location *dna.Location) (string, error) {
+	return strings.Repeat(string(base), location.End()-location.Start()+1), nil
+}
+
+func (base baseReader) Close() error {
+	return nil
+}
+
+// a reference of one codon repeated in frame from start
+type codonReader struct {
+	codon string
+	start int
+}
+
+func (reader codonReader) Sequence(location *dna.Location) (string, error) {
+	var seq strings.Builder
+
+	for p := location.Start(); p <= location.End(); p++ {
+		seq.WriteByte(reader.codon[((p-reader.start)%3+3)%3])
+	}
+
+	return seq.String(), nil
+}
+
+func (reader codonReader) Close() error {
+	return nil
+}
+
+func TestCodonTableForChr(t *testing.T) {
+	for _, chr := range []string{"chrM", "chrMT", "MT", "M", "chrm"} {
+		if table := genome.CodonTableForChr(chr); table != genome.VertebrateMitochondrialCodonTable {
+			t.Errorf("%s uses the %s table", chr, table.Name)
+		}
+	}
+
+	for _, chr := range []string{"chr1", "chrX", "2", "chrMTX"} {
+		if table := genome.CodonTableForChr(chr); table != genome.StandardCodonTable {
+			t.Errorf("%s uses the %s table", chr, table.Name)
+		}
+	}
+
+	// TGA is Trp and AGA a stop in vertebrate mitochondria
+	if got := genome.VertebrateMitochondrialCodonTable.TranslateSequence("ATGTGAAGACCC"); got != "MW*" {
+		t.Errorf("mitochondrial translation = %s", got)
+	}
+
+	if got := genome.StandardCodonTable.TranslateSequence("ATGTGAAGACCC"); got != "M*" {
+		t.Errorf("standard translation = %s", got)
+	}
+
+	// ATA is an alternative mitochondrial start translated as Met
+	if got := genome.VertebrateMitochondrialCodonTable.TranslateCds("ATAATATAG"); got != "MM*" {
+		t.Errorf("mitochondrial cds = %s", got)
+	}
+}
+
+func TestTranscriptProtein(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	seqs := openFasta(t)
+
+	for _, gene := range genometest.Genes() {
+		for _, transcript := range gene.Transcripts {
+			protein, err := gdb.TranscriptProtein(&genome.GenomicFeature{Transcript: transcript.Id}, seqs)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !transcript.IsCoding() {
+				if protein.Protein != "" || !slices.Equal(protein.Warnings, []string{genome.NonCodingTranscriptWarning}) {
+					t.Errorf("%s: non-coding protein %s warnings %v", transcript.Id, protein.Protein, protein.Warnings)
+				}
+
+				continue
+			}
+
+			codons := len(transcript.CodingSequence(gene.Strand)) / 3
+
+			if !protein.HasStart || !protein.HasStop || protein.Incomplete || len(protein.Warnings) > 0 {
+				t.Errorf("%s: start %v stop %v warnings %v", transcript.Id, protein.HasStart, protein.HasStop, protein.Warnings)
+			}
+
+			if !strings.HasPrefix(protein.Protein, "M") || len(protein.Protein) != codons-1 {
+				t.Errorf("%s: protein of length %d, want %d", transcript.Id, len(protein.Protein), codons-1)
+			}
+
+			if protein.CodonTable != genome.StandardCodonTable.Name {
+				t.Errorf("%s: codon table %s", transcript.Id, protein.CodonTable)
+			}
+		}
+	}
+}
+
+func TestTranscriptProteinWarnings(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	seqs := openFasta(t)
+
+	complete, err := gdb.TranscriptProtein(&genome.GenomicFeature{Transcript: "ENST00000000001"}, seqs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without start_codon and stop_codon features the protein is the
+	// same but cannot be trusted
+	model, err := gdb.TranscriptModel("ENST00000000001")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model.StartCodon = nil
+	model.StopCodon = nil
+
+	protein, err := model.Protein(seqs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if protein.HasStart || protein.HasStop || !protein.Incomplete ||
+		!slices.Equal(protein.Warnings, []string{genome.MissingStartWarning, genome.MissingStopWarning}) {
+		t.Errorf("missing codons: start %v stop %v warnings %v", protein.HasStart, protein.HasStop, protein.Warnings)
+	}
+
+	if protein.Protein != complete.Protein {
+		t.Errorf("missing codons changed the protein")
+	}
+
+	// codon features over a reference of CCC codons match neither a
+	// start nor a stop
+	model, err = gdb.TranscriptModel("ENST00000000001")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protein, err = model.Protein(baseReader('C'))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if protein.HasStart || protein.HasStop || !protein.Incomplete ||
+		!slices.Equal(protein.Warnings, []string{genome.StartCodonMismatchWarning, genome.StopCodonMismatchWarning}) {
+		t.Errorf("mismatched codons: start %v stop %v warnings %v", protein.HasStart, protein.HasStop, protein.Warnings)
+	}
+
+	if strings.Trim(protein.Protein, "P") != "" {
+		t.Errorf("mismatched codons protein = %s", protein.Protein)
+	}
+}
+
+// transcripts on the mitochondrion are translated with its table so
+// TGA is Trp rather than a premature stop
+func TestTranscriptProteinMitochondrial(t *testing.T) {
+	gdb := openGenes(t, []*genometest.Gene{{Id: "ENSG00000000001",
+		Symbol:  "GENEA",
+		Chr:     "chr1",
+		Strand:  "+",
+		Biotype: "protein_coding",
+		Transcripts: []*genometest.Transcript{{Id: "ENST00000000001",
+			Biotype:   "protein_coding",
+			Exons:     []genometest.Interval{{Start: 1001, End: 2000}},
+			Cds:       genometest.Interval{Start: 1101, End: 1400},
+			Canonical: true}}}})
+
+	model, err := gdb.TranscriptModel("ENST00000000001")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transcript := *model.Transcript
+	model.Transcript = &transcript
+
+	// every codon of the cds is TGA
+	seqs := codonReader{codon: "TGA", start: 1101}
+
+	for _, tc := range []struct {
+		chr      string
+		table    *genome.CodonTable
+		protein  string
+		warnings []string
+	}{{"chrM", genome.VertebrateMitochondrialCodonTable,
+		strings.Repeat("W", 100),
+		[]string{genome.StartCodonMismatchWarning, genome.StopCodonMismatchWarning}},
+		{"chr1", genome.StandardCodonTable,
+			"",
+			[]string{genome.StartCodonMismatchWarning, genome.PrematureStopWarning}}} {
+		transcript.Location, err = dna.NewStrandedLocation(tc.chr, 1001, 2000, "+")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		protein, err := model.Protein(seqs)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if protein.CodonTable != tc.table.Name || protein.Protein != tc.protein || !slices.Equal(protein.Warnings, tc.warnings) {
+			t.Errorf("%s: %s table protein %s warnings %v", tc.chr, protein.CodonTable, protein.Protein, protein.Warnings)
+		}
+	}
+}
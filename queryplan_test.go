@@ -0,0 +1,443 @@
+package genome
+
+import (
+	"database/sql"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+//
+// Checks that the queries of a GtfDB use the indexes made by the
+// importer so that changes to either do not quietly turn lookups into
+// table scans. Plans only depend on the sql and the schema since the
+// importer does not ANALYZE, so the small fixture is enough.
+//
+
+type planQuery struct {
+	// the sql constant the query is made from
+	constant string
+	// e.g. with a transcript policy
+	variant string
+	query   string
+}
+
+const importerScript = "scripts/step1_gencode_gtf_to_sqlite3_v2.py"
+
+var (
+	// tables with a row per gene or more
+	largeTables = []string{"genes", "transcripts", "exons", "features", "transcript_tags", "gene_aliases", "gene_xrefs", "gene_orthologs", "id_versions"}
+
+	// indexes on a column with a handful of values, so searching them
+	// reads a large part of the table
+	lowSelectivityIndexes = []string{"idx_genes_strand",
+		"idx_genes_biotype_id",
+		"idx_transcripts_is_canonical",
+		"idx_transcripts_is_longest",
+		"idx_transcripts_biotype_id",
+		"idx_features_feature_type_id"}
+
+	// queries that are allowed to scan a large table and why
+	allowedScans = map[string]string{
+		"GeneInfoSql (name)":               "LIKE matching cannot use the LOWER() indexes",
+		"GeneInfoSql (name, policy)":       "LIKE matching cannot use the LOWER() indexes",
+		"TranscriptInfoSql (name)":         "LIKE matching cannot use the LOWER() indexes",
+		"TranscriptInfoSql (name, policy)": "LIKE matching cannot use the LOWER() indexes",
+		"ExonInfoSql (name)":               "LIKE matching cannot use the LOWER() indexes",
+		"ExonInfoSql (name, policy)":       "LIKE matching cannot use the LOWER() indexes",
+		"GeneNamesSql":                     "loads every gene once for fuzzy searches",
+		"AllGeneAliasesSql":                "loads every alias once for fuzzy searches",
+		"AutocompleteGenesSql":             "loads every gene once for autocomplete",
+		"GeneTssSql (genome)":              "exports every gene",
+		"TranscriptTssSql (genome)":        "exports every transcript",
+		"BiotypesSql":                      "counts every gene and transcript",
+		"DiffGenesSql":                     "compares whole annotations",
+		"DiffTranscriptsSql":               "compares whole annotations",
+		"DiffTaggedTranscriptsSql":         "compares whole annotations",
+	}
+
+	// sql constants that are not queries of a GtfDB
+	unplannedSql = map[string]string{
+		"BasicLocationSql":       "fragment",
+		"CoreLocationSql":        "fragment",
+		"OverlapOrderBySql":      "fragment",
+		"PolicyTranscriptSql":    "fragment",
+		"PolicyBiotypeSql":       "fragment",
+		"PolicyTagSql":           "fragment",
+		"GeneTssRegionSql":       "fragment",
+		"TranscriptTssRegionSql": "fragment",
+		"AllTssSql":              "fragment",
+		"GeneNameMatchSql":       "fragment",
+		"TranscriptNameMatchSql": "fragment",
+		"ExonNameMatchSql":       "fragment",
+		"GeneIdsMatchSql":        "fragment",
+		"TranscriptIdsMatchSql":  "fragment",
+		"GeneDBInfoSql":          "the info table has one row",
+		"CdsSql":                 "unused, the importer no longer makes a cds table",
+		"UtrSql":                 "unused, the importer no longer makes a utrs table",
+		"IdToNameSql":            "unused, the importer no longer makes an ids table",
+		"GenomesSQL":             "catalog",
+		"AssembliesSql":          "catalog",
+		"GtfsSql":                "catalog",
+		"AnnotationsFromIdSql":   "catalog",
+		"AssemblyIdSql":          "catalog",
+		"ChainSql":               "catalog",
+		"AnnotationsByTypeSql":   "catalog",
+	}
+
+	namedArgRegex = regexp.MustCompile(`:(\w+)`)
+
+	// FROM genes AS g, JOIN transcripts t etc.
+	tableAliasRegex = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+(\w+)(?:\s+AS)?\s+(\w+)`)
+
+	subqueryRegex = regexp.MustCompile(`^(?:CO-ROUTINE|MATERIALIZE) (\w+)`)
+
+	// SCAN t or SCAN t USING [COVERING] INDEX x
+	scanRegex = regexp.MustCompile(`^SCAN (\w+)`)
+
+	searchIndexRegex = regexp.MustCompile(`^SEARCH (\w+) USING (?:COVERING )?INDEX (\w+)`)
+
+	createIndexRegex = regexp.MustCompile(`(?i)CREATE (UNIQUE )?INDEX (\w+) ON (\w+)\s*\((.+?)\)\s*;?\s*$`)
+)
+
+func (q *planQuery) name() string {
+	if q.variant == "" {
+		return q.constant
+	}
+
+	return fmt.Sprintf("%s (%s)", q.constant, q.variant)
+}
+
+func TestQueryPlans(t *testing.T) {
+	fixture := genometest.New(t)
+
+	gdb := NewGtfDB(fixture.Dir, &Annotation{Url: filepath.Base(genometest.Annotations()[1].File)})
+
+	t.Cleanup(func() { gdb.Close() })
+
+	for _, q := range planQueries(t) {
+		plan, err := queryPlan(gdb.db, q.query)
+
+		if err != nil {
+			t.Errorf("%s: %v", q.name(), err)
+			continue
+		}
+
+		scans := planScans(q.query, plan)
+
+		reason, allowed := allowedScans[q.name()]
+
+		switch {
+		case len(scans) > 0 && !allowed:
+			t.Errorf("%s %s:\n  %s", q.name(), strings.Join(scans, ", "), strings.Join(plan, "\n  "))
+		case len(scans) == 0 && allowed:
+			t.Errorf("%s no longer scans (%s), remove it from allowedScans", q.name(), reason)
+		}
+	}
+}
+
+// every sql constant of the package should have its plan checked
+func TestQueryPlansCoverSql(t *testing.T) {
+	planned := make(map[string]bool)
+
+	for _, q := range planQueries(t) {
+		planned[q.constant] = true
+	}
+
+	for _, name := range sqlConstants(t) {
+		_, unplanned := unplannedSql[name]
+
+		if !planned[name] && !unplanned {
+			t.Errorf("%s is not in planQueries or unplannedSql", name)
+		}
+	}
+}
+
+// the fixture should be indexed as the importer indexes real databases
+// or its plans say nothing about production
+func TestFixtureIndexesMatchImporter(t *testing.T) {
+	script, err := os.ReadFile(importerScript)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]string, 0, 30)
+
+	for _, m := range regexp.MustCompile(`CREATE (?:UNIQUE )?INDEX [^"]+`).FindAllString(string(script), -1) {
+		want = append(want, normalizeIndex(m))
+	}
+
+	fixture := genometest.New(t)
+
+	db, err := sql.Open("sqlite3", filepath.Join(fixture.Dir, genometest.Annotations()[1].File))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT sql FROM sqlite_master WHERE type = 'index' AND sql IS NOT NULL`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	got := make([]string, 0, 30)
+
+	for rows.Next() {
+		var s string
+
+		err := rows.Scan(&s)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, normalizeIndex(s))
+	}
+
+	slices.Sort(want)
+	slices.Sort(got)
+
+	if !slices.Equal(want, got) {
+		t.Errorf("fixture indexes differ from %s\nwant:\n%s\ngot:\n%s", importerScript, strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func normalizeIndex(s string) string {
+	m := createIndexRegex.FindStringSubmatch(strings.TrimSpace(s))
+
+	if m == nil {
+		return s
+	}
+
+	return fmt.Sprintf("%s%s ON %s(%s)", strings.ToUpper(m[1]), m[2], m[3], strings.ReplaceAll(m[4], " ", ""))
+}
+
+func queryPlan(db *sql.DB, query string) ([]string, error) {
+	// bind every named arg, the values do not change the plan
+	namedArgs := make([]any, 0, 20)
+	seen := make(map[string]bool)
+
+	for _, m := range namedArgRegex.FindAllStringSubmatch(query, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			namedArgs = append(namedArgs, sql.Named(m[1], ""))
+		}
+	}
+
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+query, namedArgs...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	plan := make([]string, 0, 20)
+
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+
+		err := rows.Scan(&id, &parent, &notUsed, &detail)
+
+		if err != nil {
+			return nil, err
+		}
+
+		plan = append(plan, detail)
+	}
+
+	return plan, rows.Err()
+}
+
+// the steps of a plan that read all or much of a large table
+func planScans(query string, plan []string) []string {
+	aliases := make(map[string]string)
+
+	for _, m := range tableAliasRegex.FindAllStringSubmatch(query, -1) {
+		aliases[m[2]] = m[1]
+	}
+
+	table := func(alias string) string {
+		if name, ok := aliases[alias]; ok {
+			return name
+		}
+
+		return alias
+	}
+
+	// ctes and subqueries are listed before they are scanned
+	subqueries := make(map[string]bool)
+
+	ret := make([]string, 0, 5)
+
+	for _, detail := range plan {
+		if m := subqueryRegex.FindStringSubmatch(detail); m != nil {
+			subqueries[m[1]] = true
+			continue
+		}
+
+		if m := scanRegex.FindStringSubmatch(detail); m != nil {
+			if !subqueries[m[1]] && slices.Contains(largeTables, table(m[1])) {
+				ret = append(ret, "scans "+table(m[1]))
+			}
+
+			continue
+		}
+
+		if m := searchIndexRegex.FindStringSubmatch(detail); m != nil && slices.Contains(lowSelectivityIndexes, m[2]) {
+			ret = append(ret, fmt.Sprintf("searches %s by %s", table(m[1]), m[2]))
+		}
+	}
+
+	return ret
+}
+
+func planQueries(t *testing.T) []planQuery {
+	t.Helper()
+
+	policy, err := ParseTranscriptPolicy("mane,appris,tsl,canonical,longest")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err = policy.WithBiotypes([]string{"protein_coding"}, []string{"nonsense_mediated_decay"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err = policy.WithGeneBiotypes([]string{CodingBiotypes}, []string{"ig_c_gene"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	geneIdsMatch := strings.Replace(GeneIdsMatchSql, "<<IDS>>", ":g1, :g2", 1)
+	transcriptIdsMatch := strings.Replace(TranscriptIdsMatchSql, "<<IDS>>", ":t1, :t2", 1)
+
+	withPolicies := []planQuery{{constant: "BasicOverlapSql", query: BasicOverlapSql},
+		{constant: "OverlapSql", query: OverlapSql},
+		{constant: "IntragenicSql", query: IntragenicSql},
+		{constant: "ClosestGeneSql", query: ClosestGeneSql},
+		{constant: "TranscriptInfoSql", variant: "name", query: strings.Replace(TranscriptInfoSql, "<<MATCH>>", TranscriptNameMatchSql, 1)},
+		{constant: "TranscriptInfoSql", variant: "ids", query: strings.Replace(TranscriptInfoSql, "<<MATCH>>", geneIdsMatch, 1)},
+		{constant: "TranscriptInfoSql", variant: "transcript ids", query: strings.Replace(TranscriptInfoSql, "<<MATCH>>", transcriptIdsMatch, 1)},
+		{constant: "ExonInfoSql", variant: "name", query: strings.Replace(ExonInfoSql, "<<MATCH>>", ExonNameMatchSql, 1)},
+		{constant: "ExonInfoSql", variant: "ids", query: strings.Replace(ExonInfoSql, "<<MATCH>>", geneIdsMatch, 1)},
+		{constant: "TranscriptTssSql", variant: "region", query: strings.Replace(TranscriptTssSql, "<<REGION>>", TranscriptTssRegionSql, 1)},
+		{constant: "GeneInfoSql", variant: "name", query: strings.Replace(GeneInfoSql, "<<MATCH>>", GeneNameMatchSql, 1)},
+		{constant: "GeneInfoSql", variant: "ids", query: strings.Replace(GeneInfoSql, "<<MATCH>>", geneIdsMatch, 1)},
+		{constant: "GeneTssSql", variant: "region", query: strings.Replace(GeneTssSql, "<<REGION>>", GeneTssRegionSql, 1)}}
+
+	ret := make([]planQuery, 0, 30)
+
+	for _, q := range withPolicies {
+		var namedArgs []any
+
+		policyVariant := "policy"
+
+		if q.variant != "" {
+			policyVariant = q.variant + ", policy"
+		}
+
+		ret = append(ret, planQuery{constant: q.constant, variant: q.variant, query: MakeTranscriptPolicySql(q.query, nil, &namedArgs)},
+			planQuery{constant: q.constant, variant: policyVariant, query: MakeTranscriptPolicySql(q.query, policy, &namedArgs)})
+	}
+
+	var namedArgs []any
+
+	return append(ret, planQuery{constant: "InGeneSql", query: InGeneSql},
+		planQuery{constant: "InExonSql", query: InExonSql},
+		planQuery{constant: "GeneNamesSql", query: GeneNamesSql},
+		planQuery{constant: "GeneAliasesSql", query: GeneAliasesSql},
+		planQuery{constant: "AllGeneAliasesSql", query: AllGeneAliasesSql},
+		planQuery{constant: "AutocompleteGenesSql", query: AutocompleteGenesSql},
+		planQuery{constant: "GeneModelSql", query: GeneModelSql},
+		planQuery{constant: "GeneModelsSql", query: strings.Replace(GeneModelsSql, "<<IDS>>", ":g1, :g2", 1)},
+		planQuery{constant: "TranscriptModelSql", query: TranscriptModelSql},
+		planQuery{constant: "GeneTssSql",
+			variant: "genome",
+			query:   MakeGeneBiotypeSql(strings.Replace(GeneTssSql, "<<REGION>>", AllTssSql, 1), nil, &namedArgs)},
+		planQuery{constant: "TranscriptTssSql",
+			variant: "genome",
+			query:   MakeTranscriptPolicySql(strings.Replace(TranscriptTssSql, "<<REGION>>", AllTssSql, 1), nil, &namedArgs)},
+		planQuery{constant: "TranscriptTagsSql",
+			query: strings.Replace(TranscriptTagsSql, "<<TRANSCRIPT_IDS>>", "LOWER(t.transcript_id) IN (:t1, :t2)", 1)},
+		planQuery{constant: "ResolveGeneIdsSql", query: strings.Replace(ResolveGeneIdsSql, "<<IDS>>", ":k1, :k2", 1)},
+		planQuery{constant: "ResolveTranscriptIdsSql", query: strings.Replace(ResolveTranscriptIdsSql, "<<IDS>>", ":k1, :k2", 1)},
+		planQuery{constant: "ResolveOfficialIdsSql", query: strings.Replace(ResolveOfficialIdsSql, "<<IDS>>", ":k1, :k2", 1)},
+		planQuery{constant: "ResolveXrefsSql", query: strings.Replace(ResolveXrefsSql, "<<IDS>>", ":k1, :k2", 1)},
+		planQuery{constant: "GeneXrefsSql", query: GeneXrefsSql},
+		planQuery{constant: "XrefsOfGenesSql", query: strings.Replace(XrefsOfGenesSql, "<<IDS>>", ":g1, :g2", 1)},
+		planQuery{constant: "DescriptionsOfGenesSql", query: strings.Replace(DescriptionsOfGenesSql, "<<IDS>>", ":g1, :g2", 1)},
+		planQuery{constant: "OrthologsSql", query: strings.Replace(OrthologsSql, "<<IDS>>", ":g1, :g2", 1)},
+		planQuery{constant: "IdVersionsSql", query: strings.Replace(IdVersionsSql, "<<IDS>>", ":v1, :v2", 1)},
+		planQuery{constant: "ResolveSymbolsSql", query: strings.Replace(ResolveSymbolsSql, "<<IDS>>", ":k1, :k2", 1)},
+		planQuery{constant: "ResolveAliasesSql", query: strings.Replace(ResolveAliasesSql, "<<IDS>>", ":k1, :k2", 1)},
+		planQuery{constant: "BiotypesSql", query: BiotypesSql},
+		planQuery{constant: "DiffGenesSql", query: DiffGenesSql},
+		planQuery{constant: "DiffTranscriptsSql", query: DiffTranscriptsSql},
+		planQuery{constant: "DiffTaggedTranscriptsSql", query: DiffTaggedTranscriptsSql})
+}
+
+// the names of the package level constants that hold sql
+func sqlConstants(t *testing.T) []string {
+	t.Helper()
+
+	fset := token.NewFileSet()
+
+	ret := make([]string, 0, 50)
+
+	files, err := filepath.Glob("*.go")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, file, nil, 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					if strings.HasSuffix(name.Name, "Sql") || strings.HasSuffix(name.Name, "SQL") {
+						ret = append(ret, name.Name)
+					}
+				}
+			}
+		}
+	}
+
+	return ret
+}
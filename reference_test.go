@@ -0,0 +1,684 @@
+package genome_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+//
+// Differential tests of the location queries against a brute force
+// reference written directly from the gene models. Failing cases are
+// shrunk to a minimal set of genes and location before being reported.
+//
+
+var (
+	seed  = flag.Uint64("seed", 0, "seed for the random gene models, 0 for a random seed")
+	cases = flag.Int("cases", 200, "number of random cases to check against the reference")
+)
+
+const (
+	// random cases have up to this many genes
+	maxRandomGenes int = 8
+
+	// max number of extra databases built when shrinking a failure
+	shrinkBudget int = 1000
+)
+
+type (
+	refCase struct {
+		genes       []*genometest.Gene
+		start       int
+		end         int
+		upstream    int
+		downstream  int
+		closestN    int
+		useOfficial bool
+		// false for single base tss
+		tssPromoter bool
+	}
+
+	mismatch struct {
+		query string
+		want  []string
+		got   []string
+	}
+
+	refChecker struct {
+		dir string
+		n   int
+	}
+)
+
+func TestReferenceQueries(t *testing.T) {
+	s := *seed
+
+	if s == 0 {
+		s = rand.Uint64()
+	}
+
+	rng := rand.New(rand.NewPCG(s, s))
+
+	n := *cases
+
+	if testing.Short() {
+		n = min(n, 25)
+	}
+
+	checker := &refChecker{dir: t.TempDir()}
+
+	for i := range n {
+		c := randomCase(rng)
+
+		m, err := checker.check(c)
+
+		if err != nil {
+			t.Fatalf("seed %d case %d: %v", s, i, err)
+		}
+
+		if m == nil {
+			continue
+		}
+
+		c, m, err = checker.shrink(c, m)
+
+		if err != nil {
+			t.Fatalf("seed %d case %d: %v", s, i, err)
+		}
+
+		t.Fatalf("seed %d case %d: %s differs from the reference for\n%s\nwant:\n%s\ngot:\n%s",
+			s,
+			i,
+			m.query,
+			c,
+			strings.Join(m.want, "\n"),
+			strings.Join(m.got, "\n"))
+	}
+}
+
+func randomCase(rng *rand.Rand) *refCase {
+	genes := genometest.RandomGenes(rng, 1+rng.IntN(maxRandomGenes))
+
+	c := refCase{genes: genes,
+		upstream:    []int{0, 100, 2000}[rng.IntN(3)],
+		downstream:  []int{0, 100, 1000}[rng.IntN(3)],
+		closestN:    1 + rng.IntN(5),
+		useOfficial: rng.IntN(2) == 0,
+		tssPromoter: rng.IntN(2) == 0}
+
+	if rng.IntN(4) == 0 {
+		// exactly on a tss, where distances are zero
+		gene := genes[rng.IntN(len(genes))]
+		c.start = refTss(gene, gene.Transcripts[rng.IntN(len(gene.Transcripts))])
+		c.end = c.start
+	} else {
+		c.start = 1 + rng.IntN(genometest.RandomRegionSize+1000)
+		c.end = c.start + []int{0, 50, 2000}[rng.IntN(3)]
+	}
+
+	return &c
+}
+
+func (c *refCase) String() string {
+	lines := make([]string, 0, len(c.genes)+1)
+
+	lines = append(lines, fmt.Sprintf("location chr1:%d-%d promoter -%d/+%d closest %d official %v tss promoter %v",
+		c.start,
+		c.end,
+		c.upstream,
+		c.downstream,
+		c.closestN,
+		c.useOfficial,
+		c.tssPromoter))
+
+	for _, gene := range c.genes {
+		lines = append(lines, gene.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (c *refCase) mid() int {
+	return (c.start + c.end) / 2
+}
+
+func (c *refCase) overlaps(start int, end int) bool {
+	return c.start <= end && c.end >= start
+}
+
+// smaller variations of a case to try when shrinking
+func (c *refCase) shrinkCandidates() []*refCase {
+	ret := make([]*refCase, 0, 20)
+
+	variant := func(fn func(v *refCase)) {
+		v := *c
+		v.genes = genometest.CloneGenes(c.genes)
+		fn(&v)
+		ret = append(ret, &v)
+	}
+
+	for gi, gene := range c.genes {
+		if len(c.genes) > 1 {
+			variant(func(v *refCase) { v.genes = slices.Delete(v.genes, gi, gi+1) })
+		}
+
+		for ti, transcript := range gene.Transcripts {
+			if len(gene.Transcripts) > 1 {
+				variant(func(v *refCase) {
+					v.genes[gi].Transcripts = slices.Delete(v.genes[gi].Transcripts, ti, ti+1)
+				})
+			}
+
+			for ei := range transcript.Exons {
+				if len(transcript.Exons) > 1 {
+					variant(func(v *refCase) {
+						t := v.genes[gi].Transcripts[ti]
+						t.Exons = slices.Delete(t.Exons, ei, ei+1)
+					})
+				}
+			}
+		}
+	}
+
+	if c.start != c.end {
+		variant(func(v *refCase) { v.end = v.start })
+		variant(func(v *refCase) { v.start = v.end })
+	}
+
+	if c.upstream != 0 {
+		variant(func(v *refCase) { v.upstream = 0 })
+	}
+
+	if c.downstream != 0 {
+		variant(func(v *refCase) { v.downstream = 0 })
+	}
+
+	if c.closestN > 1 {
+		variant(func(v *refCase) { v.closestN-- })
+	}
+
+	if c.useOfficial {
+		variant(func(v *refCase) { v.useOfficial = false })
+	}
+
+	return ret
+}
+
+// Greedily take the first smaller case that still fails the same
+// query until none do
+func (checker *refChecker) shrink(c *refCase, m *mismatch) (*refCase, *mismatch, error) {
+	budget := shrinkBudget
+
+	for budget > 0 {
+		shrunk := false
+
+		for _, candidate := range c.shrinkCandidates() {
+			budget--
+
+			cm, err := checker.check(candidate)
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if cm != nil && cm.query == m.query {
+				c = candidate
+				m = cm
+				shrunk = true
+				break
+			}
+
+			if budget == 0 {
+				break
+			}
+		}
+
+		if !shrunk {
+			break
+		}
+	}
+
+	return c, m, nil
+}
+
+// build a database and an in-memory copy of the case and compare
+// each query with the reference, returning the first that differs
+func (checker *refChecker) check(c *refCase) (*mismatch, error) {
+	checker.n++
+
+	file := fmt.Sprintf("random%d.db", checker.n)
+
+	err := genometest.WriteGtfDB(filepath.Join(checker.dir, file), &genometest.Annotation{PublicId: "random",
+		Name:  "random",
+		File:  file,
+		Genes: c.genes})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(filepath.Join(checker.dir, file))
+
+	gdb := genome.NewGtfDB(checker.dir, &genome.Annotation{Url: file})
+
+	defer gdb.Close()
+
+	location, err := dna.NewLocation("chr1", c.start, c.end)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prom := dna.NewPromoterRegion(c.upstream, c.downstream)
+
+	var gtf bytes.Buffer
+
+	err = genometest.WriteGtf(&gtf, c.genes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	genes, err := genome.ParseGtf(&gtf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mdb := genome.NewMemGeneDB(&genome.Annotation{}, genes)
+
+	for _, backend := range []struct {
+		name string
+		gdb  genome.GeneDB
+	}{{"GtfDB", gdb}, {"MemGeneDB", mdb}} {
+		m, err := checkGeneDB(backend.name, backend.gdb, c, location, prom)
+
+		if err != nil || m != nil {
+			return m, err
+		}
+	}
+
+	var tssProm *dna.PromoterRegion
+
+	if c.tssPromoter {
+		tssProm = prom
+	}
+
+	for _, level := range []string{genome.GeneLevel, genome.TranscriptLevel} {
+		got := make([]string, 0, 10)
+
+		err := gdb.TssFeatures(location, level, tssProm, nil, func(feature *genome.GenomicFeature) error {
+			id := feature.GeneId
+
+			if level == genome.TranscriptLevel {
+				id = feature.Transcript
+			}
+
+			got = append(got, fmt.Sprintf("%s %d-%d", id, feature.Location.Start(), feature.Location.End()))
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if m := compare("TssFeatures "+level, refTssWindows(c, level), got); m != nil {
+			return m, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// compare the queries of the GeneDB interface with the reference
+func checkGeneDB(name string, gdb genome.GeneDB, c *refCase, location *dna.Location, prom *dna.PromoterRegion) (*mismatch, error) {
+	levels := "gene,transcript,exon"
+
+	features, err := gdb.OverlappingGenes(location, levels, prom, nil, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m := compare(name+" OverlappingGenes", refOverlap(c, false), describe(features, 0)); m != nil {
+		return m, nil
+	}
+
+	features, err = gdb.OverlappingGenes(location, levels, prom, nil, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m := compare(name+" OverlappingGenes annotation", refOverlap(c, true), describe(features, 0)); m != nil {
+		return m, nil
+	}
+
+	within, err := gdb.WithinGenes(location, levels, prom)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m := compare(name+" WithinGenes", refOverlap(c, true), describe(within.Features, 0)); m != nil {
+		return m, nil
+	}
+
+	features, err = gdb.IntragenicFeatures(location, genome.GeneLevel, prom, nil, c.useOfficial)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m := compare(name+" IntragenicFeatures", refIntragenic(c), describe(features, 0)); m != nil {
+		return m, nil
+	}
+
+	features, err = gdb.ClosestGenes(location, prom, int8(c.closestN), nil, c.useOfficial)
+
+	if err != nil {
+		return nil, err
+	}
+
+	want, got := refClosest(c, features)
+
+	if m := compare(name+" ClosestGenes", want, got); m != nil {
+		return m, nil
+	}
+
+	return nil, nil
+}
+
+func compare(query string, want []string, got []string) *mismatch {
+	if slices.Equal(want, got) {
+		return nil
+	}
+
+	return &mismatch{query: query, want: want, got: got}
+}
+
+// one line per feature, indented by level
+func describe(features []*genome.GenomicFeature, depth int) []string {
+	ret := make([]string, 0, len(features))
+
+	for _, feature := range features {
+		indent := strings.Repeat("  ", depth)
+
+		switch feature.Type {
+		case genome.GeneLevel:
+			ret = append(ret, fmt.Sprintf("%s%s %s %d", indent, feature.GeneId, feature.Label, feature.TssDist))
+		case genome.TranscriptLevel:
+			ret = append(ret, fmt.Sprintf("%s%s %s %d", indent, feature.Transcript, feature.Label, feature.TssDist))
+		default:
+			ret = append(ret, fmt.Sprintf("%s%d-%d %s", indent, feature.Location.Start(), feature.Location.End(), feature.Label))
+		}
+
+		ret = append(ret, describe(feature.Children, depth+1)...)
+	}
+
+	return ret
+}
+
+//
+// The reference. Locations are always on chr1.
+//
+
+func refTss(gene *genometest.Gene, transcript *genometest.Transcript) int {
+	if gene.Strand == "-" {
+		return transcript.Span().End
+	}
+
+	return transcript.Span().Start
+}
+
+// the promoter window of a tss, which is flipped on the minus strand
+func refPromoter(strand string, tss int, upstream int, downstream int) (int, int) {
+	if strand == "-" {
+		return tss - downstream, tss + upstream
+	}
+
+	return tss - upstream, tss + downstream
+}
+
+func refInPromoter(c *refCase, gene *genometest.Gene, transcript *genometest.Transcript) bool {
+	return c.overlaps(refPromoter(gene.Strand, refTss(gene, transcript), c.upstream, c.downstream))
+}
+
+func refInExon(c *refCase, transcript *genometest.Transcript) bool {
+	for _, exon := range transcript.Exons {
+		if c.overlaps(exon.Start, exon.End) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func refIsIntragenic(c *refCase, transcript *genometest.Transcript) bool {
+	span := transcript.Span()
+	return c.overlaps(span.Start, span.End)
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// genes and the transcripts chosen by keep, with the gene labels
+// summarizing its transcripts and the gene tss distance being the
+// first smallest of them
+func refGenes(c *refCase,
+	keep func(gene *genometest.Gene, transcript *genometest.Transcript) bool,
+	useOfficial bool,
+	children bool,
+	annotationMode bool) []string {
+	ret := make([]string, 0, 10)
+
+	for _, gene := range c.genes {
+		if gene.Chr != "chr1" || (useOfficial && gene.OfficialId == "") {
+			continue
+		}
+
+		var inPromoter, inExon, isIntragenic bool
+		var tssDist int
+		var lines []string
+
+		for _, transcript := range gene.Transcripts {
+			if !keep(gene, transcript) {
+				continue
+			}
+
+			tInPromoter := refInPromoter(c, gene, transcript)
+			tInExon := refInExon(c, transcript)
+			tIsIntragenic := refIsIntragenic(c, transcript)
+			tTssDist := c.mid() - refTss(gene, transcript)
+
+			if lines == nil || absInt(tTssDist) < absInt(tssDist) {
+				tssDist = tTssDist
+			}
+
+			inPromoter = inPromoter || tInPromoter
+			inExon = inExon || tInExon
+			isIntragenic = isIntragenic || tIsIntragenic
+
+			label := ""
+			dist := 0
+
+			if annotationMode {
+				label = genome.MakePromLabel(tInPromoter, tInExon, tIsIntragenic)
+				dist = tTssDist
+			}
+
+			lines = append(lines, fmt.Sprintf("  %s %s %d", transcript.Id, label, dist))
+
+			for _, exon := range transcript.Exons {
+				label := ""
+
+				if annotationMode {
+					label = genome.MakePromLabel(tInPromoter, c.overlaps(exon.Start, exon.End), tIsIntragenic)
+				}
+
+				lines = append(lines, fmt.Sprintf("    %d-%d %s", exon.Start, exon.End, label))
+			}
+		}
+
+		if lines == nil {
+			continue
+		}
+
+		if annotationMode {
+			ret = append(ret, fmt.Sprintf("%s %s %d", gene.Id, genome.MakePromLabel(inPromoter, inExon, isIntragenic), tssDist))
+		} else {
+			ret = append(ret, fmt.Sprintf("%s  0", gene.Id))
+		}
+
+		if children {
+			ret = append(ret, lines...)
+		}
+	}
+
+	return ret
+}
+
+// transcripts overlapping the location
+func refOverlap(c *refCase, annotationMode bool) []string {
+	return refGenes(c, func(gene *genometest.Gene, transcript *genometest.Transcript) bool {
+		return refIsIntragenic(c, transcript)
+	}, false, true, annotationMode)
+}
+
+// transcripts or their promoters overlapping the location
+func refIntragenic(c *refCase) []string {
+	return refGenes(c, func(gene *genometest.Gene, transcript *genometest.Transcript) bool {
+		return refIsIntragenic(c, transcript) || refInPromoter(c, gene, transcript)
+	}, c.useOfficial, false, true)
+}
+
+// Genes with equally close transcripts can be returned in any order so
+// only the distances are compared, along with a check that each gene
+// returned is as close as the reference says it is
+func refClosest(c *refCase, features []*genome.GenomicFeature) ([]string, []string) {
+	closest := make(map[string]int)
+
+	for _, gene := range c.genes {
+		if gene.Chr != "chr1" || (c.useOfficial && gene.OfficialId == "") {
+			continue
+		}
+
+		for ti, transcript := range gene.Transcripts {
+			d := absInt(c.mid() - refTss(gene, transcript))
+
+			if ti == 0 || d < closest[gene.Id] {
+				closest[gene.Id] = d
+			}
+		}
+	}
+
+	dists := make([]int, 0, len(closest))
+
+	for _, d := range closest {
+		dists = append(dists, d)
+	}
+
+	slices.Sort(dists)
+
+	want := make([]string, 0, c.closestN)
+
+	for _, d := range dists[:min(len(dists), c.closestN)] {
+		want = append(want, fmt.Sprintf("%d", d))
+	}
+
+	got := make([]string, 0, len(features))
+
+	for _, feature := range features {
+		d := absInt(feature.TssDist)
+
+		if ref, ok := closest[feature.GeneId]; !ok || ref != d {
+			got = append(got, fmt.Sprintf("%d %s should be %d", d, feature.GeneId, ref))
+		} else {
+			got = append(got, fmt.Sprintf("%d", d))
+		}
+	}
+
+	return want, got
+}
+
+// tss windows overlapping the location in tss order
+func refTssWindows(c *refCase, level string) []string {
+	type window struct {
+		id    string
+		tss   int
+		start int
+		end   int
+	}
+
+	windows := make([]*window, 0, 10)
+
+	upstream := 0
+	downstream := 0
+
+	if c.tssPromoter {
+		upstream = c.upstream
+		downstream = c.downstream
+	}
+
+	add := func(id string, strand string, tss int) {
+		s, e := refPromoter(strand, tss, upstream, downstream)
+
+		if c.overlaps(s, e) {
+			windows = append(windows, &window{id: id, tss: tss, start: max(1, s), end: max(1, e)})
+		}
+	}
+
+	for _, gene := range c.genes {
+		if gene.Chr != "chr1" {
+			continue
+		}
+
+		if level == genome.GeneLevel {
+			tss := gene.Span().Start
+
+			if gene.Strand == "-" {
+				tss = gene.Span().End
+			}
+
+			add(gene.Id, gene.Strand, tss)
+
+			continue
+		}
+
+		for _, transcript := range gene.Transcripts {
+			add(transcript.Id, gene.Strand, refTss(gene, transcript))
+		}
+	}
+
+	slices.SortStableFunc(windows, func(a, b *window) int {
+		if a.tss != b.tss {
+			return a.tss - b.tss
+		}
+
+		return strings.Compare(a.id, b.id)
+	})
+
+	ret := make([]string, 0, len(windows))
+
+	for _, w := range windows {
+		ret = append(ret, fmt.Sprintf("%s %d-%d", w.id, w.start, w.end))
+	}
+
+	return ret
+}
@@ -0,0 +1,540 @@
+package genome
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+//
+// Resolving lists of identifiers of mixed type, e.g. symbols pasted
+// from a spreadsheet alongside Ensembl and HGNC ids, to genes so they
+// can be converted to coordinates or to each other.
+//
+
+type ResolvedId struct {
+	// the identifier as given
+	Query  string `json:"query"`
+	Status string `json:"status"`
+	// the kind of identifier that matched
+	MatchedBy string `json:"matchedBy,omitempty"`
+	// the gene matched, every candidate if ambiguous. Genes matched
+	// by a transcript id have that transcript as their child.
+	Features []*GenomicFeature `json:"features"`
+	// the version of a gene or transcript id as given when it is not
+	// the version in the annotation
+	MatchedVersion string `json:"matchedVersion,omitempty"`
+}
+
+const (
+	ResolvedMatched   string = "matched"
+	ResolvedAmbiguous string = "ambiguous"
+	ResolvedUnmatched string = "unmatched"
+
+	GeneIdMatch       string = "geneId"
+	TranscriptIdMatch string = "transcriptId"
+	OfficialIdMatch   string = "officialId"
+	XrefMatch         string = "xref"
+	SymbolMatch       string = "symbol"
+	AliasMatch        string = "alias"
+
+	MaxResolveIds int = 10000
+
+	// each returns the key matched, the row id of the gene and the
+	// transcript id if a transcript matched
+	ResolveGeneIdsSql = `SELECT LOWER(g.gene_id), g.id, ''
+		FROM genes AS g
+		WHERE LOWER(g.gene_id) IN (<<IDS>>)`
+
+	ResolveTranscriptIdsSql = `SELECT LOWER(t.transcript_id), t.gene_id, t.transcript_id
+		FROM transcripts AS t
+		WHERE LOWER(t.transcript_id) IN (<<IDS>>)`
+
+	ResolveOfficialIdsSql = `SELECT LOWER(g.official_gene_id), g.id, ''
+		FROM genes AS g
+		WHERE LOWER(g.official_gene_id) IN (<<IDS>>)`
+
+	ResolveXrefsSql = `SELECT LOWER(x.xref), x.gene_id, ''
+		FROM gene_xrefs AS x
+		WHERE LOWER(x.xref) IN (<<IDS>>)`
+
+	ResolveSymbolsSql = `SELECT LOWER(g.symbol), g.id, ''
+		FROM genes AS g
+		WHERE LOWER(g.symbol) IN (<<IDS>>)`
+
+	ResolveAliasesSql = `SELECT LOWER(ga.alias), ga.gene_id, ''
+		FROM gene_aliases AS ga
+		WHERE LOWER(ga.alias) IN (<<IDS>>)`
+
+	// genes matched by a transcript id are found with only
+	// that transcript
+	TranscriptIdsMatchSql = `LOWER(t.transcript_id) IN (<<IDS>>)`
+)
+
+type idCandidate struct {
+	key string
+	// row id of the gene
+	id         int
+	transcript string
+}
+
+var (
+	// identifiers are tried in this order and the first kind that
+	// matches decides, so an id is never mistaken for a symbol
+	resolveOrder = []string{GeneIdMatch, TranscriptIdMatch, OfficialIdMatch, XrefMatch, SymbolMatch, AliasMatch}
+
+	resolveSql = map[string]string{GeneIdMatch: ResolveGeneIdsSql,
+		TranscriptIdMatch: ResolveTranscriptIdsSql,
+		OfficialIdMatch:   ResolveOfficialIdsSql,
+		XrefMatch:         ResolveXrefsSql,
+		SymbolMatch:       ResolveSymbolsSql,
+		AliasMatch:        ResolveAliasesSql}
+)
+
+// ResolveIds finds the genes of a list of symbols, aliases, HGNC or MGI
+// ids, Entrez, UniProt or RefSeq ids and Ensembl gene or transcript ids,
+// with or without versions.
+// There is one record per id in the order given, saying whether it
+// matched one gene, several or none. Genes and transcripts matched by a
+// versioned id have their versions, and the record flags a different
+// version than the annotation's.
+func (gdb *GtfDB) ResolveIds(ids []string) ([]*ResolvedId, error) {
+	return resolveIds(ids, gdb.resolveKeys, gdb.AddVersions)
+}
+
+// the genes, or genes with a transcript, matching each key of a kind
+// of identifier
+func (gdb *GtfDB) resolveKeys(matchedBy string, keys []string) (map[string][]*GenomicFeature, error) {
+	if (matchedBy == AliasMatch && !gdb.hasGeneAliases()) || (matchedBy == XrefMatch && !gdb.hasGeneXrefs()) {
+		return map[string][]*GenomicFeature{}, nil
+	}
+
+	candidates := make([]idCandidate, 0, len(keys))
+
+	for chunk := range slices.Chunk(keys, MaxTagQueryIds) {
+		query, namedArgs := inSql(resolveSql[matchedBy], "k", chunk)
+
+		found, err := gdb.idCandidates(query, namedArgs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, found...)
+	}
+
+	var features map[idCandidate]*GenomicFeature
+	var err error
+
+	if matchedBy == TranscriptIdMatch {
+		features, err = gdb.resolveTranscripts(candidates)
+	} else {
+		features, err = gdb.resolveGenes(candidates)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string][]*GenomicFeature, len(keys))
+
+	for _, candidate := range candidates {
+		if feature, ok := features[candidate]; ok {
+			ret[candidate.key] = append(ret[candidate.key], feature)
+		}
+	}
+
+	return ret, nil
+}
+
+func (gdb *GtfDB) idCandidates(query string, namedArgs []any) ([]idCandidate, error) {
+	rows, err := gdb.db.Query(query, namedArgs...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ret := make([]idCandidate, 0, len(namedArgs))
+
+	for rows.Next() {
+		var candidate idCandidate
+
+		err := rows.Scan(&candidate.key, &candidate.id, &candidate.transcript)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, candidate)
+	}
+
+	return ret, rows.Err()
+}
+
+// the gene of each candidate
+func (gdb *GtfDB) resolveGenes(candidates []idCandidate) (map[idCandidate]*GenomicFeature, error) {
+	ids := make([]int, 0, len(candidates))
+
+	for _, candidate := range candidates {
+		ids = append(ids, candidate.id)
+	}
+
+	slices.Sort(ids)
+
+	genes := make(map[int]*GenomicFeature, len(ids))
+
+	for chunk := range slices.Chunk(slices.Compact(ids), MaxTagQueryIds) {
+		query, namedArgs := geneIdsMatchSql(chunk)
+
+		// no limit on the genes returned
+		namedArgs = append(namedArgs, sql.Named("n", -1))
+
+		rows, err := gdb.db.Query(MakeGeneBiotypeSql(strings.Replace(GeneInfoSql, "<<MATCH>>", query, 1), nil, &namedArgs),
+			namedArgs...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		features, err := genesToGeneInfoRecords(rows)
+
+		rows.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, feature := range features {
+			genes[feature.Id] = feature
+		}
+	}
+
+	ret := make(map[idCandidate]*GenomicFeature, len(candidates))
+
+	for _, candidate := range candidates {
+		if gene, ok := genes[candidate.id]; ok {
+			ret[candidate] = gene
+		}
+	}
+
+	return ret, nil
+}
+
+// the gene of each candidate with only the transcript that matched
+func (gdb *GtfDB) resolveTranscripts(candidates []idCandidate) (map[idCandidate]*GenomicFeature, error) {
+	ret := make(map[idCandidate]*GenomicFeature, len(candidates))
+
+	// genes are limited to MaxGeneInfoResults transcripts
+	for chunk := range slices.Chunk(candidates, int(MaxGeneInfoResults)) {
+		transcripts := make([]string, 0, len(chunk))
+
+		for _, candidate := range chunk {
+			transcripts = append(transcripts, candidate.key)
+		}
+
+		query, namedArgs := inSql(TranscriptIdsMatchSql, "t", transcripts)
+
+		features, err := gdb.searchTranscripts(query, namedArgs, nil, false, MaxGeneInfoResults)
+
+		if err != nil {
+			return nil, err
+		}
+
+		addTranscriptMatches(ret, chunk, features)
+	}
+
+	return ret, nil
+}
+
+// ResolveIds resolves ids as GtfDB.ResolveIds does
+func (mdb *MemGeneDB) ResolveIds(ids []string) ([]*ResolvedId, error) {
+	return resolveIds(ids, mdb.resolveKeys, mdb.AddVersions)
+}
+
+func (mdb *MemGeneDB) resolveKeys(matchedBy string, keys []string) (map[string][]*GenomicFeature, error) {
+	wanted := make(map[string]bool, len(keys))
+
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	candidates := make([]idCandidate, 0, len(keys))
+
+	for _, gene := range mdb.symbolGenes {
+		id := mdb.geneIds[gene]
+
+		switch matchedBy {
+		case GeneIdMatch:
+			candidates = appendCandidate(candidates, wanted, gene.Id, id, "")
+		case TranscriptIdMatch:
+			for _, transcript := range gene.Transcripts {
+				candidates = appendCandidate(candidates, wanted, transcript.Id, id, transcript.Id)
+			}
+		case OfficialIdMatch:
+			candidates = appendCandidate(candidates, wanted, gene.OfficialId, id, "")
+		case XrefMatch:
+			for _, xrefs := range gene.Xrefs {
+				for _, xref := range xrefs {
+					candidates = appendCandidate(candidates, wanted, xref, id, "")
+				}
+			}
+		case SymbolMatch:
+			candidates = appendCandidate(candidates, wanted, gene.Symbol, id, "")
+		case AliasMatch:
+			for _, alias := range gene.Aliases {
+				candidates = appendCandidate(candidates, wanted, alias, id, "")
+			}
+		}
+	}
+
+	var features map[idCandidate]*GenomicFeature
+
+	if matchedBy == TranscriptIdMatch {
+		transcripts := make(map[string]bool, len(candidates))
+
+		for _, candidate := range candidates {
+			transcripts[candidate.transcript] = true
+		}
+
+		found, err := mdb.searchTranscripts(func(gene *MemGene) bool { return false },
+			func(id string) bool { return transcripts[id] },
+			nil,
+			false,
+			MaxGeneInfoResults)
+
+		if err != nil {
+			return nil, err
+		}
+
+		features = make(map[idCandidate]*GenomicFeature, len(candidates))
+
+		addTranscriptMatches(features, candidates, found)
+	} else {
+		genes := make(map[int]bool, len(candidates))
+
+		for _, candidate := range candidates {
+			genes[candidate.id] = true
+		}
+
+		found, err := mdb.searchGenes(func(gene *MemGene) bool { return genes[mdb.geneIds[gene]] }, nil, int16(len(genes)))
+
+		if err != nil {
+			return nil, err
+		}
+
+		byId := make(map[int]*GenomicFeature, len(found))
+
+		for _, feature := range found {
+			byId[feature.Id] = feature
+		}
+
+		features = make(map[idCandidate]*GenomicFeature, len(candidates))
+
+		for _, candidate := range candidates {
+			if gene, ok := byId[candidate.id]; ok {
+				features[candidate] = gene
+			}
+		}
+	}
+
+	ret := make(map[string][]*GenomicFeature, len(keys))
+
+	for _, candidate := range candidates {
+		if feature, ok := features[candidate]; ok {
+			ret[candidate.key] = append(ret[candidate.key], feature)
+		}
+	}
+
+	return ret, nil
+}
+
+// adds a candidate if the lower case name is a key that is wanted
+func appendCandidate(candidates []idCandidate, wanted map[string]bool, name string, id int, transcript string) []idCandidate {
+	key := strings.ToLower(name)
+
+	if name == "" || !wanted[key] {
+		return candidates
+	}
+
+	return append(candidates, idCandidate{key: key, id: id, transcript: transcript})
+}
+
+// splits genes found with several transcripts into a copy of the gene
+// for each transcript
+func addTranscriptMatches(matches map[idCandidate]*GenomicFeature, candidates []idCandidate, genes []*GenomicFeature) {
+	for _, candidate := range candidates {
+		for _, gene := range genes {
+			if gene.Id != candidate.id {
+				continue
+			}
+
+			i := slices.IndexFunc(gene.Children, func(transcript *GenomicFeature) bool {
+				return transcript.Transcript == candidate.transcript
+			})
+
+			if i == -1 {
+				continue
+			}
+
+			match := *gene
+			match.Children = []*GenomicFeature{gene.Children[i]}
+
+			matches[candidate] = &match
+		}
+	}
+}
+
+// resolveIds resolves each id by the first kind of identifier that
+// matches it, using resolveKeys to find the genes matching the lower
+// case keys of a kind and addVersions to compare versioned ids
+func resolveIds(ids []string,
+	resolveKeys func(matchedBy string, keys []string) (map[string][]*GenomicFeature, error),
+	addVersions func(features []*GenomicFeature) error) ([]*ResolvedId, error) {
+	if len(ids) > MaxResolveIds {
+		return nil, fmt.Errorf("at most %d ids can be resolved at once", MaxResolveIds)
+	}
+
+	ret := make([]*ResolvedId, 0, len(ids))
+
+	for _, id := range ids {
+		ret = append(ret, &ResolvedId{Query: id, Status: ResolvedUnmatched, Features: []*GenomicFeature{}})
+	}
+
+	for _, matchedBy := range resolveOrder {
+		// the ids still unresolved with each key
+		keys := make(map[string][]int, len(ids))
+
+		for i, id := range ids {
+			if ret[i].Status != ResolvedUnmatched {
+				continue
+			}
+
+			key := resolveKey(matchedBy, id)
+
+			if key != "" {
+				keys[key] = append(keys[key], i)
+			}
+		}
+
+		if len(keys) == 0 {
+			break
+		}
+
+		sortedKeys := make([]string, 0, len(keys))
+
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+
+		// deterministic queries
+		slices.Sort(sortedKeys)
+
+		found, err := resolveKeys(matchedBy, sortedKeys)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for key, features := range found {
+			features = sortResolved(features)
+
+			status := ResolvedMatched
+
+			if len(features) > 1 {
+				status = ResolvedAmbiguous
+			}
+
+			for _, i := range keys[key] {
+				ret[i].Status = status
+				ret[i].MatchedBy = matchedBy
+				ret[i].Features = features
+			}
+		}
+	}
+
+	return ret, matchResolvedVersions(ret, addVersions)
+}
+
+// matchResolvedVersions sets the versions of genes and transcripts
+// matched by versioned ids and flags the ids whose version differs
+func matchResolvedVersions(resolved []*ResolvedId, addVersions func(features []*GenomicFeature) error) error {
+	features := make([]*GenomicFeature, 0, len(resolved))
+
+	for _, r := range resolved {
+		if _, version := splitIdVersion(strings.TrimSpace(r.Query)); version != "" &&
+			(r.MatchedBy == GeneIdMatch || r.MatchedBy == TranscriptIdMatch) {
+			features = append(features, r.Features...)
+		}
+	}
+
+	if len(features) == 0 {
+		return nil
+	}
+
+	err := addVersions(features)
+
+	if err != nil {
+		return err
+	}
+
+	for _, r := range resolved {
+		id, version := splitIdVersion(strings.TrimSpace(r.Query))
+
+		if version == "" || (r.MatchedBy != GeneIdMatch && r.MatchedBy != TranscriptIdMatch) {
+			continue
+		}
+
+		if feature := findFeatureById(r.Features, id); feature != nil && feature.Version != "" && feature.Version != version {
+			r.MatchedVersion = version
+		}
+	}
+
+	return nil
+}
+
+// the lower case form of id matched by a kind of identifier. Versions
+// are ignored on Ensembl ids since the importer strips them.
+func resolveKey(matchedBy string, id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+
+	if matchedBy == GeneIdMatch || matchedBy == TranscriptIdMatch {
+		id = StripIdVersion(id)
+	}
+
+	return id
+}
+
+// candidates are ordered as searches order genes, once each since
+// e.g. a gene can have aliases differing only by case
+func sortResolved(features []*GenomicFeature) []*GenomicFeature {
+	slices.SortFunc(features, func(a, b *GenomicFeature) int {
+		if c := strings.Compare(a.Symbol, b.Symbol); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.GeneId, b.GeneId)
+	})
+
+	return slices.CompactFunc(features, func(a, b *GenomicFeature) bool {
+		return a.Id == b.Id
+	})
+}
+
+// inSql replaces <<IDS>> in query with a named placeholder for each
+// of values, named by prefix and their position
+func inSql[T any](query string, prefix string, values []T) (string, []any) {
+	namedArgs := make([]any, 0, len(values))
+
+	placeholders := make([]string, len(values))
+
+	for i, value := range values {
+		ph := fmt.Sprintf("%s%d", prefix, i+1)
+		placeholders[i] = ":" + ph
+		namedArgs = append(namedArgs, sql.Named(ph, value))
+	}
+
+	return strings.Replace(query, "<<IDS>>", strings.Join(placeholders, ","), 1), namedArgs
+}
@@ -0,0 +1,91 @@
+package genome_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+// status, what matched and the genes and transcripts found for each id
+func describeResolved(resolved []*genome.ResolvedId) []string {
+	ret := make([]string, 0, len(resolved))
+
+	for _, r := range resolved {
+		line := fmt.Sprintf("%s %s %s", r.Query, r.Status, r.MatchedBy)
+
+		for _, feature := range r.Features {
+			line += " " + feature.Symbol
+
+			for _, child := range feature.Children {
+				line += "/" + child.Transcript
+			}
+		}
+
+		ret = append(ret, line)
+	}
+
+	return ret
+}
+
+func TestResolveIds(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	resolved, err := gdb.ResolveIds([]string{"GENEA",
+		"ensg00000000002.7",
+		"ENST00000000002.1",
+		"HGNC:4",
+		"delta",
+		"Alpha",
+		"ENSG00000000003",
+		"nothing",
+		"",
+		"genea",
+		"1002",
+		"P00045"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"GENEA matched symbol GENEA",
+		"ensg00000000002.7 matched geneId GENEB",
+		"ENST00000000002.1 matched transcriptId GENEA/ENST00000000002",
+		"HGNC:4 matched officialId GENED",
+		"delta ambiguous alias GENED GENEE",
+		"Alpha matched alias GENEA",
+		// ids win over symbols
+		"ENSG00000000003 matched geneId ENSG00000000003",
+		"nothing unmatched ",
+		" unmatched ",
+		"genea matched symbol GENEA",
+		"1002 matched xref GENEB",
+		"P00045 ambiguous xref GENED GENEE"}
+
+	if got := describeResolved(resolved); !slices.Equal(got, want) {
+		t.Errorf("resolved\n%q\nwant\n%q", got, want)
+	}
+
+	if gene := resolved[0].Features[0]; gene.Type != genome.GeneLevel || gene.GeneId != "ENSG00000000001" || gene.Location == nil {
+		t.Errorf("gene = %+v", gene)
+	}
+
+	// older databases do not have aliases or xrefs
+	resolved, err = openGtf(t, genometest.OldGtfId).ResolveIds([]string{"alpha", "GENEA"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := describeResolved(resolved); !slices.Equal(got, []string{"alpha unmatched ", "GENEA matched symbol GENEA"}) {
+		t.Errorf("old database = %q", got)
+	}
+
+	_, err = gdb.ResolveIds(make([]string, genome.MaxResolveIds+1))
+
+	if err == nil {
+		t.Error("too many ids should be an error")
+	}
+}
@@ -1,11 +1,13 @@
 package routes
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -25,21 +27,33 @@ type (
 		//Assembly string
 		Feature string
 		Db      *genome.GtfDB
-		Biotype string // e.g. "protein_coding", "non_coding", etc.
-		// only show canonical genes
-		Canonical bool
-		Promoter  *dna.PromoterRegion
+		// which genes and which of their transcripts to show, by
+		// biotype and transcript policy, nil for all
+		Policy   *genome.TranscriptPolicy
+		Promoter *dna.PromoterRegion
+		// whether to add the Entrez, UniProt and RefSeq ids of genes
+		Xrefs bool
+		// whether to add the versions of gene, transcript and exon ids
+		Versions bool
+		// whether to add the full names of genes
+		Descriptions bool
 	}
 
 	GenesResp struct {
 		Location *dna.Location            `json:"location"`
 		Features []*genome.GenomicFeature `json:"features"`
+		Liftover *genome.LiftResult       `json:"liftover,omitempty"`
 	}
 
 	AnnotationResponse struct {
 		Status int                      `json:"status"`
 		Data   []*genome.GeneAnnotation `json:"data"`
 	}
+
+	// the identifiers to resolve, in any mix of types
+	ResolveIdsReq struct {
+		Ids []string `json:"ids"`
+	}
 )
 
 const (
@@ -52,11 +66,23 @@ const (
 
 	// Max number of locations to annotate in a single request. This is to prevent abuse and also to keep response times reasonable.
 	MaxAnnotations int = 100
+
+	// Max number of annotation databases that can be compared in a single request.
+	MaxAnnotationSources int = 5
+
+	// Max number of gene or transcript biotypes that can be included or excluded.
+	MaxBiotypes int = 20
 )
 
 var (
-	ErrLocationCannotBeEmpty = errors.New("location cannot be empty")
-	ErrSearchTooShort        = errors.New("search too short")
+	ErrLocationCannotBeEmpty    = errors.New("location cannot be empty")
+	ErrSearchTooShort           = errors.New("search too short")
+	ErrTranscriptsCannotBeEmpty = errors.New("transcripts cannot be empty")
+	ErrSourcesCannotBeEmpty     = errors.New("annotation ids cannot be empty")
+	ErrIdsCannotBeEmpty         = errors.New("ids cannot be empty")
+	ErrGeneCannotBeEmpty        = errors.New("gene cannot be empty")
+	ErrTargetCannotBeEmpty      = errors.New("target cannot be empty")
+	ErrNotSupported             = errors.New("not supported by the annotation")
 
 	// genomeNormMap = map[string]string{
 	// 	"hg19":   "gencode.v48lift37.basic.grch37",
@@ -133,9 +159,11 @@ func parseQuery(c *gin.Context, param string) (*GeneQuery, error) {
 	// 	feature = genome.GeneLevel
 	// }
 
-	canonical := strings.HasPrefix(strings.ToLower(c.Query("canonical")), "t")
+	policy, err := ParseTranscriptPolicy(c)
 
-	biotype := ParseBiotype(c)
+	if err != nil {
+		return nil, err
+	}
 
 	promoterRegion := ParsePromoterRegion(c)
 
@@ -155,11 +183,13 @@ func parseQuery(c *gin.Context, param string) (*GeneQuery, error) {
 	return &GeneQuery{
 			Id: id,
 			//Assembly:  id,
-			Biotype:   biotype,
-			Db:        db,
-			Feature:   feature,
-			Canonical: canonical,
-			Promoter:  promoterRegion},
+			Db:           db,
+			Feature:      feature,
+			Policy:       policy,
+			Promoter:     promoterRegion,
+			Xrefs:        web.ParseBoolParam(c, "xrefs", false),
+			Versions:     web.ParseBoolParam(c, "versions", false),
+			Descriptions: web.ParseBoolParam(c, "descriptions", false)},
 		nil
 }
 
@@ -191,24 +221,45 @@ func OverlappingGenesRoute(c *gin.Context) {
 
 	if len(locations) == 0 {
 		web.BadReqResp(c, ErrLocationCannotBeEmpty)
+		return
+	}
+
+	locations, lifts, err := liftLocations(c, query.Db.Annotation().Assembly, locations)
+
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
 	ret := make([]*GenesResp, 0, len(locations))
 
-	for _, location := range locations {
+	for li, location := range locations {
+		if location == nil {
+			ret = append(ret, &GenesResp{Location: lifts[li].Location,
+				Features: []*genome.GenomicFeature{},
+				Liftover: lifts[li]})
+			continue
+		}
+
 		features, err := query.Db.OverlappingGenes(location,
 			query.Feature,
 			query.Promoter,
-			query.Canonical,
-			false,
-			query.Biotype)
+			query.Policy,
+			false)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		err = addDetails(query, features)
 
 		if err != nil {
 			c.Error(err)
 			return
 		}
 
-		ret = append(ret, &GenesResp{Location: location, Features: features})
+		ret = append(ret, &GenesResp{Location: location, Features: features, Liftover: lifts[li]})
 
 	}
 
@@ -225,8 +276,6 @@ func SearchForGenesByAssemblyRoute(c *gin.Context) {
 		return
 	}
 
-	//fuzzyMode := c.Query("mode") == "fuzzy"
-
 	n := web.ParseN(c, 20)
 
 	query, err := parseQuery(c, "assembly")
@@ -236,20 +285,97 @@ func SearchForGenesByAssemblyRoute(c *gin.Context) {
 		return
 	}
 
-	canonical := strings.HasPrefix(strings.ToLower(c.Query("canonical")), "t")
+	features, err := searchByName(c, query, search, n)
 
-	features, _ := query.Db.SearchByName(search,
-		query.Feature,
-		canonical,
-		int16(n))
-
-	// if err != nil {
-	// 	return web.ErrorReq(err)
-	// }
+	if err != nil {
+		c.Error(err)
+		return
+	}
 
 	web.MakeDataResp(c, "", &features)
 }
 
+// search by name, ranking genes by how well they match if
+// the mode is fuzzy
+func searchByName(c *gin.Context, query *GeneQuery, search string, n int) ([]*genome.GenomicFeature, error) {
+	var features []*genome.GenomicFeature
+	var err error
+
+	if c.Query("mode") == genome.FuzzySearchMode {
+		features, err = query.Db.FuzzySearchByName(search,
+			query.Feature,
+			query.Policy,
+			int16(n))
+	} else {
+		features, err = query.Db.SearchByName(search,
+			query.Feature,
+			query.Policy,
+			int16(n))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return features, addDetails(query, features)
+}
+
+// add the xrefs and descriptions of genes and the versions of ids if
+// asked for
+func addDetails(query *GeneQuery, features []*genome.GenomicFeature) error {
+	if query.Xrefs {
+		db, err := capability[genome.XrefAdder](query.Db)
+
+		if err != nil {
+			return err
+		}
+
+		err = db.AddXrefs(features)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if query.Descriptions {
+		db, err := capability[genome.DescriptionAdder](query.Db)
+
+		if err != nil {
+			return err
+		}
+
+		err = db.AddDescriptions(features)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if query.Versions {
+		db, err := capability[genome.VersionAdder](query.Db)
+
+		if err != nil {
+			return err
+		}
+
+		return db.AddVersions(features)
+	}
+
+	return nil
+}
+
+// the optional capabilities of a gene database, e.g. paged search,
+// are interfaces of their own that not every backend implements
+func capability[T any](gdb genome.GeneDB) (T, error) {
+	db, ok := gdb.(T)
+
+	if !ok {
+		return db, fmt.Errorf("%s: %w", gdb.Annotation().PublicId, ErrNotSupported)
+	}
+
+	return db, nil
+}
+
 // Search for genes using a specific gtf database. Preferable
 // as slightly faster lookup.
 func SearchForGenesRoute(c *gin.Context) {
@@ -269,132 +395,168 @@ func SearchForGenesRoute(c *gin.Context) {
 		return
 	}
 
-	canonical := strings.HasPrefix(strings.ToLower(c.Query("canonical")), "t")
-
-	features, _ := query.Db.SearchByName(search,
-		query.Feature,
-		canonical,
-		int16(n))
+	features, err := searchByName(c, query, search, n)
 
-	// if err != nil {
-	// 	return web.ErrorReq(err)
-	// }
+	if err != nil {
+		c.Error(err)
+		return
+	}
 
 	web.MakeDataResp(c, "", &features)
 }
 
-func WithinGenesRoute(c *gin.Context) {
-	locations, err := dnaroutes.ParseLocationsFromPost(c, MaxAnnotations) // dnaroutes.ParseLocationsFromPost(c)
+// Search for genes a page at a time, best matches first. The response
+// has the total number of genes matched, at most
+// genome.MaxSearchCandidates, and the cursor of the next page
+// to pass back as cursor.
+func SearchPageRoute(c *gin.Context) {
+	search := c.Query("q")
+
+	if search == "" {
+		web.BadReqResp(c, ErrSearchTooShort)
+		return
+	}
+
+	n := web.ParseN(c, 20)
+
+	query, err := parseQuery(c, "id")
 
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	query, err := parseQuery(c, "assembly")
+	db, err := capability[genome.GeneSearcher](query.Db)
 
 	if err != nil {
-		c.Error(err)
+		web.BadReqResp(c, err)
 		return
 	}
 
-	data := make([]*genome.GenomicSearchResults, len(locations))
+	page, err := db.Search(search,
+		query.Feature,
+		query.Policy,
+		c.Query("mode") == genome.FuzzySearchMode,
+		int16(n),
+		c.Query("cursor"))
 
-	for li, location := range locations {
-		genes, err := query.Db.WithinGenes(location, query.Feature, query.Promoter)
+	if err != nil {
+		web.BadReqResp(c, err)
+		return
+	}
 
-		if err != nil {
-			c.Error(err)
-			return
-		}
+	err = addDetails(query, page.Features)
 
-		data[li] = genes
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	web.MakeDataResp(c, "", &data)
+	web.MakeDataResp(c, "", page)
 }
 
-// Find the n closest genes to a location
-func ClosestGeneRoute(c *gin.Context) {
-	locations, err := dnaroutes.ParseLocationsFromPost(c, MaxAnnotations)
+// Suggest genes whose symbol, an alias or an id starts with q, for
+// search boxes that query on every keystroke. Suggestions are answered
+// from memory so unlike the other searches q can be a single letter.
+func AutocompleteRoute(c *gin.Context) {
+	prefix := c.Query("q")
 
-	if err != nil {
-		c.Error(err)
+	if prefix == "" {
+		web.BadReqResp(c, ErrSearchTooShort)
 		return
 	}
 
-	query, err := parseQuery(c, "assembly")
+	n := web.ParseN(c, 10)
+
+	gdb, err := parseGtf(c, "id")
 
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	closestN := max(web.ParseNumParam(c, "closest", DefaultClosestN), MaxClosestN)
-
-	useOfficialGenes := web.ParseBoolParam(c, "use_official", true)
-
-	data := make([]*genome.GenomicSearchResults, len(locations))
+	db, err := capability[genome.GeneAutocompleter](gdb)
 
-	for li, location := range locations {
-		genes, err := query.Db.ClosestGenes(location,
-			query.Promoter,
-			int8(closestN),
-			useOfficialGenes)
+	if err != nil {
+		web.BadReqResp(c, err)
+		return
+	}
 
-		if err != nil {
-			c.Error(err)
-			return
-		}
+	suggestions, err := db.Autocomplete(prefix, int16(n))
 
-		data[li] = &genome.GenomicSearchResults{Location: location, Type: genome.GeneLevel, Features: genes}
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	web.MakeDataResp(c, "", &data)
+	web.MakeDataResp(c, "", suggestions)
 }
 
-func ParseBiotype(c *gin.Context) string {
-	geneType := c.Query("type")
+// List the biotypes of a database with the number of genes and
+// transcripts of each and the group, e.g. coding, they are in
+func BiotypesRoute(c *gin.Context) {
+	gdb, err := parseGtf(c, "id")
 
-	// user can specify gene type in query string, but we sanitize it
-	switch {
-	case strings.Contains(geneType, "protein"):
-		return "protein_coding"
-	default:
-		return ""
+	if err != nil {
+		c.Error(err)
+		return
 	}
-}
 
-func ParsePromoterRegion(c *gin.Context) *dna.PromoterRegion {
+	db, err := capability[genome.BiotypeCatalog](gdb)
 
-	v := c.Query("promoter")
+	if err != nil {
+		web.BadReqResp(c, err)
+		return
+	}
 
-	if v == "" {
-		return dna.DefaultPromoterRegion()
+	biotypes, err := db.Biotypes()
+
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	tokens := strings.Split(v, ",")
+	web.MakeDataResp(c, "", biotypes)
+}
 
-	s, err := strconv.Atoi(tokens[0])
+// the database of a URL parameter for routes that need none of the
+// other query params
+func parseGtf(c *gin.Context, param string) (genome.GeneDB, error) {
+	id := web.FormatParam(c.Param(param))
 
-	if err != nil {
-		return dna.DefaultPromoterRegion()
+	if id == "" {
+		return nil, errors.New("assembly cannot be empty")
 	}
 
-	e, err := strconv.Atoi(tokens[1])
+	db, err := genomedb.GtfFromId(genome.NormalizeAssembly(id))
 
 	if err != nil {
-		return dna.DefaultPromoterRegion()
+		return nil, err
 	}
 
-	return dna.NewPromoterRegion(s, e)
+	return db, nil
 }
 
-func AnnotateRoute(c *gin.Context) {
-	locations, err := dnaroutes.ParseLocationsFromPost(c, MaxAnnotations)
+// Resolve a list of symbols, aliases, HGNC ids and Ensembl gene or
+// transcript ids posted as {"ids": [...]} to genes, one record per id
+// in order, flagging ids that are ambiguous or not found
+func ResolveIdsRoute(c *gin.Context) {
+	var req ResolveIdsReq
+
+	err := c.ShouldBindJSON(&req)
 
 	if err != nil {
-		c.Error(err)
+		web.BadReqResp(c, err)
+		return
+	}
+
+	if len(req.Ids) == 0 {
+		web.BadReqResp(c, ErrIdsCannotBeEmpty)
+		return
+	}
+
+	if len(req.Ids) > genome.MaxResolveIds {
+		web.BadReqResp(c, fmt.Errorf("at most %d ids can be resolved at once", genome.MaxResolveIds))
 		return
 	}
 
@@ -405,96 +567,857 @@ func AnnotateRoute(c *gin.Context) {
 		return
 	}
 
-	// default to using official gene symbols for annotation, but can be turned off with query param
-	useOfficialGenes := web.ParseBoolParam(c, "use_official", true)
-
-	closestN := web.ParseNumParam(c, "closest", DefaultClosestN)
+	db, err := capability[genome.GeneResolver](query.Db)
 
-	tssRegion := ParsePromoterRegion(c)
+	if err != nil {
+		web.BadReqResp(c, err)
+		return
+	}
 
-	output := web.ParseOutput(c)
+	ret, err := db.ResolveIds(req.Ids)
 
-	annotationDb := genome.NewGtfAnnotateDb(query.Db, tssRegion, int8(closestN), useOfficialGenes)
+	if err != nil {
+		c.Error(err)
+		return
+	}
 
-	data := make([]*genome.GeneAnnotation, len(locations))
+	features := make([]*genome.GenomicFeature, 0, len(ret))
 
-	for li, location := range locations {
-		annotations, err := annotationDb.Annotate(location, query.Feature)
+	for _, resolved := range ret {
+		features = append(features, resolved.Features...)
+	}
 
-		if err != nil {
-			log.Error().Msgf("Error annotating location %s: %v", location, err)
-			c.Error(err)
-			return
-		}
+	err = addDetails(query, features)
 
-		data[li] = annotations
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	if output == "text" {
-		tsv, err := MakeGeneTable(data, tssRegion)
+	web.MakeDataResp(c, "", &ret)
+}
 
-		if err != nil {
-			c.Error(err)
-			return
-		}
+// Map a gene, e.g. ?gene=TP53&target=mm10, to its orthologs in the
+// latest annotation of the target assembly, or a specific annotation
+// if target is its id
+func OrthologsRoute(c *gin.Context) {
+	gene := strings.TrimSpace(c.Query("gene"))
 
-		c.String(http.StatusOK, tsv)
-	} else {
-		web.MakeDataResp(c, "", &data)
+	if gene == "" {
+		web.BadReqResp(c, ErrGeneCannotBeEmpty)
+		return
 	}
-}
 
-func MakeGeneTable(
-	data []*genome.GeneAnnotation,
-	ts *dna.PromoterRegion,
-) (string, error) {
-	var buffer bytes.Buffer
-	wtr := csv.NewWriter(&buffer)
-	wtr.Comma = '\t'
+	targetId := genome.NormalizeAssembly(c.Query("target"))
 
-	closestN := len(data[0].ClosestGenes)
+	if targetId == "" {
+		web.BadReqResp(c, ErrTargetCannotBeEmpty)
+		return
+	}
 
-	headers := make([]string, 5+4*closestN)
+	query, err := parseQuery(c, "id")
 
-	headers[0] = "Location"
-	headers[1] = "Gene Id"
-	headers[2] = "Gene Symbol"
-	headers[3] = fmt.Sprintf(
-		"Relative To Gene (prom=-%d/+%dkb)",
-		ts.Upstream()/1000,
-		ts.Downstream()/1000)
-	headers[4] = "TSS Distance"
-	//headers[5] = "Gene Location"
+	if err != nil {
+		c.Error(err)
+		return
+	}
 
-	idx := 6
-	for i := 1; i <= closestN; i++ {
-		headers[idx] = fmt.Sprintf("#%d Closest Id", i)
-		headers[idx] = fmt.Sprintf("#%d Closest Gene Symbols", i)
-		headers[idx] = fmt.Sprintf(
-			"#%d Relative To Closet Gene (prom=-%d/+%dkb)",
-			i,
-			ts.Upstream()/1000,
-			ts.Downstream()/1000)
-		headers[idx] = fmt.Sprintf("#%d TSS Closest Distance", i)
-		headers[idx] = fmt.Sprintf("#%d Gene Location", i)
+	db, err := capability[genome.OrthologMapper](query.Db)
+
+	if err != nil {
+		web.BadReqResp(c, err)
+		return
 	}
 
-	err := wtr.Write(headers)
+	target, err := genomedb.GtfFromId(targetId)
 
 	if err != nil {
-		return "", err
+		c.Error(fmt.Errorf("unable to open database for assembly %s %s", targetId, err))
+		return
 	}
 
-	for _, annotation := range data {
-		n := len(annotation.WithinGenes)
-		geneIds := make([]string, n)
-		geneNames := make([]string, n)
-		promLabels := make([]string, n)
-		tssDists := make([]string, n)
+	ret, err := db.Orthologs(gene, target)
 
-		for i, gene := range annotation.WithinGenes {
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	web.MakeDataResp(c, "", &ret)
+}
+
+func WithinGenesRoute(c *gin.Context) {
+	locations, err := dnaroutes.ParseLocationsFromPost(c, MaxAnnotations) // dnaroutes.ParseLocationsFromPost(c)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	query, err := parseQuery(c, "assembly")
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	locations, lifts, err := liftLocations(c, query.Db.Annotation().Assembly, locations)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	data := make([]*genome.GenomicSearchResults, len(locations))
+
+	for li, location := range locations {
+		if location == nil {
+			data[li] = failedLiftResults(lifts[li], query.Feature)
+			continue
+		}
+
+		genes, err := query.Db.WithinGenes(location, query.Feature, query.Promoter)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		genes.Liftover = lifts[li]
+
+		data[li] = genes
+	}
+
+	web.MakeDataResp(c, "", &data)
+}
+
+// Find the n closest genes to a location
+func ClosestGeneRoute(c *gin.Context) {
+	locations, err := dnaroutes.ParseLocationsFromPost(c, MaxAnnotations)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	query, err := parseQuery(c, "assembly")
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	closestN := min(web.ParseNumParam(c, "closest", DefaultClosestN), MaxClosestN)
+
+	useOfficialGenes := web.ParseBoolParam(c, "use_official", true)
+
+	locations, lifts, err := liftLocations(c, query.Db.Annotation().Assembly, locations)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	data := make([]*genome.GenomicSearchResults, len(locations))
+
+	for li, location := range locations {
+		if location == nil {
+			data[li] = failedLiftResults(lifts[li], genome.GeneLevel)
+			continue
+		}
+
+		genes, err := query.Db.ClosestGenes(location,
+			query.Promoter,
+			int8(closestN),
+			query.Policy,
+			useOfficialGenes)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		data[li] = &genome.GenomicSearchResults{Location: location,
+			Type:     genome.GeneLevel,
+			Features: genes,
+			Liftover: lifts[li]}
+	}
+
+	web.MakeDataResp(c, "", &data)
+}
+
+// Export the TSS or promoter window of every gene or transcript as
+// BED6 or JSON. A GET request exports the whole genome whilst a POST
+// with locations restricts the export to those regions.
+func TssRoute(c *gin.Context) {
+	query, err := parseQuery(c, "id")
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var locations []*dna.Location
+
+	if c.Request.Method == http.MethodPost {
+		locations, err = dnaroutes.ParseLocationsFromPost(c, MaxAnnotations)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		locations, _, err = liftLocations(c, query.Db.Annotation().Assembly, locations)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		// locations that could not be lifted are skipped
+		locations = slices.DeleteFunc(locations, func(location *dna.Location) bool {
+			return location == nil
+		})
+	} else {
+		// a nil location means genome wide
+		locations = []*dna.Location{nil}
+	}
+
+	level := genome.TranscriptLevel
+
+	if !strings.Contains(query.Feature, genome.TranscriptLevel) {
+		level = genome.GeneLevel
+	}
+
+	// check before any of a text response is written
+	if level == genome.GeneLevel && !query.Policy.HasCriteria() && query.Policy.FiltersTranscripts() {
+		web.BadReqResp(c, genome.ErrGeneTssNeedsCriteria)
+		return
+	}
+
+	// if the user wants promoters, use the promoter region, otherwise
+	// just the single base tss
+	var prom *dna.PromoterRegion
+
+	if c.Query("mode") == genome.PromoterLabel {
+		prom = query.Promoter
+	}
+
+	output := web.ParseOutput(c)
+
+	if output == "text" {
+		c.Header("Content-Type", "text/plain")
+		c.Status(http.StatusOK)
+
+		wtr := bufio.NewWriter(c.Writer)
+
+		for _, location := range locations {
+			err := query.Db.TssFeatures(location,
+				level,
+				prom,
+				query.Policy,
+				func(feature *genome.GenomicFeature) error {
+					return genome.WriteBed(wtr, feature)
+				})
+
+			if err != nil {
+				// headers have been sent so we can only log
+				log.Error().Msgf("error writing tss bed: %v", err)
+				break
+			}
+		}
+
+		wtr.Flush()
+
+		return
+	}
+
+	features := make([]*genome.GenomicFeature, 0, 100)
+
+	for _, location := range locations {
+		err := query.Db.TssFeatures(location,
+			level,
+			prom,
+			query.Policy,
+			func(feature *genome.GenomicFeature) error {
+				features = append(features, feature)
+				return nil
+			})
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	web.MakeDataResp(c, "", &features)
+}
+
+// Return the spliced mRNA, CDS or UTR sequences of transcripts, e.g.
+// ?transcripts=ENST00000269305,ENST00000445888&seq=cds, as FASTA when
+// output=text, otherwise as JSON with all sequence types.
+func TranscriptSequencesRoute(c *gin.Context) {
+	query, err := parseQuery(c, "id")
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ids := parseIdList(c, "transcripts", MaxAnnotations)
+
+	if len(ids) == 0 {
+		web.BadReqResp(c, ErrTranscriptsCannotBeEmpty)
+		return
+	}
+
+	seqs, err := genomedb.SequenceFromAssembly(query.Db.Annotation().Assembly)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	defer seqs.Close()
+
+	ret := make([]*genome.TranscriptSequences, 0, len(ids))
+
+	for _, id := range ids {
+		sequences, err := query.Db.TranscriptSequences(&genome.GenomicFeature{Transcript: id}, seqs)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		ret = append(ret, sequences)
+	}
+
+	if web.ParseOutput(c) == "text" {
+		seqType := ParseSequenceType(c)
+
+		var buffer strings.Builder
+
+		for _, sequences := range ret {
+			err := sequences.WriteFasta(&buffer, seqType)
+
+			if err != nil {
+				c.Error(err)
+				return
+			}
+		}
+
+		c.String(http.StatusOK, buffer.String())
+
+		return
+	}
+
+	web.MakeDataResp(c, "", &ret)
+}
+
+// Translate coding transcripts, e.g. ?transcripts=ENST00000269305,
+// returning FASTA when output=text, otherwise JSON which includes
+// whether the start and stop codons are present
+func TranscriptProteinRoute(c *gin.Context) {
+	query, err := parseQuery(c, "id")
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ids := parseIdList(c, "transcripts", MaxAnnotations)
+
+	if len(ids) == 0 {
+		web.BadReqResp(c, ErrTranscriptsCannotBeEmpty)
+		return
+	}
+
+	seqs, err := genomedb.SequenceFromAssembly(query.Db.Annotation().Assembly)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	defer seqs.Close()
+
+	ret := make([]*genome.TranscriptProtein, 0, len(ids))
+
+	for _, id := range ids {
+		protein, err := query.Db.TranscriptProtein(&genome.GenomicFeature{Transcript: id}, seqs)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		ret = append(ret, protein)
+	}
+
+	if web.ParseOutput(c) == "text" {
+		var buffer strings.Builder
+
+		for _, protein := range ret {
+			err := protein.WriteFasta(&buffer)
+
+			if err != nil {
+				c.Error(err)
+				return
+			}
+		}
+
+		c.String(http.StatusOK, buffer.String())
+
+		return
+	}
+
+	web.MakeDataResp(c, "", &ret)
+}
+
+// comma separated ids from a query param, e.g. ?transcripts=id1,id2,
+// keeping at most n
+func parseIdList(c *gin.Context, param string, n int) []string {
+	ids := make([]string, 0, 10)
+
+	for _, id := range strings.Split(c.Query(param), ",") {
+		id = strings.TrimSpace(id)
+
+		if id != "" {
+			ids = append(ids, id)
+		}
+
+		if len(ids) == n {
+			break
+		}
+	}
+
+	return ids
+}
+
+func ParseSequenceType(c *gin.Context) string {
+	switch web.FormatParam(c.Query("seq")) {
+	case genome.CdsSequence:
+		return genome.CdsSequence
+	case genome.Utr5Sequence:
+		return genome.Utr5Sequence
+	case genome.Utr3Sequence:
+		return genome.Utr3Sequence
+	default:
+		return genome.MrnaSequence
+	}
+}
+
+// If the from query param names a different assembly to the database,
+// e.g. from=hg19 with a GRCh38 database, lift the locations to the
+// assembly of the database. The lifted locations are returned in the
+// same order along with the liftover results, which are nil if no
+// liftover was needed. Locations that could not be lifted are nil.
+func liftLocations(c *gin.Context, assembly string, locations []*dna.Location) ([]*dna.Location, []*genome.LiftResult, error) {
+	lifts := make([]*genome.LiftResult, len(locations))
+
+	from := web.FormatParam(c.Query("from"))
+
+	if from == "" {
+		return locations, lifts, nil
+	}
+
+	liftOver, err := genomedb.LiftOver(from, assembly)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if liftOver == nil {
+		return locations, lifts, nil
+	}
+
+	lifted := make([]*dna.Location, len(locations))
+
+	for li, location := range locations {
+		lifts[li] = liftOver.Lift(location)
+		lifted[li] = lifts[li].Primary()
+	}
+
+	return lifted, lifts, nil
+}
+
+// an empty result for a location that could not be lifted
+func failedLiftResults(lift *genome.LiftResult, level string) *genome.GenomicSearchResults {
+	return &genome.GenomicSearchResults{Location: lift.Location,
+		Type:     level,
+		Features: []*genome.GenomicFeature{},
+		Liftover: lift}
+}
+
+// Compare two annotations in the catalog, e.g. GENCODE v47 and v48,
+// returning the changed genes as JSON or as TSV when output=text
+func AnnotationDiffRoute(c *gin.Context) {
+	oldDb, err := genomedb.GtfFromId(web.FormatParam(c.Param("old")))
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	newDb, err := genomedb.GtfFromId(web.FormatParam(c.Param("new")))
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	diff, err := genome.DiffGtfDBs(oldDb, newDb)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if web.ParseOutput(c) == "text" {
+		var buffer strings.Builder
+
+		err := diff.WriteTsv(&buffer)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.String(http.StatusOK, buffer.String())
+
+		return
+	}
+
+	web.MakeDataResp(c, "", diff)
+}
+
+// ParseBiotype reads the gene biotypes or groups of them to keep, e.g.
+// biotype=protein_coding,lncrna or biotype=coding, along with the
+// type=protein of earlier clients
+func ParseBiotype(c *gin.Context) []string {
+	biotypes := parseIdList(c, "biotype", MaxBiotypes)
+
+	if strings.Contains(c.Query("type"), "protein") {
+		biotypes = append(biotypes, "protein_coding")
+	}
+
+	return biotypes
+}
+
+// ParseTranscriptPolicy reads the policy param, e.g.
+// policy=mane,ensembl_canonical,longest, falling back to the
+// canonical=true flag of earlier clients. Genes and transcripts can also
+// be filtered by biotype or groups of biotypes, e.g.
+// biotype=coding,lncrna&exclude_transcript_biotype=nonsense_mediated_decay
+func ParseTranscriptPolicy(c *gin.Context) (*genome.TranscriptPolicy, error) {
+	var policy *genome.TranscriptPolicy
+	var err error
+
+	v := c.Query("policy")
+
+	if v != "" {
+		policy, err = genome.ParseTranscriptPolicy(v)
+
+		if err != nil {
+			return nil, err
+		}
+	} else if strings.HasPrefix(strings.ToLower(c.Query("canonical")), "t") {
+		policy = genome.CanonicalPolicy
+	}
+
+	include := parseIdList(c, "transcript_biotype", MaxBiotypes)
+	exclude := parseIdList(c, "exclude_transcript_biotype", MaxBiotypes)
+
+	if len(include) > 0 || len(exclude) > 0 {
+		policy, err = policy.WithBiotypes(include, exclude)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	include = ParseBiotype(c)
+	exclude = parseIdList(c, "exclude_biotype", MaxBiotypes)
+
+	if len(include) == 0 && len(exclude) == 0 {
+		return policy, nil
+	}
+
+	return policy.WithGeneBiotypes(include, exclude)
+}
+
+func ParsePromoterRegion(c *gin.Context) *dna.PromoterRegion {
+
+	v := c.Query("promoter")
+
+	if v == "" {
+		return dna.DefaultPromoterRegion()
+	}
+
+	tokens := strings.Split(v, ",")
+
+	s, err := strconv.Atoi(tokens[0])
+
+	if err != nil {
+		return dna.DefaultPromoterRegion()
+	}
+
+	e, err := strconv.Atoi(tokens[1])
+
+	if err != nil {
+		return dna.DefaultPromoterRegion()
+	}
+
+	return dna.NewPromoterRegion(s, e)
+}
+
+func AnnotateRoute(c *gin.Context) {
+	locations, err := dnaroutes.ParseLocationsFromPost(c, MaxAnnotations)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	query, err := parseQuery(c, "id")
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// default to using official gene symbols for annotation, but can be turned off with query param
+	useOfficialGenes := web.ParseBoolParam(c, "use_official", true)
+
+	closestN := min(web.ParseNumParam(c, "closest", DefaultClosestN), MaxClosestN)
+
+	tssRegion := ParsePromoterRegion(c)
+
+	output := web.ParseOutput(c)
+
+	annotationDb := genome.NewGtfAnnotateDb(query.Db, tssRegion, int8(closestN), useOfficialGenes, query.Policy)
+
+	locations, lifts, err := liftLocations(c, query.Db.Annotation().Assembly, locations)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	data := make([]*genome.GeneAnnotation, len(locations))
+
+	for li, location := range locations {
+		if location == nil {
+			data[li] = &genome.GeneAnnotation{Location: lifts[li].Location,
+				WithinGenes:  []*genome.GenomicFeature{},
+				ClosestGenes: []*genome.GenomicFeature{},
+				Liftover:     lifts[li]}
+			continue
+		}
+
+		annotations, err := annotationDb.Annotate(location, query.Feature)
+
+		if err != nil {
+			log.Error().Msgf("Error annotating location %s: %v", location, err)
+			c.Error(err)
+			return
+		}
+
+		annotations.Liftover = lifts[li]
+
+		data[li] = annotations
+	}
+
+	// the table always has the descriptions of genes
+	if query.Descriptions || output == "text" {
+		features := make([]*genome.GenomicFeature, 0, len(data)*(closestN+1))
+
+		for _, annotation := range data {
+			features = append(features, annotation.WithinGenes...)
+			features = append(features, annotation.ClosestGenes...)
+		}
+
+		db, err := capability[genome.DescriptionAdder](query.Db)
+
+		if err != nil {
+			web.BadReqResp(c, err)
+			return
+		}
+
+		err = db.AddDescriptions(features)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	if output == "text" {
+		tsv, err := MakeGeneTable(data, tssRegion)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.String(http.StatusOK, tsv)
+	} else {
+		web.MakeDataResp(c, "", &data)
+	}
+}
+
+// Annotate locations against several annotation databases, e.g.
+// ?ids=<gencode basic id>,<refseq id>, returning the results of each
+// side by side with the nearest gene most of them agree on. The
+// databases must be for the same assembly.
+func MultiAnnotateRoute(c *gin.Context) {
+	locations, err := dnaroutes.ParseLocationsFromPost(c, MaxAnnotations)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ids := parseIdList(c, "ids", MaxAnnotationSources)
+
+	if len(ids) == 0 {
+		web.BadReqResp(c, ErrSourcesCannotBeEmpty)
+		return
+	}
+
+	gtfdbs := make([]genome.GeneDB, 0, len(ids))
+
+	for _, id := range ids {
+		gtfdb, err := genomedb.GtfFromId(web.FormatParam(id))
+
+		if err != nil {
+			c.Error(fmt.Errorf("unable to open database %s %s", id, err))
+			return
+		}
+
+		gtfdbs = append(gtfdbs, gtfdb)
+	}
+
+	// locations are lifted once so the sources must agree
+	err = genome.CheckSameAssembly(gtfdbs)
+
+	if err != nil {
+		web.BadReqResp(c, err)
+		return
+	}
+
+	useOfficialGenes := web.ParseBoolParam(c, "use_official", true)
+
+	closestN := min(web.ParseNumParam(c, "closest", DefaultClosestN), MaxClosestN)
+
+	tssRegion := ParsePromoterRegion(c)
+
+	policy, err := ParseTranscriptPolicy(c)
+
+	if err != nil {
+		web.BadReqResp(c, err)
+		return
+	}
+
+	locations, lifts, err := liftLocations(c, gtfdbs[0].Annotation().Assembly, locations)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	multiDb := genome.NewGtfMultiAnnotateDb(gtfdbs, tssRegion, int8(closestN), useOfficialGenes, policy)
+
+	data := make([]*genome.MultiGeneAnnotation, len(locations))
+
+	for li, location := range locations {
+		if location == nil {
+			data[li] = &genome.MultiGeneAnnotation{Location: lifts[li].Location,
+				Sources:  []*genome.SourceAnnotation{},
+				Liftover: lifts[li]}
+			continue
+		}
+
+		annotation, err := multiDb.Annotate(location, ParseFeature(c))
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		annotation.Liftover = lifts[li]
+
+		data[li] = annotation
+	}
+
+	web.MakeDataResp(c, "", &data)
+}
+
+func MakeGeneTable(
+	data []*genome.GeneAnnotation,
+	ts *dna.PromoterRegion,
+) (string, error) {
+	var buffer bytes.Buffer
+	wtr := csv.NewWriter(&buffer)
+	wtr.Comma = '\t'
+
+	closestN := 0
+
+	for _, annotation := range data {
+		closestN = max(closestN, len(annotation.ClosestGenes))
+	}
+
+	headers := make([]string, 6+5*closestN)
+
+	headers[0] = "Location"
+	headers[1] = "Gene Id"
+	headers[2] = "Gene Symbol"
+	headers[3] = "Gene Description"
+	headers[4] = fmt.Sprintf(
+		"Relative To Gene (prom=-%d/+%dkb)",
+		ts.Upstream()/1000,
+		ts.Downstream()/1000)
+	headers[5] = "TSS Distance"
+	//headers[6] = "Gene Location"
+
+	idx := 6
+	for i := 1; i <= closestN; i++ {
+		headers[idx] = fmt.Sprintf("#%d Closest Id", i)
+		idx++
+		headers[idx] = fmt.Sprintf("#%d Closest Gene Symbols", i)
+		idx++
+		headers[idx] = fmt.Sprintf("#%d Closest Gene Description", i)
+		idx++
+		headers[idx] = fmt.Sprintf(
+			"#%d Relative To Closet Gene (prom=-%d/+%dkb)",
+			i,
+			ts.Upstream()/1000,
+			ts.Downstream()/1000)
+		idx++
+		headers[idx] = fmt.Sprintf("#%d TSS Closest Distance", i)
+		idx++
+		//headers[idx] = fmt.Sprintf("#%d Gene Location", i)
+	}
+
+	err := wtr.Write(headers)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, annotation := range data {
+		n := len(annotation.WithinGenes)
+		geneIds := make([]string, n)
+		geneNames := make([]string, n)
+		descriptions := make([]string, n)
+		promLabels := make([]string, n)
+		tssDists := make([]string, n)
+
+		for i, gene := range annotation.WithinGenes {
 			geneIds[i] = gene.GeneId
 			geneNames[i] = gene.Symbol
+			descriptions[i] = gene.Description
 			promLabels[i] = gene.Label
 			tssDists[i] = strconv.Itoa(gene.TssDist)
 
@@ -503,17 +1426,24 @@ func MakeGeneTable(
 		row := []string{annotation.Location.String(),
 			strings.Join(geneIds, genome.FeatureSeparator),
 			strings.Join(geneNames, genome.FeatureSeparator),
+			strings.Join(descriptions, genome.FeatureSeparator),
 			strings.Join(promLabels, genome.FeatureSeparator),
 			strings.Join(tssDists, genome.FeatureSeparator)}
 
 		for _, closestGene := range annotation.ClosestGenes {
 			row = append(row, closestGene.GeneId)
 			row = append(row, genome.GeneWithStrandLabel(closestGene.Symbol, closestGene.Location.Strand()))
+			row = append(row, closestGene.Description)
 			row = append(row, closestGene.Label)
 			row = append(row, strconv.Itoa(closestGene.TssDist))
 			//row = append(row, closestGene.Location.String())
 		}
 
+		// pad locations with fewer closest genes so the table is square
+		for len(row) < len(headers) {
+			row = append(row, "")
+		}
+
 		err := wtr.Write(row)
 
 		if err != nil {
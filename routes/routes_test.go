@@ -0,0 +1,824 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genomedb"
+	"github.com/antonybholmes/go-genome/genometest"
+	"github.com/antonybholmes/go-genome/routes"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	// the parts of a genomic feature the tests look at
+	feature struct {
+		GeneId      string
+		Symbol      string
+		Transcript  string
+		Biotype     string
+		Label       string
+		TssDist     int
+		IsCanonical bool
+		Tags        []string
+		// set when a search matched an alias
+		MatchedAlias   string
+		MatchedXref    string
+		Xrefs          map[string][]string
+		Description    string
+		Version        string
+		MatchedVersion string
+		Children       []*feature
+	}
+
+	liftover struct {
+		Status string
+	}
+
+	searchResults struct {
+		Features []*feature
+		Liftover *liftover
+	}
+
+	searchPage struct {
+		Total    int
+		Next     string
+		Features []*feature
+	}
+
+	resolvedId struct {
+		Query     string
+		Status    string
+		MatchedBy string
+		Features  []*feature
+	}
+)
+
+var router *gin.Engine
+
+// the genome cache is a singleton so the fixture is built once for
+// all the tests
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	dir, err := os.MkdirTemp("", "genometest")
+
+	if err != nil {
+		panic(err)
+	}
+
+	fixture, err := genometest.Build(dir)
+
+	if err != nil {
+		panic(err)
+	}
+
+	genomedb.InitCache(fixture.Catalog)
+
+	router = gin.New()
+	router.GET("/gtfs", routes.GtfsRoute)
+	router.POST("/overlap/:id", routes.OverlappingGenesRoute)
+	router.GET("/search/:id", routes.SearchForGenesRoute)
+	router.GET("/search/:id/page", routes.SearchPageRoute)
+	router.GET("/autocomplete/:id", routes.AutocompleteRoute)
+	router.GET("/biotypes/:id", routes.BiotypesRoute)
+	router.POST("/resolve/:id", routes.ResolveIdsRoute)
+	router.GET("/orthologs/:id", routes.OrthologsRoute)
+	router.GET("/assembly/:assembly/search", routes.SearchForGenesByAssemblyRoute)
+	router.POST("/within/:assembly", routes.WithinGenesRoute)
+	router.POST("/closest/:assembly", routes.ClosestGeneRoute)
+	router.GET("/tss/:id", routes.TssRoute)
+	router.POST("/tss/:id", routes.TssRoute)
+	router.GET("/sequences/:id", routes.TranscriptSequencesRoute)
+	router.GET("/protein/:id", routes.TranscriptProteinRoute)
+	router.GET("/diff/:old/:new", routes.AnnotationDiffRoute)
+	router.POST("/annotate/:id", routes.AnnotateRoute)
+	router.POST("/multiannotate", routes.MultiAnnotateRoute)
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+
+	os.Exit(code)
+}
+
+// make a request to the test router, posting the locations as
+// JSON if there are any
+func request(t *testing.T, method string, url string, locations ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+
+	if method == http.MethodPost {
+		err := json.NewEncoder(&body).Encode(map[string][]string{"locations": locations})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, url, &body)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+// request and decode the data of a successful JSON response
+func requestData[T any](t *testing.T, method string, url string, locations ...string) T {
+	t.Helper()
+
+	w := request(t, method, url, locations...)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s: status %d %s", method, url, w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data T
+	}
+
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if err != nil {
+		t.Fatalf("%s %s: %v in %q", method, url, err, w.Body.String())
+	}
+
+	return resp.Data
+}
+
+func readTsv(t *testing.T, w *httptest.ResponseRecorder) [][]string {
+	t.Helper()
+
+	rdr := csv.NewReader(w.Body)
+	rdr.Comma = '\t'
+	rdr.FieldsPerRecord = -1
+
+	rows, err := rdr.ReadAll()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rows
+}
+
+func symbols(features []*feature) []string {
+	ret := make([]string, 0, len(features))
+
+	for _, feature := range features {
+		ret = append(ret, feature.Symbol)
+	}
+
+	return ret
+}
+
+func TestGtfsRoute(t *testing.T) {
+	gtfs := requestData[[]*genome.Annotation](t, http.MethodGet, "/gtfs")
+
+	ids := make([]string, 0, len(gtfs))
+
+	for _, gtf := range gtfs {
+		ids = append(ids, gtf.PublicId)
+	}
+
+	slices.Sort(ids)
+
+	if !slices.Equal(ids, []string{genometest.OldGtfId, genometest.GtfId, genometest.MouseGtfId}) {
+		t.Errorf("gtfs = %v", ids)
+	}
+}
+
+func TestOverlappingGenesRoute(t *testing.T) {
+	data := requestData[[]*searchResults](t, http.MethodPost,
+		"/overlap/"+genometest.GtfId+"?feature=gene",
+		"chr1:1-12000",
+		"chr2:1-10000")
+
+	if len(data) != 2 {
+		t.Fatalf("got %d results, want 2", len(data))
+	}
+
+	if got := symbols(data[0].Features); !slices.Equal(got, []string{"GENEA", "GENEB"}) {
+		t.Errorf("chr1 genes = %v", got)
+	}
+
+	if got := symbols(data[1].Features); !slices.Equal(got, []string{"GENEE"}) {
+		t.Errorf("chr2 genes = %v", got)
+	}
+
+	data = requestData[[]*searchResults](t, http.MethodPost,
+		"/overlap/"+genometest.GtfId+"?feature=gene&descriptions=true",
+		"chr2:1-10000")
+
+	if len(data[0].Features) != 1 || data[0].Features[0].Description != "gene epsilon" {
+		t.Errorf("chr2 descriptions = %+v", data[0].Features)
+	}
+
+	data = requestData[[]*searchResults](t, http.MethodPost,
+		"/overlap/"+genometest.GtfId+"?feature=gene,transcript&policy=mane",
+		"chr1:1-12000")
+
+	for _, gene := range data[0].Features {
+		if len(gene.Children) != 1 || !slices.Contains(gene.Children[0].Tags, "MANE_Select") {
+			t.Errorf("%s: want the MANE transcript, got %d transcripts", gene.Symbol, len(gene.Children))
+		}
+	}
+
+	data = requestData[[]*searchResults](t, http.MethodPost,
+		"/overlap/"+genometest.GtfId+"?feature=gene,transcript&exclude_transcript_biotype=protein_coding",
+		"chr1:1-12000")
+
+	for _, gene := range data[0].Features {
+		for _, transcript := range gene.Children {
+			if transcript.Biotype == "protein_coding" {
+				t.Errorf("%s: protein coding transcript was not excluded", transcript.Transcript)
+			}
+		}
+	}
+
+	data = requestData[[]*searchResults](t, http.MethodPost,
+		"/overlap/"+genometest.GtfId+"?feature=gene&biotype=coding,lncrna&exclude_biotype=protein_coding",
+		"chr1:1-40000")
+
+	if got := symbols(data[0].Features); !slices.Equal(got, []string{"ENSG00000000003"}) {
+		t.Errorf("gene biotypes = %v", got)
+	}
+
+	data = requestData[[]*searchResults](t, http.MethodPost, "/overlap/"+genometest.GtfId+"?feature=gene&type=protein", "chr1:1-40000")
+
+	if got := symbols(data[0].Features); !slices.Equal(got, []string{"GENEA", "GENEB", "GENED"}) {
+		t.Errorf("type=protein = %v", got)
+	}
+
+	w := request(t, http.MethodPost, "/overlap/"+genometest.GtfId)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("no locations: status %d", w.Code)
+	}
+}
+
+func TestOverlappingGenesLiftoverRoute(t *testing.T) {
+	// hg19 coordinates of the first exon of GENEA and a region that
+	// has no hg38 equivalent
+	data := requestData[[]*searchResults](t, http.MethodPost,
+		"/overlap/"+genometest.GtfId+"?feature=gene&from="+genometest.LiftFromAssembly,
+		"chr1:2050-2060",
+		"chr1:1-500")
+
+	if len(data) != 2 {
+		t.Fatalf("got %d results, want 2", len(data))
+	}
+
+	if data[0].Liftover == nil || data[0].Liftover.Status != genome.LiftMapped {
+		t.Errorf("lift = %+v", data[0].Liftover)
+	}
+
+	if got := symbols(data[0].Features); !slices.Equal(got, []string{"GENEA"}) {
+		t.Errorf("lifted genes = %v", got)
+	}
+
+	if data[1].Liftover == nil || data[1].Liftover.Status != genome.LiftFailed || len(data[1].Features) != 0 {
+		t.Errorf("unliftable location = %+v", data[1])
+	}
+
+	// no liftover is reported when none was asked for
+	data = requestData[[]*searchResults](t, http.MethodPost, "/overlap/"+genometest.GtfId, "chr1:1050-1060")
+
+	if data[0].Liftover != nil {
+		t.Errorf("unexpected liftover %+v", data[0].Liftover)
+	}
+}
+
+func TestSearchRoutes(t *testing.T) {
+	genes := requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.GtfId+"?q=gene&feature=gene")
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENEA", "GENEB", "GENED", "GENEE"}) {
+		t.Errorf("genes = %v", got)
+	}
+
+	genes = requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.GtfId+"?q=gene&feature=gene&n=2")
+
+	if len(genes) != 2 {
+		t.Errorf("got %d genes, want 2", len(genes))
+	}
+
+	// the legacy annotation calls GENEB OLDB
+	genes = requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.OldGtfId+"?q=oldb&feature=gene")
+
+	if got := symbols(genes); !slices.Equal(got, []string{"OLDB"}) {
+		t.Errorf("old genes = %v", got)
+	}
+
+	// an assembly resolves to its latest annotation
+	genes = requestData[[]*feature](t, http.MethodGet, "/assembly/"+genometest.Assembly+"/search?q=oldb&feature=gene")
+
+	if len(genes) != 0 {
+		t.Errorf("latest annotation has %v", symbols(genes))
+	}
+
+	genes = requestData[[]*feature](t, http.MethodGet, "/assembly/GRCh38/search?q=ENSG00000000004&feature=gene")
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENED"}) {
+		t.Errorf("genes by id = %v", got)
+	}
+
+	genes = requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.GtfId+"?q=genea&feature=transcript&policy=mane")
+
+	if len(genes) != 1 || len(genes[0].Children) != 1 || genes[0].Children[0].Transcript != "ENST00000000001" {
+		t.Errorf("mane transcripts of %v", symbols(genes))
+	}
+
+	genes = requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.GtfId+"?q=GENAE&feature=gene&mode=fuzzy")
+
+	if got := symbols(genes); !slices.Equal(got, []string{"GENEA", "GENEE"}) {
+		t.Errorf("fuzzy genes = %v", got)
+	}
+
+	genes = requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.GtfId+"?q=alpha&feature=gene")
+
+	if len(genes) != 1 || genes[0].Symbol != "GENEA" || genes[0].MatchedAlias != "ALPHA" {
+		t.Errorf("alias genes = %v", symbols(genes))
+	}
+
+	genes = requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.GtfId+"?q=1001&feature=gene&xrefs=true")
+
+	if len(genes) != 1 || genes[0].MatchedXref != "entrez:1001" || !slices.Equal(genes[0].Xrefs["refseq"], []string{"NM_000001", "NM_000011"}) {
+		t.Errorf("xref genes = %+v", genes)
+	}
+
+	genes = requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.GtfId+"?q=genea&feature=gene")
+
+	if len(genes) != 1 || genes[0].Xrefs != nil || genes[0].Description != "" {
+		t.Errorf("details without asking = %+v", genes)
+	}
+
+	genes = requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.GtfId+"?q=genea&feature=gene&descriptions=true")
+
+	if len(genes) != 1 || genes[0].Description != "gene alpha, test transcription factor" {
+		t.Errorf("described genes = %+v", genes)
+	}
+
+	genes = requestData[[]*feature](t, http.MethodGet, "/search/"+genometest.GtfId+"?q=ENST00000000002.1&feature=transcript&versions=true")
+
+	if len(genes) != 1 || genes[0].Version != "1" || genes[0].Children[0].Version != "2" || genes[0].Children[0].MatchedVersion != "1" {
+		t.Errorf("versioned genes = %+v", genes)
+	}
+
+	w := request(t, http.MethodGet, "/search/"+genometest.GtfId)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("empty search: status %d", w.Code)
+	}
+}
+
+func TestSearchPageRoute(t *testing.T) {
+	page := requestData[searchPage](t, http.MethodGet, "/search/"+genometest.GtfId+"/page?q=gene&feature=gene&n=3")
+
+	if got := symbols(page.Features); page.Total != 4 || !slices.Equal(got, []string{"GENEA", "GENEB", "GENED"}) || page.Next == "" {
+		t.Errorf("first page = %d %v", page.Total, got)
+	}
+
+	page = requestData[searchPage](t, http.MethodGet, "/search/"+genometest.GtfId+"/page?q=gene&feature=gene&n=3&cursor="+page.Next)
+
+	if got := symbols(page.Features); !slices.Equal(got, []string{"GENEE"}) || page.Next != "" {
+		t.Errorf("last page = %v", got)
+	}
+
+	page = requestData[searchPage](t, http.MethodGet, "/search/"+genometest.GtfId+"/page?q=delta&feature=transcript&xrefs=true")
+
+	if got := symbols(page.Features); !slices.Equal(got, []string{"GENED", "GENEE"}) || page.Features[0].Xrefs == nil {
+		t.Errorf("alias page = %+v", page.Features)
+	}
+
+	w := request(t, http.MethodGet, "/search/"+genometest.GtfId+"/page?q=gene&cursor=nope")
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid cursor: status %d", w.Code)
+	}
+}
+
+func TestAutocompleteRoute(t *testing.T) {
+	suggestions := requestData[[]*genome.Suggestion](t, http.MethodGet, "/autocomplete/"+genometest.GtfId+"?q=del")
+
+	if len(suggestions) != 2 || suggestions[0].Symbol != "GENED" || suggestions[0].Name != "DELTA" ||
+		suggestions[0].MatchedBy != genome.AliasMatch || suggestions[0].Biotype != "protein_coding" {
+		t.Errorf("del = %+v", suggestions)
+	}
+
+	suggestions = requestData[[]*genome.Suggestion](t, http.MethodGet, "/autocomplete/"+genometest.GtfId+"?q=g&n=1")
+
+	if len(suggestions) != 1 || suggestions[0].GeneId != "ENSG00000000001" {
+		t.Errorf("g = %+v", suggestions)
+	}
+
+	w := request(t, http.MethodGet, "/autocomplete/"+genometest.GtfId)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("empty q: status %d", w.Code)
+	}
+}
+
+func TestBiotypesRoute(t *testing.T) {
+	biotypes := requestData[[]*genome.BiotypeCount](t, http.MethodGet, "/biotypes/"+genometest.GtfId)
+
+	i := slices.IndexFunc(biotypes, func(biotype *genome.BiotypeCount) bool {
+		return biotype.Name == "protein_coding"
+	})
+
+	if len(biotypes) != 4 || i == -1 || biotypes[i].Genes != 4 || biotypes[i].Group != genome.CodingBiotypes {
+		t.Errorf("biotypes = %+v", biotypes)
+	}
+}
+
+// post ids to the resolve route
+func postIds(t *testing.T, ids []string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+
+	err := json.NewEncoder(&body).Encode(routes.ResolveIdsReq{Ids: ids})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/resolve/"+genometest.GtfId, &body)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestResolveIdsRoute(t *testing.T) {
+	w := postIds(t, []string{"ENST00000000003", "delta", "GENEA", "missing"})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data []*resolvedId
+	}
+
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := resp.Data
+
+	if len(data) != 4 {
+		t.Fatalf("got %d records, want 4", len(data))
+	}
+
+	if r := data[0]; r.Status != "matched" || r.MatchedBy != "transcriptId" || len(r.Features) != 1 ||
+		r.Features[0].Symbol != "GENEB" || len(r.Features[0].Children) != 1 {
+		t.Errorf("transcript id = %+v", r)
+	}
+
+	if r := data[1]; r.Status != "ambiguous" || !slices.Equal(symbols(r.Features), []string{"GENED", "GENEE"}) {
+		t.Errorf("alias = %+v", r)
+	}
+
+	if r := data[2]; r.Query != "GENEA" || r.Status != "matched" || r.MatchedBy != "symbol" {
+		t.Errorf("symbol = %+v", r)
+	}
+
+	if r := data[3]; r.Status != "unmatched" || len(r.Features) != 0 {
+		t.Errorf("missing = %+v", r)
+	}
+
+	w = postIds(t, nil)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("no ids: status %d", w.Code)
+	}
+}
+
+func TestOrthologsRoute(t *testing.T) {
+	type ortholog struct {
+		GeneId  string
+		Feature *feature
+	}
+
+	data := requestData[[]*struct {
+		Gene      *feature
+		Orthologs []*ortholog
+	}](t, http.MethodGet, "/orthologs/"+genometest.Assembly+"?gene=GENED&target="+genometest.MouseAssembly)
+
+	if len(data) != 1 || data[0].Gene.Symbol != "GENED" || len(data[0].Orthologs) != 2 {
+		t.Fatalf("orthologs = %+v", data)
+	}
+
+	for _, o := range data[0].Orthologs {
+		if o.Feature == nil || o.Feature.GeneId != o.GeneId {
+			t.Errorf("ortholog %s = %+v", o.GeneId, o.Feature)
+		}
+	}
+
+	// and back again
+	data = requestData[[]*struct {
+		Gene      *feature
+		Orthologs []*ortholog
+	}](t, http.MethodGet, "/orthologs/"+genometest.MouseGtfId+"?gene=Gened2&target="+genometest.Assembly)
+
+	if len(data) != 1 || len(data[0].Orthologs) != 1 || data[0].Orthologs[0].Feature.Symbol != "GENED" {
+		t.Errorf("human orthologs = %+v", data)
+	}
+
+	w := request(t, http.MethodGet, "/orthologs/"+genometest.Assembly+"?gene=GENED")
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("no target: status %d", w.Code)
+	}
+}
+
+func TestWithinGenesRoute(t *testing.T) {
+	data := requestData[[]*searchResults](t, http.MethodPost,
+		"/within/"+genometest.Assembly+"?feature=gene",
+		"chr1:1050-1060",
+		"chr1:25000-25010")
+
+	if got := symbols(data[0].Features); !slices.Equal(got, []string{"GENEA"}) {
+		t.Errorf("within = %v", got)
+	}
+
+	if len(data[1].Features) != 0 {
+		t.Errorf("intergenic location within %v", symbols(data[1].Features))
+	}
+}
+
+func TestClosestGeneRoute(t *testing.T) {
+	data := requestData[[]*searchResults](t, http.MethodPost,
+		"/closest/"+genometest.Assembly+"?closest=1",
+		"chr1:6000-6001")
+
+	if got := symbols(data[0].Features); !slices.Equal(got, []string{"GENEB"}) {
+		t.Errorf("closest = %v", got)
+	}
+
+	// the number of closest genes is capped but asking for more than
+	// exist is not an error
+	data = requestData[[]*searchResults](t, http.MethodPost,
+		"/closest/"+genometest.Assembly+"?closest=1000",
+		"chr1:6000-6001")
+
+	if n := len(data[0].Features); n != 3 {
+		t.Errorf("got %d closest genes, want the 3 official genes on chr1", n)
+	}
+
+	data = requestData[[]*searchResults](t, http.MethodPost,
+		"/closest/"+genometest.Assembly+"?closest=2&use_official=false&from="+genometest.LiftFromAssembly,
+		"chr1:21500-21501")
+
+	if got := symbols(data[0].Features); len(got) != 2 || got[0] != "ENSG00000000003" {
+		t.Errorf("closest lifted = %v", got)
+	}
+}
+
+func TestTssRoute(t *testing.T) {
+	w := request(t, http.MethodGet, "/tss/"+genometest.GtfId+"?feature=gene&output=text")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+
+	rows := readTsv(t, w)
+
+	if len(rows) != len(genometest.Genes()) {
+		t.Fatalf("got %d bed rows, want %d", len(rows), len(genometest.Genes()))
+	}
+
+	for _, row := range rows {
+		// single base tss
+		if len(row) != 6 || row[1] == row[2] {
+			t.Errorf("bad bed row %v", row)
+		}
+	}
+
+	features := requestData[[]*feature](t, http.MethodPost,
+		"/tss/"+genometest.GtfId+"?feature=transcript&mode=promoter",
+		"chr2:1-10000")
+
+	if len(features) != 1 || features[0].Transcript != "ENST00000000007" {
+		t.Errorf("chr2 tss = %+v", features)
+	}
+}
+
+func TestTranscriptSequencesRoute(t *testing.T) {
+	gene := genometest.Genes()[1]
+	transcript := gene.Transcripts[0]
+
+	w := request(t, http.MethodGet,
+		"/sequences/"+genometest.GtfId+"?seq=cds&output=text&transcripts="+transcript.Id)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+
+	if !strings.HasPrefix(lines[0], ">") || !strings.Contains(lines[0], transcript.Id) {
+		t.Fatalf("bad fasta header %q", lines[0])
+	}
+
+	seq := strings.Join(lines[1:], "")
+	coding := transcript.CodingSequence(gene.Strand)
+
+	// the cds may or may not include the stop codon
+	if !strings.HasPrefix(coding, seq) || len(seq) < len(coding)-3 {
+		t.Errorf("cds = %s, want %s", seq, coding)
+	}
+
+	w = request(t, http.MethodGet, "/sequences/"+genometest.GtfId)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("no transcripts: status %d", w.Code)
+	}
+}
+
+func TestTranscriptProteinRoute(t *testing.T) {
+	gene := genometest.Genes()[0]
+	transcript := gene.Transcripts[0]
+
+	proteins := requestData[[]*genome.TranscriptProtein](t, http.MethodGet,
+		"/protein/"+genometest.GtfId+"?transcripts="+transcript.Id)
+
+	if len(proteins) != 1 {
+		t.Fatalf("got %d proteins, want 1", len(proteins))
+	}
+
+	protein := proteins[0]
+
+	if !protein.HasStart || !protein.HasStop || len(protein.Warnings) != 0 {
+		t.Errorf("start %v stop %v warnings %v", protein.HasStart, protein.HasStop, protein.Warnings)
+	}
+
+	// the stop codon is not translated
+	if n := len(transcript.CodingSequence(gene.Strand))/3 - 1; len(protein.Protein) != n {
+		t.Errorf("protein has %d residues, want %d", len(protein.Protein), n)
+	}
+
+	w := request(t, http.MethodGet, "/protein/"+genometest.GtfId+"?transcripts=%20,")
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("no transcripts: status %d", w.Code)
+	}
+}
+
+func TestAnnotationDiffRoute(t *testing.T) {
+	diff := requestData[*struct {
+		Genes []*struct {
+			GeneId  string
+			Changes []string
+		}
+	}](t, http.MethodGet, "/diff/"+genometest.OldGtfId+"/"+genometest.GtfId)
+
+	changed := make([]string, 0, len(diff.Genes))
+
+	for _, gene := range diff.Genes {
+		changed = append(changed, gene.GeneId)
+
+		if len(gene.Changes) == 0 {
+			t.Errorf("%s: no changes listed", gene.GeneId)
+		}
+	}
+
+	slices.Sort(changed)
+
+	// GENEA changes canonical transcript, GENEB is renamed, GENED is
+	// added and GENEZ removed
+	want := []string{"ENSG00000000001", "ENSG00000000002", "ENSG00000000004", "ENSG00000000009"}
+
+	if !slices.Equal(changed, want) {
+		t.Errorf("changed genes = %v, want %v", changed, want)
+	}
+
+	w := request(t, http.MethodGet, "/diff/"+genometest.OldGtfId+"/"+genometest.GtfId+"?output=text")
+
+	if rows := readTsv(t, w); len(rows) != len(want)+1 {
+		t.Errorf("got %d tsv rows, want %d", len(rows), len(want)+1)
+	}
+}
+
+func TestAnnotateRoute(t *testing.T) {
+	data := requestData[[]*struct {
+		WithinGenes  []*feature
+		ClosestGenes []*feature
+		Liftover     *liftover
+	}](t, http.MethodPost,
+		"/annotate/"+genometest.GtfId+"?closest=2&from="+genometest.LiftFromAssembly,
+		"chr1:2050-2060")
+
+	annotation := data[0]
+
+	if got := symbols(annotation.WithinGenes); !slices.Equal(got, []string{"GENEA"}) {
+		t.Errorf("within = %v", got)
+	}
+
+	if len(annotation.ClosestGenes) != 2 || annotation.ClosestGenes[0].Symbol != "GENEA" {
+		t.Errorf("closest = %v", symbols(annotation.ClosestGenes))
+	}
+
+	if annotation.WithinGenes[0].Description != "" {
+		t.Errorf("description without asking = %s", annotation.WithinGenes[0].Description)
+	}
+
+	data = requestData[[]*struct {
+		WithinGenes  []*feature
+		ClosestGenes []*feature
+		Liftover     *liftover
+	}](t, http.MethodPost, "/annotate/"+genometest.GtfId+"?closest=2&descriptions=true", "chr1:1050-1060")
+
+	if got := data[0].ClosestGenes; len(got) != 2 || got[0].Description != "gene alpha, test transcription factor" || got[1].Description != "gene beta" {
+		t.Errorf("closest descriptions = %+v", got)
+	}
+
+	if annotation.Liftover == nil || annotation.Liftover.Status != genome.LiftMapped {
+		t.Errorf("lift = %+v", annotation.Liftover)
+	}
+
+	w := request(t, http.MethodPost, "/annotate/"+genometest.GtfId+"?closest=2&output=text", "chr1:1050-1060", "chr2:1-10")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+
+	rows := readTsv(t, w)
+
+	if len(rows) != 3 {
+		t.Fatalf("got %d tsv rows, want 3", len(rows))
+	}
+
+	// 6 columns for the location plus 5 for each closest gene
+	if n := len(rows[0]); n != 6+5*2 {
+		t.Errorf("got %d headers, want %d", n, 6+5*2)
+	}
+
+	if slices.Contains(rows[0], "") {
+		t.Errorf("empty header in %v", rows[0])
+	}
+
+	if rows[1][0] != "chr1:1050-1060" || rows[1][2] != "GENEA" || rows[1][3] != "gene alpha, test transcription factor" ||
+		rows[1][6] != "ENSG00000000001" || rows[1][8] != "gene alpha, test transcription factor" {
+		t.Errorf("bad row %v", rows[1])
+	}
+
+	if len(rows[2]) != len(rows[0]) || rows[2][2] != "" {
+		t.Errorf("bad row %v", rows[2])
+	}
+}
+
+func TestMultiAnnotateRoute(t *testing.T) {
+	data := requestData[[]*struct {
+		Sources   []*struct{}
+		Consensus *genome.ConsensusGene
+	}](t, http.MethodPost,
+		"/multiannotate?ids="+genometest.OldGtfId+","+genometest.GtfId,
+		"chr1:1050-1060")
+
+	if len(data) != 1 || len(data[0].Sources) != 2 {
+		t.Fatalf("want 2 sources, got %+v", data)
+	}
+
+	consensus := data[0].Consensus
+
+	if consensus == nil || consensus.Symbol != "GENEA" || !consensus.Unanimous || consensus.Votes != 2 {
+		t.Errorf("consensus = %+v", consensus)
+	}
+
+	w := request(t, http.MethodPost, "/multiannotate", "chr1:1050-1060")
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("no ids: status %d", w.Code)
+	}
+
+	w = request(t, http.MethodPost, "/multiannotate?ids="+genometest.GtfId+"&policy=nonsense", "chr1:1050-1060")
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad policy: status %d", w.Code)
+	}
+
+	// locations can only be lifted to one assembly
+	w = request(t, http.MethodPost, "/multiannotate?ids="+genometest.GtfId+","+genometest.MouseGtfId, "chr1:1050-1060")
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), genome.ErrMixedAssemblies.Error()) {
+		t.Errorf("mixed assemblies: status %d %s", w.Code, w.Body.String())
+	}
+}
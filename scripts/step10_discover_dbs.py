@@ -7,6 +7,7 @@ Encode read counts per base in 2 bytes
 
 import argparse
 import os
+import re
 import sqlite3
 
 import uuid_utils as uuid
@@ -112,6 +113,7 @@ cursor.execute(
 assembly_map = {
     "hg19": 1,
     "grch37": 1,
+    "hg38": 2,
     "grch38": 2,
     "mm10": 3,
     "grcm38": 3,
@@ -135,6 +137,15 @@ cursor.execute(
 cursor.execute(
     f"INSERT INTO annotation_types (id, public_id, name) VALUES (1, '{uuid.uuid7()}', 'GTF');"
 )
+cursor.execute(
+    f"INSERT INTO annotation_types (id, public_id, name) VALUES (2, '{uuid.uuid7()}', '2bit');"
+)
+cursor.execute(
+    f"INSERT INTO annotation_types (id, public_id, name) VALUES (3, '{uuid.uuid7()}', 'FASTA');"
+)
+cursor.execute(
+    f"INSERT INTO annotation_types (id, public_id, name) VALUES (4, '{uuid.uuid7()}', 'chain');"
+)
 
 cursor.execute(f""" CREATE TABLE annotations (
 	id INTEGER PRIMARY KEY,
@@ -152,6 +163,9 @@ cursor.execute(f""" CREATE TABLE annotations (
 
 type_map = {
     "gtf": 1,
+    "2bit": 2,
+    "fasta": 3,
+    "chain": 4,
 }
 
 for root, dirs, files in os.walk(dir):
@@ -198,6 +212,60 @@ for root, dirs, files in os.walk(dir):
 
             conn2.close()
 
+        # UCSC liftover chains, e.g. hg19ToHg38.over.chain.gz, are
+        # registered against the assembly they map to. The assembly
+        # they map from is found from the name when they are used
+        match = re.match(r"^([A-Za-z0-9]+)To([A-Za-z0-9]+)\.over\.chain(\.gz)?$", filename)
+
+        if match:
+            assembly = match.group(2).lower()
+
+            if assembly not in assembly_map or match.group(1).lower() not in assembly_map:
+                print(f"skipping {filename}, unknown assembly")
+                continue
+
+            print(filename)
+
+            cursor.execute(
+                f"""INSERT INTO annotations (public_id, assembly_id, annotation_type_id, name, url) VALUES (
+                '{uuid.uuid7()}',
+                '{assembly_map[assembly]}',
+                '{type_map["chain"]}',
+                '{filename}',
+                '{os.path.relpath(os.path.join(root, filename), dir)}');"""
+            )
+
+            continue
+
+        # reference sequences for transcript sequence extraction. These
+        # have no info table so the assembly comes from the file name,
+        # e.g. hg38.2bit or GRCh38.primary_assembly.genome.fa
+        if filename.endswith(".2bit"):
+            seq_type = "2bit"
+        elif filename.endswith((".fa", ".fasta")) and os.path.exists(
+            os.path.join(root, filename + ".fai")
+        ):
+            seq_type = "fasta"
+        else:
+            continue
+
+        assembly = filename.split(".")[0].lower()
+
+        if assembly not in assembly_map:
+            print(f"skipping {filename}, unknown assembly")
+            continue
+
+        print(filename)
+
+        cursor.execute(
+            f"""INSERT INTO annotations (public_id, assembly_id, annotation_type_id, name, url) VALUES (
+            '{uuid.uuid7()}',
+            '{assembly_map[assembly]}',
+            '{type_map[seq_type]}',
+            '{filename}',
+            '{os.path.relpath(os.path.join(root, filename), dir)}');"""
+        )
+
 
 cursor.execute(f""" CREATE INDEX idx_annotations_name ON annotations (LOWER(name));
 """)
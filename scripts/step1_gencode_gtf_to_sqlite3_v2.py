@@ -78,10 +78,140 @@ TRANSCRIPTS_SQL = """CREATE TABLE transcripts (
     end INT NOT NULL DEFAULT 1,
     is_canonical INT NOT NULL DEFAULT 0,
     is_longest INT NOT NULL DEFAULT 0,
+    tsl INT,
     FOREIGN KEY (gene_id) REFERENCES genes(id),
     FOREIGN KEY (biotype_id) REFERENCES biotypes(id)
 );"""
 
+# GTF tags such as MANE_Select, Ensembl_canonical, basic, CCDS
+# and appris_principal_1
+TAGS_SQL = """CREATE TABLE tags (
+    id INTEGER PRIMARY KEY,
+    public_id TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL UNIQUE);"""
+
+TRANSCRIPT_TAGS_SQL = """CREATE TABLE transcript_tags (
+    transcript_id INT NOT NULL,
+    tag_id INT NOT NULL,
+    PRIMARY KEY (transcript_id, tag_id),
+    FOREIGN KEY (transcript_id) REFERENCES transcripts(id),
+    FOREIGN KEY (tag_id) REFERENCES tags(id)
+);"""
+
+# alias and previous symbols of genes from HGNC or MGI, e.g.
+# MLL for KMT2A, so that genes can be found by their old names
+GENE_ALIASES_SQL = """CREATE TABLE gene_aliases (
+    id INTEGER PRIMARY KEY,
+    gene_id INT NOT NULL,
+    alias TEXT NOT NULL,
+    UNIQUE(gene_id, alias),
+    FOREIGN KEY (gene_id) REFERENCES genes(id)
+);"""
+
+# columns of the HGNC complete set and the MGI MRK_List2.rpt with the
+# official id and the pipe separated aliases of each gene. Give the
+# path of either as "aliases" in files.json to load them
+ALIAS_COLUMNS = {
+    "Human": ("hgnc_id", ["alias_symbol", "prev_symbol"]),
+    "Mouse": ("MGI Accession ID", ["Marker Synonyms (pipe-separated)"]),
+}
+
+# Entrez, UniProt and RefSeq ids of genes, e.g. 7157, P04637 and
+# NM_000546 for TP53, keyed by the name of the database
+GENE_XREFS_SQL = """CREATE TABLE gene_xrefs (
+    id INTEGER PRIMARY KEY,
+    gene_id INT NOT NULL,
+    db TEXT NOT NULL,
+    xref TEXT NOT NULL,
+    UNIQUE(gene_id, db, xref),
+    FOREIGN KEY (gene_id) REFERENCES genes(id)
+);"""
+
+# columns of the HGNC complete set and the MGI MRK_Sequence.rpt with
+# the official id and the pipe separated xrefs of each database. Give
+# the path of either as "xrefs" in files.json to load them
+XREF_COLUMNS = {
+    "Human": (
+        "hgnc_id",
+        {"entrez": "entrez_id", "uniprot": "uniprot_ids", "refseq": "refseq_accession"},
+    ),
+    "Mouse": (
+        "MGI Marker Accession ID",
+        {"uniprot": "UniProt IDs", "refseq": "RefSeq transcript IDs"},
+    ),
+}
+
+# orthologs of genes in other genomes, e.g. mouse genes of a human
+# annotation, by their unversioned Ensembl id in that genome
+GENE_ORTHOLOGS_SQL = """CREATE TABLE gene_orthologs (
+    id INTEGER PRIMARY KEY,
+    gene_id INT NOT NULL,
+    genome TEXT NOT NULL,
+    ortholog_gene_id TEXT NOT NULL,
+    ortholog_symbol TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL DEFAULT '',
+    UNIQUE(gene_id, genome, ortholog_gene_id),
+    FOREIGN KEY (gene_id) REFERENCES genes(id)
+);"""
+
+# full names of genes, e.g. "MYC proto-oncogene, bHLH transcription
+# factor" for MYC, from the description attribute of the GTF, which
+# RefSeq GTFs have, or from HGNC or MGI
+GENE_DESCRIPTIONS_SQL = """CREATE TABLE gene_descriptions (
+    gene_id INTEGER PRIMARY KEY,
+    description TEXT NOT NULL,
+    FOREIGN KEY (gene_id) REFERENCES genes(id)
+);"""
+
+# columns of the HGNC complete set and the MGI MRK_List2.rpt with the
+# official id and the name of each gene. Give the path of either as
+# "descriptions" in files.json to load them, which replaces names from
+# the GTF
+DESCRIPTION_COLUMNS = {
+    "Human": ("hgnc_id", "name"),
+    "Mouse": ("MGI Accession ID", "Marker Name"),
+}
+
+# versions of gene, transcript and exon ids, e.g. 21 for
+# ENSG00000136997.21, which are stripped from the ids themselves so
+# that lookups match any version
+ID_VERSIONS_SQL = """CREATE TABLE id_versions (
+    id INTEGER PRIMARY KEY,
+    stable_id TEXT NOT NULL UNIQUE,
+    version TEXT NOT NULL
+);"""
+
+
+def add_version(version_map, id, versioned_id):
+    """record the version of an id, e.g. 5 for ENSG00000223972.5"""
+    matcher = re.search(r"\.(\d+)", versioned_id)
+
+    if matcher and id not in version_map:
+        version_map[id] = matcher.group(1)
+
+
+# columns of the Ensembl ids of genes of this genome, of their orthologs
+# in another and the symbol and source of each ortholog in an HCOP
+# export, e.g. human_mouse_hcop_fifteen_column.txt, or an Ensembl
+# Compara BioMart export. List them as "orthologs" in files.json, e.g.
+# [{"genome": "Mouse", "format": "hcop", "path": "..."}]
+def ortholog_columns(format, genome, other):
+    if format == "hcop":
+        return (
+            f"{genome.lower()}_ensembl_gene",
+            f"{other.lower()}_ensembl_gene",
+            f"{other.lower()}_symbol",
+            "support",
+        )
+
+    return (
+        "Gene stable ID",
+        f"{other} gene stable ID",
+        f"{other} gene name",
+        f"{other} homology type",
+    )
+
+
 # exon ids are stored in a separate table to save space,
 # as they are often repeated across exons, cds and utrs
 # EXONS_IDS_SQL = """CREATE TABLE exon_ids (
@@ -193,6 +323,24 @@ for file_desc in files:
         "CREATE INDEX idx_transcripts_biotype_id ON transcripts(biotype_id);"
     )
 
+    cursor.execute(TAGS_SQL)
+    cursor.execute(TRANSCRIPT_TAGS_SQL)
+    cursor.execute("CREATE INDEX idx_transcript_tags_tag_id ON transcript_tags(tag_id);")
+
+    cursor.execute(GENE_ALIASES_SQL)
+    cursor.execute("CREATE INDEX idx_gene_aliases_alias ON gene_aliases(LOWER(alias));")
+
+    cursor.execute(GENE_XREFS_SQL)
+    cursor.execute("CREATE INDEX idx_gene_xrefs_xref ON gene_xrefs(LOWER(xref));")
+    cursor.execute("CREATE INDEX idx_gene_xrefs_gene_id ON gene_xrefs(gene_id);")
+
+    cursor.execute(GENE_ORTHOLOGS_SQL)
+    cursor.execute("CREATE INDEX idx_gene_orthologs_gene_id ON gene_orthologs(gene_id);")
+
+    cursor.execute(ID_VERSIONS_SQL)
+
+    cursor.execute(GENE_DESCRIPTIONS_SQL)
+
     # cursor.execute(EXONS_IDS_SQL)
     cursor.execute(FEATURE_TYPES_SQL)
     cursor.execute(
@@ -234,6 +382,8 @@ for file_desc in files:
 
     biotypes_map = {"NA": 1}
 
+    tag_map = {}
+
     cursor.execute(
         f"INSERT INTO feature_types (id, public_id, name) VALUES (1, '{uuid.uuid7()}', 'exon');"
     )
@@ -280,6 +430,12 @@ for file_desc in files:
     exon_map = {}
     transcript_map = {}
 
+    # versions of ids, from the first line an id is seen on
+    version_map = {}
+
+    # descriptions of genes from the GTF by gene row id
+    description_map = {}
+
     with gzip.open(
         file_desc["file"],
         "rt",
@@ -309,6 +465,14 @@ for file_desc in files:
             else:
                 is_canonical = 0
 
+            # all of the GTF tags and the transcript support level,
+            # which is NA for some transcripts
+            gtf_tags = re.findall(r'tag "(.+?)";', tokens[8])
+
+            matcher = re.search(r'transcript_support_level "(\d)', tokens[8])
+
+            tsl = int(matcher.group(1)) if matcher else None
+
             # gene
             matcher = re.search(r'gene_id "(.+?)";', tokens[8])
 
@@ -316,6 +480,8 @@ for file_desc in files:
                 # remove version
                 gene_id = re.sub(r"\..+", "", matcher.group(1))
 
+                add_version(version_map, gene_id, matcher.group(1))
+
                 if gene_id not in gene_map:
                     gene_map[gene_id] = len(gene_map) + 1
 
@@ -337,6 +503,11 @@ for file_desc in files:
                 official_gene_id = matcher.group(1)
                 tags.add(f"official_gene_id:{official_gene_id}")
 
+            matcher = re.search(r'description "(.+?)";', tokens[8])
+
+            if matcher and gene_map[gene_id] not in description_map:
+                description_map[gene_map[gene_id]] = matcher.group(1)
+
             # gene_type
             gene_biotype = "NA"
             matcher = re.search(r'gene_type "(.+?)";', tokens[8])
@@ -351,6 +522,8 @@ for file_desc in files:
             if matcher:
                 transcript_id = re.sub(r"\..+", "", matcher.group(1))
 
+                add_version(version_map, transcript_id, matcher.group(1))
+
                 if transcript_id not in transcript_map:
                     transcript_map[transcript_id] = len(transcript_map) + 1
 
@@ -373,6 +546,8 @@ for file_desc in files:
             if matcher:
                 exon_id = re.sub(r"\..+", "", matcher.group(1))
 
+                add_version(version_map, exon_id, matcher.group(1))
+
                 if exon_id not in exon_map:
                     exon_map[exon_id] = len(exon_map) + 1
 
@@ -451,7 +626,7 @@ for file_desc in files:
             elif level == "transcript":
 
                 cursor.execute(
-                    "INSERT INTO transcripts (id, public_id, gene_id, transcript_id, start, end, is_canonical, biotype_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+                    "INSERT INTO transcripts (id, public_id, gene_id, transcript_id, start, end, is_canonical, tsl, biotype_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
                     (
                         transcript_map[transcript_id],
                         str(uuid.uuid7()),
@@ -460,9 +635,31 @@ for file_desc in files:
                         start,
                         end,
                         is_canonical,
+                        tsl,
                         biotypes_map[transcript_biotype],
                     ),
                 )
+
+                for tag in gtf_tags:
+                    if tag not in tag_map:
+                        tag_map[tag] = len(tag_map) + 1
+
+                        cursor.execute(
+                            "INSERT INTO tags (id, public_id, name) VALUES (?, ?, ?)",
+                            (
+                                tag_map[tag],
+                                str(uuid.uuid7()),
+                                tag,
+                            ),
+                        )
+
+                    cursor.execute(
+                        "INSERT INTO transcript_tags (transcript_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+                        (
+                            transcript_map[transcript_id],
+                            tag_map[tag],
+                        ),
+                    )
                 # record = cursor.lastrowid
             else:
 
@@ -491,6 +688,130 @@ for file_desc in files:
 
             record += 1
 
+    # aliases and xrefs are optional since they come from HGNC/MGI
+    # rather than the GTF, and are matched to genes by official id
+    cursor.execute(
+        "SELECT id, official_gene_id, symbol FROM genes WHERE official_gene_id IS NOT NULL"
+    )
+
+    official_map = collections.defaultdict(list)
+
+    for row in cursor.fetchall():
+        official_map[row[1]].append((row[0], row[2]))
+
+    if "aliases" in file_desc:
+        print("Adding aliases...")
+
+        id_col, alias_cols = ALIAS_COLUMNS[file_desc["genome"]]
+
+        df_aliases = pd.read_csv(file_desc["aliases"], sep="\t", header=0, dtype=str, keep_default_na=False)
+
+        aliases = []
+
+        for _, row in df_aliases.iterrows():
+            for id, symbol in official_map.get(row[id_col], []):
+                for col in alias_cols:
+                    for alias in row[col].split("|"):
+                        alias = alias.strip()
+
+                        if alias != "" and alias != symbol:
+                            aliases.append((id, alias))
+
+        cursor.executemany(
+            "INSERT INTO gene_aliases (gene_id, alias) VALUES (?, ?) ON CONFLICT DO NOTHING",
+            aliases,
+        )
+
+        print(len(aliases), "aliases added")
+
+    if "xrefs" in file_desc:
+        print("Adding xrefs...")
+
+        id_col, xref_cols = XREF_COLUMNS[file_desc["genome"]]
+
+        df_xrefs = pd.read_csv(file_desc["xrefs"], sep="\t", header=0, dtype=str, keep_default_na=False)
+
+        xrefs = []
+
+        for _, row in df_xrefs.iterrows():
+            for id, _ in official_map.get(row[id_col], []):
+                for db, col in xref_cols.items():
+                    for xref in row[col].split("|"):
+                        xref = xref.strip()
+
+                        if xref != "":
+                            xrefs.append((id, db, xref))
+
+        cursor.executemany(
+            "INSERT INTO gene_xrefs (gene_id, db, xref) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+            xrefs,
+        )
+
+        print(len(xrefs), "xrefs added")
+
+    if "descriptions" in file_desc:
+        print("Adding descriptions...")
+
+        id_col, name_col = DESCRIPTION_COLUMNS[file_desc["genome"]]
+
+        df_descriptions = pd.read_csv(file_desc["descriptions"], sep="\t", header=0, dtype=str, keep_default_na=False)
+
+        for _, row in df_descriptions.iterrows():
+            description = row[name_col].strip()
+
+            if description == "":
+                continue
+
+            for id, _ in official_map.get(row[id_col], []):
+                description_map[id] = description
+
+    cursor.executemany(
+        "INSERT INTO gene_descriptions (gene_id, description) VALUES (?, ?)",
+        description_map.items(),
+    )
+
+    print(len(description_map), "descriptions added")
+
+    # orthologs are matched to genes by Ensembl id
+    for ortholog_desc in file_desc.get("orthologs", []):
+        other = ortholog_desc["genome"]
+
+        print(f"Adding {other} orthologs...")
+
+        id_col, other_id_col, symbol_col, source_col = ortholog_columns(
+            ortholog_desc["format"], file_desc["genome"], other
+        )
+
+        df_orthologs = pd.read_csv(ortholog_desc["path"], sep="\t", header=0, dtype=str, keep_default_na=False)
+
+        orthologs = []
+
+        for _, row in df_orthologs.iterrows():
+            gene_id = re.sub(r"\..+", "", row[id_col])
+            other_id = re.sub(r"\..+", "", row[other_id_col])
+
+            # HCOP uses - for missing ids
+            if gene_id not in gene_map or other_id in ("", "-"):
+                continue
+
+            orthologs.append(
+                (gene_map[gene_id], other, other_id, row[symbol_col], row[source_col])
+            )
+
+        cursor.executemany(
+            "INSERT INTO gene_orthologs (gene_id, genome, ortholog_gene_id, ortholog_symbol, source) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+            orthologs,
+        )
+
+        print(len(orthologs), "orthologs added")
+
+    cursor.executemany(
+        "INSERT INTO id_versions (stable_id, version) VALUES (?, ?)",
+        version_map.items(),
+    )
+
+    print(len(version_map), "id versions added")
+
     # work out who is longest transcript per gene
     print("Finding longest transcripts...")
 
@@ -0,0 +1,309 @@
+package genome
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+//
+// Searches by name that return every match, ranked by relevance, a page
+// at a time with the total number of matches, so that clients can page
+// through them with a cursor.
+//
+
+type (
+	SearchPage struct {
+		// the number of genes matched over all pages, at most
+		// MaxSearchCandidates
+		Total int `json:"total"`
+		// pass as the cursor to get the next page, empty on the last page
+		Next string `json:"next,omitempty"`
+		// the genes of this page, best first, with all their matching
+		// transcripts or exons
+		Features []*GenomicFeature `json:"features"`
+	}
+
+	// the last gene of a page, where the next page starts
+	searchCursor struct {
+		Score  float64 `json:"s"`
+		Symbol string  `json:"y"`
+		GeneId string  `json:"g"`
+	}
+)
+
+const (
+	// no limit on the results of internal searches
+	NoLimit int16 = -1
+
+	// the most genes a search ranks. Fuzzy searches keep the best
+	// matching and other searches the first by symbol, as SearchByName
+	// orders them, so broad searches such as a short prefix do not rank
+	// the whole annotation for every page.
+	MaxSearchCandidates int16 = 1000
+)
+
+// Search finds genes as SearchByName does, or as FuzzySearchByName does
+// if fuzzy, but ranks all of them by the score of their match and returns
+// the n genes after cursor, or the first n if cursor is empty. Unlike
+// SearchByName, n counts genes at every level and each gene has all of
+// its matching transcripts or exons.
+//
+// Genes are ranked on one matching transcript or exon each, which is
+// enough to score them, and only the genes of the page are loaded with
+// all of theirs. At most MaxSearchCandidates genes are ranked.
+func (gdb *GtfDB) Search(search string,
+	level string,
+	policy *TranscriptPolicy,
+	fuzzy bool,
+	n int16,
+	cursor string) (*SearchPage, error) {
+	after, err := parseSearchCursor(cursor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// at the gene level n limits genes rather than their children
+	perGene := NoLimit
+
+	if level == TranscriptLevel || level == ExonLevel {
+		perGene = 1
+	}
+
+	// the first n genes matching search, with perGene of their
+	// transcripts or exons each
+	find := func(n int16, perGene int16, genes []int) ([]*GenomicFeature, error) {
+		if fuzzy {
+			return gdb.fuzzySearchByName(search, level, policy, n, perGene, genes)
+		}
+
+		// the gene query limits genes, the others the rows of each gene
+		limit := perGene
+
+		if level != TranscriptLevel && level != ExonLevel {
+			limit = n
+		}
+
+		features, err := gdb.searchByName(search, level, policy, limit, genes)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if n != NoLimit {
+			features = features[:min(len(features), int(n))]
+		}
+
+		scoreNameMatches(features, search)
+
+		return features, nil
+	}
+
+	ranked, err := find(MaxSearchCandidates, perGene, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := searchPage(ranked, after, n)
+
+	if perGene == NoLimit || len(page.Features) == 0 {
+		return page, nil
+	}
+
+	ids := make([]int, 0, len(page.Features))
+	order := make(map[int]int, len(page.Features))
+
+	for i, feature := range page.Features {
+		ids = append(ids, feature.Id)
+		order[feature.Id] = i
+	}
+
+	features, err := find(NoLimit, NoLimit, ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the ranking and scores the page was made from
+	slices.SortStableFunc(features, func(a, b *GenomicFeature) int {
+		return order[a.Id] - order[b.Id]
+	})
+
+	for _, feature := range features {
+		setScore(feature, page.Features[order[feature.Id]].Score)
+	}
+
+	page.Features = features
+
+	return page, nil
+}
+
+// Search pages genes as GtfDB.Search does
+func (mdb *MemGeneDB) Search(search string,
+	level string,
+	policy *TranscriptPolicy,
+	fuzzy bool,
+	n int16,
+	cursor string) (*SearchPage, error) {
+	after, err := parseSearchCursor(cursor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var features []*GenomicFeature
+
+	if fuzzy {
+		features, err = mdb.fuzzySearchByName(search, level, policy, NoLimit)
+	} else {
+		features, err = mdb.searchByName(search, level, policy, NoLimit)
+
+		scoreNameMatches(features, search)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the same candidates as GtfDB.Search ranks
+	features = features[:min(len(features), int(MaxSearchCandidates))]
+
+	return searchPage(features, after, n), nil
+}
+
+// scoreNameMatches scores genes found by name as fuzzy searches score
+// them: symbols exactly, case insensitively or by prefix, ids in full and
+// aliases and xrefs just below symbols
+func scoreNameMatches(features []*GenomicFeature, search string) {
+	lower := strings.ToLower(search)
+
+	// ids match with any version
+	id, _ := splitIdVersion(search)
+	lowerId := strings.ToLower(id)
+
+	for _, feature := range features {
+		var score float64
+
+		switch {
+		case feature.MatchedAlias != "":
+			score = symbolScore(feature.MatchedAlias, strings.ToLower(feature.MatchedAlias), search, lower, 0, false) - AliasMatchPenalty
+		case feature.MatchedXref != "":
+			_, xref, _ := strings.Cut(feature.MatchedXref, ":")
+
+			score = idScore(xref, search, lower) - AliasMatchPenalty
+		default:
+			score = max(idScore(feature.GeneId, id, lowerId),
+				idScore(feature.OfficialId, search, lower),
+				symbolScore(feature.Symbol, strings.ToLower(feature.Symbol), search, lower, 0, true),
+				childIdScore(feature.Children, id, lowerId))
+		}
+
+		if score <= 0 {
+			// only matched through an sql wildcard such as _
+			score = FuzzyMatchScore
+		}
+
+		setScore(feature, score)
+	}
+}
+
+// the best score of a transcript or exon id matching search
+func childIdScore(features []*GenomicFeature, search string, lower string) float64 {
+	var ret float64
+
+	for _, feature := range features {
+		ret = max(ret,
+			idScore(feature.Transcript, search, lower),
+			idScore(feature.Exon, search, lower),
+			childIdScore(feature.Children, search, lower))
+	}
+
+	return ret
+}
+
+// searchPage ranks scored genes best first, then by symbol and gene id,
+// and returns the n after the cursor
+func searchPage(features []*GenomicFeature, after *searchCursor, n int16) *SearchPage {
+	n = max(1, min(n, MaxGeneInfoResults))
+
+	slices.SortStableFunc(features, func(a, b *GenomicFeature) int {
+		return compareSearchCursors(newSearchCursor(a), newSearchCursor(b))
+	})
+
+	start := 0
+
+	if after != nil {
+		start = slices.IndexFunc(features, func(feature *GenomicFeature) bool {
+			return compareSearchCursors(newSearchCursor(feature), after) > 0
+		})
+
+		if start == -1 {
+			start = len(features)
+		}
+	}
+
+	end := min(len(features), start+int(n))
+
+	ret := &SearchPage{Total: len(features), Features: features[start:end]}
+
+	if end < len(features) {
+		ret.Next = newSearchCursor(features[end-1]).String()
+	}
+
+	return ret
+}
+
+func newSearchCursor(feature *GenomicFeature) *searchCursor {
+	return &searchCursor{Score: feature.Score, Symbol: feature.Symbol, GeneId: feature.GeneId}
+}
+
+// cursors are opaque to clients
+func (cursor *searchCursor) String() string {
+	data, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// the cursor of a page, nil for the first
+func parseSearchCursor(cursor string) (*searchCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s is an invalid cursor", cursor)
+	}
+
+	var ret searchCursor
+
+	err = json.Unmarshal(data, &ret)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s is an invalid cursor", cursor)
+	}
+
+	return &ret, nil
+}
+
+// best score first, then by symbol and gene id as searches by
+// name order genes
+func compareSearchCursors(a *searchCursor, b *searchCursor) int {
+	switch {
+	case a.Score > b.Score:
+		return -1
+	case a.Score < b.Score:
+		return 1
+	}
+
+	if c := strings.Compare(a.Symbol, b.Symbol); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.GeneId, b.GeneId)
+}
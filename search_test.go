@@ -0,0 +1,151 @@
+package genome_test
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+func TestSearch(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	page, err := gdb.Search("gene", genome.GeneLevel, nil, false, 3, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(page.Features); page.Total != 4 || !slices.Equal(got, []string{"GENEA", "GENEB", "GENED"}) || page.Next == "" {
+		t.Errorf("first page = %d %v %q", page.Total, got, page.Next)
+	}
+
+	page, err = gdb.Search("gene", genome.GeneLevel, nil, false, 3, page.Next)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(page.Features); page.Total != 4 || !slices.Equal(got, []string{"GENEE"}) || page.Next != "" {
+		t.Errorf("last page = %d %v %q", page.Total, got, page.Next)
+	}
+
+	// exact matches rank above aliases and n counts genes at every level
+	page, err = gdb.Search("GENEA", genome.ExonLevel, nil, false, 1, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(page.Features); page.Total != 1 || !slices.Equal(got, []string{"GENEA"}) ||
+		page.Features[0].Score != genome.ExactMatchScore || len(page.Features[0].Children) != 2 {
+		t.Errorf("exons of GENEA = %d %v", page.Total, got)
+	}
+
+	for _, transcript := range page.Features[0].Children {
+		if len(transcript.Children) < 2 {
+			t.Errorf("exons of %s = %d", transcript.Transcript, len(transcript.Children))
+		}
+	}
+
+	page, err = gdb.Search("delta", genome.TranscriptLevel, nil, false, 1, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(page.Features); page.Total != 2 || !slices.Equal(got, []string{"GENED"}) ||
+		page.Features[0].Score != genome.CaseInsensitiveMatchScore-genome.AliasMatchPenalty {
+		t.Errorf("delta = %d %v", page.Total, got)
+	}
+
+	page, err = gdb.Search("hgnc:4", genome.GeneLevel, nil, false, 10, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Features) != 1 || page.Features[0].OfficialId != "HGNC:4" || page.Features[0].Score != genome.CaseInsensitiveMatchScore {
+		t.Errorf("hgnc:4 = %v", symbols(page.Features))
+	}
+
+	page, err = gdb.Search("genae", genome.GeneLevel, nil, true, 1, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := symbols(page.Features); page.Total < 2 || !slices.Equal(got, []string{"GENEA"}) || page.Next == "" {
+		t.Errorf("fuzzy = %d %v", page.Total, got)
+	}
+
+	_, err = gdb.Search("gene", genome.GeneLevel, nil, false, 3, "not a cursor")
+
+	if err == nil {
+		t.Error("an invalid cursor should be an error")
+	}
+}
+
+// broad searches rank a bounded number of genes
+func TestSearchCandidates(t *testing.T) {
+	genes := make([]*genometest.Gene, 0, genome.MaxSearchCandidates+5)
+
+	for i := range int(genome.MaxSearchCandidates) + 5 {
+		start := 1001 + i*1000
+
+		genes = append(genes, &genometest.Gene{Id: fmt.Sprintf("ENSG%011d", i+1),
+			Symbol:  fmt.Sprintf("GENE%04d", i),
+			Chr:     "chr1",
+			Strand:  "+",
+			Biotype: "lncRNA",
+			Transcripts: []*genometest.Transcript{{Id: fmt.Sprintf("ENST%011d", i+1),
+				Biotype:   "lncRNA",
+				Exons:     []genometest.Interval{{Start: start, End: start + 100}},
+				Canonical: true}}})
+	}
+
+	var gtf bytes.Buffer
+
+	err := genometest.WriteGtf(&gtf, genes)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memGenes, err := genome.ParseGtf(&gtf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, backend := range []struct {
+		name string
+		gdb  genome.GeneSearcher
+	}{{"GtfDB", openGenes(t, genes)}, {"MemGeneDB", genome.NewMemGeneDB(&genome.Annotation{}, memGenes)}} {
+		page, err := backend.gdb.Search("gene", genome.GeneLevel, nil, false, 2, "")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the first genes by symbol
+		if got := symbols(page.Features); page.Total != int(genome.MaxSearchCandidates) ||
+			!slices.Equal(got, []string{"GENE0000", "GENE0001"}) {
+			t.Errorf("%s = %d %v", backend.name, page.Total, got)
+		}
+
+		// but the best fuzzy matches, even past the first genes by symbol
+		page, err = backend.gdb.Search("gene1003", genome.TranscriptLevel, nil, true, 1, "")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := symbols(page.Features); page.Total > int(genome.MaxSearchCandidates) || !slices.Equal(got, []string{"GENE1003"}) {
+			t.Errorf("%s fuzzy = %d %v", backend.name, page.Total, got)
+		}
+	}
+}
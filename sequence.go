@@ -0,0 +1,248 @@
+package genome
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/antonybholmes/go-dna"
+)
+
+//
+// Reading reference sequence from local indexed FASTA or 2bit files
+//
+
+type (
+	SequenceReader interface {
+		// Sequence returns the upper case sequence of a location on
+		// the + strand
+		Sequence(location *dna.Location) (string, error)
+
+		Close() error
+	}
+
+	faiEntry struct {
+		length    int
+		offset    int64
+		lineBases int
+		lineWidth int
+	}
+
+	// Reads a FASTA file indexed with samtools faidx
+	FastaReader struct {
+		file  *os.File
+		index map[string]*faiEntry
+	}
+)
+
+var (
+	ErrChrNotFound = errors.New("chromosome not found in sequence file")
+
+	complementMap = map[byte]byte{
+		'A': 'T',
+		'C': 'G',
+		'G': 'C',
+		'T': 'A',
+		'N': 'N',
+		'a': 't',
+		'c': 'g',
+		'g': 'c',
+		't': 'a',
+		'n': 'n',
+	}
+)
+
+// OpenSequenceReader opens a FASTA (.fa, .fasta with a .fai index)
+// or 2bit file depending on its extension.
+func OpenSequenceReader(path string) (SequenceReader, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".2bit" {
+		return NewTwoBitReader(path)
+	}
+
+	return NewFastaReader(path)
+}
+
+func NewFastaReader(path string) (*FastaReader, error) {
+	index, err := readFai(path + ".fai")
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FastaReader{file: file, index: index}, nil
+}
+
+func readFai(path string) (map[string]*faiEntry, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	index := make(map[string]*faiEntry)
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		tokens := strings.Split(scanner.Text(), "\t")
+
+		if len(tokens) < 5 {
+			continue
+		}
+
+		var entry faiEntry
+
+		entry.length, err = strconv.Atoi(tokens[1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		entry.offset, err = strconv.ParseInt(tokens[2], 10, 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entry.lineBases, err = strconv.Atoi(tokens[3])
+
+		if err != nil {
+			return nil, err
+		}
+
+		entry.lineWidth, err = strconv.Atoi(tokens[4])
+
+		if err != nil {
+			return nil, err
+		}
+
+		index[tokens[0]] = &entry
+	}
+
+	return index, scanner.Err()
+}
+
+func (reader *FastaReader) Sequence(location *dna.Location) (string, error) {
+	entry, ok := lookupChr(reader.index, location.Chr())
+
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrChrNotFound, location.Chr())
+	}
+
+	start := location.Start()
+	end := min(location.End(), entry.length)
+
+	if start > end {
+		return "", fmt.Errorf("%s is outside of the sequence", location)
+	}
+
+	// byte offsets must account for the new lines
+	startOffset := entry.offset + int64((start-1)/entry.lineBases*entry.lineWidth+(start-1)%entry.lineBases)
+	endOffset := entry.offset + int64((end-1)/entry.lineBases*entry.lineWidth+(end-1)%entry.lineBases)
+
+	buf := make([]byte, endOffset-startOffset+1)
+
+	_, err := reader.file.ReadAt(buf, startOffset)
+
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	seq := make([]byte, 0, end-start+1)
+
+	for _, b := range buf {
+		if b != '\n' && b != '\r' {
+			seq = append(seq, b)
+		}
+	}
+
+	return strings.ToUpper(string(seq)), nil
+}
+
+func (reader *FastaReader) Close() error {
+	return reader.file.Close()
+}
+
+// the names the mitochondrion goes by in different sources
+var mitochondrialChrs = []string{"chrM", "MT", "chrMT", "M"}
+
+// chromosome names differ between sources, e.g. chr1 vs 1 and
+// chrM vs MT, so try the common alternatives
+func lookupChr[T any](index map[string]T, chr string) (T, bool) {
+	if v, ok := index[chr]; ok {
+		return v, true
+	}
+
+	var alts []string
+
+	switch chr {
+	case "chrM", "chrMT", "MT", "M":
+		// the mitochondrion has the most spellings
+		alts = mitochondrialChrs
+	default:
+		if strings.HasPrefix(chr, "chr") {
+			alts = []string{strings.TrimPrefix(chr, "chr")}
+		} else {
+			alts = []string{"chr" + chr}
+		}
+	}
+
+	for _, alt := range alts {
+		if v, ok := index[alt]; ok {
+			return v, true
+		}
+	}
+
+	var zero T
+
+	return zero, false
+}
+
+// ReverseComplement returns the reverse complement of a sequence.
+// Unknown bases are returned as N.
+func ReverseComplement(seq string) string {
+	n := len(seq)
+
+	ret := make([]byte, n)
+
+	for i := range n {
+		c, ok := complementMap[seq[n-1-i]]
+
+		if !ok {
+			c = 'N'
+		}
+
+		ret[i] = c
+	}
+
+	return string(ret)
+}
+
+// StrandedSequence returns the sequence of a location on its own
+// strand, i.e. reverse complemented for the minus strand
+func StrandedSequence(reader SequenceReader, location *dna.Location) (string, error) {
+	seq, err := reader.Sequence(location)
+
+	if err != nil {
+		return "", err
+	}
+
+	if location.Strand() == "-" {
+		return ReverseComplement(seq), nil
+	}
+
+	return seq, nil
+}
@@ -0,0 +1,242 @@
+package genome_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+type twoBitSeq struct {
+	name string
+	// lower case bases are soft masked and Ns are stored as N blocks
+	seq string
+}
+
+// runs of bases matching f as 0-based starts and sizes
+func twoBitBlocks(seq string, f func(rune) bool) ([]uint32, []uint32) {
+	starts := make([]uint32, 0, 10)
+	sizes := make([]uint32, 0, 10)
+
+	for i, c := range seq {
+		if !f(c) {
+			continue
+		}
+
+		if n := len(starts); n > 0 && int(starts[n-1]+sizes[n-1]) == i {
+			sizes[n-1]++
+		} else {
+			starts = append(starts, uint32(i))
+			sizes = append(sizes, 1)
+		}
+	}
+
+	return starts, sizes
+}
+
+// writeTwoBit writes a version 0 2bit file in the given byte order
+func writeTwoBit(t *testing.T, path string, order binary.AppendByteOrder, seqs []twoBitSeq) {
+	t.Helper()
+
+	u32 := func(buf []byte, values ...uint32) []byte {
+		for _, v := range values {
+			buf = order.AppendUint32(buf, v)
+		}
+
+		return buf
+	}
+
+	buf := u32(nil, 0x1A412743, 0, uint32(len(seqs)), 0)
+
+	indexSize := 0
+
+	for _, s := range seqs {
+		indexSize += 1 + len(s.name) + 4
+	}
+
+	records := make([]byte, 0, 1000)
+
+	for _, s := range seqs {
+		buf = append(buf, byte(len(s.name)))
+		buf = append(buf, s.name...)
+		buf = u32(buf, uint32(16+indexSize+len(records)))
+
+		nStarts, nSizes := twoBitBlocks(s.seq, func(c rune) bool { return c == 'N' || c == 'n' })
+		maskStarts, maskSizes := twoBitBlocks(s.seq, unicode.IsLower)
+
+		records = u32(records, uint32(len(s.seq)), uint32(len(nStarts)))
+		records = u32(records, nStarts...)
+		records = u32(records, nSizes...)
+		records = u32(records, uint32(len(maskStarts)))
+		records = u32(records, maskStarts...)
+		records = u32(records, maskSizes...)
+		records = u32(records, 0)
+
+		packed := make([]byte, (len(s.seq)+3)/4)
+
+		for i, c := range strings.ToUpper(s.seq) {
+			// N is stored as T, i.e. 0
+			packed[i/4] |= byte(max(0, strings.IndexRune("TCAG", c))) << (6 - 2*(i%4))
+		}
+
+		records = append(records, packed...)
+	}
+
+	err := os.WriteFile(path, append(buf, records...), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sequence(t *testing.T, reader genome.SequenceReader, chr string, start int, end int) string {
+	t.Helper()
+
+	seq, err := reader.Sequence(location(t, chr, start, end))
+
+	if err != nil {
+		t.Fatalf("%s:%d-%d: %v", chr, start, end, err)
+	}
+
+	return seq
+}
+
+func TestFastaReader(t *testing.T) {
+	fixture := genometest.New(t)
+
+	reader, err := genome.OpenSequenceReader(filepath.Join(fixture.Dir, genometest.FastaFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	chr1 := genometest.Sequence("chr1")
+
+	// within a line, across lines and at the ends of the chromosome
+	for _, r := range [][2]int{{1, 1}, {1, 60}, {55, 125}, {1101, 1200}, {39990, 40000}} {
+		if got := sequence(t, reader, "chr1", r[0], r[1]); got != chr1[r[0]-1:r[1]] {
+			t.Errorf("chr1:%d-%d = %s", r[0], r[1], got)
+		}
+	}
+
+	// Ensembl style names and ends past the chromosome
+	if got := sequence(t, reader, "2", 9991, 10100); got != genometest.Sequence("chr2")[9990:] {
+		t.Errorf("2:9991-10100 = %s", got)
+	}
+
+	_, err = reader.Sequence(location(t, "chr3", 1, 10))
+
+	if !errors.Is(err, genome.ErrChrNotFound) {
+		t.Errorf("chr3: %v", err)
+	}
+
+	_, err = reader.Sequence(location(t, "chr1", 40001, 40010))
+
+	if err == nil {
+		t.Errorf("read past the end of chr1")
+	}
+}
+
+func TestTwoBitReader(t *testing.T) {
+	dir := t.TempDir()
+
+	seqs := []twoBitSeq{{"chr1", "ACGTnnNNacgtACGTAcgtaNNTTGCA"},
+		{"chrM", "NNNNgattacaGATTACA"},
+		{"chr2", strings.Repeat("ACGTTGCA", 50) + "NNNNN" + strings.Repeat("cattag", 20)}}
+
+	for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+		path := filepath.Join(dir, order.String()+".2bit")
+
+		writeTwoBit(t, path, order, seqs)
+
+		reader, err := genome.OpenSequenceReader(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range seqs {
+			// masked bases come back upper case and N blocks as N
+			want := strings.ToUpper(s.seq)
+
+			if got := sequence(t, reader, s.name, 1, len(s.seq)); got != want {
+				t.Errorf("%s %s = %s, want %s", order, s.name, got, want)
+			}
+
+			// every start and end offset within a byte
+			for start := 1; start <= 8; start++ {
+				for end := len(s.seq) - 8; end <= len(s.seq); end++ {
+					if got := sequence(t, reader, s.name, start, end); got != want[start-1:end] {
+						t.Fatalf("%s %s:%d-%d = %s", order, s.name, start, end, got)
+					}
+				}
+			}
+		}
+
+		// an N block that only partly overlaps the location
+		if got := sequence(t, reader, "chr1", 6, 9); got != "NNNA" {
+			t.Errorf("%s partial n block = %s", order, got)
+		}
+
+		// chrM is MT in Ensembl and chrMT or M elsewhere
+		for _, chr := range []string{"MT", "chrMT", "M"} {
+			if got := sequence(t, reader, chr, 3, 6); got != "NNGA" {
+				t.Errorf("%s %s = %s", order, chr, got)
+			}
+		}
+
+		_, err = reader.Sequence(location(t, "chr3", 1, 10))
+
+		if !errors.Is(err, genome.ErrChrNotFound) {
+			t.Errorf("%s chr3: %v", order, err)
+		}
+
+		reader.Close()
+	}
+
+	os.WriteFile(filepath.Join(dir, "bad.2bit"), make([]byte, 16), 0644)
+
+	_, err := genome.OpenSequenceReader(filepath.Join(dir, "bad.2bit"))
+
+	if !errors.Is(err, genome.ErrInvalidTwoBit) {
+		t.Errorf("bad signature: %v", err)
+	}
+}
+
+func TestReverseComplement(t *testing.T) {
+	if got := genome.ReverseComplement("ACGTNacgtnX"); got != "NnacgtNACGT" {
+		t.Errorf("reverse complement = %s", got)
+	}
+
+	fixture := genometest.New(t)
+
+	reader, err := genome.NewFastaReader(filepath.Join(fixture.Dir, genometest.FastaFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	minus, err := dna.NewStrandedLocation("chr1", 11099, 11101, "-")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the start codon of GENEB
+	seq, err := genome.StrandedSequence(reader, minus)
+
+	if err != nil || seq != "ATG" {
+		t.Errorf("stranded = %s, %v", seq, err)
+	}
+}
@@ -0,0 +1,376 @@
+package genome
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/antonybholmes/go-dna"
+)
+
+//
+// A transcript with its exons and coding features ordered in the
+// direction of transcription. This is the basis for coordinate
+// conversion, sequence extraction and variant annotation.
+//
+
+type (
+	TranscriptModel struct {
+		Transcript *GenomicFeature `json:"transcript"`
+		// exons and coding features ordered 5' to 3' relative
+		// to the transcript, so on the minus strand the first
+		// exon has the largest coordinates
+		Exons      []*dna.Location `json:"exons"`
+		Cds        []*dna.Location `json:"cds"`
+		StartCodon []*dna.Location `json:"startCodon,omitempty"`
+		StopCodon  []*dna.Location `json:"stopCodon,omitempty"`
+		// length of the spliced transcript
+		Length int `json:"length"`
+		// transcript positions of the first and last coding
+		// base including the stop codon. Zero for non-coding
+		// transcripts
+		cdsStart int
+		cdsEnd   int
+	}
+)
+
+const (
+	StartCodonFeature string = "start_codon"
+	StopCodonFeature  string = "stop_codon"
+	CdsFeature        string = "cds"
+
+	TranscriptModelLevels string = "transcript,exon,cds,start_codon,stop_codon"
+
+	TranscriptModelSql = BasicLocationSql +
+		` WHERE
+			LOWER(t.transcript_id) = LOWER(:transcriptId)
+		ORDER BY
+			g.gene_id,
+			t.transcript_id,
+			f.start,
+			f.end,
+			f.feature_type_id`
+)
+
+// TranscriptModel loads the exons, CDS and start/stop codons of a
+// transcript, whose id can have any version.
+func (gdb *GtfDB) TranscriptModel(transcriptId string) (*TranscriptModel, error) {
+	id, _ := splitIdVersion(transcriptId)
+
+	rows, err := gdb.db.Query(TranscriptModelSql, sql.Named("transcriptId", id))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	transcripts, err := rowsToRecords(rows, TranscriptModelLevels, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transcripts) == 0 {
+		return nil, fmt.Errorf("transcript %s not found", transcriptId)
+	}
+
+	err = matchVersions(gdb.AddVersions, transcripts[:1], transcriptId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTranscriptModel(transcripts[0])
+}
+
+// NewTranscriptModel creates a model from a transcript feature whose
+// children are its exon, cds and start/stop codon features.
+func NewTranscriptModel(transcript *GenomicFeature) (*TranscriptModel, error) {
+	model := TranscriptModel{Transcript: transcript,
+		Exons:      make([]*dna.Location, 0, 10),
+		Cds:        make([]*dna.Location, 0, 10),
+		StartCodon: make([]*dna.Location, 0, 2),
+		StopCodon:  make([]*dna.Location, 0, 2),
+	}
+
+	for _, feature := range transcript.Children {
+		switch feature.Type {
+		case ExonLevel:
+			model.Exons = append(model.Exons, feature.Location)
+		case CdsFeature:
+			model.Cds = append(model.Cds, feature.Location)
+		case StartCodonFeature:
+			model.StartCodon = append(model.StartCodon, feature.Location)
+		case StopCodonFeature:
+			model.StopCodon = append(model.StopCodon, feature.Location)
+		}
+	}
+
+	if len(model.Exons) == 0 {
+		return nil, fmt.Errorf("transcript %s has no exons", transcript.Transcript)
+	}
+
+	minusStrand := model.IsMinusStrand()
+
+	for _, locations := range [][]*dna.Location{model.Exons, model.Cds, model.StartCodon, model.StopCodon} {
+		sortTranscriptOrder(locations, minusStrand)
+	}
+
+	for _, exon := range model.Exons {
+		model.Length += exon.End() - exon.Start() + 1
+	}
+
+	// GTF CDS features exclude the stop codon, but for coordinates
+	// the stop codon is the last codon of the coding sequence
+	coding := model.CodingRegions()
+
+	if len(coding) > 0 {
+		first := coding[0]
+		last := coding[len(coding)-1]
+
+		var err error
+
+		if minusStrand {
+			model.cdsStart, err = model.exonicIndex(first.End())
+
+			if err != nil {
+				return nil, err
+			}
+
+			model.cdsEnd, err = model.exonicIndex(last.Start())
+		} else {
+			model.cdsStart, err = model.exonicIndex(first.Start())
+
+			if err != nil {
+				return nil, err
+			}
+
+			model.cdsEnd, err = model.exonicIndex(last.End())
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &model, nil
+}
+
+func sortTranscriptOrder(locations []*dna.Location, minusStrand bool) {
+	slices.SortFunc(locations, func(a, b *dna.Location) int {
+		if minusStrand {
+			return b.Start() - a.Start()
+		}
+
+		return a.Start() - b.Start()
+	})
+}
+
+func (model *TranscriptModel) IsMinusStrand() bool {
+	return model.Transcript.Location.Strand() == "-"
+}
+
+func (model *TranscriptModel) IsCoding() bool {
+	return model.cdsStart > 0
+}
+
+// CodingRegions returns the CDS plus stop codon intervals in
+// transcript order with overlapping or abutting intervals merged.
+func (model *TranscriptModel) CodingRegions() []*dna.Location {
+	regions := make([]*dna.Location, 0, len(model.Cds)+len(model.StopCodon))
+
+	regions = append(regions, model.Cds...)
+	regions = append(regions, model.StopCodon...)
+
+	if len(regions) == 0 {
+		return regions
+	}
+
+	// merge in genomic order, then restore transcript order
+	sortTranscriptOrder(regions, false)
+
+	merged := make([]*dna.Location, 0, len(regions))
+
+	current := regions[0]
+
+	for _, region := range regions[1:] {
+		if region.Start() <= current.End()+1 {
+			if region.End() > current.End() {
+				// errors are not possible since start < end
+				current, _ = dna.NewStrandedLocation(current.Chr(), current.Start(), region.End(), current.Strand())
+			}
+		} else {
+			merged = append(merged, current)
+			current = region
+		}
+	}
+
+	merged = append(merged, current)
+
+	sortTranscriptOrder(merged, model.IsMinusStrand())
+
+	return merged
+}
+
+// CdsStart returns the transcript position of the first base of
+// the start codon, i.e. c.1
+func (model *TranscriptModel) CdsStart() int {
+	return model.cdsStart
+}
+
+// CdsEnd returns the transcript position of the last base of the
+// stop codon
+func (model *TranscriptModel) CdsEnd() int {
+	return model.cdsEnd
+}
+
+// transcript position of a genomic position that must be exonic
+func (model *TranscriptModel) exonicIndex(pos int) (int, error) {
+	index, offset := model.genomicToIndex(pos)
+
+	if offset != 0 || index < 1 || index > model.Length {
+		return 0, fmt.Errorf("position %d is not in an exon of %s", pos, model.Transcript.Transcript)
+	}
+
+	return index, nil
+}
+
+// genomicToIndex converts a genomic position to a 1-based position in
+// the spliced transcript plus an intronic offset. Positions 5' of the
+// transcript are <= 0 and positions 3' of the transcript are > length.
+func (model *TranscriptModel) genomicToIndex(pos int) (int, int) {
+	minusStrand := model.IsMinusStrand()
+
+	cum := 0
+
+	for _, exon := range model.Exons {
+		if pos >= exon.Start() && pos <= exon.End() {
+			if minusStrand {
+				return cum + exon.End() - pos + 1, 0
+			}
+
+			return cum + pos - exon.Start() + 1, 0
+		}
+
+		cum += exon.End() - exon.Start() + 1
+	}
+
+	first := model.Exons[0]
+	last := model.Exons[len(model.Exons)-1]
+
+	// outside the transcript
+	if minusStrand {
+		if pos > first.End() {
+			return 1 - (pos - first.End()), 0
+		}
+
+		if pos < last.Start() {
+			return model.Length + last.Start() - pos, 0
+		}
+	} else {
+		if pos < first.Start() {
+			return 1 - (first.Start() - pos), 0
+		}
+
+		if pos > last.End() {
+			return model.Length + pos - last.End(), 0
+		}
+	}
+
+	// intronic, so anchor on the nearest exon boundary. If the
+	// position is in the middle of the intron, the upstream exon
+	// is used as per HGVS
+	cum = 0
+
+	for i, exon := range model.Exons[:len(model.Exons)-1] {
+		cum += exon.End() - exon.Start() + 1
+
+		next := model.Exons[i+1]
+
+		var d1 int
+		var d2 int
+
+		if minusStrand {
+			if pos >= exon.Start() || pos <= next.End() {
+				continue
+			}
+
+			d1 = exon.Start() - pos
+			d2 = pos - next.End()
+		} else {
+			if pos <= exon.End() || pos >= next.Start() {
+				continue
+			}
+
+			d1 = pos - exon.End()
+			d2 = next.Start() - pos
+		}
+
+		if d1 <= d2 {
+			return cum, d1
+		}
+
+		return cum + 1, -d2
+	}
+
+	// should not happen with well formed exons
+	return 0, 0
+}
+
+// indexToGenomic is the inverse of genomicToIndex
+func (model *TranscriptModel) indexToGenomic(index int, offset int) (int, error) {
+	minusStrand := model.IsMinusStrand()
+
+	first := model.Exons[0]
+	last := model.Exons[len(model.Exons)-1]
+
+	var pos int
+
+	switch {
+	case index < 1:
+		if offset != 0 {
+			return 0, fmt.Errorf("offsets are not allowed outside of %s", model.Transcript.Transcript)
+		}
+
+		if minusStrand {
+			return first.End() + 1 - index, nil
+		}
+
+		return first.Start() - 1 + index, nil
+	case index > model.Length:
+		if offset != 0 {
+			return 0, fmt.Errorf("offsets are not allowed outside of %s", model.Transcript.Transcript)
+		}
+
+		if minusStrand {
+			return last.Start() - (index - model.Length), nil
+		}
+
+		return last.End() + index - model.Length, nil
+	default:
+		cum := 0
+
+		for _, exon := range model.Exons {
+			l := exon.End() - exon.Start() + 1
+
+			if index <= cum+l {
+				if minusStrand {
+					pos = exon.End() - (index - cum - 1)
+				} else {
+					pos = exon.Start() + (index - cum - 1)
+				}
+
+				break
+			}
+
+			cum += l
+		}
+	}
+
+	if minusStrand {
+		return pos - offset, nil
+	}
+
+	return pos + offset, nil
+}
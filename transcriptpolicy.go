@@ -0,0 +1,494 @@
+package genome
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+//
+// Transcript tags, e.g. MANE_Select, and policies for choosing one
+// transcript per gene
+//
+
+type (
+	// A TranscriptPolicy picks one transcript per gene by applying
+	// criteria in order, e.g. "mane,ensembl_canonical,longest" means
+	// use the MANE Select transcript, otherwise the Ensembl canonical
+	// transcript, otherwise the longest. Remaining ties are broken by
+	// transcript id so the choice is stable.
+	//
+	// A policy can also include or exclude transcripts by biotype, e.g.
+	// to ignore nonsense_mediated_decay transcripts. Transcripts are
+	// filtered before the criteria are applied so a gene is never
+	// represented by an excluded transcript.
+	//
+	// Genes can be included or excluded by biotype in the same way, which
+	// keeps genes out of every query that takes a policy.
+	TranscriptPolicy struct {
+		criteria            []string
+		includeBiotypes     []string
+		excludeBiotypes     []string
+		includeGeneBiotypes []string
+		excludeGeneBiotypes []string
+	}
+)
+
+const (
+	ManeCriterion             string = "mane"
+	EnsemblCanonicalCriterion string = "ensembl_canonical"
+	BasicCriterion            string = "basic"
+	CcdsCriterion             string = "ccds"
+	ApprisCriterion           string = "appris"
+	CanonicalCriterion        string = "canonical"
+	LongestCriterion          string = "longest"
+	TslCriterion              string = "tsl"
+
+	// criteria of the form tag:<name> match any GTF tag
+	TagCriterionPrefix string = "tag:"
+
+	ManeSelectTag       string = "MANE_Select"
+	EnsemblCanonicalTag string = "Ensembl_canonical"
+	BasicTag            string = "basic"
+	CcdsTag             string = "CCDS"
+
+	// TSL is 1 (best) to 5 and missing values sort last
+	MissingTsl int = 6
+
+	PolicyTranscriptSql = `AND t.id = (
+		SELECT pt.id
+		FROM transcripts AS pt
+		WHERE pt.gene_id = t.gene_id
+			<<BIOTYPES>>
+		ORDER BY <<CRITERIA>>
+		LIMIT 1)`
+
+	PolicyBiotypeSql = `AND <<ALIAS>>.biotype_id <<IN>> (
+		SELECT pb.id FROM biotypes AS pb WHERE LOWER(pb.name) IN (<<NAMES>>))`
+
+	PolicyTagSql = `EXISTS (
+			SELECT 1
+			FROM transcript_tags AS ptt
+			JOIN tags AS ptg ON ptt.tag_id = ptg.id
+			WHERE ptt.transcript_id = pt.id AND <<TAG>>) DESC`
+
+	TranscriptTagsSql = `SELECT
+		t.transcript_id,
+		COALESCE(t.tsl, 0),
+		COALESCE(tg.name, '')
+		FROM transcripts AS t
+		LEFT JOIN transcript_tags AS tt ON tt.transcript_id = t.id
+		LEFT JOIN tags AS tg ON tt.tag_id = tg.id
+		WHERE <<TRANSCRIPT_IDS>>
+		ORDER BY t.transcript_id, tg.name`
+
+	// max ids in a single IN query to keep under the sqlite
+	// variable limit
+	MaxTagQueryIds int = 500
+)
+
+var (
+	// keep the tag names we accept simple since they end up in sql,
+	// albeit as named args
+	tagNameRegex = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+	biotypeNameRegex = regexp.MustCompile(`^[a-z0-9_\-]+$`)
+
+	// the legacy canonical=true behavior
+	CanonicalPolicy = &TranscriptPolicy{criteria: []string{CanonicalCriterion}}
+)
+
+// ParseTranscriptPolicy parses a comma separated list of criteria.
+// An empty string returns a nil policy, meaning all transcripts.
+func ParseTranscriptPolicy(s string) (*TranscriptPolicy, error) {
+	criteria := make([]string, 0, 5)
+
+	for _, criterion := range strings.Split(s, ",") {
+		criterion = strings.TrimSpace(criterion)
+
+		if criterion == "" {
+			continue
+		}
+
+		if tag, ok := strings.CutPrefix(criterion, TagCriterionPrefix); ok {
+			if !tagNameRegex.MatchString(tag) {
+				return nil, fmt.Errorf("invalid transcript tag: %s", tag)
+			}
+
+			criteria = append(criteria, criterion)
+			continue
+		}
+
+		criterion = strings.ToLower(criterion)
+
+		switch criterion {
+		case ManeCriterion,
+			EnsemblCanonicalCriterion,
+			BasicCriterion,
+			CcdsCriterion,
+			ApprisCriterion,
+			CanonicalCriterion,
+			LongestCriterion,
+			TslCriterion:
+			criteria = append(criteria, criterion)
+		default:
+			return nil, fmt.Errorf("invalid transcript policy criterion: %s", criterion)
+		}
+	}
+
+	if len(criteria) == 0 {
+		return nil, nil
+	}
+
+	return &TranscriptPolicy{criteria: criteria}, nil
+}
+
+// WithBiotypes returns a copy of the policy that also keeps only
+// transcripts with one of the include biotypes, if any are given, and
+// none of the exclude biotypes. Biotypes are case insensitive and can be
+// groups such as coding. The policy can be nil, in which case only the
+// biotype filter applies.
+func (policy *TranscriptPolicy) WithBiotypes(include []string, exclude []string) (*TranscriptPolicy, error) {
+	return policy.withBiotypes(include, exclude, nil, nil)
+}
+
+// WithGeneBiotypes returns a copy of the policy that also keeps only
+// genes with one of the include biotypes, if any are given, and none of
+// the exclude biotypes, as WithBiotypes does for transcripts
+func (policy *TranscriptPolicy) WithGeneBiotypes(include []string, exclude []string) (*TranscriptPolicy, error) {
+	return policy.withBiotypes(nil, nil, include, exclude)
+}
+
+func (policy *TranscriptPolicy) withBiotypes(include []string,
+	exclude []string,
+	includeGenes []string,
+	excludeGenes []string) (*TranscriptPolicy, error) {
+	ret := TranscriptPolicy{}
+
+	if policy != nil {
+		ret = *policy
+	}
+
+	var err error
+
+	for _, filter := range []struct {
+		biotypes *[]string
+		names    []string
+	}{{&ret.includeBiotypes, include},
+		{&ret.excludeBiotypes, exclude},
+		{&ret.includeGeneBiotypes, includeGenes},
+		{&ret.excludeGeneBiotypes, excludeGenes}} {
+		*filter.biotypes, err = appendBiotypes(*filter.biotypes, filter.names)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ret.criteria) == 0 && len(ret.includeBiotypes) == 0 && len(ret.excludeBiotypes) == 0 &&
+		len(ret.includeGeneBiotypes) == 0 && len(ret.excludeGeneBiotypes) == 0 {
+		return nil, nil
+	}
+
+	return &ret, nil
+}
+
+func appendBiotypes(biotypes []string, names []string) ([]string, error) {
+	// copy so policies never share a backing array
+	ret := slices.Clone(biotypes)
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if name == "" {
+			continue
+		}
+
+		if !biotypeNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid biotype: %s", name)
+		}
+
+		for _, biotype := range expandBiotypeGroup(name) {
+			if !slices.Contains(ret, biotype) {
+				ret = append(ret, biotype)
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+func (policy *TranscriptPolicy) String() string {
+	if policy == nil {
+		return ""
+	}
+
+	return strings.Join(policy.criteria, ",")
+}
+
+// MakeGeneBiotypeSql replaces the <<GENES>> placeholder in a query with
+// a predicate restricting the genes aliased as g to those with an
+// allowed biotype. A nil policy keeps all genes.
+func MakeGeneBiotypeSql(query string, policy *TranscriptPolicy, namedArgs *[]any) string {
+	if policy == nil {
+		return strings.Replace(query, "<<GENES>>", "", 1)
+	}
+
+	include := policyBiotypeNames("policy_gene_biotype", policy.includeGeneBiotypes, namedArgs)
+	exclude := policyBiotypeNames("policy_exclude_gene_biotype", policy.excludeGeneBiotypes, namedArgs)
+
+	// the unary + stops sqlite finding genes by biotype, which for
+	// common biotypes is most of them
+	return strings.Replace(query, "<<GENES>>", policyBiotypeSql("+g", include, exclude), 1)
+}
+
+// MakeTranscriptPolicySql replaces the <<GENES>> placeholder in a query
+// as MakeGeneBiotypeSql does and the <<TRANSCRIPTS>> placeholder with a
+// predicate restricting the transcripts aliased as t to those with an
+// allowed biotype and then to the one chosen by the policy criteria for
+// each gene. A nil policy keeps all genes and transcripts.
+func MakeTranscriptPolicySql(query string, policy *TranscriptPolicy, namedArgs *[]any) string {
+	query = MakeGeneBiotypeSql(query, policy, namedArgs)
+
+	if policy == nil {
+		return strings.Replace(query, "<<TRANSCRIPTS>>", "", 1)
+	}
+
+	include := policyBiotypeNames("policy_biotype", policy.includeBiotypes, namedArgs)
+	exclude := policyBiotypeNames("policy_exclude_biotype", policy.excludeBiotypes, namedArgs)
+
+	clause := policyBiotypeSql("t", include, exclude)
+
+	if len(policy.criteria) == 0 {
+		return strings.Replace(query, "<<TRANSCRIPTS>>", clause, 1)
+	}
+
+	orderBy := make([]string, 0, len(policy.criteria)+1)
+
+	tags := 0
+
+	for _, criterion := range policy.criteria {
+		switch criterion {
+		case CanonicalCriterion:
+			orderBy = append(orderBy, "pt.is_canonical DESC")
+		case LongestCriterion:
+			orderBy = append(orderBy, "pt.is_longest DESC")
+		case TslCriterion:
+			orderBy = append(orderBy, fmt.Sprintf("COALESCE(pt.tsl, %d) ASC", MissingTsl))
+		case ApprisCriterion:
+			orderBy = append(orderBy, strings.Replace(PolicyTagSql, "<<TAG>>", "ptg.name LIKE 'appris_principal%'", 1))
+		default:
+			tags++
+			ph := fmt.Sprintf("policy_tag%d", tags)
+			*namedArgs = append(*namedArgs, sql.Named(ph, policyTag(criterion)))
+			orderBy = append(orderBy, strings.Replace(PolicyTagSql, "<<TAG>>", "ptg.name = :"+ph, 1))
+		}
+	}
+
+	orderBy = append(orderBy, "pt.transcript_id")
+
+	transcriptSql := strings.Replace(PolicyTranscriptSql, "<<CRITERIA>>", strings.Join(orderBy, ",\n\t\t\t"), 1)
+	transcriptSql = strings.Replace(transcriptSql, "<<BIOTYPES>>", policyBiotypeSql("pt", include, exclude), 1)
+
+	if clause != "" {
+		clause += "\n\t\t"
+	}
+
+	clause += transcriptSql
+
+	return strings.Replace(query, "<<TRANSCRIPTS>>", clause, 1)
+}
+
+// adds the biotypes as named args, returning their placeholders
+func policyBiotypeNames(prefix string, biotypes []string, namedArgs *[]any) string {
+	placeholders := make([]string, len(biotypes))
+
+	for i, biotype := range biotypes {
+		ph := fmt.Sprintf("%s%d", prefix, i+1)
+		placeholders[i] = ":" + ph
+		*namedArgs = append(*namedArgs, sql.Named(ph, biotype))
+	}
+
+	return strings.Join(placeholders, ",")
+}
+
+// the biotype predicates for a genes or transcripts table alias
+func policyBiotypeSql(alias string, include string, exclude string) string {
+	clauses := make([]string, 0, 2)
+
+	for _, filter := range []struct {
+		op    string
+		names string
+	}{{"IN", include}, {"NOT IN", exclude}} {
+		if filter.names == "" {
+			continue
+		}
+
+		clause := strings.Replace(PolicyBiotypeSql, "<<ALIAS>>", alias, 1)
+		clause = strings.Replace(clause, "<<IN>>", filter.op, 1)
+		clause = strings.Replace(clause, "<<NAMES>>", filter.names, 1)
+
+		clauses = append(clauses, clause)
+	}
+
+	return strings.Join(clauses, "\n\t\t")
+}
+
+// HasCriteria returns true if the policy picks one transcript per gene
+// rather than only filtering transcripts by biotype
+func (policy *TranscriptPolicy) HasCriteria() bool {
+	return policy != nil && len(policy.criteria) > 0
+}
+
+// FiltersTranscripts returns true if the policy includes or excludes
+// transcripts by biotype
+func (policy *TranscriptPolicy) FiltersTranscripts() bool {
+	return policy != nil && (len(policy.includeBiotypes) > 0 || len(policy.excludeBiotypes) > 0)
+}
+
+// whether the policy needs the tags and TSL of transcripts rather than
+// just the canonical and longest flags every database has
+func (policy *TranscriptPolicy) usesTags() bool {
+	if policy == nil {
+		return false
+	}
+
+	for _, criterion := range policy.criteria {
+		if criterion != CanonicalCriterion && criterion != LongestCriterion {
+			return true
+		}
+	}
+
+	return false
+}
+
+// makeTranscriptPolicySql is MakeTranscriptPolicySql with a check that
+// the database can support the policy
+func (gdb *GtfDB) makeTranscriptPolicySql(query string, policy *TranscriptPolicy, namedArgs *[]any) (string, error) {
+	if policy.usesTags() && !gdb.hasTranscriptTags() {
+		return "", fmt.Errorf("%s does not have transcript tags required by policy %s", gdb.annotation.Name, policy)
+	}
+
+	return MakeTranscriptPolicySql(query, policy, namedArgs), nil
+}
+
+// the GTF tag a criterion refers to
+func policyTag(criterion string) string {
+	switch criterion {
+	case ManeCriterion:
+		return ManeSelectTag
+	case EnsemblCanonicalCriterion:
+		return EnsemblCanonicalTag
+	case BasicCriterion:
+		return BasicTag
+	case CcdsCriterion:
+		return CcdsTag
+	default:
+		return strings.TrimPrefix(criterion, TagCriterionPrefix)
+	}
+}
+
+// addTranscriptTags sets the tags and TSL of the transcripts in a set
+// of features, including those that are children of genes. Databases
+// created before tags were imported are left untouched.
+func (gdb *GtfDB) addTranscriptTags(features []*GenomicFeature) error {
+	if !gdb.hasTranscriptTags() {
+		return nil
+	}
+
+	transcriptMap := make(map[string][]*GenomicFeature)
+
+	var collect func(features []*GenomicFeature)
+
+	collect = func(features []*GenomicFeature) {
+		for _, feature := range features {
+			if feature.Type == TranscriptLevel {
+				transcriptMap[feature.Transcript] = append(transcriptMap[feature.Transcript], feature)
+			}
+
+			collect(feature.Children)
+		}
+	}
+
+	collect(features)
+
+	if len(transcriptMap) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(transcriptMap))
+
+	for id := range transcriptMap {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	for chunk := range slices.Chunk(ids, MaxTagQueryIds) {
+		namedArgs := make([]any, 0, len(chunk))
+
+		placeholders := make([]string, len(chunk))
+
+		for i, id := range chunk {
+			ph := fmt.Sprintf("t%d", i+1)
+			placeholders[i] = ":" + ph
+			namedArgs = append(namedArgs, sql.Named(ph, strings.ToLower(id)))
+		}
+
+		query := strings.Replace(TranscriptTagsSql,
+			"<<TRANSCRIPT_IDS>>",
+			"LOWER(t.transcript_id) IN ("+strings.Join(placeholders, ",")+")",
+			1)
+
+		err := gdb.scanTranscriptTags(query, namedArgs, transcriptMap)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (gdb *GtfDB) scanTranscriptTags(query string, namedArgs []any, transcriptMap map[string][]*GenomicFeature) error {
+	rows, err := gdb.db.Query(query, namedArgs...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var transcriptId string
+		var tsl int
+		var tag string
+
+		err := rows.Scan(&transcriptId, &tsl, &tag)
+
+		if err != nil {
+			return err
+		}
+
+		for _, feature := range transcriptMap[transcriptId] {
+			feature.Tsl = tsl
+
+			if tag != "" {
+				feature.Tags = append(feature.Tags, tag)
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+// databases created by older importers do not have transcript tags
+func (gdb *GtfDB) hasTranscriptTags() bool {
+	gdb.tagsOnce.Do(func() {
+		gdb.hasTags = gdb.hasTable("transcript_tags")
+	})
+
+	return gdb.hasTags
+}
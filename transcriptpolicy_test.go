@@ -0,0 +1,263 @@
+package genome_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+func policy(t *testing.T, s string) *genome.TranscriptPolicy {
+	t.Helper()
+
+	p, err := genome.ParseTranscriptPolicy(s)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestTranscriptPolicies(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	loc := location(t, "chr1", 1001, 12000)
+
+	for _, test := range []struct {
+		policy string
+		want   []string
+	}{
+		{"", []string{"ENST00000000001", "ENST00000000002", "ENST00000000003", "ENST00000000004"}},
+		{"mane", []string{"ENST00000000001", "ENST00000000003"}},
+		{"tag:basic,tsl", []string{"ENST00000000001", "ENST00000000003"}},
+		// a criterion no transcript matches falls through to the
+		// transcript id
+		{"tag:missing", []string{"ENST00000000001", "ENST00000000003"}},
+	} {
+		genes, err := gdb.OverlappingGenes(loc,
+			genome.TranscriptLevel,
+			dna.DefaultPromoterRegion(),
+			policy(t, test.policy),
+			false)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := transcriptIds(genes); !slices.Equal(got, test.want) {
+			t.Errorf("policy %q: transcripts = %v, want %v", test.policy, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"mane,bogus", "tag:bad tag"} {
+		if _, err := genome.ParseTranscriptPolicy(s); err == nil {
+			t.Errorf("invalid policy %q was accepted", s)
+		}
+	}
+
+	if p := policy(t, " , "); p != nil {
+		t.Errorf("empty policy = %s", p)
+	}
+}
+
+func TestTranscriptPolicyNeedsTags(t *testing.T) {
+	// made without tags as older importers did
+	gdb := openAnnotation(t, &genometest.Annotation{PublicId: "legacy",
+		Name:   "legacy",
+		File:   "legacy.db",
+		Legacy: true,
+		Genes:  genometest.Genes()})
+
+	loc := location(t, "chr1", 1001, 12000)
+
+	for _, s := range []string{"mane", "tsl", "canonical,tag:basic"} {
+		_, err := gdb.OverlappingGenes(loc, genome.TranscriptLevel, dna.DefaultPromoterRegion(), policy(t, s), false)
+
+		if err == nil {
+			t.Errorf("tag policy %q on a database without tags did not fail", s)
+		}
+	}
+
+	genes, err := gdb.OverlappingGenes(loc, genome.TranscriptLevel, dna.DefaultPromoterRegion(), policy(t, "canonical,longest"), false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := transcriptIds(genes); !slices.Equal(got, []string{"ENST00000000001", "ENST00000000003"}) {
+		t.Errorf("canonical transcripts = %v", got)
+	}
+}
+
+// criteria are applied in order, each only breaking the ties of the
+// ones before it
+func TestTranscriptPolicyOrder(t *testing.T) {
+	transcript := func(id string, end int, tsl int, canonical bool, tags ...string) *genometest.Transcript {
+		return &genometest.Transcript{Id: id,
+			Biotype:   "lncRNA",
+			Exons:     []genometest.Interval{{Start: 1001, End: end}},
+			Canonical: canonical,
+			Tsl:       tsl,
+			Tags:      tags}
+	}
+
+	// on the minus strand so each transcript has its own TSS
+	gdb := openGenes(t, []*genometest.Gene{{Id: "ENSG00000000001",
+		Symbol:  "GENEA",
+		Chr:     "chr1",
+		Strand:  "-",
+		Biotype: "lncRNA",
+		Transcripts: []*genometest.Transcript{transcript("ENST00000000001", 1100, 2, true),
+			transcript("ENST00000000002", 1200, 1, false, "basic"),
+			transcript("ENST00000000003", 1500, 0, false, "basic", "Ensembl_canonical"),
+			transcript("ENST00000000004", 1300, 1, false, "basic", "MANE_Select")}}})
+
+	tss := map[string]int{"ENST00000000001": 1100,
+		"ENST00000000002": 1200,
+		"ENST00000000003": 1500,
+		"ENST00000000004": 1300}
+
+	for _, test := range []struct {
+		policy string
+		want   string
+	}{
+		{"mane,ensembl_canonical", "ENST00000000004"},
+		{"ensembl_canonical,mane", "ENST00000000003"},
+		// ties on TSL go to the lowest id unless another criterion
+		// follows
+		{"tsl", "ENST00000000002"},
+		{"tsl,mane", "ENST00000000004"},
+		// a missing TSL sorts last
+		{"basic,tsl,longest", "ENST00000000002"},
+		{"basic,longest", "ENST00000000003"},
+		{"canonical", "ENST00000000001"},
+		{"longest", "ENST00000000003"},
+		{"tag:missing,ccds,canonical", "ENST00000000001"},
+		{"ccds", "ENST00000000001"},
+	} {
+		p := policy(t, test.policy)
+
+		genes, err := gdb.OverlappingGenes(location(t, "chr1", 1001, 2000),
+			genome.TranscriptLevel,
+			dna.DefaultPromoterRegion(),
+			p,
+			false)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := transcriptIds(genes); !slices.Equal(got, []string{test.want}) {
+			t.Errorf("policy %q: transcripts = %v, want %s", test.policy, got, test.want)
+		}
+
+		// and a gene's TSS is that of the transcript the policy picks
+		genes = tssFeatures(t, gdb, nil, genome.GeneLevel, nil, p)
+
+		if len(genes) != 1 || genes[0].Location.Start() != tss[test.want] || genes[0].Transcript != "" {
+			t.Errorf("policy %q: gene tss = %v, want %d", test.policy, tssStrings(genes), tss[test.want])
+		}
+	}
+}
+
+func TestTranscriptBiotypes(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	loc := location(t, "chr1", 1001, 12000)
+
+	genes, err := gdb.OverlappingGenes(loc, genome.GeneAndTranscriptLevels, dna.DefaultPromoterRegion(), nil, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// transcripts have their own biotype rather than the gene's
+	biotypes := make(map[string]string)
+
+	for _, gene := range genes {
+		for _, transcript := range gene.Children {
+			biotypes[transcript.Transcript] = transcript.Biotype
+		}
+	}
+
+	if biotypes["ENST00000000002"] != "nonsense_mediated_decay" || biotypes["ENST00000000004"] != "retained_intron" {
+		t.Errorf("transcript biotypes = %v", biotypes)
+	}
+
+	excludeNmd, err := (*genome.TranscriptPolicy)(nil).WithBiotypes(nil, []string{"Nonsense_Mediated_Decay"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genes, err = gdb.OverlappingGenes(loc, genome.GeneAndTranscriptLevels, dna.DefaultPromoterRegion(), excludeNmd, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 2 ||
+		!slices.Equal(transcriptIds(genes[0].Children), []string{"ENST00000000001"}) ||
+		!slices.Equal(transcriptIds(genes[1].Children), []string{"ENST00000000003", "ENST00000000004"}) {
+		t.Errorf("transcripts excluding nmd = %v", genes)
+	}
+
+	found, err := gdb.SearchByName("GENEA", genome.TranscriptLevel, excludeNmd, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 1 || !slices.Equal(transcriptIds(found[0].Children), []string{"ENST00000000001"}) {
+		t.Errorf("search excluding nmd = %v", found)
+	}
+
+	// only GENEB has a retained intron transcript so it is closest
+	// even though GENEA is nearer
+	retainedIntron, err := (*genome.TranscriptPolicy)(nil).WithBiotypes([]string{"retained_intron"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closest, err := gdb.ClosestGenes(location(t, "chr1", 5500, 5500), dna.DefaultPromoterRegion(), 5, retainedIntron, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(closest) != 1 || closest[0].Symbol != "GENEB" {
+		t.Errorf("closest retained intron genes = %v", closest)
+	}
+
+	// a biotype filter alone cannot pick a TSS for a gene
+	err = gdb.TssFeatures(nil, genome.GeneLevel, nil, excludeNmd, func(feature *genome.GenomicFeature) error {
+		return nil
+	})
+
+	if !errors.Is(err, genome.ErrGeneTssNeedsCriteria) {
+		t.Errorf("gene tss with only a biotype filter = %v", err)
+	}
+
+	// but can exclude transcripts from being picked, so GENEB falls
+	// back to the TSS of its retained intron transcript
+	proteinCoding, err := policy(t, "canonical").WithBiotypes(nil, []string{"protein_coding"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tss := tssFeatures(t, gdb, location(t, "chr1", 1, 12000), genome.GeneLevel, nil, proteinCoding)
+
+	if got := tssStrings(tss); !slices.Equal(got, []string{"GENEA:1001-1001:+", "GENEB:9200-9200:-"}) {
+		t.Errorf("gene tss excluding protein coding = %v", got)
+	}
+
+	if _, err := (*genome.TranscriptPolicy)(nil).WithBiotypes([]string{"bad biotype"}, nil); err == nil {
+		t.Error("invalid biotype was accepted")
+	}
+}
@@ -0,0 +1,139 @@
+package genome
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+//
+// Spliced mRNA, CDS and UTR sequences of transcripts
+//
+
+type (
+	// Sequences are given 5' to 3' on the strand of the transcript,
+	// i.e. reverse complemented for minus strand transcripts
+	TranscriptSequences struct {
+		Transcript *GenomicFeature `json:"transcript"`
+		Mrna       string          `json:"mrna"`
+		// coding sequence including the stop codon
+		Cds  string `json:"cds,omitempty"`
+		Utr5 string `json:"utr5,omitempty"`
+		Utr3 string `json:"utr3,omitempty"`
+	}
+)
+
+const (
+	MrnaSequence string = "mrna"
+	CdsSequence  string = "cds"
+	Utr5Sequence string = "utr5"
+	Utr3Sequence string = "utr3"
+
+	FastaLineWidth int = 60
+)
+
+// TranscriptSequences extracts the sequences of a transcript. The
+// transcript only needs its id set since its exons and coding features
+// are loaded from the database.
+func (gdb *GtfDB) TranscriptSequences(transcript *GenomicFeature, seqs SequenceReader) (*TranscriptSequences, error) {
+	model, err := gdb.TranscriptModel(transcript.Transcript)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return model.Sequences(seqs)
+}
+
+// Sequences returns the spliced mRNA of the transcript and, if it is
+// protein coding, its CDS and UTRs.
+func (model *TranscriptModel) Sequences(seqs SequenceReader) (*TranscriptSequences, error) {
+	var buffer strings.Builder
+
+	buffer.Grow(model.Length)
+
+	minusStrand := model.IsMinusStrand()
+
+	// exons are already in transcript order so each just needs to be
+	// on the right strand
+	for _, exon := range model.Exons {
+		seq, err := seqs.Sequence(exon)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if minusStrand {
+			seq = ReverseComplement(seq)
+		}
+
+		buffer.WriteString(seq)
+	}
+
+	ret := TranscriptSequences{Transcript: model.Transcript, Mrna: buffer.String()}
+
+	if model.IsCoding() {
+		// clip in case the reference is shorter than the annotation,
+		// e.g. a truncated final chromosome
+		cdsStart := min(model.cdsStart-1, len(ret.Mrna))
+		cdsEnd := min(model.cdsEnd, len(ret.Mrna))
+
+		ret.Utr5 = ret.Mrna[:cdsStart]
+		ret.Cds = ret.Mrna[cdsStart:cdsEnd]
+		ret.Utr3 = ret.Mrna[cdsEnd:]
+	}
+
+	return &ret, nil
+}
+
+// Sequence returns one of the sequence types, e.g. mrna or cds
+func (sequences *TranscriptSequences) Sequence(seqType string) string {
+	switch seqType {
+	case CdsSequence:
+		return sequences.Cds
+	case Utr5Sequence:
+		return sequences.Utr5
+	case Utr3Sequence:
+		return sequences.Utr3
+	default:
+		return sequences.Mrna
+	}
+}
+
+// WriteFasta writes one of the sequence types as FASTA with a header
+// such as >ENST00000269305|TP53|cds chr17:7668402-7687550 -
+func (sequences *TranscriptSequences) WriteFasta(w io.Writer, seqType string) error {
+	err := writeFastaHeader(w, sequences.Transcript, seqType)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFastaSequence(w, sequences.Sequence(seqType))
+}
+
+func writeFastaHeader(w io.Writer, feature *GenomicFeature, seqType string) error {
+	_, err := fmt.Fprintf(w, ">%s%s%s%s%s %s %s\n",
+		feature.Transcript,
+		FeatureSeparator,
+		feature.Symbol,
+		FeatureSeparator,
+		seqType,
+		feature.Location,
+		feature.Location.Strand())
+
+	return err
+}
+
+// write a sequence wrapped at FastaLineWidth bases per line
+func writeFastaSequence(w io.Writer, seq string) error {
+	for i := 0; i < len(seq); i += FastaLineWidth {
+		_, err := fmt.Fprintln(w, seq[i:min(i+FastaLineWidth, len(seq))])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package genome_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+// the fixture reference in a temporary FASTA file
+func openFasta(t *testing.T) genome.SequenceReader {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), genometest.FastaFile)
+
+	err := genometest.WriteFasta(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := genome.NewFastaReader(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { reader.Close() })
+
+	return reader
+}
+
+func TestTranscriptSequences(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	seqs := openFasta(t)
+
+	for _, gene := range genometest.Genes() {
+		chr := genometest.Sequence(gene.Chr)
+
+		for _, transcript := range gene.Transcripts {
+			sequences, err := gdb.TranscriptSequences(&genome.GenomicFeature{Transcript: transcript.Id}, seqs)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the exons spliced together on the strand of the gene
+			var mrna strings.Builder
+
+			for _, exon := range transcript.Exons {
+				mrna.WriteString(chr[exon.Start-1 : exon.End])
+			}
+
+			want := mrna.String()
+
+			if gene.Strand == "-" {
+				want = genome.ReverseComplement(want)
+			}
+
+			if sequences.Mrna != want {
+				t.Errorf("%s: mrna = %s..., want %s...", transcript.Id, sequences.Mrna[:20], want[:20])
+			}
+
+			if transcript.IsCoding() && sequences.Utr5+sequences.Cds+sequences.Utr3 != sequences.Mrna {
+				t.Errorf("%s: utrs and cds do not make the mrna", transcript.Id)
+			}
+
+			if cds := transcript.CodingSequence(gene.Strand); sequences.Cds != cds {
+				t.Errorf("%s: cds = %s, want %s", transcript.Id, sequences.Cds, cds)
+			}
+
+			if !transcript.IsCoding() && (sequences.Utr5 != "" || sequences.Utr3 != "") {
+				t.Errorf("%s: non-coding transcript has utrs", transcript.Id)
+			}
+		}
+	}
+
+	// the 5' UTR of GENEB is the 899 bases of its first exon, at the
+	// end of the gene, after the start codon at 11101
+	sequences, err := gdb.TranscriptSequences(&genome.GenomicFeature{Transcript: "ENST00000000003"}, seqs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sequences.Utr5) != 899 || !strings.HasPrefix(sequences.Cds, "ATG") || !strings.HasSuffix(sequences.Cds, "TAA") {
+		t.Errorf("minus strand utr5 of %d bases and cds %s...%s",
+			len(sequences.Utr5),
+			sequences.Cds[:3],
+			sequences.Cds[len(sequences.Cds)-3:])
+	}
+
+	_, err = gdb.TranscriptSequences(&genome.GenomicFeature{Transcript: "ENST00000000099"}, seqs)
+
+	if err == nil {
+		t.Error("missing transcript did not fail")
+	}
+}
+
+func TestTranscriptSequencesWriteFasta(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	sequences, err := gdb.TranscriptSequences(&genome.GenomicFeature{Transcript: "ENST00000000001"}, openFasta(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fasta strings.Builder
+
+	err = sequences.WriteFasta(&fasta, genome.CdsSequence)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(fasta.String(), "\n"), "\n")
+
+	if lines[0] != ">ENST00000000001|GENEA|cds chr1:1001-5000 +" {
+		t.Errorf("header = %q", lines[0])
+	}
+
+	if got := strings.Join(lines[1:], ""); got != sequences.Cds {
+		t.Errorf("fasta sequence = %s", got)
+	}
+
+	for _, line := range lines[1 : len(lines)-1] {
+		if len(line) != genome.FastaLineWidth {
+			t.Errorf("line of %d bases", len(line))
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package genome
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-sys/log"
+)
+
+//
+// Export of TSS points and promoter windows, either genome-wide
+// or for a region, e.g. for making BED files of promoters
+//
+
+const (
+	TssLabel string = "tss"
+
+	// Gene level TSS use the gene coordinates rather than
+	// those of individual transcripts. The region filter
+	// uses the same strand aware promoter logic as
+	// CoreLocationSql so that a region picks up the same
+	// promoters as the annotation queries.
+	GeneTssSql = `SELECT
+		g.id,
+		c.name AS chr,
+		g.start,
+		g.end,
+		g.strand,
+		g.gene_id,
+		g.symbol,
+		gt.name AS gene_biotype
+	FROM genes AS g
+	JOIN chromosomes AS c ON g.chr_id = c.id
+	JOIN biotypes AS gt ON g.biotype_id = gt.id
+	WHERE
+		<<REGION>>
+		<<GENES>>
+	ORDER BY
+		c.id,
+		CASE WHEN g.strand = '-' THEN g.end ELSE g.start END,
+		g.gene_id`
+
+	TranscriptTssSql = `SELECT
+		g.id,
+		c.name AS chr,
+		g.strand,
+		g.gene_id,
+		g.symbol,
+		gt.name AS gene_biotype,
+		t.transcript_id,
+		t.start,
+		t.end,
+		t.is_canonical,
+		t.is_longest,
+		tb.name AS transcript_biotype
+	FROM genes AS g
+	JOIN chromosomes AS c ON g.chr_id = c.id
+	JOIN transcripts AS t ON g.id = t.gene_id
+	JOIN biotypes AS gt ON g.biotype_id = gt.id
+	JOIN biotypes AS tb ON t.biotype_id = tb.id
+	WHERE
+		<<REGION>>
+		<<GENES>>
+		<<TRANSCRIPTS>>
+	ORDER BY
+		c.id,
+		CASE WHEN g.strand = '-' THEN t.end ELSE t.start END,
+		t.transcript_id`
+
+	// restrict the tss queries to windows overlapping a region, which
+	// is kept out of the queries so that genome wide exports do not
+	// stop region queries using the chr index
+	GeneTssRegionSql = `c.name = :chr AND (
+			((g.strand = '+') AND (:start <= g.start + :prom3p) AND (:end >= g.start - :prom5p)) OR
+			((g.strand = '-') AND (:start <= g.end + :prom5p) AND (:end >= g.end - :prom3p))
+		)`
+
+	TranscriptTssRegionSql = `c.name = :chr AND (
+			((g.strand = '+') AND (:start <= t.start + :prom3p) AND (:end >= t.start - :prom5p)) OR
+			((g.strand = '-') AND (:start <= t.end + :prom5p) AND (:end >= t.end - :prom3p))
+		)`
+
+	AllTssSql = `1 = 1`
+)
+
+var (
+	ErrGeneTssNeedsCriteria = errors.New("gene level tss with a transcript biotype filter need policy criteria to pick one transcript per gene")
+)
+
+// TssFeatures finds the TSS of each gene or transcript and calls fn
+// with a feature describing it. If prom is nil, the feature location
+// is the single base TSS, otherwise it is the promoter window around
+// the TSS. If location is nil, the whole genome is scanned. Features
+// are passed to fn as they are read so that genome wide exports do
+// not need to be held in memory. At transcript level the policy picks
+// one transcript per gene, or keeps all of them if it is nil. At gene
+// level with a policy, the TSS of a gene is that of the transcript the
+// policy picks rather than the gene start, so a policy that only filters
+// transcripts by biotype is an error.
+func (gdb *GtfDB) TssFeatures(location *dna.Location,
+	level string,
+	prom *dna.PromoterRegion,
+	policy *TranscriptPolicy,
+	fn func(feature *GenomicFeature) error) error {
+
+	// tss mode is just a promoter of zero width
+	window := prom
+
+	label := PromoterLabel
+
+	if window == nil {
+		window = dna.NewPromoterRegion(0, 0)
+		label = TssLabel
+	}
+
+	namedArgs := []any{sql.Named("prom5p", window.Upstream()),
+		sql.Named("prom3p", window.Downstream())}
+
+	geneRegion := AllTssSql
+	transcriptRegion := AllTssSql
+
+	if location != nil {
+		geneRegion = GeneTssRegionSql
+		transcriptRegion = TranscriptTssRegionSql
+
+		namedArgs = append(namedArgs, sql.Named("chr", location.Chr()),
+			sql.Named("start", location.Start()),
+			sql.Named("end", location.End()))
+	}
+
+	if level == GeneLevel && !policy.HasCriteria() {
+		if policy.FiltersTranscripts() {
+			return ErrGeneTssNeedsCriteria
+		}
+
+		query := MakeGeneBiotypeSql(strings.Replace(GeneTssSql, "<<REGION>>", geneRegion, 1), policy, &namedArgs)
+
+		return gdb.geneTssFeatures(query, window, label, namedArgs, fn)
+	}
+
+	query := strings.Replace(TranscriptTssSql, "<<REGION>>", transcriptRegion, 1)
+
+	query, err := gdb.makeTranscriptPolicySql(query, policy, &namedArgs)
+
+	if err != nil {
+		return err
+	}
+
+	return gdb.transcriptTssFeatures(query, level, window, label, namedArgs, fn)
+}
+
+func (gdb *GtfDB) geneTssFeatures(query string,
+	prom *dna.PromoterRegion,
+	label string,
+	namedArgs []any,
+	fn func(feature *GenomicFeature) error) error {
+
+	rows, err := gdb.db.Query(query, namedArgs...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	var gid int
+	var chr string
+	var geneStart int
+	var geneEnd int
+	var strand string
+	var geneId string
+	var geneSymbol string
+	var geneBiotype string
+
+	for rows.Next() {
+		err := rows.Scan(&gid,
+			&chr,
+			&geneStart,
+			&geneEnd,
+			&strand,
+			&geneId,
+			&geneSymbol,
+			&geneBiotype)
+
+		if err != nil {
+			log.Error().Msgf("error reading tss rows %s", err)
+			return err
+		}
+
+		location, err := TssWindow(chr, geneStart, geneEnd, strand, prom)
+
+		if err != nil {
+			return err
+		}
+
+		err = fn(&GenomicFeature{Id: gid,
+			Location: location,
+			Type:     GeneLevel,
+			Label:    label,
+			Symbol:   geneSymbol,
+			GeneId:   geneId,
+			Biotype:  geneBiotype,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// transcriptTssFeatures reads the TSS of transcripts, describing them
+// as genes at gene level
+func (gdb *GtfDB) transcriptTssFeatures(query string,
+	level string,
+	prom *dna.PromoterRegion,
+	label string,
+	namedArgs []any,
+	fn func(feature *GenomicFeature) error) error {
+
+	rows, err := gdb.db.Query(query, namedArgs...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	var gid int
+	var chr string
+	var strand string
+	var geneId string
+	var geneSymbol string
+	var geneBiotype string
+	var transcriptId string
+	var transcriptStart int
+	var transcriptEnd int
+	var isCanonical bool
+	var isLongest bool
+	var transcriptBiotype string
+
+	for rows.Next() {
+		err := rows.Scan(&gid,
+			&chr,
+			&strand,
+			&geneId,
+			&geneSymbol,
+			&geneBiotype,
+			&transcriptId,
+			&transcriptStart,
+			&transcriptEnd,
+			&isCanonical,
+			&isLongest,
+			&transcriptBiotype)
+
+		if err != nil {
+			log.Error().Msgf("error reading tss rows %s", err)
+			return err
+		}
+
+		location, err := TssWindow(chr, transcriptStart, transcriptEnd, strand, prom)
+
+		if err != nil {
+			return err
+		}
+
+		feature := &GenomicFeature{Id: gid,
+			Location: location,
+			Type:     GeneLevel,
+			Label:    label,
+			Symbol:   geneSymbol,
+			GeneId:   geneId,
+			Biotype:  geneBiotype,
+		}
+
+		if level != GeneLevel {
+			feature.Type = TranscriptLevel
+			feature.Biotype = transcriptBiotype
+			feature.Transcript = transcriptId
+			feature.IsCanonical = isCanonical
+			feature.IsLongest = isLongest
+		}
+
+		err = fn(feature)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// TssWindow returns the promoter window around the TSS of a feature
+// spanning start to end. On the minus strand the TSS is the end
+// coordinate and upstream is to the right, so the window is flipped.
+func TssWindow(chr string, start int, end int, strand string, prom *dna.PromoterRegion) (*dna.Location, error) {
+	var s int
+	var e int
+
+	if strand == "-" {
+		s = end - prom.Downstream()
+		e = end + prom.Upstream()
+	} else {
+		s = start - prom.Upstream()
+		e = start + prom.Downstream()
+	}
+
+	// windows near the start of a chromosome cannot go below 1
+	return dna.NewStrandedLocation(chr, max(1, s), max(1, e), strand)
+}
+
+// WriteBed writes a feature as a BED6 line. Locations are 1-based
+// so the start must be shifted to be 0-based for BED.
+func WriteBed(w io.Writer, feature *GenomicFeature) error {
+	name := feature.Symbol
+
+	if feature.Transcript != "" {
+		name += FeatureSeparator + feature.Transcript
+	} else if feature.GeneId != "" {
+		name += FeatureSeparator + feature.GeneId
+	}
+
+	_, err := fmt.Fprintf(w, "%s\t%d\t%d\t%s\t0\t%s\n",
+		feature.Location.Chr(),
+		feature.Location.Start()-1,
+		feature.Location.End(),
+		name,
+		feature.Location.Strand())
+
+	return err
+}
@@ -0,0 +1,275 @@
+package genome_test
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-dna"
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+func tssFeatures(t *testing.T,
+	gdb *genome.GtfDB,
+	loc *dna.Location,
+	level string,
+	prom *dna.PromoterRegion,
+	policy *genome.TranscriptPolicy) []*genome.GenomicFeature {
+	t.Helper()
+
+	features := make([]*genome.GenomicFeature, 0, 10)
+
+	err := gdb.TssFeatures(loc, level, prom, policy, func(feature *genome.GenomicFeature) error {
+		features = append(features, feature)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return features
+}
+
+// features as name:start-end:strand
+func tssStrings(features []*genome.GenomicFeature) []string {
+	ret := make([]string, 0, len(features))
+
+	for _, feature := range features {
+		name := feature.Transcript
+
+		if name == "" {
+			name = feature.Symbol
+		}
+
+		ret = append(ret, fmt.Sprintf("%s:%d-%d:%s", name, feature.Location.Start(), feature.Location.End(), feature.Location.Strand()))
+	}
+
+	return ret
+}
+
+func TestTssWindow(t *testing.T) {
+	prom := dna.NewPromoterRegion(2000, 1000)
+	tss := dna.NewPromoterRegion(0, 0)
+
+	for _, tc := range []struct {
+		start  int
+		end    int
+		strand string
+		prom   *dna.PromoterRegion
+		want   string
+	}{
+		{5001, 9000, "+", prom, "3001-6001:+"},
+		// upstream is to the right of the end on the minus strand
+		{5001, 9000, "-", prom, "8000-11000:-"},
+		{5001, 9000, "+", tss, "5001-5001:+"},
+		{5001, 9000, "-", tss, "9000-9000:-"},
+		// windows are clamped at the start of the chromosome
+		{1001, 5000, "+", prom, "1-2001:+"},
+		{100, 500, "-", prom, "1-2500:-"},
+	} {
+		loc, err := genome.TssWindow("chr1", tc.start, tc.end, tc.strand, tc.prom)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := fmt.Sprintf("%d-%d:%s", loc.Start(), loc.End(), loc.Strand()); loc.Chr() != "chr1" || got != tc.want {
+			t.Errorf("%d-%d:%s = %s, want %s", tc.start, tc.end, tc.strand, got, tc.want)
+		}
+	}
+}
+
+func TestWriteBed(t *testing.T) {
+	plus, err := genome.TssWindow("chr1", 1001, 5000, "+", dna.NewPromoterRegion(2000, 1000))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	minus, err := genome.TssWindow("chr1", 8001, 12000, "-", dna.NewPromoterRegion(0, 0))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+
+	for _, feature := range []*genome.GenomicFeature{
+		{Location: plus, Type: genome.TranscriptLevel, Symbol: "GENEA", GeneId: "ENSG00000000001", Transcript: "ENST00000000001"},
+		{Location: minus, Type: genome.GeneLevel, Symbol: "GENEB", GeneId: "ENSG00000000002"},
+	} {
+		err := genome.WriteBed(&buffer, feature)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// BED starts are 0-based
+	want := "chr1\t0\t2001\tGENEA|ENST00000000001\t0\t+\n" +
+		"chr1\t11999\t12000\tGENEB|ENSG00000000002\t0\t-\n"
+
+	if got := buffer.String(); got != want {
+		t.Errorf("bed = %q, want %q", got, want)
+	}
+}
+
+func TestTssFeatures(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	tss := tssFeatures(t, gdb, nil, genome.TranscriptLevel, nil, nil)
+
+	// ordered by chromosome then TSS, which is the end of minus
+	// strand transcripts
+	want := []string{"ENST00000000001:1001-1001:+",
+		"ENST00000000002:1001-1001:+",
+		"ENST00000000004:9200-9200:-",
+		"ENST00000000003:12000-12000:-",
+		"ENST00000000005:20001-20001:+",
+		"ENST00000000006:30001-30001:+",
+		"ENST00000000007:7000-7000:-"}
+
+	if got := tssStrings(tss); !slices.Equal(got, want) {
+		t.Errorf("tss = %v, want %v", got, want)
+	}
+
+	if tss[0].Label != genome.TssLabel || tss[0].Symbol != "GENEA" || !tss[0].IsCanonical {
+		t.Errorf("tss feature = %+v", tss[0])
+	}
+
+	canonical := tssFeatures(t, gdb, nil, genome.TranscriptLevel, nil, genome.CanonicalPolicy)
+
+	if got := transcriptIds(canonical); !slices.Equal(got, []string{"ENST00000000001",
+		"ENST00000000003",
+		"ENST00000000005",
+		"ENST00000000006",
+		"ENST00000000007"}) {
+		t.Errorf("canonical tss = %v", got)
+	}
+
+	genes := tssFeatures(t, gdb, nil, genome.GeneLevel, nil, nil)
+
+	if got := tssStrings(genes); !slices.Equal(got, []string{"GENEA:1001-1001:+",
+		"GENEB:12000-12000:-",
+		"ENSG00000000003:20001-20001:+",
+		"GENED:30001-30001:+",
+		"GENEE:7000-7000:-"}) {
+		t.Errorf("gene tss = %v", got)
+	}
+}
+
+// a region finds the same windows as filtering the genome wide export
+func TestTssFeaturesRegion(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	prom := dna.NewPromoterRegion(2000, 1000)
+
+	for _, level := range []string{genome.GeneLevel, genome.TranscriptLevel} {
+		all := tssFeatures(t, gdb, nil, level, prom, nil)
+
+		for _, region := range []*dna.Location{location(t, "chr1", 2001, 2001),
+			location(t, "chr1", 2002, 2100),
+			location(t, "chr1", 11200, 11200),
+			location(t, "chr1", 11201, 11300),
+			location(t, "chr1", 1, 40000),
+			location(t, "chr2", 6000, 6000)} {
+			want := make([]string, 0, len(all))
+
+			for _, feature := range all {
+				if feature.Location.Chr() == region.Chr() &&
+					feature.Location.Start() <= region.End() &&
+					feature.Location.End() >= region.Start() {
+					want = append(want, tssStrings([]*genome.GenomicFeature{feature})...)
+				}
+			}
+
+			features := tssFeatures(t, gdb, region, level, prom, nil)
+
+			if got := tssStrings(features); !slices.Equal(got, want) {
+				t.Errorf("%s %s = %v, want %v", level, region, got, want)
+			}
+
+			for _, feature := range features {
+				if feature.Label != genome.PromoterLabel {
+					t.Errorf("%s label = %s", feature.Symbol, feature.Label)
+				}
+			}
+		}
+	}
+}
+
+// with a policy a gene's TSS is that of the transcript it picks
+func TestGeneTssCanonical(t *testing.T) {
+	gdb := openGenes(t, []*genometest.Gene{{Id: "ENSG00000000001",
+		Symbol:  "GENEA",
+		Chr:     "chr1",
+		Strand:  "+",
+		Biotype: "lncRNA",
+		Transcripts: []*genometest.Transcript{{Id: "ENST00000000001",
+			Biotype: "lncRNA",
+			Exons:   []genometest.Interval{{Start: 1001, End: 1200}, {Start: 1501, End: 2000}}},
+			{Id: "ENST00000000002",
+				Biotype:   "lncRNA",
+				Exons:     []genometest.Interval{{Start: 1301, End: 2500}},
+				Canonical: true}}},
+		{Id: "ENSG00000000002",
+			Symbol:  "GENEB",
+			Chr:     "chr1",
+			Strand:  "-",
+			Biotype: "lncRNA",
+			Transcripts: []*genometest.Transcript{{Id: "ENST00000000003",
+				Biotype:   "lncRNA",
+				Exons:     []genometest.Interval{{Start: 5001, End: 5500}},
+				Canonical: true},
+				{Id: "ENST00000000004",
+					Biotype: "lncRNA",
+					Exons:   []genometest.Interval{{Start: 5001, End: 6000}}}}}})
+
+	prom := dna.NewPromoterRegion(100, 50)
+
+	if got := tssStrings(tssFeatures(t, gdb, nil, genome.GeneLevel, prom, nil)); !slices.Equal(got,
+		[]string{"GENEA:901-1051:+", "GENEB:5950-6100:-"}) {
+		t.Errorf("gene tss = %v", got)
+	}
+
+	genes := tssFeatures(t, gdb, nil, genome.GeneLevel, prom, genome.CanonicalPolicy)
+
+	if got := tssStrings(genes); !slices.Equal(got, []string{"GENEA:1201-1351:+", "GENEB:5450-5600:-"}) {
+		t.Errorf("canonical gene tss = %v", got)
+	}
+
+	for _, gene := range genes {
+		if gene.Type != genome.GeneLevel || gene.Transcript != "" || gene.GeneId == "" {
+			t.Errorf("canonical gene tss = %+v", gene)
+		}
+	}
+
+	// and a region finds genes by their canonical TSS
+	for _, region := range []struct {
+		loc  *dna.Location
+		want []string
+	}{{location(t, "chr1", 1000, 1000), []string{}},
+		{location(t, "chr1", 1300, 1300), []string{"GENEA:1201-1351:+"}}} {
+		if got := tssStrings(tssFeatures(t, gdb, region.loc, genome.GeneLevel, prom, genome.CanonicalPolicy)); !slices.Equal(got, region.want) {
+			t.Errorf("%s = %v, want %v", region.loc, got, region.want)
+		}
+	}
+}
+
+// gene biotype filters need no transcript to be picked
+func TestGeneTssBiotypes(t *testing.T) {
+	gdb := openGenes(t, genometest.Genes())
+
+	lncRNA, err := (*genome.TranscriptPolicy)(nil).WithGeneBiotypes([]string{"lncRNA"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tssStrings(tssFeatures(t, gdb, nil, genome.GeneLevel, nil, lncRNA)); !slices.Equal(got, []string{"ENSG00000000003:20001-20001:+"}) {
+		t.Errorf("lncRNA gene tss = %v", got)
+	}
+}
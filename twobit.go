@@ -0,0 +1,256 @@
+package genome
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/antonybholmes/go-dna"
+)
+
+//
+// Reader for UCSC 2bit files, see
+// https://genome.ucsc.edu/FAQ/FAQformat.html#format7
+//
+
+type (
+	twoBitRecord struct {
+		// blocks of Ns as 0-based starts and sizes
+		nBlockStarts []uint32
+		nBlockSizes  []uint32
+		offset       int64
+		dnaOffset    int64
+		length       int
+		loaded       bool
+	}
+
+	TwoBitReader struct {
+		file    *os.File
+		order   binary.ByteOrder
+		records map[string]*twoBitRecord
+		lock    sync.Mutex
+	}
+)
+
+const twoBitSignature uint32 = 0x1A412743
+
+var (
+	ErrInvalidTwoBit = errors.New("invalid 2bit file")
+
+	twoBitBases = [4]byte{'T', 'C', 'A', 'G'}
+)
+
+func NewTwoBitReader(path string) (*TwoBitReader, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader := TwoBitReader{file: file, records: make(map[string]*twoBitRecord)}
+
+	err = reader.readIndex()
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &reader, nil
+}
+
+func (reader *TwoBitReader) readIndex() error {
+	header := make([]byte, 16)
+
+	_, err := io.ReadFull(reader.file, header)
+
+	if err != nil {
+		return err
+	}
+
+	// the signature tells us the byte order
+	switch {
+	case binary.LittleEndian.Uint32(header) == twoBitSignature:
+		reader.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == twoBitSignature:
+		reader.order = binary.BigEndian
+	default:
+		return ErrInvalidTwoBit
+	}
+
+	// version 1 uses 64-bit offsets
+	version := reader.order.Uint32(header[4:])
+
+	if version > 1 {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidTwoBit, version)
+	}
+
+	count := reader.order.Uint32(header[8:])
+
+	offsetSize := 4
+
+	if version == 1 {
+		offsetSize = 8
+	}
+
+	buf := make([]byte, 256)
+
+	for range count {
+		_, err := io.ReadFull(reader.file, buf[:1])
+
+		if err != nil {
+			return err
+		}
+
+		nameSize := int(buf[0])
+
+		_, err = io.ReadFull(reader.file, buf[:nameSize+offsetSize])
+
+		if err != nil {
+			return err
+		}
+
+		name := string(buf[:nameSize])
+
+		var offset int64
+
+		if version == 1 {
+			offset = int64(reader.order.Uint64(buf[nameSize:]))
+		} else {
+			offset = int64(reader.order.Uint32(buf[nameSize:]))
+		}
+
+		reader.records[name] = &twoBitRecord{offset: offset}
+	}
+
+	return nil
+}
+
+// read the sequence header on first use so opening a file with
+// many sequences is cheap
+func (reader *TwoBitReader) loadRecord(record *twoBitRecord) error {
+	reader.lock.Lock()
+	defer reader.lock.Unlock()
+
+	if record.loaded {
+		return nil
+	}
+
+	pos := record.offset
+
+	readUint32s := func(n int) ([]uint32, error) {
+		buf := make([]byte, 4*n)
+
+		_, err := reader.file.ReadAt(buf, pos)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pos += int64(len(buf))
+
+		ret := make([]uint32, n)
+
+		for i := range n {
+			ret[i] = reader.order.Uint32(buf[4*i:])
+		}
+
+		return ret, nil
+	}
+
+	v, err := readUint32s(2)
+
+	if err != nil {
+		return err
+	}
+
+	record.length = int(v[0])
+	nBlockCount := int(v[1])
+
+	record.nBlockStarts, err = readUint32s(nBlockCount)
+
+	if err != nil {
+		return err
+	}
+
+	record.nBlockSizes, err = readUint32s(nBlockCount)
+
+	if err != nil {
+		return err
+	}
+
+	v, err = readUint32s(1)
+
+	if err != nil {
+		return err
+	}
+
+	// skip the mask blocks and the reserved word, we only return
+	// upper case sequence
+	pos += int64(8*v[0]) + 4
+
+	record.dnaOffset = pos
+	record.loaded = true
+
+	return nil
+}
+
+func (reader *TwoBitReader) Sequence(location *dna.Location) (string, error) {
+	record, ok := lookupChr(reader.records, location.Chr())
+
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrChrNotFound, location.Chr())
+	}
+
+	err := reader.loadRecord(record)
+
+	if err != nil {
+		return "", err
+	}
+
+	// 0-based half open
+	start := location.Start() - 1
+	end := min(location.End(), record.length)
+
+	if start >= end {
+		return "", fmt.Errorf("%s is outside of the sequence", location)
+	}
+
+	// 4 bases are packed into each byte
+	firstByte := start / 4
+	lastByte := (end - 1) / 4
+
+	buf := make([]byte, lastByte-firstByte+1)
+
+	_, err = reader.file.ReadAt(buf, record.dnaOffset+int64(firstByte))
+
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	seq := make([]byte, end-start)
+
+	for i := start; i < end; i++ {
+		b := buf[i/4-firstByte]
+		shift := 6 - 2*(i%4)
+		seq[i-start] = twoBitBases[(b>>shift)&3]
+	}
+
+	for i, blockStart := range record.nBlockStarts {
+		s := max(int(blockStart), start)
+		e := min(int(blockStart+record.nBlockSizes[i]), end)
+
+		for p := s; p < e; p++ {
+			seq[p-start] = 'N'
+		}
+	}
+
+	return string(seq), nil
+}
+
+func (reader *TwoBitReader) Close() error {
+	return reader.file.Close()
+}
@@ -0,0 +1,842 @@
+package genome
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/antonybholmes/go-dna"
+)
+
+//
+// Sequence Ontology consequences and HGVS notation for variants using
+// the transcript models of a GtfDB and a local reference sequence
+//
+
+type (
+	TranscriptConsequence struct {
+		Allele       string   `json:"allele"`
+		Symbol       string   `json:"symbol"`
+		GeneId       string   `json:"geneId"`
+		Transcript   string   `json:"transcript"`
+		Biotype      string   `json:"biotype,omitempty"`
+		HgvsC        string   `json:"hgvsc,omitempty"`
+		HgvsP        string   `json:"hgvsp,omitempty"`
+		Consequences []string `json:"consequences"`
+		Distance     int      `json:"distance,omitempty"`
+	}
+
+	VariantAnnotation struct {
+		Variant      *Variant                 `json:"variant"`
+		Consequences []*TranscriptConsequence `json:"consequences"`
+		// the VCF ref does not match the reference sequence
+		RefMismatch bool `json:"refMismatch,omitempty"`
+	}
+
+	VariantAnnotator struct {
+		GtfDB *GtfDB
+		Seqs  SequenceReader
+		// cache models since VCFs are sorted so neighboring
+		// variants hit the same transcripts
+		models map[string]*TranscriptModel
+		// how far upstream/downstream of a transcript to report
+		UpstreamDist int
+	}
+
+	// a variant reduced to the bases that change
+	trimmedVariant struct {
+		ref   string
+		alt   string
+		start int
+		end   int
+	}
+)
+
+const (
+	SpliceAcceptorVariant          string = "splice_acceptor_variant"
+	SpliceDonorVariant             string = "splice_donor_variant"
+	StopGained                     string = "stop_gained"
+	FrameshiftVariant              string = "frameshift_variant"
+	StopLost                       string = "stop_lost"
+	StartLost                      string = "start_lost"
+	InframeInsertion               string = "inframe_insertion"
+	InframeDeletion                string = "inframe_deletion"
+	MissenseVariant                string = "missense_variant"
+	SpliceRegionVariant            string = "splice_region_variant"
+	SynonymousVariant              string = "synonymous_variant"
+	CodingSequenceVariant          string = "coding_sequence_variant"
+	FivePrimeUtrVariant            string = "5_prime_UTR_variant"
+	ThreePrimeUtrVariant           string = "3_prime_UTR_variant"
+	NonCodingTranscriptExonVariant string = "non_coding_transcript_exon_variant"
+	IntronVariant                  string = "intron_variant"
+	UpstreamGeneVariant            string = "upstream_gene_variant"
+	DownstreamGeneVariant          string = "downstream_gene_variant"
+
+	DefaultUpstreamDist int = 5000
+
+	maxCachedModels int = 1000
+
+	// bases of reference read at a time when shifting indels
+	shiftWindow int = 100
+)
+
+var (
+	// most to least severe so consequences can be ordered
+	consequenceOrder = []string{
+		SpliceAcceptorVariant,
+		SpliceDonorVariant,
+		StopGained,
+		FrameshiftVariant,
+		StopLost,
+		StartLost,
+		InframeInsertion,
+		InframeDeletion,
+		MissenseVariant,
+		SpliceRegionVariant,
+		SynonymousVariant,
+		CodingSequenceVariant,
+		FivePrimeUtrVariant,
+		ThreePrimeUtrVariant,
+		NonCodingTranscriptExonVariant,
+		IntronVariant,
+		UpstreamGeneVariant,
+		DownstreamGeneVariant,
+	}
+)
+
+func NewVariantAnnotator(gtfdb *GtfDB, seqs SequenceReader) *VariantAnnotator {
+	return &VariantAnnotator{GtfDB: gtfdb,
+		Seqs:         seqs,
+		UpstreamDist: DefaultUpstreamDist,
+		models:       make(map[string]*TranscriptModel)}
+}
+
+// Annotate finds the consequences of a variant on every transcript
+// within UpstreamDist of it.
+func (annotator *VariantAnnotator) Annotate(variant *Variant) (*VariantAnnotation, error) {
+	annotation := VariantAnnotation{Variant: variant,
+		Consequences: make([]*TranscriptConsequence, 0, 10)}
+
+	if variant.IsSymbolic() {
+		return &annotation, nil
+	}
+
+	start, end, ref, alt := variant.Trim()
+
+	tv := trimmedVariant{start: start, end: end, ref: ref, alt: alt}
+
+	chr := ucscChr(variant.Chr)
+
+	// check the vcf agrees with the reference
+	if len(ref) > 0 {
+		location, err := dna.NewLocation(chr, start, end)
+
+		if err != nil {
+			return nil, err
+		}
+
+		seq, err := annotator.Seqs.Sequence(location)
+
+		if err != nil {
+			return nil, err
+		}
+
+		annotation.RefMismatch = seq != ref
+	}
+
+	// insertions have end < start
+	searchLocation, err := dna.NewLocation(chr,
+		max(1, min(start, end)-annotator.UpstreamDist),
+		max(start, end)+annotator.UpstreamDist)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transcripts, err := annotator.GtfDB.OverlappingGenes(searchLocation,
+		TranscriptLevel,
+		dna.DefaultPromoterRegion(),
+		nil,
+		false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, transcript := range transcripts {
+		model, err := annotator.transcriptModel(transcript.Transcript)
+
+		if err != nil {
+			return nil, err
+		}
+
+		consequence, err := annotator.transcriptConsequence(model, &tv)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if consequence != nil {
+			consequence.Allele = variant.Alt
+			annotation.Consequences = append(annotation.Consequences, consequence)
+		}
+	}
+
+	return &annotation, nil
+}
+
+func (annotator *VariantAnnotator) transcriptModel(transcriptId string) (*TranscriptModel, error) {
+	model, ok := annotator.models[transcriptId]
+
+	if ok {
+		return model, nil
+	}
+
+	model, err := annotator.GtfDB.TranscriptModel(transcriptId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// crude, but keeps memory bounded for large VCFs
+	if len(annotator.models) >= maxCachedModels {
+		clear(annotator.models)
+	}
+
+	annotator.models[transcriptId] = model
+
+	return model, nil
+}
+
+func (annotator *VariantAnnotator) transcriptConsequence(model *TranscriptModel, tv *trimmedVariant) (*TranscriptConsequence, error) {
+	transcript := model.Transcript
+	minusStrand := model.IsMinusStrand()
+
+	ret := TranscriptConsequence{Symbol: transcript.Symbol,
+		GeneId:       transcript.GeneId,
+		Transcript:   transcript.Transcript,
+		Biotype:      transcript.Biotype,
+		Consequences: make([]string, 0, 3)}
+
+	// the span of bases touched, which for an insertion are the
+	// two flanking bases
+	s := min(tv.start, tv.end)
+	e := max(tv.start, tv.end)
+
+	ts := transcript.Location.Start()
+	te := transcript.Location.End()
+
+	// outside the transcript
+	if e < ts || s > te {
+		upstream := (!minusStrand && e < ts) || (minusStrand && s > te)
+
+		if upstream {
+			ret.Consequences = append(ret.Consequences, UpstreamGeneVariant)
+		} else {
+			ret.Consequences = append(ret.Consequences, DownstreamGeneVariant)
+		}
+
+		if e < ts {
+			ret.Distance = ts - e
+		} else {
+			ret.Distance = s - te
+		}
+
+		if ret.Distance > annotator.UpstreamDist {
+			return nil, nil
+		}
+
+		return &ret, nil
+	}
+
+	ret.Consequences = append(ret.Consequences, spliceConsequences(model, s, e)...)
+
+	exonic := overlapsAny(model.Exons, s, e, tv.ref == "")
+
+	if exonic {
+		switch {
+		case !model.IsCoding():
+			ret.Consequences = append(ret.Consequences, NonCodingTranscriptExonVariant)
+		case overlapsAny(model.CodingRegions(), s, e, tv.ref == ""):
+			consequences, hgvsp, err := annotator.codingConsequences(model, tv)
+
+			if err != nil {
+				return nil, err
+			}
+
+			ret.Consequences = append(ret.Consequences, consequences...)
+			ret.HgvsP = hgvsp
+		default:
+			// which side of the cds are we on
+			index, _ := model.genomicToIndex(tv.start)
+
+			if index < model.CdsStart() {
+				ret.Consequences = append(ret.Consequences, FivePrimeUtrVariant)
+			} else {
+				ret.Consequences = append(ret.Consequences, ThreePrimeUtrVariant)
+			}
+		}
+	} else if !slices.Contains(ret.Consequences, IntronVariant) {
+		ret.Consequences = append(ret.Consequences, IntronVariant)
+	}
+
+	ret.Consequences = sortConsequences(ret.Consequences)
+
+	hgvsc, err := annotator.hgvsC(model, tv)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret.HgvsC = hgvsc
+
+	return &ret, nil
+}
+
+// splice site and region consequences for the bases s to e
+func spliceConsequences(model *TranscriptModel, s int, e int) []string {
+	ret := make([]string, 0, 2)
+
+	minusStrand := model.IsMinusStrand()
+
+	add := func(consequence string) {
+		if !slices.Contains(ret, consequence) {
+			ret = append(ret, consequence)
+		}
+	}
+
+	overlaps := func(a int, b int) bool {
+		return s <= b && e >= a
+	}
+
+	for i, exon := range model.Exons[:len(model.Exons)-1] {
+		next := model.Exons[i+1]
+
+		// genomic intron coordinates
+		var is int
+		var ie int
+
+		if minusStrand {
+			is = next.End() + 1
+			ie = exon.Start() - 1
+		} else {
+			is = exon.End() + 1
+			ie = next.Start() - 1
+		}
+
+		if ie < is {
+			continue
+		}
+
+		// donor is at the 5' end of the intron in the direction
+		// of transcription
+		if minusStrand {
+			if overlaps(ie-1, ie) {
+				add(SpliceDonorVariant)
+			}
+
+			if overlaps(is, is+1) {
+				add(SpliceAcceptorVariant)
+			}
+		} else {
+			if overlaps(is, is+1) {
+				add(SpliceDonorVariant)
+			}
+
+			if overlaps(ie-1, ie) {
+				add(SpliceAcceptorVariant)
+			}
+		}
+
+		// 1-3 bases into the exon or 3-8 bases into the intron
+		if overlaps(is-3, is-1) || overlaps(is+2, is+7) || overlaps(ie-7, ie-2) || overlaps(ie+1, ie+3) {
+			add(SpliceRegionVariant)
+		}
+
+		if overlaps(is, ie) {
+			add(IntronVariant)
+		}
+	}
+
+	return ret
+}
+
+// does s to e overlap any of the locations. For insertions, s and
+// e are the flanking bases which must both be in the same location
+func overlapsAny(locations []*dna.Location, s int, e int, insertion bool) bool {
+	for _, location := range locations {
+		if insertion {
+			if s >= location.Start() && e <= location.End() {
+				return true
+			}
+		} else if s <= location.End() && e >= location.Start() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply the variant to the coding sequence and compare the proteins
+func (annotator *VariantAnnotator) codingConsequences(model *TranscriptModel, tv *trimmedVariant) ([]string, string, error) {
+	regions := model.CodingRegions()
+
+	// work in genomic order and reverse complement at the end
+	genomicRegions := slices.Clone(regions)
+	sortTranscriptOrder(genomicRegions, false)
+
+	var buffer strings.Builder
+
+	offset := -1
+	cum := 0
+
+	for _, region := range genomicRegions {
+		seq, err := annotator.Seqs.Sequence(region)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		// the variant must be entirely within one coding region for us
+		// to say what happens to the protein
+		var inRegion bool
+
+		if tv.ref == "" {
+			// both flanking bases of an insertion must be coding
+			inRegion = tv.start > region.Start() && tv.start <= region.End()
+		} else {
+			inRegion = tv.start >= region.Start() && tv.end <= region.End()
+		}
+
+		if inRegion {
+			offset = cum + tv.start - region.Start()
+		}
+
+		buffer.WriteString(seq)
+		cum += len(seq)
+	}
+
+	if offset == -1 {
+		return []string{CodingSequenceVariant}, "", nil
+	}
+
+	refCds := buffer.String()
+	altCds := refCds[:offset] + tv.alt + refCds[offset+len(tv.ref):]
+
+	// position of the first changed base in the cds
+	cdsPos := offset
+
+	if model.IsMinusStrand() {
+		refCds = ReverseComplement(refCds)
+		altCds = ReverseComplement(altCds)
+		cdsPos = len(refCds) - offset - len(tv.ref)
+	}
+
+	table := CodonTableForChr(model.Transcript.Location.Chr())
+
+	refProtein := table.TranslateCds(refCds)
+	altProtein := table.TranslateCds(altCds)
+
+	// 0-based amino acid affected
+	aaIndex := cdsPos / 3
+
+	lenDiff := len(tv.alt) - len(tv.ref)
+
+	switch {
+	case aaIndex == 0 && strings.HasPrefix(refProtein, "M") && !strings.HasPrefix(altProtein, "M"):
+		return []string{StartLost}, "p.Met1?", nil
+	case lenDiff%3 != 0:
+		i := firstDifference(refProtein, altProtein)
+
+		if i >= len(refProtein) {
+			return []string{FrameshiftVariant}, "", nil
+		}
+
+		return []string{FrameshiftVariant}, fmt.Sprintf("p.%s%dfs", AminoAcidName(refProtein[i]), i+1), nil
+	case refProtein == altProtein:
+		if aaIndex < len(refProtein) {
+			return []string{SynonymousVariant}, fmt.Sprintf("p.%s%d=", AminoAcidName(refProtein[aaIndex]), aaIndex+1), nil
+		}
+
+		return []string{SynonymousVariant}, "", nil
+	}
+
+	i := firstDifference(refProtein, altProtein)
+
+	// premature stop
+	if i < len(altProtein) && altProtein[i] == StopAminoAcid && i < len(refProtein) && refProtein[i] != StopAminoAcid {
+		return []string{StopGained}, fmt.Sprintf("p.%s%dTer", AminoAcidName(refProtein[i]), i+1), nil
+	}
+
+	// the stop codon was changed to something else
+	if i < len(refProtein) && refProtein[i] == StopAminoAcid {
+		if i >= len(altProtein) {
+			return []string{StopLost}, fmt.Sprintf("p.Ter%d?", i+1), nil
+		}
+
+		return []string{StopLost}, fmt.Sprintf("p.Ter%d%sext*?", i+1, AminoAcidName(altProtein[i])), nil
+	}
+
+	consequence := MissenseVariant
+
+	if lenDiff > 0 {
+		consequence = InframeInsertion
+	} else if lenDiff < 0 {
+		consequence = InframeDeletion
+	}
+
+	return []string{consequence}, proteinChange(refProtein, altProtein), nil
+}
+
+func firstDifference(a string, b string) int {
+	n := min(len(a), len(b))
+
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	return n
+}
+
+// proteinChange describes the difference between two proteins of the
+// same frame in HGVS p. notation
+func proteinChange(ref string, alt string) string {
+	p := firstDifference(ref, alt)
+
+	// common suffix, not overlapping the prefix
+	s := 0
+
+	for s < len(ref)-p && s < len(alt)-p && ref[len(ref)-1-s] == alt[len(alt)-1-s] {
+		s++
+	}
+
+	r := ref[p : len(ref)-s]
+	a := alt[p : len(alt)-s]
+
+	aa := func(i int) string {
+		return AminoAcidName(ref[i]) + strconv.Itoa(i+1)
+	}
+
+	switch {
+	case len(r) == 1 && len(a) == 1:
+		return "p." + aa(p) + AminoAcidName(a[0])
+	case len(r) == 0:
+		if p == 0 || p >= len(ref) {
+			return "p.?"
+		}
+
+		// the inserted residues repeat those before them
+		if p >= len(a) && ref[p-len(a):p] == a {
+			span := aa(p - len(a))
+
+			if len(a) > 1 {
+				span += "_" + aa(p-1)
+			}
+
+			return "p." + span + "dup"
+		}
+
+		return "p." + aa(p-1) + "_" + aa(p) + "ins" + ThreeLetterProtein(a)
+	}
+
+	span := aa(p)
+
+	if len(r) > 1 {
+		span += "_" + aa(p+len(r)-1)
+	}
+
+	if len(a) == 0 {
+		return "p." + span + "del"
+	}
+
+	return "p." + span + "delins" + ThreeLetterProtein(a)
+}
+
+// the exon or intron containing the bases s to e, in genomic order,
+// so that indels are never shifted across a splice site
+func featureBounds(model *TranscriptModel, s int, e int) (int, int, bool) {
+	exons := slices.Clone(model.Exons)
+	sortTranscriptOrder(exons, false)
+
+	for i, exon := range exons {
+		if s >= exon.Start() && e <= exon.End() {
+			return exon.Start(), exon.End(), true
+		}
+
+		if i < len(exons)-1 && s > exon.End() && e < exons[i+1].Start() {
+			return exon.End() + 1, exons[i+1].Start() - 1, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// shiftIndel moves an insertion or deletion as far 3' as it will go in
+// the transcript orientation, which on the minus strand is to the left
+// of the genome, without leaving the exon or intron it is in
+func (annotator *VariantAnnotator) shiftIndel(model *TranscriptModel, tv *trimmedVariant) (*trimmedVariant, error) {
+	if (tv.ref == "") == (tv.alt == "") {
+		return tv, nil
+	}
+
+	// the flanking bases of an insertion must stay in the feature
+	s := min(tv.start, tv.end)
+	e := max(tv.start, tv.end)
+
+	fs, fe, ok := featureBounds(model, s, e)
+
+	if !ok {
+		return tv, nil
+	}
+
+	chr := model.Transcript.Location.Chr()
+
+	// read the reference in windows rather than a whole intron at a time
+	var window string
+	ws := 0
+
+	base := func(pos int) (byte, error) {
+		if pos < ws || pos >= ws+len(window) {
+			ws = max(fs, pos-shiftWindow+1)
+			we := min(fe, pos+shiftWindow-1)
+
+			location, err := dna.NewLocation(chr, ws, we)
+
+			if err != nil {
+				return 0, err
+			}
+
+			window, err = annotator.Seqs.Sequence(location)
+
+			if err != nil {
+				return 0, err
+			}
+
+			if len(window) != we-ws+1 {
+				return 0, fmt.Errorf("%s: expected %d bases", location, we-ws+1)
+			}
+		}
+
+		return window[pos-ws], nil
+	}
+
+	ret := *tv
+	bases := tv.ref
+
+	if bases == "" {
+		bases = tv.alt
+	}
+
+	n := len(bases) - 1
+
+	for {
+		var pos int
+
+		if model.IsMinusStrand() {
+			pos = ret.start - 1
+		} else if ret.ref == "" {
+			pos = ret.start
+		} else {
+			pos = ret.end + 1
+		}
+
+		// an insertion is between start - 1 and start so both must
+		// remain in the feature after the shift
+		if pos < fs || pos > fe || (ret.ref == "" && (pos == fs || pos == fe)) {
+			break
+		}
+
+		b, err := base(pos)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if model.IsMinusStrand() {
+			if b != bases[n] {
+				break
+			}
+
+			bases = bases[n:] + bases[:n]
+			ret.start--
+			ret.end--
+		} else {
+			if b != bases[0] {
+				break
+			}
+
+			bases = bases[1:] + bases[:1]
+			ret.start++
+			ret.end++
+		}
+	}
+
+	if ret.ref == "" {
+		ret.alt = bases
+	} else {
+		ret.ref = bases
+	}
+
+	return &ret, nil
+}
+
+// isDup tests whether an insertion repeats the bases immediately 5' of
+// it in the transcript and returns their genomic span
+func (annotator *VariantAnnotator) isDup(model *TranscriptModel, tv *trimmedVariant) (int, int, bool, error) {
+	n := len(tv.alt)
+
+	s := tv.start - n
+	e := tv.start - 1
+
+	if model.IsMinusStrand() {
+		s = tv.start
+		e = tv.start + n - 1
+	}
+
+	fs, fe, ok := featureBounds(model, s, e)
+
+	if !ok || s < fs || e > fe {
+		return 0, 0, false, nil
+	}
+
+	location, err := dna.NewLocation(model.Transcript.Location.Chr(), s, e)
+
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	seq, err := annotator.Seqs.Sequence(location)
+
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return s, e, seq == tv.alt, nil
+}
+
+// hgvsC describes the variant in c. notation for coding transcripts
+// and n. notation otherwise. Insertions and deletions are shifted 3'
+// first and insertions that repeat the preceding bases are duplications.
+func (annotator *VariantAnnotator) hgvsC(model *TranscriptModel, tv *trimmedVariant) (string, error) {
+	coord := func(pos int) (*Coord, error) {
+		if model.IsCoding() {
+			return model.GenomicToCoding(pos)
+		}
+
+		return model.GenomicToTranscript(pos), nil
+	}
+
+	tv, err := annotator.shiftIndel(model, tv)
+
+	if err != nil {
+		return "", err
+	}
+
+	ref := tv.ref
+	alt := tv.alt
+
+	// 5' and 3' genomic ends of the change in transcript order
+	first := tv.start
+	last := tv.end
+
+	dup := false
+
+	if tv.ref == "" {
+		// flanking bases of the insertion
+		first = tv.start - 1
+		last = tv.start
+
+		s, e, ok, err := annotator.isDup(model, tv)
+
+		if err != nil {
+			return "", err
+		}
+
+		if ok {
+			first = s
+			last = e
+			dup = true
+		}
+	}
+
+	if model.IsMinusStrand() {
+		ref = ReverseComplement(ref)
+		alt = ReverseComplement(alt)
+		first, last = last, first
+	}
+
+	c1, err := coord(first)
+
+	if err != nil {
+		return "", err
+	}
+
+	c2, err := coord(last)
+
+	if err != nil {
+		return "", err
+	}
+
+	span := c1.String()
+
+	if first != last {
+		span += "_" + c2.PosString()
+	}
+
+	switch {
+	case dup:
+		return span + "dup", nil
+	case len(ref) == 1 && len(alt) == 1:
+		return span + ref + ">" + alt, nil
+	case ref == "":
+		return span + "ins" + alt, nil
+	case alt == "":
+		return span + "del", nil
+	default:
+		return span + "delins" + alt, nil
+	}
+}
+
+func sortConsequences(consequences []string) []string {
+	slices.SortFunc(consequences, func(a, b string) int {
+		return slices.Index(consequenceOrder, a) - slices.Index(consequenceOrder, b)
+	})
+
+	return consequences
+}
+
+// GENCODE uses UCSC style chromosome names whereas many VCFs use
+// Ensembl style names
+func ucscChr(chr string) string {
+	if strings.HasPrefix(chr, "chr") {
+		return chr
+	}
+
+	if chr == "MT" {
+		return "chrM"
+	}
+
+	return "chr" + chr
+}
+
+// CsqString formats the consequence for the VCF CSQ INFO field
+func (consequence *TranscriptConsequence) CsqString() string {
+	distance := ""
+
+	if consequence.Distance > 0 {
+		distance = strconv.Itoa(consequence.Distance)
+	}
+
+	return strings.Join([]string{consequence.Allele,
+		strings.Join(consequence.Consequences, "&"),
+		consequence.Symbol,
+		consequence.GeneId,
+		consequence.Transcript,
+		consequence.Biotype,
+		consequence.HgvsC,
+		consequence.HgvsP,
+		distance}, "|")
+}
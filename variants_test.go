@@ -0,0 +1,236 @@
+package genome_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+type variantCase struct {
+	pos          int
+	ref          string
+	alt          string
+	transcript   string
+	consequences []string
+	hgvsc        string
+	hgvsp        string
+	distance     int
+}
+
+func variantAnnotator(t *testing.T) *genome.VariantAnnotator {
+	t.Helper()
+
+	fixture := genometest.New(t)
+
+	genomeDb := genome.NewGenomeDB(fixture.Catalog)
+
+	gdb, err := genomeDb.GtfFromId(genometest.GtfId)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seqs, err := genomeDb.SequenceFromAssembly(genometest.Assembly)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { seqs.Close() })
+
+	return genome.NewVariantAnnotator(gdb, seqs)
+}
+
+// a base other than the reference at pos
+func otherBase(chr string, pos int) (string, string) {
+	ref := genometest.Sequence(chr)[pos-1 : pos]
+
+	if ref == "A" {
+		return ref, "C"
+	}
+
+	return ref, "A"
+}
+
+func transcriptConsequence(t *testing.T, annotator *genome.VariantAnnotator, variant *genome.Variant, transcript string) *genome.TranscriptConsequence {
+	t.Helper()
+
+	annotation, err := annotator.Annotate(variant)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if annotation.RefMismatch {
+		t.Fatalf("%+v does not match the reference", variant)
+	}
+
+	for _, consequence := range annotation.Consequences {
+		if consequence.Transcript == transcript {
+			return consequence
+		}
+	}
+
+	t.Fatalf("%+v: no consequence for %s", variant, transcript)
+
+	return nil
+}
+
+func checkVariants(t *testing.T, annotator *genome.VariantAnnotator, chr string, cases []variantCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		ref := tc.ref
+		alt := tc.alt
+		hgvsc := tc.hgvsc
+
+		// snvs of the random background are described by their c.
+		// coordinate and we add the bases
+		if ref == "" {
+			ref, alt = otherBase(chr, tc.pos)
+
+			if hgvsc != "" {
+				stranded := ref + ">" + alt
+
+				if slices.Contains([]string{"ENST00000000003", "ENST00000000004"}, tc.transcript) {
+					stranded = genome.ReverseComplement(ref) + ">" + genome.ReverseComplement(alt)
+				}
+
+				hgvsc += stranded
+			}
+		}
+
+		variant := &genome.Variant{Chr: chr, Pos: tc.pos, Ref: ref, Alt: alt}
+
+		consequence := transcriptConsequence(t, annotator, variant, tc.transcript)
+
+		if !slices.Equal(consequence.Consequences, tc.consequences) ||
+			consequence.HgvsC != hgvsc ||
+			consequence.HgvsP != tc.hgvsp ||
+			consequence.Distance != tc.distance {
+			t.Errorf("%d %s>%s %s = %v %s %s %d, want %v %s %s %d", tc.pos, ref, alt, tc.transcript,
+				consequence.Consequences, consequence.HgvsC, consequence.HgvsP, consequence.Distance,
+				tc.consequences, hgvsc, tc.hgvsp, tc.distance)
+		}
+	}
+}
+
+func TestPlusStrandConsequences(t *testing.T) {
+	annotator := variantAnnotator(t)
+
+	// GENEA ENST00000000001 has exons 1001-1200, 2001-2300 and
+	// 4001-5000 with the cds from 1101 to 4101, which starts
+	// ATG GCT CGA AAC GAT TGC and ends with TAA
+	checkVariants(t, annotator, "chr1", []variantCase{
+		{pos: 990, transcript: "ENST00000000001", consequences: []string{genome.UpstreamGeneVariant}, distance: 11},
+		{pos: 1050, transcript: "ENST00000000001", consequences: []string{genome.FivePrimeUtrVariant}, hgvsc: "c.-51"},
+		{pos: 1050, transcript: "ENST00000000002", consequences: []string{genome.NonCodingTranscriptExonVariant}, hgvsc: "n.50"},
+		{pos: 1201, transcript: "ENST00000000001", consequences: []string{genome.SpliceDonorVariant, genome.IntronVariant}, hgvsc: "c.100+1"},
+		{pos: 1205, transcript: "ENST00000000001", consequences: []string{genome.SpliceRegionVariant, genome.IntronVariant}, hgvsc: "c.100+5"},
+		{pos: 1500, transcript: "ENST00000000001", consequences: []string{genome.IntronVariant}, hgvsc: "c.100+300"},
+		{pos: 2000, transcript: "ENST00000000001", consequences: []string{genome.SpliceAcceptorVariant, genome.IntronVariant}, hgvsc: "c.101-1"},
+		{pos: 4500, transcript: "ENST00000000001", consequences: []string{genome.ThreePrimeUtrVariant}, hgvsc: "c.*399"},
+		{pos: 5010, transcript: "ENST00000000001", consequences: []string{genome.DownstreamGeneVariant}, distance: 10},
+
+		{pos: 1101, ref: "A", alt: "G", transcript: "ENST00000000001", consequences: []string{genome.StartLost}, hgvsc: "c.1A>G", hgvsp: "p.Met1?"},
+		{pos: 1104, ref: "G", alt: "A", transcript: "ENST00000000001", consequences: []string{genome.MissenseVariant}, hgvsc: "c.4G>A", hgvsp: "p.Ala2Thr"},
+		{pos: 1106, ref: "T", alt: "C", transcript: "ENST00000000001", consequences: []string{genome.SynonymousVariant}, hgvsc: "c.6T>C", hgvsp: "p.Ala2="},
+		{pos: 1118, ref: "C", alt: "A", transcript: "ENST00000000001", consequences: []string{genome.StopGained}, hgvsc: "c.18C>A", hgvsp: "p.Cys6Ter"},
+		{pos: 4100, ref: "A", alt: "C", transcript: "ENST00000000001", consequences: []string{genome.StopLost}, hgvsc: "c.500A>C", hgvsp: "p.Ter167Serext*?"},
+
+		// the A of c.9 to c.11 is deleted and shifted to the 3' end
+		{pos: 1108, ref: "GA", alt: "G", transcript: "ENST00000000001", consequences: []string{genome.FrameshiftVariant}, hgvsc: "c.11del", hgvsp: "p.Asn4fs"},
+		// an extra or missing T in the TT of c.15 and c.16
+		{pos: 1114, ref: "A", alt: "AT", transcript: "ENST00000000001", consequences: []string{genome.FrameshiftVariant}, hgvsc: "c.16dup", hgvsp: "p.Cys6fs"},
+		{pos: 1114, ref: "AT", alt: "A", transcript: "ENST00000000001", consequences: []string{genome.FrameshiftVariant}, hgvsc: "c.16del", hgvsp: "p.Cys6fs"},
+		// in frame
+		{pos: 1106, ref: "T", alt: "TGCT", transcript: "ENST00000000001", consequences: []string{genome.InframeInsertion}, hgvsc: "c.4_6dup", hgvsp: "p.Ala2dup"},
+		{pos: 1106, ref: "TCGA", alt: "T", transcript: "ENST00000000001", consequences: []string{genome.InframeDeletion}, hgvsc: "c.7_9del", hgvsp: "p.Arg3del"},
+		{pos: 1106, ref: "T", alt: "TAAA", transcript: "ENST00000000001", consequences: []string{genome.InframeInsertion}, hgvsc: "c.6_7insAAA", hgvsp: "p.Ala2_Arg3insLys"},
+	})
+}
+
+func TestMinusStrandConsequences(t *testing.T) {
+	annotator := variantAnnotator(t)
+
+	// GENEB ENST00000000003 has exons 11001-12000, 9001-9200 and
+	// 8001-8500 with the cds from 11101 down to 8400, so the genome
+	// has the complement of ATG GCT CGA AAC GAT TGC reading left
+	checkVariants(t, annotator, "chr1", []variantCase{
+		{pos: 12010, transcript: "ENST00000000003", consequences: []string{genome.UpstreamGeneVariant}, distance: 10},
+		{pos: 11500, transcript: "ENST00000000003", consequences: []string{genome.FivePrimeUtrVariant}, hgvsc: "c.-399"},
+		{pos: 11000, transcript: "ENST00000000003", consequences: []string{genome.SpliceDonorVariant, genome.IntronVariant}, hgvsc: "c.101+1"},
+		{pos: 10996, transcript: "ENST00000000003", consequences: []string{genome.SpliceRegionVariant, genome.IntronVariant}, hgvsc: "c.101+5"},
+		{pos: 10000, transcript: "ENST00000000003", consequences: []string{genome.IntronVariant}, hgvsc: "c.102-800"},
+		{pos: 9201, transcript: "ENST00000000003", consequences: []string{genome.SpliceAcceptorVariant, genome.IntronVariant}, hgvsc: "c.102-1"},
+		{pos: 8200, transcript: "ENST00000000003", consequences: []string{genome.ThreePrimeUtrVariant}, hgvsc: "c.*200"},
+		{pos: 7990, transcript: "ENST00000000003", consequences: []string{genome.DownstreamGeneVariant}, distance: 11},
+
+		{pos: 11101, ref: "T", alt: "C", transcript: "ENST00000000003", consequences: []string{genome.StartLost}, hgvsc: "c.1A>G", hgvsp: "p.Met1?"},
+		{pos: 11098, ref: "C", alt: "T", transcript: "ENST00000000003", consequences: []string{genome.MissenseVariant}, hgvsc: "c.4G>A", hgvsp: "p.Ala2Thr"},
+		{pos: 11096, ref: "A", alt: "G", transcript: "ENST00000000003", consequences: []string{genome.SynonymousVariant}, hgvsc: "c.6T>C", hgvsp: "p.Ala2="},
+		{pos: 11084, ref: "G", alt: "T", transcript: "ENST00000000003", consequences: []string{genome.StopGained}, hgvsc: "c.18C>A", hgvsp: "p.Cys6Ter"},
+		{pos: 8401, ref: "T", alt: "G", transcript: "ENST00000000003", consequences: []string{genome.StopLost}, hgvsc: "c.401A>C", hgvsp: "p.Ter134Serext*?"},
+
+		// c.15 and c.16 are the AA at 11087 and 11086, so the minus
+		// strand shifts genomically left
+		{pos: 11085, ref: "C", alt: "CA", transcript: "ENST00000000003", consequences: []string{genome.FrameshiftVariant}, hgvsc: "c.16dup", hgvsp: "p.Cys6fs"},
+		{pos: 11085, ref: "CA", alt: "C", transcript: "ENST00000000003", consequences: []string{genome.FrameshiftVariant}, hgvsc: "c.16del", hgvsp: "p.Cys6fs"},
+		{pos: 11087, ref: "AT", alt: "T", transcript: "ENST00000000003", consequences: []string{genome.FrameshiftVariant}, hgvsc: "c.16del", hgvsp: "p.Cys6fs"},
+		// c.4 to c.6 GCT at 11098 down to 11096
+		{pos: 11095, ref: "G", alt: "GAGC", transcript: "ENST00000000003", consequences: []string{genome.InframeInsertion}, hgvsc: "c.4_6dup", hgvsp: "p.Ala2dup"},
+	})
+}
+
+func TestAnnotateVariants(t *testing.T) {
+	annotator := variantAnnotator(t)
+
+	// symbolic alleles are not annotated
+	for _, alt := range []string{"<DEL>", "*", ".", "A[chr2:100["} {
+		annotation, err := annotator.Annotate(&genome.Variant{Chr: "chr1", Pos: 1104, Ref: "G", Alt: alt})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(annotation.Consequences) != 0 {
+			t.Errorf("%s: %+v", alt, annotation.Consequences)
+		}
+	}
+
+	// Ensembl style chromosomes and a ref that does not match
+	annotation, err := annotator.Annotate(&genome.Variant{Chr: "1", Pos: 1104, Ref: "C", Alt: "A"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !annotation.RefMismatch {
+		t.Errorf("ref mismatch not found")
+	}
+
+	// every transcript within UpstreamDist is annotated
+	consequence := transcriptConsequence(t, annotator, &genome.Variant{Chr: "1", Pos: 1104, Ref: "G", Alt: "A"}, "ENST00000000002")
+
+	if !slices.Equal(consequence.Consequences, []string{genome.NonCodingTranscriptExonVariant}) || consequence.HgvsC != "n.104G>A" {
+		t.Errorf("ENST00000000002 = %+v", consequence)
+	}
+
+	if got := consequence.CsqString(); got != "A|non_coding_transcript_exon_variant|GENEA|ENSG00000000001|ENST00000000002|nonsense_mediated_decay|n.104G>A||" {
+		t.Errorf("csq = %s", got)
+	}
+
+	annotator.UpstreamDist = 5
+
+	annotation, err = annotator.Annotate(&genome.Variant{Chr: "chr1", Pos: 990, Ref: "A", Alt: "C"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(annotation.Consequences) != 0 {
+		t.Errorf("beyond upstream distance: %+v", annotation.Consequences)
+	}
+}
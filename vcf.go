@@ -0,0 +1,208 @@
+package genome
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//
+// Minimal VCF reading and writing for variant annotation
+//
+
+type (
+	Variant struct {
+		Chr string `json:"chr"`
+		Id  string `json:"id,omitempty"`
+		Ref string `json:"ref"`
+		Alt string `json:"alt"`
+		Pos int    `json:"pos"`
+	}
+
+	// A VCF data line with one variant per alt allele
+	VcfRecord struct {
+		Fields   []string
+		Variants []*Variant
+	}
+
+	VcfReader struct {
+		scanner *bufio.Scanner
+		// the meta and column header lines, including the #
+		Header []string
+		// first data line seen whilst reading the header
+		pending string
+	}
+)
+
+const (
+	VcfChrCol   = 0
+	VcfPosCol   = 1
+	VcfIdCol    = 2
+	VcfRefCol   = 3
+	VcfAltCol   = 4
+	VcfInfoCol  = 7
+	VcfMinCols  = 8
+	VcfMissing  = "."
+	CsqInfoName = "CSQ"
+
+	CsqFormat = "Allele|Consequence|SYMBOL|Gene|Feature|BIOTYPE|HGVSc|HGVSp|DISTANCE"
+
+	CsqHeader = `##INFO=<ID=CSQ,Number=.,Type=String,Description="Consequence annotations. Format: ` +
+		CsqFormat + `">`
+)
+
+// NewVcfReader reads the header of a VCF immediately so that it is
+// available before the records are read.
+func NewVcfReader(r io.Reader) (*VcfReader, error) {
+	scanner := bufio.NewScanner(r)
+
+	// INFO fields can make for very long lines
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+
+	reader := VcfReader{scanner: scanner, Header: make([]string, 0, 100)}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if !strings.HasPrefix(line, "#") {
+			reader.pending = line
+			break
+		}
+
+		reader.Header = append(reader.Header, line)
+	}
+
+	return &reader, scanner.Err()
+}
+
+// Next returns the next record or io.EOF when there are no more
+func (reader *VcfReader) Next() (*VcfRecord, error) {
+	for {
+		var line string
+
+		if reader.pending != "" {
+			line = reader.pending
+			reader.pending = ""
+		} else {
+			if !reader.scanner.Scan() {
+				err := reader.scanner.Err()
+
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, io.EOF
+			}
+
+			line = reader.scanner.Text()
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		return ParseVcfLine(line)
+	}
+}
+
+func ParseVcfLine(line string) (*VcfRecord, error) {
+	fields := strings.Split(line, "\t")
+
+	if len(fields) < VcfMinCols {
+		return nil, fmt.Errorf("vcf line has too few columns: %s", line)
+	}
+
+	pos, err := strconv.Atoi(fields[VcfPosCol])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid vcf position: %s", fields[VcfPosCol])
+	}
+
+	alts := strings.Split(fields[VcfAltCol], ",")
+
+	record := VcfRecord{Fields: fields, Variants: make([]*Variant, 0, len(alts))}
+
+	for _, alt := range alts {
+		record.Variants = append(record.Variants, &Variant{Chr: fields[VcfChrCol],
+			Pos: pos,
+			Id:  fields[VcfIdCol],
+			Ref: strings.ToUpper(fields[VcfRefCol]),
+			Alt: strings.ToUpper(alt)})
+	}
+
+	return &record, nil
+}
+
+// AddInfo adds a key=value to the INFO column
+func (record *VcfRecord) AddInfo(key string, value string) {
+	entry := key + "=" + value
+
+	if record.Fields[VcfInfoCol] == VcfMissing || record.Fields[VcfInfoCol] == "" {
+		record.Fields[VcfInfoCol] = entry
+	} else {
+		record.Fields[VcfInfoCol] += ";" + entry
+	}
+}
+
+func (record *VcfRecord) String() string {
+	return strings.Join(record.Fields, "\t")
+}
+
+// AnnotatedVcfHeader returns a copy of a header with the CSQ INFO
+// definition added before the column header line
+func AnnotatedVcfHeader(header []string) []string {
+	ret := make([]string, 0, len(header)+1)
+
+	added := false
+
+	for _, line := range header {
+		if !added && strings.HasPrefix(line, "#CHROM") {
+			ret = append(ret, CsqHeader)
+			added = true
+		}
+
+		ret = append(ret, line)
+	}
+
+	if !added {
+		ret = append(ret, CsqHeader)
+	}
+
+	return ret
+}
+
+// IsSymbolic returns true for alleles we cannot annotate such as
+// <DEL>, breakends or the * spanning deletion allele
+func (variant *Variant) IsSymbolic() bool {
+	return variant.Alt == "*" ||
+		variant.Alt == VcfMissing ||
+		strings.ContainsAny(variant.Alt, "<>[]")
+}
+
+// Trim removes the bases shared by ref and alt, e.g. the padding base
+// VCF uses for indels. It returns the genomic span of the remaining
+// ref bases and the remaining ref and alt. For insertions the ref is
+// empty and end = start - 1, i.e. the insertion is between end and
+// start.
+func (variant *Variant) Trim() (int, int, string, string) {
+	ref := variant.Ref
+	alt := variant.Alt
+
+	// trim the suffix first so that indels remain left aligned
+	for len(ref) > 0 && len(alt) > 0 && ref[len(ref)-1] == alt[len(alt)-1] {
+		ref = ref[:len(ref)-1]
+		alt = alt[:len(alt)-1]
+	}
+
+	start := variant.Pos
+
+	for len(ref) > 0 && len(alt) > 0 && ref[0] == alt[0] {
+		ref = ref[1:]
+		alt = alt[1:]
+		start++
+	}
+
+	return start, start + len(ref) - 1, ref, alt
+}
@@ -0,0 +1,150 @@
+package genome_test
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/antonybholmes/go-genome"
+)
+
+const testVcf = `##fileformat=VCFv4.2
+##contig=<ID=chr1>
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+chr1	1104	rs1	g	A,C,<DEL>	.	PASS	.
+
+chr1	1114	.	A	AT,*	50	PASS	DP=10
+# a stray comment
+1	1118	rs2	C	A	.	.	DP=3;AF=0.5
+`
+
+func TestVcfReader(t *testing.T) {
+	reader, err := genome.NewVcfReader(strings.NewReader(testVcf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reader.Header) != 3 || !strings.HasPrefix(reader.Header[2], "#CHROM") {
+		t.Fatalf("header = %v", reader.Header)
+	}
+
+	records := make([]*genome.VcfRecord, 0, 3)
+
+	for {
+		record, err := reader.Next()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		records = append(records, record)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+
+	// one variant per alt allele, upper cased
+	variants := records[0].Variants
+
+	want := []genome.Variant{{Chr: "chr1", Pos: 1104, Id: "rs1", Ref: "G", Alt: "A"},
+		{Chr: "chr1", Pos: 1104, Id: "rs1", Ref: "G", Alt: "C"},
+		{Chr: "chr1", Pos: 1104, Id: "rs1", Ref: "G", Alt: "<DEL>"}}
+
+	if len(variants) != len(want) {
+		t.Fatalf("got %d variants, want %d", len(variants), len(want))
+	}
+
+	for i, variant := range variants {
+		if *variant != want[i] {
+			t.Errorf("variant %d = %+v, want %+v", i, variant, want[i])
+		}
+
+		if variant.IsSymbolic() != (i == 2) {
+			t.Errorf("%s symbolic = %v", variant.Alt, variant.IsSymbolic())
+		}
+	}
+
+	if alts := []string{records[1].Variants[0].Alt, records[1].Variants[1].Alt}; !slices.Equal(alts, []string{"AT", "*"}) ||
+		!records[1].Variants[1].IsSymbolic() {
+		t.Errorf("alts = %v", alts)
+	}
+
+	// info is added to whatever is already there
+	records[0].AddInfo(genome.CsqInfoName, "a")
+	records[1].AddInfo(genome.CsqInfoName, "b")
+
+	if got := records[0].String(); got != "chr1\t1104\trs1\tg\tA,C,<DEL>\t.\tPASS\tCSQ=a" {
+		t.Errorf("record = %q", got)
+	}
+
+	if got := records[1].Fields[genome.VcfInfoCol]; got != "DP=10;CSQ=b" {
+		t.Errorf("info = %q", got)
+	}
+
+	header := genome.AnnotatedVcfHeader(reader.Header)
+
+	if len(header) != 4 || header[2] != genome.CsqHeader || header[3] != reader.Header[2] {
+		t.Errorf("annotated header = %v", header)
+	}
+
+	// a vcf with no header at all
+	reader, err = genome.NewVcfReader(strings.NewReader("chr1\t1\t.\tA\tC\t.\t.\t.\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := reader.Next()
+
+	if err != nil || len(reader.Header) != 0 || record.Variants[0].Alt != "C" {
+		t.Errorf("headerless = %+v, %v", record, err)
+	}
+
+	if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	if header := genome.AnnotatedVcfHeader(nil); !slices.Equal(header, []string{genome.CsqHeader}) {
+		t.Errorf("empty annotated header = %v", header)
+	}
+
+	for _, line := range []string{"chr1\t1104\t.\tG\tA", "chr1\tx\t.\tG\tA\t.\t.\t."} {
+		if record, err := genome.ParseVcfLine(line); err == nil {
+			t.Errorf("%q = %+v", line, record)
+		}
+	}
+}
+
+func TestVariantTrim(t *testing.T) {
+	for _, tc := range []struct {
+		variant genome.Variant
+		start   int
+		end     int
+		ref     string
+		alt     string
+	}{
+		{genome.Variant{Pos: 100, Ref: "G", Alt: "A"}, 100, 100, "G", "A"},
+		// vcf padding bases
+		{genome.Variant{Pos: 100, Ref: "A", Alt: "AT"}, 101, 100, "", "T"},
+		{genome.Variant{Pos: 100, Ref: "AT", Alt: "A"}, 101, 101, "T", ""},
+		// shared bases at both ends of a multi-allelic record
+		{genome.Variant{Pos: 100, Ref: "ACGT", Alt: "AGGT"}, 101, 101, "C", "G"},
+		{genome.Variant{Pos: 100, Ref: "ACGT", Alt: "AT"}, 101, 102, "CG", ""},
+		// the suffix is trimmed first so repeats stay left aligned
+		{genome.Variant{Pos: 100, Ref: "ATT", Alt: "AT"}, 101, 101, "T", ""},
+	} {
+		start, end, ref, alt := tc.variant.Trim()
+
+		if start != tc.start || end != tc.end || ref != tc.ref || alt != tc.alt {
+			t.Errorf("%+v = %d %d %q %q", tc.variant, start, end, ref, alt)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package genome
+
+import (
+	"slices"
+	"strings"
+)
+
+//
+// Versions of Ensembl ids, e.g. 21 for ENSG00000136997.21. The importer
+// strips them from ids so that ids match with any version or none, and
+// keeps them apart so that the version in the annotation can be given.
+//
+
+const (
+	IdVersionsSql = `SELECT v.stable_id, v.version
+		FROM id_versions AS v
+		WHERE v.stable_id IN (<<IDS>>)`
+)
+
+// databases created by older importers do not have versions
+func (gdb *GtfDB) hasIdVersions() bool {
+	gdb.versionsOnce.Do(func() {
+		gdb.hasVersions = gdb.hasTable("id_versions")
+	})
+
+	return gdb.hasVersions
+}
+
+// splitIdVersion splits an id into the id without its version and the
+// version, e.g. ENSG00000136997 and 21 for ENSG00000136997.21. The
+// version is empty if the id does not have one.
+func splitIdVersion(id string) (string, string) {
+	loc := idVersionRegex.FindStringIndex(id)
+
+	if loc == nil {
+		return id, ""
+	}
+
+	return StripIdVersion(id), strings.TrimSuffix(id[loc[0]+1:loc[1]], "_PAR_Y")
+}
+
+// AddVersions sets the version of the gene, transcript or exon id of
+// each feature and of their children
+func (gdb *GtfDB) AddVersions(features []*GenomicFeature) error {
+	if !gdb.hasIdVersions() {
+		return nil
+	}
+
+	versioned := versionedFeatures(features, make(map[string][]*GenomicFeature))
+
+	ids := make([]string, 0, len(versioned))
+
+	for id := range versioned {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	for chunk := range slices.Chunk(ids, MaxTagQueryIds) {
+		query, namedArgs := inSql(IdVersionsSql, "v", chunk)
+
+		err := gdb.idVersions(query, namedArgs, versioned)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (gdb *GtfDB) idVersions(query string, namedArgs []any, versioned map[string][]*GenomicFeature) error {
+	rows, err := gdb.db.Query(query, namedArgs...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var version string
+
+		err := rows.Scan(&id, &version)
+
+		if err != nil {
+			return err
+		}
+
+		for _, feature := range versioned[id] {
+			feature.Version = version
+		}
+	}
+
+	return rows.Err()
+}
+
+// AddVersions sets versions as GtfDB.AddVersions does
+func (mdb *MemGeneDB) AddVersions(features []*GenomicFeature) error {
+	var exons map[string]string
+
+	for id, versioned := range versionedFeatures(features, make(map[string][]*GenomicFeature)) {
+		lower := strings.ToLower(id)
+
+		for _, feature := range versioned {
+			switch feature.Type {
+			case GeneLevel:
+				if gene, ok := mdb.genes[lower]; ok {
+					feature.Version = gene.Version
+				}
+			case TranscriptLevel:
+				if ref, ok := mdb.transcripts[lower]; ok {
+					feature.Version = ref.transcript.Version
+				}
+			case ExonLevel:
+				if exons == nil {
+					exons = mdb.exonVersions()
+				}
+
+				feature.Version = exons[lower]
+			}
+		}
+	}
+
+	return nil
+}
+
+// the versions of all exons by lower case id
+func (mdb *MemGeneDB) exonVersions() map[string]string {
+	ret := make(map[string]string, len(mdb.transcripts)*5)
+
+	for _, gene := range mdb.symbolGenes {
+		for _, transcript := range gene.Transcripts {
+			for _, feature := range transcript.Features {
+				if feature.Type == ExonLevel {
+					ret[strings.ToLower(feature.ExonId)] = feature.ExonVersion
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+// the gene, transcript or exon id of a feature by its level
+func featureId(feature *GenomicFeature) string {
+	switch feature.Type {
+	case GeneLevel:
+		return feature.GeneId
+	case TranscriptLevel:
+		return feature.Transcript
+	case ExonLevel:
+		return feature.Exon
+	default:
+		return ""
+	}
+}
+
+// the genes, transcripts and exons in features and their children
+// by id
+func versionedFeatures(features []*GenomicFeature, ret map[string][]*GenomicFeature) map[string][]*GenomicFeature {
+	for _, feature := range features {
+		if id := featureId(feature); id != "" {
+			ret[id] = append(ret[id], feature)
+		}
+
+		versionedFeatures(feature.Children, ret)
+	}
+
+	return ret
+}
+
+// the first feature whose gene, transcript or exon id is id, ignoring case
+func findFeatureById(features []*GenomicFeature, id string) *GenomicFeature {
+	for _, feature := range features {
+		if strings.EqualFold(featureId(feature), id) {
+			return feature
+		}
+
+		if found := findFeatureById(feature.Children, id); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// matchVersions sets the versions of features if search is a versioned
+// id and flags the features with that id but a different version
+func matchVersions(addVersions func(features []*GenomicFeature) error, features []*GenomicFeature, search string) error {
+	id, version := splitIdVersion(strings.TrimSpace(search))
+
+	if version == "" || len(features) == 0 {
+		return nil
+	}
+
+	err := addVersions(features)
+
+	if err != nil {
+		return err
+	}
+
+	flagVersion(features, id, version)
+
+	return nil
+}
+
+// sets MatchedVersion on the features whose id is id when their version
+// is known and not version
+func flagVersion(features []*GenomicFeature, id string, version string) {
+	for _, feature := range features {
+		if strings.EqualFold(featureId(feature), id) && feature.Version != "" && feature.Version != version {
+			feature.MatchedVersion = version
+		}
+
+		flagVersion(feature.Children, id, version)
+	}
+}
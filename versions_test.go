@@ -0,0 +1,107 @@
+package genome_test
+
+import (
+	"testing"
+
+	"github.com/antonybholmes/go-genome"
+	"github.com/antonybholmes/go-genome/genometest"
+)
+
+func TestVersionedIds(t *testing.T) {
+	gdb := openGtf(t, genometest.GtfId)
+
+	// ids match with any version and flag a different version
+	genes, err := gdb.SearchByName("ensg00000000002.3", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || genes[0].Symbol != "GENEB" || genes[0].Version != "7" || genes[0].MatchedVersion != "3" {
+		t.Errorf("ensg00000000002.3 = %+v", genes)
+	}
+
+	genes, err = gdb.SearchByName("ENSG00000000002.7", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || genes[0].Version != "7" || genes[0].MatchedVersion != "" {
+		t.Errorf("ENSG00000000002.7 = %+v", genes)
+	}
+
+	genes, err = gdb.SearchByName("ENST00000000002.1", genome.TranscriptLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || len(genes[0].Children) != 1 || genes[0].Children[0].Version != "2" ||
+		genes[0].Children[0].MatchedVersion != "1" || genes[0].MatchedVersion != "" {
+		t.Errorf("ENST00000000002.1 = %+v", genes)
+	}
+
+	genes, err = gdb.SearchByName("ENSE00000000001.1", genome.ExonLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || genes[0].Symbol != "GENEA" {
+		t.Errorf("ENSE00000000001.1 = %v", symbols(genes))
+	}
+
+	genes, err = gdb.FuzzySearchByName("ENSG00000000001.9", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) == 0 || genes[0].Symbol != "GENEA" || genes[0].MatchedVersion != "9" {
+		t.Errorf("fuzzy ENSG00000000001.9 = %v", symbols(genes))
+	}
+
+	gene, err := gdb.CollapsedGeneModel("ENSG00000000001.2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gene.Symbol != "GENEA" || gene.Version != "1" || gene.MatchedVersion != "2" {
+		t.Errorf("collapsed ENSG00000000001.2 = %+v", gene)
+	}
+
+	model, err := gdb.TranscriptModel("ENST00000000001.1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if model.Transcript.Version != "1" || model.Transcript.MatchedVersion != "" {
+		t.Errorf("model ENST00000000001.1 = %+v", model.Transcript)
+	}
+
+	resolved, err := gdb.ResolveIds([]string{"ENST00000000002.1", "ENSG00000000002.7", "ENSG00000000002"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{"1", "", ""} {
+		if resolved[i].Status != genome.ResolvedMatched || resolved[i].MatchedVersion != want {
+			t.Errorf("%s matched version = %q, want %q", resolved[i].Query, resolved[i].MatchedVersion, want)
+		}
+	}
+
+	// older databases do not have versions so nothing is flagged
+	genes, err = openGtf(t, genometest.OldGtfId).SearchByName("ENSG00000000002.3", genome.GeneLevel, nil, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genes) != 1 || genes[0].Version != "" || genes[0].MatchedVersion != "" {
+		t.Errorf("old ENSG00000000002.3 = %+v", genes)
+	}
+}
@@ -0,0 +1,186 @@
+package genome
+
+import (
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+)
+
+//
+// Entrez, UniProt and RefSeq ids of genes from HGNC or MGI so that genes
+// can be found by the ids other resources use, e.g. 7157 for TP53.
+//
+
+const (
+	EntrezXref  string = "entrez"
+	UniProtXref string = "uniprot"
+	RefSeqXref  string = "refseq"
+
+	GeneXrefsSql = `SELECT g.id, x.db, x.xref
+		FROM gene_xrefs AS x
+		JOIN genes AS g ON x.gene_id = g.id
+		WHERE LOWER(x.xref) = LOWER(:q)
+		ORDER BY g.symbol, g.gene_id, x.db, x.xref`
+
+	XrefsOfGenesSql = `SELECT x.gene_id, x.db, x.xref
+		FROM gene_xrefs AS x
+		WHERE x.gene_id IN (<<IDS>>)
+		ORDER BY x.gene_id, x.db, x.xref`
+)
+
+// databases created by older importers do not have xrefs
+func (gdb *GtfDB) hasGeneXrefs() bool {
+	gdb.xrefsOnce.Do(func() {
+		gdb.hasXrefs = gdb.hasTable("gene_xrefs")
+	})
+
+	return gdb.hasXrefs
+}
+
+// the genes with an xref equal to search, ignoring case
+func (gdb *GtfDB) xrefMatches(search string) ([]geneName, error) {
+	rows, err := gdb.db.Query(GeneXrefsSql, sql.Named("q", search))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ret := make([]geneName, 0, 5)
+
+	for rows.Next() {
+		var name geneName
+		var db string
+		var xref string
+
+		err := rows.Scan(&name.id, &db, &xref)
+
+		if err != nil {
+			return nil, err
+		}
+
+		name.xref = db + ":" + xref
+
+		ret = append(ret, name)
+	}
+
+	return ret, rows.Err()
+}
+
+// AddXrefs sets the xrefs of the genes in features and of genes that
+// are children of other features
+func (gdb *GtfDB) AddXrefs(features []*GenomicFeature) error {
+	if !gdb.hasGeneXrefs() {
+		return nil
+	}
+
+	genes := xrefGenes(features, nil)
+
+	ids := make([]int, 0, len(genes))
+
+	for _, gene := range genes {
+		ids = append(ids, gene.Id)
+	}
+
+	slices.Sort(ids)
+
+	xrefs := make(map[int]map[string][]string, len(ids))
+
+	for chunk := range slices.Chunk(slices.Compact(ids), MaxTagQueryIds) {
+		query, namedArgs := inSql(XrefsOfGenesSql, "g", chunk)
+
+		err := gdb.geneXrefs(query, namedArgs, xrefs)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, gene := range genes {
+		gene.Xrefs = xrefs[gene.Id]
+	}
+
+	return nil
+}
+
+func (gdb *GtfDB) geneXrefs(query string, namedArgs []any, xrefs map[int]map[string][]string) error {
+	rows, err := gdb.db.Query(query, namedArgs...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var db string
+		var xref string
+
+		err := rows.Scan(&id, &db, &xref)
+
+		if err != nil {
+			return err
+		}
+
+		if xrefs[id] == nil {
+			xrefs[id] = make(map[string][]string)
+		}
+
+		xrefs[id][db] = append(xrefs[id][db], xref)
+	}
+
+	return rows.Err()
+}
+
+// AddXrefs sets xrefs as GtfDB.AddXrefs does
+func (mdb *MemGeneDB) AddXrefs(features []*GenomicFeature) error {
+	for _, feature := range xrefGenes(features, nil) {
+		gene, ok := mdb.geneByRowId(feature.Id)
+
+		if !ok || len(gene.Xrefs) == 0 {
+			feature.Xrefs = nil
+			continue
+		}
+
+		feature.Xrefs = make(map[string][]string, len(gene.Xrefs))
+
+		for db, xrefs := range gene.Xrefs {
+			feature.Xrefs[db] = slices.Sorted(slices.Values(xrefs))
+		}
+	}
+
+	return nil
+}
+
+// the gene level features in features and their children
+func xrefGenes(features []*GenomicFeature, genes []*GenomicFeature) []*GenomicFeature {
+	for _, feature := range features {
+		if feature.Type == GeneLevel {
+			genes = append(genes, feature)
+		}
+
+		genes = xrefGenes(feature.Children, genes)
+	}
+
+	return genes
+}
+
+// xrefMatches finds genes by xref as GtfDB.xrefMatches does
+func (mdb *MemGeneDB) xrefMatches(search string) []geneName {
+	ret := make([]geneName, 0, 5)
+
+	for _, gene := range mdb.symbolGenes {
+		for _, db := range slices.Sorted(maps.Keys(gene.Xrefs)) {
+			for _, xref := range slices.Sorted(slices.Values(gene.Xrefs[db])) {
+				if strings.EqualFold(xref, search) {
+					ret = append(ret, geneName{id: mdb.geneIds[gene], xref: db + ":" + xref})
+				}
+			}
+		}
+	}
+
+	return ret
+}